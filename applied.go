@@ -0,0 +1,115 @@
+package henka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+// appliedStateCache keeps the state of every version replayed from the migrations log.
+// When the driver can compute the state itself, only the latest entry of every version is loaded.
+// When the driver can read the log incrementally, only entries newer than the watermark
+// are fetched on subsequent loads.
+type appliedStateCache struct {
+	sync.Mutex
+	loaded    bool
+	watermark uint64
+	states    map[migration.Version]migration.State
+}
+
+// resetAppliedState drops the cached state, so that the next load reads the whole log. Incremental reads
+// only see new entries, so the cache must be reset whenever existing entries are deleted or rewritten.
+func (m *henkaImpl) resetAppliedState() {
+	m.applied.Lock()
+	defer m.applied.Unlock()
+
+	m.applied.loaded = false
+	m.applied.watermark = 0
+	m.applied.states = nil
+}
+
+func (m *run) loadSortedMigrationsFromDB() (*map[migration.Version]migration.State, error) {
+	m.applied.Lock()
+	defer m.applied.Unlock()
+
+	var incremental driver.IncrementalLogReader
+	canReadIncrementally := driver.As(m.driver, &incremental)
+
+	var migrations *[]migration.Log
+	var err error
+
+	if m.applied.loaded && canReadIncrementally {
+		migrations, err = incremental.ListMigrationsLogAfter(m.applied.watermark)
+	} else {
+		m.applied.states = nil
+		migrations, err = m.listMigrationsState()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations from db: %w", err)
+	}
+
+	if m.applied.states == nil {
+		m.applied.states = make(map[migration.Version]migration.State, len(*migrations))
+	}
+
+	for _, mig := range *migrations {
+		m.applied.replay(mig)
+	}
+
+	m.applied.loaded = canReadIncrementally
+
+	result := make(map[migration.Version]migration.State, len(m.applied.states))
+	for version, state := range m.applied.states {
+		result[version] = state
+	}
+
+	return &result, nil
+}
+
+func (c *appliedStateCache) replay(mig migration.Log) {
+	var status migration.Status
+	var appliedAt time.Time
+	var checksum string
+	var duration time.Duration
+
+	switch {
+	case mig.Baseline:
+		status = migration.Baselined
+		appliedAt = mig.AppliedAt
+	case mig.Direction == migration.Up:
+		status = migration.Applied
+		appliedAt = mig.AppliedAt
+		checksum = mig.Checksum
+		duration = mig.Duration()
+	case mig.Direction == migration.Down:
+		status = migration.Pending
+	}
+
+	c.states[mig.Version] = migration.State{
+		Description: migration.Description{
+			Migration: mig.Migration,
+			CanUndo:   false,
+		},
+		Status:    status,
+		AppliedAt: appliedAt,
+		Checksum:  checksum,
+		Duration:  duration,
+	}
+
+	if mig.ID > c.watermark {
+		c.watermark = mig.ID
+	}
+}
+
+func (m *run) listMigrationsState() (*[]migration.Log, error) {
+	var stateReader driver.StateReader
+	if driver.As(m.driver, &stateReader) {
+		return stateReader.ListMigrationsState() //nolint:wrapcheck
+	}
+
+	return m.listMigrationsLog()
+}
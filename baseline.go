@@ -0,0 +1,73 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+var (
+	ErrBaselineNotSupported = errors.New("driver does not support writing the baseline")
+	ErrLogNotEmpty          = errors.New("migrations log is not empty")
+)
+
+// Baseline writes the baseline entry with driver.LogWriter. Drivers must report it back
+// with migration.Log.Baseline set. The log is checked and written under the migration lock.
+func (m *henkaImpl) Baseline(version migration.Version) error {
+	var writer driver.LogWriter
+	if !driver.As(m.driver, &writer) {
+		return ErrBaselineNotSupported
+	}
+
+	r := m.newRun(context.Background())
+
+	return r.inRun(func() error {
+		return r.writeBaseline(writer, version)
+	})
+}
+
+func (m *run) writeBaseline(writer driver.LogWriter, version migration.Version) error {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	if len(*appliedMigrations) > 0 {
+		return fmt.Errorf("failed to write the baseline: %w", ErrLogNotEmpty)
+	}
+
+	defer m.invalidateAppliedMigrations()
+
+	err = writer.WriteLog(migration.Log{
+		Migration: migration.Migration{Version: version, Name: migration.BaselineName},
+		Direction: migration.Up,
+		AppliedAt: time.Now(),
+		Baseline:  true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write the baseline: %w", err)
+	}
+
+	return nil
+}
+
+// baseline returns the state of the latest baseline entry, zero if the database has no baseline.
+func (m *run) baseline(appliedMigrations *map[migration.Version]migration.State) migration.State {
+	var baseline migration.State
+
+	for version, state := range *appliedMigrations {
+		if state.Status == migration.Baselined && (baseline.Version == 0 || m.compareVersions(version, baseline.Version) > 0) {
+			baseline = state
+		}
+	}
+
+	return baseline
+}
+
+func (m *henkaImpl) isBaselined(version migration.Version, baseline migration.State) bool {
+	return baseline.Version != 0 && m.compareVersions(version, baseline.Version) <= 0
+}
@@ -0,0 +1,218 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+var ErrInvalidConfig = errors.New("henka configuration is invalid")
+
+// Builder configures the engine step by step. Build checks the configuration as a whole, so that
+// mistakes are reported before the first run rather than silently ignored.
+type Builder struct {
+	source  source2.Source
+	driver  driver.Driver
+	options Options
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) Source(src source2.Source) *Builder {
+	b.source = src
+	return b
+}
+
+func (b *Builder) Driver(drv driver.Driver) *Builder {
+	b.driver = drv
+	return b
+}
+
+// With applies options, e.g. the ones that don't have a dedicated builder method.
+func (b *Builder) With(opts ...Option) *Builder {
+	for _, opt := range opts {
+		opt(&b.options)
+	}
+
+	return b
+}
+
+func (b *Builder) ChecksumVerification(workers int) *Builder {
+	return b.With(WithChecksumVerification(), WithChecksumWorkers(workers))
+}
+
+func (b *Builder) SkipWhenUpToDate() *Builder {
+	return b.With(WithSkipWhenUpToDate())
+}
+
+func (b *Builder) VersionOrdering(ordering migration.Ordering) *Builder {
+	return b.With(WithVersionOrdering(ordering))
+}
+
+func (b *Builder) Prefetch(budget int64) *Builder {
+	return b.With(WithPrefetch(budget))
+}
+
+func (b *Builder) Dependencies() *Builder {
+	return b.With(WithDependencies())
+}
+
+func (b *Builder) SchemaSnapshots() *Builder {
+	return b.With(WithSchemaSnapshots())
+}
+
+func (b *Builder) ForceDowngrade() *Builder {
+	return b.With(WithForceDowngrade())
+}
+
+func (b *Builder) OutOfOrderPolicy(policy OutOfOrderPolicy) *Builder {
+	return b.With(WithOutOfOrderPolicy(policy))
+}
+
+func (b *Builder) Logger(logger Logger) *Builder {
+	return b.With(WithLogger(logger))
+}
+
+func (b *Builder) Observer(observer Observer) *Builder {
+	return b.With(WithObserver(observer))
+}
+
+func (b *Builder) LockTimeout(timeout time.Duration) *Builder {
+	return b.With(WithLockTimeout(timeout))
+}
+
+func (b *Builder) Transactions(policy TransactionPolicy) *Builder {
+	return b.With(WithTransactions(policy))
+}
+
+func (b *Builder) Resume() *Builder {
+	return b.With(WithResume())
+}
+
+func (b *Builder) RejectMissing() *Builder {
+	return b.With(WithRejectMissing())
+}
+
+func (b *Builder) SkipVersions(versions ...migration.Version) *Builder {
+	return b.With(WithSkipVersions(versions...))
+}
+
+func (b *Builder) IncludeTags(tags ...string) *Builder {
+	return b.With(WithIncludeTags(tags...))
+}
+
+func (b *Builder) ExcludeTags(tags ...string) *Builder {
+	return b.With(WithExcludeTags(tags...))
+}
+
+func (b *Builder) MigrationTimeout(timeout time.Duration) *Builder {
+	return b.With(WithMigrationTimeout(timeout))
+}
+
+func (b *Builder) Confirm(fn ConfirmFunc) *Builder {
+	return b.With(WithConfirm(fn))
+}
+
+func (b *Builder) DriverMiddleware(middlewares ...driver.Middleware) *Builder {
+	return b.With(WithDriverMiddleware(middlewares...))
+}
+
+func (b *Builder) SourceMiddleware(middlewares ...source2.Middleware) *Builder {
+	return b.With(WithSourceMiddleware(middlewares...))
+}
+
+func (b *Builder) RunReport(fn func(RunReport)) *Builder {
+	return b.With(WithRunReport(fn))
+}
+
+// Build validates the configuration and creates the engine. All problems found are reported at once.
+func (b *Builder) Build() (Henka, error) {
+	if problems := b.validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+
+	options := b.options
+
+	return New(b.source, b.driver, func(o *Options) { *o = options }), nil
+}
+
+func (b *Builder) validate() []string {
+	problems := make([]string, 0)
+
+	if b.source == nil {
+		problems = append(problems, "source is not set")
+	}
+
+	if b.driver == nil {
+		problems = append(problems, "driver is not set")
+	}
+
+	if b.options.ChecksumWorkers < 0 {
+		problems = append(problems, "number of checksum workers is negative")
+	}
+
+	if b.options.MigrationTimeout < 0 {
+		problems = append(problems, "migration timeout is negative")
+	}
+
+	if b.options.PrefetchBudget < 0 {
+		problems = append(problems, "prefetch budget is negative")
+	}
+
+	if b.options.SkipWhenUpToDate {
+		var reader driver.MaxVersionReader
+		if b.driver != nil && !driver.As(b.driver, &reader) {
+			problems = append(problems, fmt.Sprintf("skipping when up to date requires a driver that can read "+
+				"the max applied version, %T can't", b.driver))
+		}
+
+		if b.options.Ordering != nil {
+			problems = append(problems, "skipping when up to date can't be combined with a custom version ordering")
+		}
+	}
+
+	if b.options.Transactions != NoTransactions {
+		var transactor driver.Transactor
+		if b.driver != nil && !driver.As(b.driver, &transactor) {
+			problems = append(problems, fmt.Sprintf("transaction policy requires a driver that supports transactions, %T doesn't", b.driver))
+		}
+	}
+
+	if b.options.SchemaSnapshots {
+		var dumper driver.SchemaDumper
+		if b.driver != nil && !driver.As(b.driver, &dumper) {
+			problems = append(problems, fmt.Sprintf("schema snapshots require a driver that can dump the schema, %T can't", b.driver))
+		}
+	}
+
+	if b.options.Dependencies {
+		var reader source2.DependencyReader
+		if b.source != nil && !source2.As(b.source, &reader) {
+			problems = append(problems, fmt.Sprintf("dependencies require a source that supports them, %T doesn't", b.source))
+		}
+	}
+
+	if len(b.options.IncludeTags) > 0 || len(b.options.ExcludeTags) > 0 {
+		var tagger source2.Tagger
+		if b.source != nil && !source2.As(b.source, &tagger) {
+			problems = append(problems, fmt.Sprintf("tag filtering requires a source that supports tags, %T doesn't", b.source))
+		}
+	}
+
+	if b.options.OutOfOrder > OutOfOrderWarn {
+		problems = append(problems, "out-of-order policy is unknown")
+	}
+
+	if b.options.Transactions > WrapWholeRun {
+		problems = append(problems, "transaction policy is unknown")
+	}
+
+	return problems
+}
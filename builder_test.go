@@ -0,0 +1,89 @@
+package henka_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/migration"
+)
+
+var builderTestsTable = []struct { // nolint:gochecknoglobals
+	name     string
+	builder  func() *henka.Builder
+	problems []string
+}{
+	/* s0 */ {
+		name: "s0: should build a minimal configuration",
+		builder: func() *henka.Builder {
+			return henka.NewBuilder().Source(&sourceMock{}).Driver(&driverMock{})
+		},
+	},
+	/* s1 */ {
+		name: "s1: should build a configuration with options",
+		builder: func() *henka.Builder {
+			return henka.NewBuilder().
+				Source(&sourceMock{}).
+				Driver(&maxVersionDriverMock{}).
+				ChecksumVerification(4).
+				SkipWhenUpToDate().
+				Prefetch(1 << 20).
+				RunReport(func(henka.RunReport) {})
+		},
+	},
+	/* e0 */ {
+		name:     "e0: should fail without source and driver",
+		builder:  henka.NewBuilder,
+		problems: []string{"source is not set", "driver is not set"},
+	},
+	/* e1 */ {
+		name: "e1: should fail on negative numbers",
+		builder: func() *henka.Builder {
+			return henka.NewBuilder().Source(&sourceMock{}).Driver(&driverMock{}).ChecksumVerification(-1).Prefetch(-1)
+		},
+		problems: []string{"checksum workers is negative", "prefetch budget is negative"},
+	},
+	/* e2 */ {
+		name: "e2: should fail when the driver lacks a capability",
+		builder: func() *henka.Builder {
+			return henka.NewBuilder().Source(&sourceMock{}).Driver(&driverMock{}).SkipWhenUpToDate()
+		},
+		problems: []string{"requires a driver that can read the max applied version"},
+	},
+	/* e3 */ {
+		name: "e3: should fail on conflicting options",
+		builder: func() *henka.Builder {
+			return henka.NewBuilder().
+				Source(&sourceMock{}).
+				Driver(&maxVersionDriverMock{}).
+				SkipWhenUpToDate().
+				VersionOrdering(migration.NumericOrdering)
+		},
+		problems: []string{"can't be combined with a custom version ordering"},
+	},
+}
+
+func TestBuilder(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range builderTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			migrator, err := test.builder().Build()
+			if len(test.problems) == 0 {
+				assert.NoError(t, err)
+				assert.NotNil(t, migrator)
+				return
+			}
+
+			assert.ErrorIs(t, err, henka.ErrInvalidConfig)
+			assert.Nil(t, migrator)
+			for _, problem := range test.problems {
+				assert.Contains(t, err.Error(), problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package henka
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/root-talis/henka/migration"
+)
+
+var ErrChecksumMismatch = errors.New("checksum of applied migration does not match its script")
+
+// checksumReadBufferSize is the chunk size scripts are hashed with between cancellation checks.
+const checksumReadBufferSize = 32 * 1024
+
+// verifyChecksums reads up scripts of applied migrations that have a recorded checksum with a bounded
+// pool of workers and compares the results. The first read error cancels the remaining reads.
+func (m *run) verifyChecksums(states []migration.State) error {
+	jobs := make([]migration.State, 0, len(states))
+	for _, state := range states {
+		if state.Status == migration.Applied && state.Checksum != "" {
+			jobs = append(jobs, state)
+		}
+	}
+
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	workers := m.options.ChecksumWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	queue := make(chan migration.State)
+	go func() {
+		defer close(queue)
+
+		for _, job := range jobs {
+			select {
+			case queue <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mutex sync.Mutex
+	var firstErr error
+	mismatches := make([]migration.Migration, 0)
+
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for state := range queue {
+				checksum, err := m.checksum(ctx, state.Migration)
+
+				mutex.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				case checksum != state.Checksum:
+					mismatches = append(mismatches, state.Migration)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		return m.compareVersions(mismatches[i].Version, mismatches[j].Version) < 0
+	})
+
+	names := make([]string, 0, len(mismatches))
+	for _, mig := range mismatches {
+		names = append(names, fmt.Sprintf("%d_%s", mig.Version, mig.Name))
+	}
+
+	return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(names, ", "))
+}
+
+// checksum streams the up script through the same hash migration.Checksum uses.
+func (m *run) checksum(ctx context.Context, mig migration.Migration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err //nolint:wrapcheck
+	}
+
+	reader, err := readMigration(ctx, m.source, mig, migration.Up)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	hash := sha256.New()
+	buffer := make([]byte, checksumReadBufferSize)
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return "", err //nolint:wrapcheck
+		}
+
+		n, readErr := reader.Read(buffer)
+		hash.Write(buffer[:n])
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+
+		if readErr != nil {
+			return "", fmt.Errorf("failed to read migration %d_%s: %w", mig.Version, mig.Name, readErr)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// confirmOnTerminal asks on stderr whether a destructive migration may be applied and reads the answer from stdin.
+func confirmOnTerminal(mig migration.Migration, direction migration.Direction, statements []string) bool {
+	fmt.Fprintf(os.Stderr, "migration %d_%s (%s) is destructive:\n", mig.Version, mig.Name, direction)
+
+	for _, statement := range statements {
+		fmt.Fprintf(os.Stderr, "  %s\n", statement)
+	}
+
+	fmt.Fprint(os.Stderr, "apply it? [y/N] ")
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+
+	return strings.EqualFold(strings.TrimSpace(answer), "y")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// warningLogger prints warnings of the engine to stderr. Errors are reported by main, the rest is dropped.
+type warningLogger struct{}
+
+func (warningLogger) Debug(string, ...interface{}) {}
+func (warningLogger) Info(string, ...interface{})  {}
+func (warningLogger) Error(string, ...interface{}) {}
+
+func (warningLogger) Warn(msg string, args ...interface{}) {
+	line := strings.Builder{}
+	line.WriteString("henka: warning: ")
+	line.WriteString(msg)
+
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&line, " %v=%v", args[i], args[i+1])
+	}
+
+	fmt.Fprintln(os.Stderr, line.String())
+}
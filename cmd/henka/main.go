@@ -0,0 +1,509 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/mysql"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source/files"
+	"github.com/root-talis/henka/terraform"
+	"github.com/root-talis/henka/tools/renumber"
+)
+
+const usage = `Usage: henka [flags] <command> [arguments]
+
+Commands:
+  status              print the state of every migration
+  dirty               print executions of migrations that have started but not completed
+  upgrade [version]   apply pending migrations up to version (all if omitted)
+  upgrade-until <time>
+                      apply pending migrations created not later than time (RFC 3339, e.g. 2021-01-24T14:00:00Z)
+  downgrade <version> revert applied migrations after version
+  plan [version]      print migrations upgrade would apply, with their scripts, without applying them
+  reset               revert every applied migration, refusing if any of them has no down script
+  reapply <version>   execute the up script of an applied migration again
+  baseline <version>  mark migrations up to version as applied without executing them
+  repair [checksums|missing]
+                      update checksums of changed scripts and remove log entries of missing migrations (both if omitted)
+  terraform           act as a Terraform external data source (JSON on stdin, JSON on stdout)
+  conflicts           list migrations that conflict with applied ones or share a version
+  renumber            rename files of conflicting migrations to versions after the latest one
+
+Flags:
+`
+
+type config struct {
+	dsn      string
+	database string
+	table    string
+	dir      string
+	grace    time.Duration
+	resume   bool
+	skip     string
+	tags     string
+	exclude  string
+	depends  bool
+	order    string
+	timeout  time.Duration
+	confirm  bool
+	ns       string
+	versions string
+	json     bool
+	create   bool
+	split    bool
+	diff     bool
+	lease    time.Duration
+	tidb     bool
+}
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	cfg := config{}
+
+	flags := flag.NewFlagSet("henka", flag.ExitOnError)
+	flags.StringVar(&cfg.dsn, "dsn", os.Getenv("HENKA_DSN"), "MySQL DSN, defaults to $HENKA_DSN")
+	flags.StringVar(&cfg.database, "database", os.Getenv("HENKA_DATABASE"), "database name, defaults to $HENKA_DATABASE")
+	flags.BoolVar(&cfg.create, "create-database", false, "create the database if it does not exist")
+	flags.BoolVar(&cfg.split, "split-statements", false,
+		"execute scripts statement by statement, needed for scripts with DELIMITER directives")
+	flags.StringVar(&cfg.table, "table", "migrations_log", "migrations log table name")
+	flags.StringVar(&cfg.dir, "dir", "migrations", "migrations directory")
+	flags.StringVar(&cfg.versions, "versions", "timestamp",
+		"format of versions in file names: timestamp, sequential, semver or a number of zero-padded digits")
+	flags.StringVar(&cfg.ns, "namespace", "", "stream of migrations in the log table shared with other services")
+	flags.DurationVar(&cfg.grace, "grace", 30*time.Second, //nolint:gomnd
+		"time given to the running migration to finish after SIGINT or SIGTERM before it is canceled")
+	flags.BoolVar(&cfg.resume, "resume", false, "execute again migrations whose previous execution has not completed")
+	flags.StringVar(&cfg.skip, "skip", "", "comma-separated versions of pending migrations to leave out of upgrades")
+	flags.StringVar(&cfg.tags, "tags", "", "comma-separated tags of migrations to apply, untagged ones are always applied")
+	flags.StringVar(&cfg.exclude, "exclude-tags", "", "comma-separated tags of migrations to leave out of upgrades")
+	flags.BoolVar(&cfg.depends, "dependencies", false, "apply migrations after the ones their \"-- depends:\" headers name")
+	flags.StringVar(&cfg.order, "out-of-order", "apply",
+		"what to do with pending migrations older than the latest applied one: apply, warn, skip or reject")
+	flags.DurationVar(&cfg.lease, "lease-ttl", 0,
+		"lock with a lease row in the log table that expires after this time instead of GET_LOCK, if not zero")
+	flags.BoolVar(&cfg.tidb, "tidb", false, "adjust locking and the log table to TiDB")
+	flags.DurationVar(&cfg.timeout, "migration-timeout", 0, "time a single migration may run before it is killed, no limit if zero")
+	flags.BoolVar(&cfg.json, "json", false, "print status as JSON")
+	flags.BoolVar(&cfg.diff, "schema-diff", false, "print how upgrades have changed the schema")
+	flags.BoolVar(&cfg.confirm, "confirm", false, "ask before applying migrations that drop or truncate anything")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	_ = flags.Parse(os.Args[1:])
+
+	if err := run(cfg, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "henka: %s\n", err)
+
+		if errors.Is(err, errUsage) {
+			flags.Usage()
+		}
+
+		os.Exit(1)
+	}
+}
+
+func run(cfg config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: command is required", errUsage)
+	}
+
+	conn, err := sql.Open("mysql", cfg.dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close()
+
+	versions, err := parseVersionFormat(cfg.versions)
+	if err != nil {
+		return err
+	}
+
+	src, err := files.NewFilesSource(os.DirFS(cfg.dir), ".", files.WithVersionParser(versions))
+	if err != nil {
+		return fmt.Errorf("failed to open migrations directory: %w", err)
+	}
+
+	drv := mysql.NewDriver(conn, mysql.DriverConfig{
+		DatabaseName:        cfg.database,
+		MigrationsTableName: cfg.table,
+		Namespace:           cfg.ns,
+
+		CreateDatabaseIfMissing: cfg.create,
+		SplitStatements:         cfg.split,
+		LeaseTTL:                cfg.lease,
+		TiDB:                    cfg.tidb,
+	})
+
+	shutdown := henka.NewShutdown()
+	release := henka.HandleSignals(shutdown, cfg.grace)
+	defer release()
+
+	opts := []henka.Option{henka.WithShutdown(shutdown), henka.WithLogger(warningLogger{})}
+	if cfg.resume {
+		opts = append(opts, henka.WithResume())
+	}
+
+	if cfg.skip != "" {
+		for _, arg := range splitList(cfg.skip) {
+			version, err := parseVersion([]string{arg})
+			if err != nil {
+				return err
+			}
+
+			opts = append(opts, henka.WithSkipVersions(version))
+		}
+	}
+
+	policy, err := parseOutOfOrderPolicy(cfg.order)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, henka.WithOutOfOrderPolicy(policy), henka.WithMigrationTimeout(cfg.timeout))
+
+	if cfg.confirm {
+		opts = append(opts, henka.WithConfirm(confirmOnTerminal))
+	}
+
+	if cfg.tags != "" {
+		opts = append(opts, henka.WithIncludeTags(splitList(cfg.tags)...))
+	}
+
+	if cfg.exclude != "" {
+		opts = append(opts, henka.WithExcludeTags(splitList(cfg.exclude)...))
+	}
+
+	if cfg.depends {
+		opts = append(opts, henka.WithDependencies())
+	}
+
+	if cfg.diff {
+		opts = append(opts, henka.WithSchemaSnapshots(), henka.WithRunReport(printSchemaDiff))
+	}
+
+	migrator := henka.New(src, drv, opts...)
+
+	switch args[0] {
+	case "status":
+		return status(migrator, cfg.json)
+	case "dirty":
+		return dirty(migrator, cfg.json)
+	case "upgrade":
+		return upgrade(migrator, args[1:])
+	case "upgrade-until":
+		return upgradeUntil(migrator, args[1:])
+	case "plan":
+		return plan(migrator, args[1:])
+	case "downgrade":
+		return downgrade(migrator, args[1:])
+	case "reset":
+		return migrator.Reset() //nolint:wrapcheck
+	case "reapply":
+		return reapply(migrator, args[1:])
+	case "baseline":
+		return baseline(migrator, args[1:])
+	case "repair":
+		return repair(migrator, args[1:])
+	case "terraform":
+		return terraform.Run(migrator, os.Stdin, os.Stdout)
+	case "conflicts", "renumber":
+		return resolveConflicts(cfg.dir, drv, args[0] == "renumber")
+	default:
+		return fmt.Errorf("%w: unknown command \"%s\"", errUsage, args[0])
+	}
+}
+
+func status(migrator henka.Henka, asJSON bool) error {
+	result, err := migrator.Status()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(result) //nolint:wrapcheck
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tDURATION\tAPPLIED/REVERTED\tDOWN SCRIPT")
+
+	for _, mig := range result.Migrations {
+		appliedAt := ""
+		if !mig.AppliedAt.IsZero() {
+			appliedAt = mig.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		status := mig.Status.String()
+		switch {
+		case mig.Failed:
+			status += " (failed)"
+		case mig.Dirty:
+			status += " (dirty)"
+		}
+
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%d/%d\t%t\n", mig.Version, mig.Name, status, appliedAt,
+			mig.Duration, mig.AppliedTimes, mig.RevertedTimes, mig.CanUndo)
+	}
+
+	fmt.Fprintf(writer, "\napplied: %d, pending: %d, skipped: %d, missing: %d, dirty: %d, failed: %d\n",
+		result.AppliedCount, result.PendingCount, result.SkippedCount, result.MissingCount, result.DirtyCount,
+		result.FailedCount)
+
+	return writer.Flush() //nolint:wrapcheck
+}
+
+func dirty(migrator henka.Henka, asJSON bool) error {
+	entries, err := migrator.Dirty()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(entries) //nolint:wrapcheck
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(writer, "VERSION\tNAME\tDIRECTION\tSTARTED AT\tRUN\tAPPLIED BY\tHOSTNAME\tERROR")
+
+	for _, entry := range entries {
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Version, entry.Name, entry.Direction,
+			entry.AppliedAt.Format("2006-01-02 15:04:05"), entry.RunID, entry.AppliedBy, entry.Hostname, entry.Error)
+	}
+
+	return writer.Flush() //nolint:wrapcheck
+}
+
+func upgrade(migrator henka.Henka, args []string) error {
+	if len(args) == 0 {
+		return migrator.UpgradeAll() //nolint:wrapcheck
+	}
+
+	maxVersion, err := parseMaxVersion(args)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Upgrade(maxVersion) //nolint:wrapcheck
+}
+
+func upgradeUntil(migrator henka.Henka, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: expected a single time argument", errUsage)
+	}
+
+	until, err := time.Parse(time.RFC3339, args[0])
+	if err != nil {
+		return fmt.Errorf("%w: \"%s\" is not a valid time", errUsage, args[0])
+	}
+
+	return migrator.UpgradeUntil(until) //nolint:wrapcheck
+}
+
+func plan(migrator henka.Henka, args []string) error {
+	maxVersion, err := parseMaxVersion(args)
+	if err != nil {
+		return err
+	}
+
+	steps, err := migrator.PlanUpgrade(maxVersion)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, step := range steps {
+		if step.Repeatable {
+			fmt.Printf("-- %s repeatable %s\n%s\n\n", step.Direction, step.Name, step.Script)
+			continue
+		}
+
+		fmt.Printf("-- %s %d_%s\n%s\n\n", step.Direction, step.Version, step.Name, step.Script)
+	}
+
+	return nil
+}
+
+// parseMaxVersion returns the version given in args, or the highest possible one.
+func parseMaxVersion(args []string) (migration.Version, error) {
+	if len(args) == 0 {
+		return migration.Version(^uint64(0)), nil
+	}
+
+	version, err := strconv.ParseUint(args[0], 10, migration.VersionBits)
+	if err != nil {
+		return 0, fmt.Errorf("%w: \"%s\" is not a valid version", errUsage, args[0])
+	}
+
+	return migration.Version(version), nil
+}
+
+func baseline(migrator henka.Henka, args []string) error {
+	version, err := parseVersion(args)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Baseline(version) //nolint:wrapcheck
+}
+
+func reapply(migrator henka.Henka, args []string) error {
+	version, err := parseVersion(args)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Reapply(version) //nolint:wrapcheck
+}
+
+// parseOutOfOrderPolicy maps the value of the -out-of-order flag to the policy of henka.WithOutOfOrderPolicy.
+func parseOutOfOrderPolicy(policy string) (henka.OutOfOrderPolicy, error) {
+	switch policy {
+	case "apply":
+		return henka.OutOfOrderApply, nil
+	case "warn":
+		return henka.OutOfOrderWarn, nil
+	case "skip":
+		return henka.OutOfOrderSkip, nil
+	case "reject":
+		return henka.OutOfOrderReject, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown out-of-order policy \"%s\"", errUsage, policy)
+	}
+}
+
+func parseVersionFormat(format string) (files.VersionParser, error) {
+	switch format {
+	case "timestamp":
+		return files.TimestampVersions, nil
+	case "sequential":
+		return files.SequentialVersions{}, nil
+	case "semver":
+		return files.SemanticVersions{}, nil
+	}
+
+	digits, err := strconv.Atoi(format)
+	if err != nil || digits <= 0 {
+		return nil, fmt.Errorf("%w: unknown version format \"%s\"", errUsage, format)
+	}
+
+	return files.FixedLengthVersions(digits), nil
+}
+
+// splitList splits a comma-separated flag value, e.g. of -skip or -tags, trimming spaces around items.
+func splitList(list string) []string {
+	items := strings.Split(list, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+
+	return items
+}
+
+// parseVersion returns the version given in args, which is required.
+func parseVersion(args []string) (migration.Version, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("%w: version is required", errUsage)
+	}
+
+	version, err := strconv.ParseUint(args[0], 10, migration.VersionBits)
+	if err != nil {
+		return 0, fmt.Errorf("%w: \"%s\" is not a valid version", errUsage, args[0])
+	}
+
+	return migration.Version(version), nil
+}
+
+func repair(migrator henka.Henka, args []string) error {
+	opts := henka.RepairOptions{UpdateChecksums: len(args) == 0, RemoveMissing: len(args) == 0}
+
+	for _, arg := range args {
+		switch arg {
+		case "checksums":
+			opts.UpdateChecksums = true
+		case "missing":
+			opts.RemoveMissing = true
+		default:
+			return fmt.Errorf("%w: unknown repair \"%s\"", errUsage, arg)
+		}
+	}
+
+	result, err := migrator.Repair(opts)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, mig := range result.UpdatedChecksums {
+		fmt.Printf("updated checksum of %d_%s\n", mig.Version, mig.Name)
+	}
+
+	for _, mig := range result.RemovedMissing {
+		fmt.Printf("removed log of %d_%s\n", mig.Version, mig.Name)
+	}
+
+	return nil
+}
+
+func downgrade(migrator henka.Henka, args []string) error {
+	version, err := parseVersion(args)
+	if err != nil {
+		return err
+	}
+
+	return migrator.Downgrade(version) //nolint:wrapcheck
+}
+
+func resolveConflicts(dir string, drv driver.Driver, fix bool) error {
+	conflicts, err := renumber.Detect(os.DirFS(dir), ".", drv)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, conflict := range conflicts {
+		fmt.Printf("%d_%s: %s\n", conflict.Version, conflict.Name, conflict.Reason)
+	}
+
+	if !fix {
+		return nil
+	}
+
+	mapping, err := renumber.Renumber(dir, conflicts, time.Now())
+	for _, renumbered := range mapping {
+		fmt.Printf("%d_%s -> %d_%s\n", renumbered.From.Version, renumbered.From.Name, renumbered.To.Version, renumbered.To.Name)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+func printSchemaDiff(report henka.RunReport) {
+	if report.SchemaDiff == nil {
+		return
+	}
+
+	if report.SchemaDiff.IsEmpty() {
+		fmt.Println("schema has not changed")
+		return
+	}
+
+	fmt.Println(report.SchemaDiff)
+}
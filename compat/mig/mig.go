@@ -0,0 +1,58 @@
+// Package mig adapts implementations written against the legacy mig API to the henka interfaces,
+// so that projects can move to henka one component at a time.
+//
+// Legacy drivers list the log with ListAppliedMigrations, WrapDriver exposes it as ListMigrationsLog.
+// Legacy sources have the same method set as source.Source and can be passed to henka as they are.
+// The legacy module is not a dependency of henka: the interfaces below describe its method sets
+// in terms of henka's migration types.
+package mig
+
+import (
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+// Driver is the method set of legacy drivers.
+type Driver interface {
+	ListAppliedMigrations() (*[]migration.Log, error)
+	Migrate(mig migration.Migration, dir migration.Direction, script string) error
+}
+
+// WrapDriver adapts a legacy driver to driver.Driver.
+func WrapDriver(legacy Driver) driver.Driver {
+	return &driverAdapter{legacy: legacy}
+}
+
+// UnwrapDriver adapts a driver.Driver to the legacy interface, e.g. to use henka's drivers in code
+// that still expects legacy ones.
+func UnwrapDriver(drv driver.Driver) Driver {
+	if adapter, ok := drv.(*driverAdapter); ok {
+		return adapter.legacy
+	}
+
+	return &legacyAdapter{drv: drv}
+}
+
+type driverAdapter struct {
+	legacy Driver
+}
+
+func (a *driverAdapter) ListMigrationsLog() (*[]migration.Log, error) {
+	return a.legacy.ListAppliedMigrations() //nolint:wrapcheck
+}
+
+func (a *driverAdapter) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return a.legacy.Migrate(mig, dir, script) //nolint:wrapcheck
+}
+
+type legacyAdapter struct {
+	drv driver.Driver
+}
+
+func (a *legacyAdapter) ListAppliedMigrations() (*[]migration.Log, error) {
+	return a.drv.ListMigrationsLog() //nolint:wrapcheck
+}
+
+func (a *legacyAdapter) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return a.drv.Migrate(mig, dir, script) //nolint:wrapcheck
+}
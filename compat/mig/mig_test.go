@@ -0,0 +1,61 @@
+package mig_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/compat/mig"
+	"github.com/root-talis/henka/migration"
+)
+
+var available = []migration.Description{ // nolint:gochecknoglobals
+	{Migration: migration.Migration{Version: 20220101000000, Name: "first"}},
+	{Migration: migration.Migration{Version: 20220102000000, Name: "second"}},
+}
+
+type legacySourceMock struct{}
+
+func (legacySourceMock) GetAvailableMigrations() (*[]migration.Description, error) {
+	return &available, nil
+}
+
+func (legacySourceMock) ReadMigration(m migration.Migration, _ migration.Direction) (io.Reader, error) {
+	return strings.NewReader("-- " + m.Name), nil
+}
+
+type legacyDriverMock struct {
+	log []migration.Log
+}
+
+func (m *legacyDriverMock) ListAppliedMigrations() (*[]migration.Log, error) {
+	return &m.log, nil
+}
+
+func (m *legacyDriverMock) Migrate(mg migration.Migration, dir migration.Direction, _ string) error {
+	m.log = append(m.log, migration.Log{Migration: mg, Direction: dir})
+	return nil
+}
+
+func TestWrapDriver(t *testing.T) {
+	t.Parallel()
+
+	legacy := legacyDriverMock{}
+	migrator := henka.New(legacySourceMock{}, mig.WrapDriver(&legacy))
+
+	assert.NoError(t, migrator.Upgrade(available[1].Version))
+	assert.Len(t, legacy.log, 2)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), result.AppliedCount)
+
+	assert.Same(t, &legacy, mig.UnwrapDriver(mig.WrapDriver(&legacy)))
+
+	log, err := mig.UnwrapDriver(mig.WrapDriver(&legacy)).ListAppliedMigrations()
+	assert.NoError(t, err)
+	assert.Equal(t, legacy.log, *log)
+}
@@ -0,0 +1,62 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+	"github.com/root-talis/henka/sqlscript"
+)
+
+// DestructiveTag marks migrations as destructive regardless of their scripts, see source.Tagger.
+const DestructiveTag = "destructive"
+
+var ErrNotConfirmed = errors.New("destructive migration was not confirmed")
+
+// ConfirmFunc decides whether a destructive migration may be applied. statements are the destructive statements
+// found in its script, empty if the migration is only tagged with DestructiveTag.
+type ConfirmFunc func(mig migration.Migration, direction migration.Direction, statements []string) bool
+
+// confirm asks Options.Confirm about the migration if it is destructive. Migrations applied without a script,
+// e.g. forced downgrades, are not asked about. Repeatable migrations have no tags, so only their scripts count.
+func (m *run) confirm(mig migration.Migration, direction migration.Direction, script string) error {
+	if m.options.Confirm == nil || script == "" {
+		return nil
+	}
+
+	statements := sqlscript.Destructive(script)
+
+	if len(statements) == 0 {
+		if isRepeatable(mig) {
+			return nil
+		}
+
+		tagged, err := m.taggedDestructive(mig)
+		if err != nil || !tagged {
+			return err
+		}
+	}
+
+	m.logger().Info("asking to confirm destructive migration", "version", mig.Version, "name", mig.Name, "direction", direction)
+
+	if !m.options.Confirm(mig, direction, statements) {
+		return newMigrationError(ErrNotConfirmed, mig)
+	}
+
+	return nil
+}
+
+func (m *run) taggedDestructive(mig migration.Migration) (bool, error) {
+	var tagger source2.Tagger
+	if !source2.As(m.source, &tagger) {
+		return false, nil
+	}
+
+	tags, err := tagger.MigrationTags(mig)
+	if err != nil {
+		return false, fmt.Errorf("failed to read tags of migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return containsTag(tags, DestructiveTag), nil
+}
@@ -0,0 +1,69 @@
+package henka
+
+import (
+	"context"
+	"io"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+// listMigrationsLog and migrateWithDriver call the outermost driver rather than the one As finds,
+// so that middlewares which only implement driver.Driver are not bypassed.
+func (m *run) listMigrationsLog() (*[]migration.Log, error) {
+	if drv, ok := m.driver.(driver.ContextDriver); ok {
+		return drv.ListMigrationsLogContext(m.ctx) //nolint:wrapcheck
+	}
+
+	return m.driver.ListMigrationsLog() //nolint:wrapcheck
+}
+
+func (m *run) migrateWithDriver(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+	script string,
+) error {
+	if isRepeatable(mig) {
+		return m.migrateRepeatable(mig.Name, script)
+	}
+
+	fn, err := m.migrationFunc(mig, direction)
+	if err != nil {
+		return err
+	}
+
+	if fn != nil {
+		return m.migrateFunc(ctx, mig, direction, fn)
+	}
+
+	if drv, ok := m.driver.(driver.ContextDriver); ok {
+		return drv.MigrateContext(ctx, mig, direction, script) //nolint:wrapcheck
+	}
+
+	return m.driver.Migrate(mig, direction, script) //nolint:wrapcheck
+}
+
+func listAvailableMigrations(ctx context.Context, src source2.Source) (*[]migration.Description, error) {
+	var contextSource source2.ContextSource
+	if source2.As(src, &contextSource) {
+		return contextSource.GetAvailableMigrationsContext(ctx) //nolint:wrapcheck
+	}
+
+	return src.GetAvailableMigrations() //nolint:wrapcheck
+}
+
+func readMigration(
+	ctx context.Context,
+	src source2.Source,
+	mig migration.Migration,
+	direction migration.Direction,
+) (io.Reader, error) {
+	var contextSource source2.ContextSource
+	if source2.As(src, &contextSource) {
+		return contextSource.ReadMigrationContext(ctx, mig, direction) //nolint:wrapcheck
+	}
+
+	return src.ReadMigration(mig, direction) //nolint:wrapcheck
+}
@@ -0,0 +1,192 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+var (
+	ErrDependenciesNotSupported = errors.New("source does not support migration dependencies")
+	ErrMissingDependency        = errors.New("migration depends on a version that is neither available nor applied")
+	ErrDependencyCycle          = errors.New("migration depends on itself")
+	ErrUnsatisfiedDependency    = errors.New("migration depends on a version that is not going to be applied")
+)
+
+// migrationDependencies reads the versions the migration depends on.
+func (m *run) migrationDependencies(mig migration.Migration) ([]migration.Version, error) {
+	var reader source2.DependencyReader
+	if !source2.As(m.source, &reader) {
+		return nil, fmt.Errorf("%w: %T", ErrDependenciesNotSupported, m.source)
+	}
+
+	return reader.MigrationDependencies(mig) //nolint:wrapcheck
+}
+
+// checkDependencies makes sure that every dependency of an available migration is available or applied,
+// and that no migration depends on itself through other migrations.
+func (m *run) checkDependencies(states []migration.State) error {
+	known := make(map[migration.Version]migration.Migration, len(states))
+	for _, state := range states {
+		known[state.Version] = state.Migration
+	}
+
+	graph := make(map[migration.Version][]migration.Version, len(states))
+
+	for _, state := range states {
+		if state.Status == migration.Missing {
+			continue
+		}
+
+		dependencies, err := m.migrationDependencies(state.Migration)
+		if err != nil {
+			return err
+		}
+
+		for _, dependency := range dependencies {
+			if _, ok := known[dependency]; !ok {
+				missingErr := newMigrationError(ErrMissingDependency, state.Migration)
+				missingErr.Detail = fmt.Sprintf(" depends on %d", dependency)
+
+				return missingErr
+			}
+		}
+
+		graph[state.Version] = dependencies
+	}
+
+	visited := make(map[migration.Version]bool, len(graph))
+
+	for _, state := range states {
+		if path := findCycle(graph, state.Version, visited, nil); path != nil {
+			cycleErr := newMigrationError(ErrDependencyCycle, known[path[0]])
+			cycleErr.Detail = fmt.Sprintf(" (%s)", joinVersionPath(path))
+
+			return cycleErr
+		}
+	}
+
+	return nil
+}
+
+// findCycle walks dependencies depth first and returns the versions of the first cycle it finds,
+// starting and ending with the same version. Versions that are not part of any cycle are marked visited.
+func findCycle(
+	graph map[migration.Version][]migration.Version,
+	version migration.Version,
+	visited map[migration.Version]bool,
+	path []migration.Version,
+) []migration.Version {
+	if visited[version] {
+		return nil
+	}
+
+	for i, onPath := range path {
+		if onPath == version {
+			return append(append([]migration.Version{}, path[i:]...), version)
+		}
+	}
+
+	path = append(path, version)
+
+	for _, dependency := range graph[version] {
+		if cycle := findCycle(graph, dependency, visited, path); cycle != nil {
+			return cycle
+		}
+	}
+
+	visited[version] = true
+
+	return nil
+}
+
+func joinVersionPath(path []migration.Version) string {
+	versions := make([]string, 0, len(path))
+	for _, version := range path {
+		versions = append(versions, fmt.Sprintf("%d", version))
+	}
+
+	return strings.Join(versions, " -> ")
+}
+
+// orderByDependencies moves migrations of the plan after the migrations they depend on and keeps
+// the order of the plan otherwise. Every dependency must be applied, baselined or planned.
+func (m *run) orderByDependencies(
+	plan []migration.Migration,
+	appliedMigrations *map[migration.Version]migration.State,
+	baseline migration.State,
+) ([]migration.Migration, error) {
+	planned := make(map[migration.Version]bool, len(plan))
+	for _, mig := range plan {
+		planned[mig.Version] = true
+	}
+
+	pending := make(map[migration.Version][]migration.Version, len(plan))
+
+	for _, mig := range plan {
+		dependencies, err := m.migrationDependencies(mig)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dependency := range dependencies {
+			if planned[dependency] {
+				pending[mig.Version] = append(pending[mig.Version], dependency)
+				continue
+			}
+
+			if state, ok := (*appliedMigrations)[dependency]; ok && state.Status == migration.Applied {
+				continue
+			}
+
+			if m.isBaselined(dependency, baseline) {
+				continue
+			}
+
+			unsatisfiedErr := newMigrationError(ErrUnsatisfiedDependency, mig)
+			unsatisfiedErr.Detail = fmt.Sprintf(" depends on %d", dependency)
+
+			return nil, unsatisfiedErr
+		}
+	}
+
+	ordered := make([]migration.Migration, 0, len(plan))
+	done := make(map[migration.Version]bool, len(plan))
+
+	for len(ordered) < len(plan) {
+		next := -1
+
+		for i, mig := range plan {
+			if !done[mig.Version] && allDone(pending[mig.Version], done) {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			for _, mig := range plan {
+				if !done[mig.Version] {
+					return nil, newMigrationError(ErrDependencyCycle, mig)
+				}
+			}
+		}
+
+		done[plan[next].Version] = true
+		ordered = append(ordered, plan[next])
+	}
+
+	return ordered, nil
+}
+
+func allDone(versions []migration.Version, done map[migration.Version]bool) bool {
+	for _, version := range versions {
+		if !done[version] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,391 @@
+package cassandra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/sqlscript"
+)
+
+type DriverConfig struct {
+	// Keyspace is where the migrations log and lock tables are kept.
+	Keyspace            string
+	MigrationsTableName string
+
+	// Replication creates Keyspace with these replication options unless it exists, e.g.
+	// {"class": "NetworkTopologyStrategy", "dc1": "3"}. The keyspace must exist beforehand if Replication is nil.
+	Replication map[string]string
+
+	// LockTTL is how long the lock taken by Lock lasts unless it is refreshed, DefaultLockTTL if zero, see package lease.
+	LockTTL time.Duration
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+const DefaultLockTTL = 30 * time.Second
+
+// maxAppendAttempts limits how many times a log entry is given the next ID after other writers have taken it.
+const maxAppendAttempts = 10
+
+var (
+	ErrInvalidConfig = errors.New("invalid cassandra driver config")
+	ErrLogContention = errors.New("failed to take an ID for the log entry, as other writers keep taking them")
+)
+
+type cassandraDriver struct {
+	session *gocql.Session
+	config  DriverConfig
+	mutex   sync.Mutex
+
+	// tablesExist is set once the keyspace, the migrations log and the lock tables have been created or found
+	tablesExist bool
+
+	executor driver.Executor
+
+	// lease is the lock row held between Lock and Unlock
+	lease *lease.Lease
+}
+
+// NewDriver returns a driver that executes CQL scripts on Cassandra and ScyllaDB.
+func NewDriver(session *gocql.Session, config DriverConfig) driver.Driver {
+	return &cassandraDriver{
+		session:  session,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+func (drv *cassandraDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+// ListMigrationsLogContext reads the single partition of the log, whose rows are clustered by ID.
+func (drv *cassandraDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	iter := drv.session.Query(fmt.Sprintf(
+		"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms FROM %s WHERE stream = ?",
+		drv.makeEscapedMigrationsTableName(),
+	), "").WithContext(ctx).Iter()
+
+	result := make([]migration.Log, 0)
+
+	for {
+		var log migration.Log
+		var id, version, executionTime int64
+		var name, direction, runID, checksum, appliedBy, hostname, appVersion string
+		var appliedAt, finishedAt time.Time
+
+		if !iter.Scan(&id, &version, &name, &direction, &appliedAt, &finishedAt, &runID, &checksum,
+			&appliedBy, &hostname, &appVersion, &executionTime) {
+			break
+		}
+
+		var err error
+		if log.Direction, err = decodeDirection(direction); err != nil {
+			_ = iter.Close()
+			return nil, err
+		}
+
+		log.ID = uint64(id)
+		log.Version = migration.Version(version)
+		log.Name = name
+		log.RunID = runID
+		log.Checksum = checksum
+		log.Baseline = log.Name == migration.BaselineName
+		log.AppliedBy = appliedBy
+		log.Hostname = hostname
+		log.AppVersion = appVersion
+		log.ExecutionTime = time.Duration(executionTime) * time.Millisecond
+		log.AppliedAt = appliedAt.UTC()
+
+		if !finishedAt.IsZero() {
+			log.FinishedAt = finishedAt.UTC()
+		}
+
+		result = append(result, log)
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (drv *cassandraDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext executes statements of the script one by one, as CQL has no multi-statement requests, and
+// waits for the nodes to agree on the schema after every schema change, so that the next statement
+// sees it wherever it is coordinated. CQL has no transactions, so statements before a failed one stay applied.
+func (drv *cassandraDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	held := drv.currentLease()
+	if err := held.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := held.Bind(ctx)
+	defer cancel()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	startTime := time.Now()
+	statements := sqlscript.Split(script)
+
+	for i, statement := range statements {
+		err := drv.session.Query(statement).WithContext(ctx).Exec()
+		if err == nil && isSchemaChange(statement) {
+			err = drv.session.AwaitSchemaAgreement(ctx)
+		}
+
+		if err != nil {
+			index := i
+			if len(statements) == 1 {
+				index = -1
+			}
+
+			return &driver.StatementError{Index: index, Statement: statement, Err: err}
+		}
+	}
+
+	err := drv.appendLog(ctx, migration.Log{
+		Migration:     mig,
+		Direction:     dir,
+		AppliedAt:     startTime,
+		FinishedAt:    time.Now(),
+		Checksum:      migration.Checksum([]byte(script)),
+		ExecutionTime: time.Since(startTime),
+	}, drv.executor)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *cassandraDriver) WriteLog(log migration.Log) error {
+	ctx := context.Background()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("failed to write migration log: %w", err)
+	}
+
+	if log.FinishedAt.IsZero() {
+		log.FinishedAt = log.AppliedAt
+	}
+
+	if err := drv.appendLog(ctx, log, drv.executor.ForLog(log)); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// appendLog inserts the entry with the ID after the latest one. The insert is a lightweight transaction,
+// so that an ID taken by another writer in the meantime is never overwritten; the next ID is tried then.
+func (drv *cassandraDriver) appendLog(ctx context.Context, log migration.Log, executor driver.Executor) error {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		var lastID int64
+
+		err := drv.session.Query(
+			fmt.Sprintf("SELECT id FROM %s WHERE stream = ? ORDER BY id DESC LIMIT 1", tableName), "",
+		).WithContext(ctx).Consistency(gocql.Quorum).Scan(&lastID)
+		if err != nil && !errors.Is(err, gocql.ErrNotFound) {
+			return err //nolint:wrapcheck
+		}
+
+		applied, err := drv.session.Query(
+			fmt.Sprintf("INSERT INTO %s (stream, id, version, migration_name, direction, start_time, end_time, run_id, "+
+				"checksum, applied_by, hostname, app_version, execution_time_ms) "+
+				"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) IF NOT EXISTS", tableName,
+			),
+			"",
+			lastID+1,
+			int64(log.Version),
+			log.Name,
+			encodeDirection(log.Direction),
+			log.AppliedAt.UTC(),
+			log.FinishedAt.UTC(),
+			log.RunID,
+			log.Checksum,
+			executor.AppliedBy,
+			executor.Hostname,
+			executor.AppVersion,
+			log.ExecutionTime.Milliseconds(),
+		).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if applied {
+			return nil
+		}
+	}
+
+	return ErrLogContention
+}
+
+// isSchemaChange tells whether the statement is DDL, after which nodes have to agree on the schema.
+func isSchemaChange(statement string) bool {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "CREATE", "ALTER", "DROP", "TRUNCATE":
+		return true
+	default:
+		return false
+	}
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
+
+func (drv *cassandraDriver) makeEscapedMigrationsTableName() string {
+	return escapeIdentifier(drv.config.Keyspace) + "." + escapeIdentifier(drv.config.MigrationsTableName)
+}
+
+func (drv *cassandraDriver) makeEscapedLockTableName() string {
+	return escapeIdentifier(drv.config.Keyspace) + "." + escapeIdentifier(drv.config.MigrationsTableName+"_lock")
+}
+
+func (drv *cassandraDriver) ensureTablesExist(ctx context.Context) error {
+	drv.mutex.Lock()
+	exists := drv.tablesExist
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	statements, err := drv.makeTablesDDL()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if err = drv.session.Query(statement).WithContext(ctx).Exec(); err != nil {
+			return fmt.Errorf("failed to create migrations table %s: %w", drv.makeEscapedMigrationsTableName(), err)
+		}
+	}
+
+	if err = drv.session.AwaitSchemaAgreement(ctx); err != nil {
+		return fmt.Errorf("failed to create migrations table %s: %w", drv.makeEscapedMigrationsTableName(), err)
+	}
+
+	drv.mutex.Lock()
+	drv.tablesExist = true
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// makeTablesDDL creates the log in a single partition, stream "", whose rows are clustered by ID,
+// so that it is read in the order it was written.
+func (drv *cassandraDriver) makeTablesDDL() ([]string, error) {
+	statements := make([]string, 0, 3) //nolint:gomnd
+
+	if drv.config.Replication != nil {
+		replication, err := makeReplicationMap(drv.config.Replication)
+		if err != nil {
+			return nil, err
+		}
+
+		statements = append(statements, fmt.Sprintf("CREATE KEYSPACE IF NOT EXISTS %s WITH replication = %s",
+			escapeIdentifier(drv.config.Keyspace), replication))
+	}
+
+	return append(statements,
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+			"stream         text, "+
+			"id             bigint, "+
+			"version        bigint, "+
+			"migration_name text, "+
+			"direction      text, "+ // "u" or "d"
+			"start_time     timestamp, "+
+			"end_time       timestamp, "+
+			"run_id         text, "+
+			"checksum       text, "+
+			"applied_by     text, "+
+			"hostname       text, "+
+			"app_version    text, "+
+			"execution_time_ms bigint, "+
+			"primary key (stream, id)"+
+			") WITH CLUSTERING ORDER BY (id ASC)", drv.makeEscapedMigrationsTableName()),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+			"name   text, "+
+			"holder text, "+
+			"primary key (name)"+
+			")", drv.makeEscapedLockTableName()),
+	), nil
+}
+
+// makeReplicationMap writes replication options as a CQL map literal, e.g. {'class': 'SimpleStrategy', ...}.
+func makeReplicationMap(options map[string]string) (string, error) {
+	if options["class"] == "" {
+		return "", fmt.Errorf("%w: replication class is missing", ErrInvalidConfig)
+	}
+
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	entries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, escapeString(key)+": "+escapeString(options[key]))
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}", nil
+}
+
+// escapeIdentifier quotes a name in double quotes, doubling double quotes in it. Quoted names are case-sensitive.
+func escapeIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// escapeString quotes a value as a string literal, doubling single quotes in it.
+func escapeString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,350 @@
+//nolint:gochecknoglobals
+package cassandra_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/cassandra"
+	"github.com/root-talis/henka/migration"
+)
+
+// Cassandra and ScyllaDB versions to test against
+var versions = []string{
+	"cassandra:4.0",
+	"cassandra:3.11",
+	"scylladb/scylla:5.0",
+}
+
+//
+// -- bootstrap --------------------------------------
+//
+
+type testContainer struct {
+	sync.Mutex
+	ctx       context.Context
+	container testcontainers.Container
+	session   *gocql.Session
+}
+
+var containers = make(map[string]*testContainer)
+
+func TestMain(m *testing.M) {
+	failed := false
+	waitGroup := sync.WaitGroup{}
+
+	for _, version := range versions {
+		version := version
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+			if err := setupTestContainer(version); err != nil {
+				failed = true
+				fmt.Printf("error when creating test container for version %s: %s\n", version, err) //nolint:forbidigo
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	var exitCode int
+	if !failed {
+		exitCode = m.Run()
+	} else {
+		exitCode = -1
+	}
+
+	for version, container := range containers {
+		container := container
+		version := version
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := shutdownTestContainer(version, container); err != nil {
+				fmt.Printf("error when cleaning up container %s: %s\n", version, err) //nolint:forbidigo
+				exitCode = -1
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	os.Exit(exitCode)
+}
+
+func setupTestContainer(version string) error {
+	request := testcontainers.ContainerRequest{
+		Image:        version,
+		ExposedPorts: []string{"9042/tcp"},
+		WaitingFor: wait.ForAll(
+			wait.ForListeningPort("9042").WithStartupTimeout(3*time.Minute),
+			wait.ForLog("Starting listening for CQL clients").WithStartupTimeout(3*time.Minute),
+		),
+	}
+
+	if strings.HasPrefix(version, "scylladb") {
+		request.Cmd = []string{"--smp", "1", "--memory", "750M", "--overprovisioned", "1"}
+	} else {
+		request.Env = map[string]string{"MAX_HEAP_SIZE": "512M", "HEAP_NEWSIZE": "128M"}
+	}
+
+	ctx := context.Background()
+	cassandraC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: request,
+		Started:          true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", version, err)
+	}
+
+	container := testContainer{
+		ctx:       ctx,
+		container: cassandraC,
+	}
+	containers[version] = &container
+
+	host, err := cassandraC.Host(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get host of test container %s: %w", version, err)
+	}
+
+	port, err := cassandraC.MappedPort(ctx, "9042")
+	if err != nil {
+		return fmt.Errorf("failed to get port of test container %s: %w", version, err)
+	}
+
+	cluster := gocql.NewCluster(host)
+	cluster.Port = port.Int()
+	cluster.DisableInitialHostLookup = true
+	cluster.Timeout = 30 * time.Second
+
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database in container %s: %w", version, err)
+	}
+
+	container.session = session
+
+	return nil
+}
+
+func shutdownTestContainer(version string, container *testContainer) error {
+	fmt.Printf("cleanup %s...\n", version) //nolint:forbidigo
+	container.Lock()
+	defer container.Unlock()
+
+	if container.session != nil {
+		container.session.Close()
+	}
+
+	err := container.container.Terminate(container.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to terminate test container %s: %w", version, err)
+	}
+
+	fmt.Printf("cleanup %s done\n", version) //nolint:forbidigo
+	return nil
+}
+
+//
+// -- templates --------------------------------------
+//
+
+var (
+	defaultDriverConfig = cassandra.DriverConfig{
+		Keyspace:            "test_keyspace",
+		MigrationsTableName: "migrations_log",
+		Replication:         map[string]string{"class": "SimpleStrategy", "replication_factor": "1"},
+		AppliedBy:           "tester",
+		AppVersion:          "v1.0.0",
+	}
+
+	migration1Parsed = migration.Log{
+		ID:         1,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 500000000, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+	migration2Parsed = migration.Log{
+		ID:         2,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+
+	migrationScript1 = "CREATE TABLE test_keyspace.users (id int PRIMARY KEY, name text);\n" +
+		"INSERT INTO test_keyspace.users (id, name) VALUES (1, 'semi;colon');"
+	migrationScript2 = "DROP TABLE test_keyspace.users"
+)
+
+//
+// --- tests -----------------------------------------
+//
+
+func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cassandra")
+	}
+
+	runForAllCassandraVersions(t, "ListMigrationsLog", func(t *testing.T, version string, session *gocql.Session) {
+		t.Helper()
+
+		defer dropKeyspace(t, session)
+
+		drv := cassandra.NewDriver(session, defaultDriverConfig)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+
+		err = session.Query("INSERT INTO test_keyspace.migrations_log (stream, id, version, direction) VALUES ('', 1, 1, 'x')").Exec()
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestMigrate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cassandra")
+	}
+
+	runForAllCassandraVersions(t, "Migrate", func(t *testing.T, version string, session *gocql.Session) {
+		t.Helper()
+
+		defer dropKeyspace(t, session)
+
+		drv := cassandra.NewDriver(session, defaultDriverConfig)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		var name string
+		assert.NoError(t, session.Query("SELECT name FROM test_keyspace.users WHERE id = 1").Scan(&name))
+		assert.Equal(t, "semi;colon", name)
+
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Down, migrationScript2))
+
+		err := drv.Migrate(migration1Parsed.Migration, migration.Up, "CREATE TABLE test_keyspace.users (id int PRIMARY KEY);\n"+
+			"INSERT INTO test_keyspace.nowhere (id) VALUES (1);")
+
+		var statementErr *driver.StatementError
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+		}
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Equal(t, uint64(1), (*actualLog)[0].ID)
+			assert.Equal(t, migration.Up, (*actualLog)[0].Direction)
+			assert.Equal(t, migration.Checksum([]byte(migrationScript1)), (*actualLog)[0].Checksum)
+			assert.Equal(t, "tester", (*actualLog)[0].AppliedBy)
+			assert.WithinDuration(t, time.Now(), (*actualLog)[0].AppliedAt, time.Minute)
+			assert.Equal(t, uint64(2), (*actualLog)[1].ID)
+			assert.Equal(t, migration.Down, (*actualLog)[1].Direction)
+		}
+	})
+}
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cassandra")
+	}
+
+	runForAllCassandraVersions(t, "WriteLog", func(t *testing.T, version string, session *gocql.Session) {
+		t.Helper()
+
+		defer dropKeyspace(t, session)
+
+		drv := cassandra.NewDriver(session, defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("cassandra driver must implement driver.LogWriter")
+		}
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(migration2Parsed))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *actualLog)
+	})
+}
+
+func TestLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cassandra")
+	}
+
+	runForAllCassandraVersions(t, "Lock", func(t *testing.T, version string, session *gocql.Session) {
+		t.Helper()
+
+		defer dropKeyspace(t, session)
+
+		config := defaultDriverConfig
+		config.LockTTL = 3 * time.Second
+
+		first := cassandra.NewDriver(session, config)
+		second := cassandra.NewDriver(session, config)
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		// the heartbeat keeps the lock beyond its TTL
+		time.Sleep(4 * time.Second)
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+	})
+}
+
+//
+// --- utility stuff ---------------------------------
+//
+
+func runForAllCassandraVersions(t *testing.T, baseName string, test func(t *testing.T, version string, session *gocql.Session)) {
+	t.Helper()
+
+	for version, container := range containers {
+		container := container
+		version := version
+		testName := fmt.Sprintf("%s@%s", baseName, version)
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			container.Lock()
+			defer container.Unlock()
+
+			test(t, version, container.session)
+		})
+	}
+}
+
+func dropKeyspace(t *testing.T, session *gocql.Session) {
+	t.Helper()
+
+	if err := session.Query("DROP KEYSPACE IF EXISTS test_keyspace").Exec(); err != nil {
+		t.Fatalf("falied to drop keyspace after test: %s", err)
+	}
+}
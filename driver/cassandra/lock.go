@@ -0,0 +1,87 @@
+package cassandra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/driver/lease"
+)
+
+// Lock inserts the row of the migrations table into the lock table with a lightweight transaction that
+// fails while the row exists. The row expires after DriverConfig.LockTTL unless its holder refreshes it,
+// so that the lock is taken over after the holder has crashed.
+func (drv *cassandraDriver) Lock(timeout time.Duration) error {
+	ctx := context.Background()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	holder := lease.NewHolder(drv.executor.Hostname)
+
+	err := lease.Acquire(timeout, func() (bool, error) {
+		return drv.session.Query( //nolint:wrapcheck
+			fmt.Sprintf("INSERT INTO %s (name, holder) VALUES (?, ?) IF NOT EXISTS USING TTL ?", drv.makeEscapedLockTableName()),
+			drv.config.MigrationsTableName,
+			holder,
+			drv.lockTTLSeconds(),
+		).WithContext(ctx).MapScanCAS(make(map[string]interface{}))
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	held := lease.Start(holder, drv.lockTTL(), func() (bool, error) {
+		return drv.session.Query( //nolint:wrapcheck
+			fmt.Sprintf("UPDATE %s USING TTL ? SET holder = ? WHERE name = ? IF holder = ?", drv.makeEscapedLockTableName()),
+			drv.lockTTLSeconds(),
+			holder,
+			drv.config.MigrationsTableName,
+			holder,
+		).MapScanCAS(make(map[string]interface{}))
+	}, nil)
+
+	drv.mutex.Lock()
+	drv.lease = held
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// Unlock stops the heartbeat and deletes the lock row, see lease.Lease.Release.
+func (drv *cassandraDriver) Unlock() error {
+	drv.mutex.Lock()
+	held := drv.lease
+	drv.lease = nil
+	drv.mutex.Unlock()
+
+	return held.Release(func() (bool, error) { //nolint:wrapcheck
+		return drv.session.Query( //nolint:wrapcheck
+			fmt.Sprintf("DELETE FROM %s WHERE name = ? IF holder = ?", drv.makeEscapedLockTableName()),
+			drv.config.MigrationsTableName,
+			held.Holder,
+		).MapScanCAS(make(map[string]interface{}))
+	})
+}
+
+// currentLease is the lease held between Lock and Unlock, nil when the lock is not held.
+func (drv *cassandraDriver) currentLease() *lease.Lease {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	return drv.lease
+}
+
+func (drv *cassandraDriver) lockTTL() time.Duration {
+	if drv.config.LockTTL <= 0 {
+		return DefaultLockTTL
+	}
+
+	return drv.config.LockTTL
+}
+
+// lockTTLSeconds rounds the TTL up to whole seconds, which is what USING TTL takes.
+func (drv *cassandraDriver) lockTTLSeconds() int {
+	return int((drv.lockTTL() + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,335 @@
+package cockroach
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
+	"github.com/root-talis/henka/migration"
+)
+
+type DriverConfig struct {
+	// SchemaName is the schema of the migrations log table, "public" if empty. The database is the one of the connection.
+	SchemaName          string
+	MigrationsTableName string
+
+	// MaxRetries limits how many times a migration is executed again after a serialization failure, DefaultMaxRetries
+	// if zero. Negative values disable retries.
+	MaxRetries int
+
+	// LockTTL is how long the lock taken by Lock lasts unless it is refreshed, DefaultLockTTL if zero, see package lease.
+	LockTTL time.Duration
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+const (
+	DefaultMaxRetries = 5
+	DefaultLockTTL    = 30 * time.Second
+)
+
+// DB is the connection the driver needs. It is satisfied by *sql.DB and instrumented wrappers. Every migration
+// is executed in a transaction of its own, so that it can be retried as a whole.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+type cockroachDriver struct {
+	db     DB
+	config DriverConfig
+	mutex  sync.Mutex
+
+	// tableExists is set once the migrations log and lock tables have been created or found
+	tableExists bool
+
+	executor driver.Executor
+
+	// lease is the lock row held between Lock and Unlock
+	lease *lease.Lease
+}
+
+// NewDriver returns a driver for CockroachDB. Queries use $1 style parameters, as understood by
+// github.com/lib/pq and github.com/jackc/pgx.
+func NewDriver(db DB, config DriverConfig) driver.Driver {
+	return &cockroachDriver{
+		db:       db,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+func (drv *cockroachDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *cockroachDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	var result []migration.Log
+
+	err := drv.retry(ctx, func() error {
+		rows, err := drv.db.QueryContext(ctx, fmt.Sprintf(
+			"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+				"applied_by, hostname, app_version, execution_time_ms FROM %s ORDER BY id",
+			drv.makeEscapedMigrationsTableName(),
+		))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer rows.Close()
+
+		result, err = fetchMigrationsLog(rows)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (drv *cockroachDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext executes the script and writes the log entry in a single transaction, which is executed
+// again from the start when CockroachDB aborts it with a serialization failure.
+func (drv *cockroachDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	held := drv.currentLease()
+	if err := held.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := held.Bind(ctx)
+	defer cancel()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return drv.retry(ctx, func() error {
+		return drv.migrateInTx(ctx, mig, dir, script)
+	})
+}
+
+func (drv *cockroachDriver) migrateInTx(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	startTime := time.Now()
+
+	tx, err := drv.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		_ = tx.Rollback()
+		return &driver.StatementError{Index: -1, Statement: script, Err: err}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+			drv.makeEscapedMigrationsTableName(),
+		),
+		int64(mig.Version),
+		mig.Name,
+		encodeDirection(dir),
+		startTime.UTC(),
+		time.Now().UTC(),
+		migration.Checksum([]byte(script)),
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+		time.Since(startTime).Milliseconds(),
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *cockroachDriver) WriteLog(log migration.Log) error {
+	ctx := context.Background()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("failed to write migration log: %w", err)
+	}
+
+	finishedAt := log.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = log.AppliedAt
+	}
+
+	var runID, checksum *string
+	var executionTime *int64
+	if log.RunID != "" {
+		runID = &log.RunID
+	}
+	if log.Checksum != "" {
+		checksum = &log.Checksum
+	}
+	if log.ExecutionTime > 0 {
+		milliseconds := log.ExecutionTime.Milliseconds()
+		executionTime = &milliseconds
+	}
+
+	executor := drv.executor.ForLog(log)
+
+	err := drv.retry(ctx, func() error {
+		_, err := drv.db.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+				"applied_by, hostname, app_version, execution_time_ms) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+				drv.makeEscapedMigrationsTableName(),
+			),
+			int64(log.Version),
+			log.Name,
+			encodeDirection(log.Direction),
+			log.AppliedAt.UTC(),
+			finishedAt.UTC(),
+			runID,
+			checksum,
+			executor.AppliedBy,
+			executor.Hostname,
+			executor.AppVersion,
+			executionTime,
+		)
+
+		return err //nolint:wrapcheck
+	})
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// fetchMigrationsLog scans rows of id, version, migration_name, direction, start_time, end_time, run_id,
+// checksum, applied_by, hostname, app_version and execution_time_ms.
+func fetchMigrationsLog(rows *sql.Rows) ([]migration.Log, error) {
+	result := make([]migration.Log, 0)
+	for rows.Next() {
+		var log migration.Log
+		var version int64
+		var direction string
+		var appliedAt time.Time
+		var finishedAt sql.NullTime
+		var name, runID, checksum, appliedBy, hostname, appVersion sql.NullString
+		var executionTime sql.NullInt64
+
+		err := rows.Scan(&log.ID, &version, &name, &direction, &appliedAt, &finishedAt, &runID, &checksum,
+			&appliedBy, &hostname, &appVersion, &executionTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+		}
+
+		log.Version = migration.Version(version)
+		log.Name = name.String
+
+		log.Direction, err = decodeDirection(direction)
+		if err != nil {
+			return nil, err
+		}
+
+		log.RunID = runID.String
+		log.Checksum = checksum.String
+		log.Baseline = log.Name == migration.BaselineName
+		log.AppliedBy = appliedBy.String
+		log.Hostname = hostname.String
+		log.AppVersion = appVersion.String
+		log.ExecutionTime = time.Duration(executionTime.Int64) * time.Millisecond
+		log.AppliedAt = appliedAt.UTC()
+
+		if finishedAt.Valid {
+			log.FinishedAt = finishedAt.Time.UTC()
+		}
+
+		result = append(result, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+	}
+
+	return result, nil
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
+
+func (drv *cockroachDriver) schemaName() string {
+	if drv.config.SchemaName == "" {
+		return "public"
+	}
+
+	return drv.config.SchemaName
+}
+
+func (drv *cockroachDriver) makeEscapedMigrationsTableName() string {
+	return escapeIdentifier(drv.schemaName()) + "." + escapeIdentifier(drv.config.MigrationsTableName)
+}
+
+// ensureTablesExist creates the tables and the sequence of the migrations log table, see tableExists.
+func (drv *cockroachDriver) ensureTablesExist(ctx context.Context) error {
+	drv.mutex.Lock()
+	exists := drv.tableExists
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	for _, ddl := range drv.makeTablesDDL() {
+		if _, err := drv.db.ExecContext(ctx, ddl); err != nil {
+			return fmt.Errorf("failed to create migrations table %s: %w", drv.makeEscapedMigrationsTableName(), err)
+		}
+	}
+
+	drv.mutex.Lock()
+	drv.tableExists = true
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// escapeIdentifier quotes a name in double quotes, doubling double quotes in it.
+func escapeIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// escapeString quotes a value as a string literal, doubling single quotes in it.
+func escapeString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,397 @@
+//nolint:gochecknoglobals
+package cockroach_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/cockroach"
+	"github.com/root-talis/henka/migration"
+)
+
+// CockroachDB versions to test against
+var versions = []string{
+	"cockroachdb/cockroach:v22.1.2",
+	"cockroachdb/cockroach:v21.2.12",
+}
+
+//
+// -- bootstrap --------------------------------------
+//
+
+type testContainer struct {
+	sync.Mutex
+	ctx       context.Context
+	container testcontainers.Container
+	conn      *sql.DB
+}
+
+var containers = make(map[string]*testContainer)
+
+func TestMain(m *testing.M) {
+	failed := false
+	waitGroup := sync.WaitGroup{}
+
+	for _, version := range versions {
+		version := version
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+			if err := setupTestContainer(version); err != nil {
+				failed = true
+				fmt.Printf("error when creating test container for version %s: %s\n", version, err) //nolint:forbidigo
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	var exitCode int
+	if !failed {
+		exitCode = m.Run()
+	} else {
+		exitCode = -1
+	}
+
+	for version, container := range containers {
+		container := container
+		version := version
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := shutdownTestContainer(version, container); err != nil {
+				fmt.Printf("error when cleaning up container %s: %s\n", version, err) //nolint:forbidigo
+				exitCode = -1
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	os.Exit(exitCode)
+}
+
+func setupTestContainer(version string) error {
+	ctx := context.Background()
+	cockroachC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        version,
+			ExposedPorts: []string{"26257/tcp"},
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort("26257"),
+				wait.ForLog("CockroachDB node starting"),
+			),
+			Cmd: []string{"start-single-node", "--insecure"},
+		},
+		Started: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", version, err)
+	}
+
+	container := testContainer{
+		ctx:       ctx,
+		container: cockroachC,
+	}
+	containers[version] = &container
+
+	endpoint, err := cockroachC.Endpoint(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to get endpoint for test container %s: %w", version, err)
+	}
+
+	conn, err := sql.Open("postgres", fmt.Sprintf("postgres://root@%s/defaultdb?sslmode=disable", endpoint))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database in container %s: %w", version, err)
+	}
+
+	container.conn = conn
+
+	return nil
+}
+
+func shutdownTestContainer(version string, container *testContainer) error {
+	fmt.Printf("cleanup %s...\n", version) //nolint:forbidigo
+	container.Lock()
+	defer container.Unlock()
+
+	if container.conn != nil {
+		err := container.conn.Close()
+		if err != nil {
+			return fmt.Errorf("failed to close connection to test database %s: %w", version, err)
+		}
+	}
+
+	err := container.container.Terminate(container.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to terminate test container %s: %w", version, err)
+	}
+
+	fmt.Printf("cleanup %s done\n", version) //nolint:forbidigo
+	return nil
+}
+
+//
+// -- templates --------------------------------------
+//
+
+var (
+	initSchema = []string{
+		"CREATE SCHEMA test_schema",
+	}
+	dropSchema = []string{
+		"DROP SCHEMA IF EXISTS test_schema CASCADE",
+	}
+
+	defaultDriverConfig = cockroach.DriverConfig{
+		SchemaName:          "test_schema",
+		MigrationsTableName: "migrations_log",
+		AppliedBy:           "tester",
+		AppVersion:          "v1.0.0",
+	}
+
+	migration1Parsed = migration.Log{
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 500000000, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+	migration2Parsed = migration.Log{
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+
+	migrationScript1 = "CREATE TABLE test_schema.users (id int8 not null primary key)"
+	migrationScript2 = "DROP TABLE test_schema.users"
+)
+
+//
+// --- tests -----------------------------------------
+//
+
+func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cockroach")
+	}
+
+	runForAllCockroachVersions(t, "ListMigrationsLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		drv := cockroach.NewDriver(conn, defaultDriverConfig)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+
+		_, err = conn.Exec("INSERT INTO test_schema.migrations_log (version, migration_name, direction) VALUES (1, 'bad', 'x')")
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestMigrate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cockroach")
+	}
+
+	runForAllCockroachVersions(t, "Migrate", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		drv := cockroach.NewDriver(conn, defaultDriverConfig)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+		assert.True(t, tableExists(t, conn, "users"))
+
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Down, migrationScript2))
+		assert.False(t, tableExists(t, conn, "users"))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Equal(t, migration.Up, (*actualLog)[0].Direction)
+			assert.Equal(t, migration.Checksum([]byte(migrationScript1)), (*actualLog)[0].Checksum)
+			assert.Equal(t, "tester", (*actualLog)[0].AppliedBy)
+			assert.WithinDuration(t, time.Now(), (*actualLog)[0].AppliedAt, time.Minute)
+			assert.Equal(t, migration.Down, (*actualLog)[1].Direction)
+		}
+	})
+}
+
+func TestMigrateRetriesSerializationFailures(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cockroach")
+	}
+
+	runForAllCockroachVersions(t, "MigrateRetriesSerializationFailures", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		config := defaultDriverConfig
+		config.MaxRetries = 2
+		drv := cockroach.NewDriver(conn, config)
+
+		// every transaction younger than a minute is aborted with a serialization failure
+		script := "INSERT INTO test_schema.migrations_log (version, direction) VALUES (0, 'u'); " +
+			"SELECT crdb_internal.force_retry('1m')"
+
+		err := drv.Migrate(migration1Parsed.Migration, migration.Up, script)
+		assert.True(t, cockroach.IsRetryable(err))
+
+		var attempts int
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM test_schema.migrations_log").Scan(&attempts))
+		assert.Equal(t, 0, attempts)
+	})
+}
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cockroach")
+	}
+
+	runForAllCockroachVersions(t, "WriteLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		drv := cockroach.NewDriver(conn, defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("cockroach driver must implement driver.LogWriter")
+		}
+
+		elsewhere := migration2Parsed
+		elsewhere.AppliedAt = migration2Parsed.AppliedAt.In(time.FixedZone("UTC+3", 3*60*60))
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(elsewhere))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Less(t, (*actualLog)[0].ID, (*actualLog)[1].ID)
+
+			(*actualLog)[0].ID, (*actualLog)[1].ID = 0, 0
+			assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *actualLog)
+		}
+	})
+}
+
+func TestLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/cockroach")
+	}
+
+	runForAllCockroachVersions(t, "Lock", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		config := defaultDriverConfig
+		config.LockTTL = 3 * time.Second
+
+		first := cockroach.NewDriver(conn, config)
+		second := cockroach.NewDriver(conn, config)
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		// the heartbeat keeps the lock beyond its TTL
+		time.Sleep(4 * time.Second)
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+	})
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsRetryable(t *testing.T) { //nolint:paralleltest
+	assert.True(t, cockroach.IsRetryable(sqlStateError("40001")))
+	assert.True(t, cockroach.IsRetryable(fmt.Errorf("failed to commit migration: %w", sqlStateError("40001"))))
+	assert.False(t, cockroach.IsRetryable(sqlStateError("42P01")))
+	assert.False(t, cockroach.IsRetryable(errors.New("40001")))
+	assert.False(t, cockroach.IsRetryable(nil))
+}
+
+//
+// --- utility stuff ---------------------------------
+//
+
+func runForAllCockroachVersions(t *testing.T, baseName string, test func(t *testing.T, version string, conn *sql.DB)) {
+	t.Helper()
+
+	for version, container := range containers {
+		container := container
+		version := version
+		testName := fmt.Sprintf("%s@%s", baseName, version)
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			container.Lock()
+			defer container.Unlock()
+
+			test(t, version, container.conn)
+		})
+	}
+}
+
+func execAll(t *testing.T, conn *sql.DB, statements []string) {
+	t.Helper()
+
+	for _, statement := range statements {
+		if _, err := conn.Exec(statement); err != nil {
+			t.Fatalf("failed to execute \"%s\": %s", statement, err)
+		}
+	}
+}
+
+func tableExists(t *testing.T, conn *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := conn.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'test_schema' AND table_name = $1", name,
+	).Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to look up table %s: %s", name, err)
+	}
+
+	return count > 0
+}
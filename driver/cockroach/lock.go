@@ -0,0 +1,113 @@
+package cockroach
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/driver/lease"
+)
+
+// Lock takes the row of the migrations table in the lock table, as CockroachDB accepts advisory locks but
+// doesn't enforce them. The row holds the holder and its latest heartbeat, and is taken over when it is free
+// or its heartbeat is older than DriverConfig.LockTTL. Times come from the database, so that clocks
+// of the instances don't matter.
+func (drv *cockroachDriver) Lock(timeout time.Duration) error {
+	ctx := context.Background()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	holder := lease.NewHolder(drv.executor.Hostname)
+
+	err := lease.Acquire(timeout, func() (bool, error) {
+		result, err := drv.db.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %[1]s (name, holder, heartbeat) VALUES ($1, $2, now()) "+
+				"ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, heartbeat = excluded.heartbeat "+
+				"WHERE %[1]s.holder IS NULL OR %[1]s.heartbeat < now() - $3 * INTERVAL '1 millisecond'",
+				drv.makeEscapedLockTableName(),
+			),
+			drv.config.MigrationsTableName,
+			holder,
+			drv.lockTTL().Milliseconds(),
+		)
+
+		switch {
+		case err != nil && IsRetryable(err):
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+
+		updated, err := result.RowsAffected()
+
+		return err == nil && updated > 0, nil
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	held := lease.Start(holder, drv.lockTTL(), func() (bool, error) {
+		return drv.updateLock(context.Background(), "heartbeat = now()", holder)
+	}, nil)
+
+	drv.mutex.Lock()
+	drv.lease = held
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// Unlock stops the heartbeat and frees the lock row, see lease.Lease.Release.
+func (drv *cockroachDriver) Unlock() error {
+	drv.mutex.Lock()
+	held := drv.lease
+	drv.lease = nil
+	drv.mutex.Unlock()
+
+	return held.Release(func() (released bool, err error) { //nolint:wrapcheck
+		err = drv.retry(context.Background(), func() error {
+			released, err = drv.updateLock(context.Background(), "holder = NULL", held.Holder)
+			return err
+		})
+
+		return released, err
+	})
+}
+
+// currentLease is the lease held between Lock and Unlock, nil when the lock is not held.
+func (drv *cockroachDriver) currentLease() *lease.Lease {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	return drv.lease
+}
+
+// updateLock sets columns of the lock row while it is held by the holder, and reports whether it is.
+func (drv *cockroachDriver) updateLock(ctx context.Context, set string, holder string) (bool, error) {
+	result, err := drv.db.ExecContext(ctx,
+		fmt.Sprintf("UPDATE %s SET %s WHERE name = $1 AND holder = $2", drv.makeEscapedLockTableName(), set),
+		drv.config.MigrationsTableName,
+		holder,
+	)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	updated, err := result.RowsAffected()
+
+	return updated > 0, err //nolint:wrapcheck
+}
+
+func (drv *cockroachDriver) lockTTL() time.Duration {
+	if drv.config.LockTTL <= 0 {
+		return DefaultLockTTL
+	}
+
+	return drv.config.LockTTL
+}
+
+func (drv *cockroachDriver) makeEscapedLockTableName() string {
+	return escapeIdentifier(drv.schemaName()) + "." + escapeIdentifier(drv.config.MigrationsTableName+"_lock")
+}
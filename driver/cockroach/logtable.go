@@ -0,0 +1,34 @@
+package cockroach
+
+import "fmt"
+
+// makeTablesDDL creates the migrations log table and the table of Lock. IDs come from a sequence rather than
+// unique_rowid(), whose values are not ordered across nodes, so that the log is read in the order it was written.
+func (drv *cockroachDriver) makeTablesDDL() []string {
+	sequenceName := escapeIdentifier(drv.schemaName()) + "." + escapeIdentifier(drv.config.MigrationsTableName+"_id_seq")
+
+	return []string{
+		fmt.Sprintf("CREATE SEQUENCE IF NOT EXISTS %s", sequenceName),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+			"id             int8 not null default nextval(%s), "+
+			"version        int8 not null, "+
+			"migration_name string null, "+
+			"direction      char(1) not null, "+ // "u" or "d"
+			"start_time     timestamptz not null default now(), "+
+			"end_time       timestamptz null, "+
+			"run_id         string null, "+
+			"checksum       char(64) null, "+
+			"applied_by     string null, "+
+			"hostname       string null, "+
+			"app_version    string null, "+
+			"execution_time_ms int8 null, "+
+			"primary key (id)"+
+			")", drv.makeEscapedMigrationsTableName(), escapeString(sequenceName)),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+			"name      string not null, "+
+			"holder    string null, "+
+			"heartbeat timestamptz null, "+
+			"primary key (name)"+
+			")", drv.makeEscapedLockTableName()),
+	}
+}
@@ -0,0 +1,62 @@
+package cockroach
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// serializationFailure is the SQLSTATE of transactions that CockroachDB has aborted to keep them serializable.
+// They succeed when they are executed again.
+const serializationFailure = "40001"
+
+const (
+	minRetryDelay = 10 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// sqlStateError is implemented by errors of github.com/lib/pq and github.com/jackc/pgx.
+type sqlStateError interface {
+	SQLState() string
+}
+
+// IsRetryable tells whether err is a serialization failure, after which the transaction should be executed again.
+func IsRetryable(err error) bool {
+	var stateErr sqlStateError
+
+	return errors.As(err, &stateErr) && stateErr.SQLState() == serializationFailure
+}
+
+// retry calls fn until it succeeds, fails with an error that is not a serialization failure, or has been retried
+// DriverConfig.MaxRetries times. Delays between attempts double from minRetryDelay up to maxRetryDelay.
+func (drv *cockroachDriver) retry(ctx context.Context, fn func() error) error {
+	delay := minRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsRetryable(err) || attempt >= drv.maxRetries() {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (drv *cockroachDriver) maxRetries() int {
+	switch {
+	case drv.config.MaxRetries == 0:
+		return DefaultMaxRetries
+	case drv.config.MaxRetries < 0:
+		return 0
+	default:
+		return drv.config.MaxRetries
+	}
+}
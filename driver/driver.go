@@ -1,9 +1,13 @@
 package driver
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
 )
 
 type Driver interface {
@@ -11,4 +15,145 @@ type Driver interface {
 	Migrate(mig migration.Migration, dir migration.Direction, script string) error
 }
 
-var ErrInvalidLogTable = errors.New("an error has occurred when reading log table")
+// ContextDriver is implemented by drivers that accept a context, so that listing the log
+// and applying migrations can be canceled or given a deadline.
+type ContextDriver interface {
+	ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error)
+	MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error
+}
+
+// LogWriter is implemented by drivers that can append an entry to the migrations log
+// without executing any script. It is used to record migrations that were applied by other tools.
+type LogWriter interface {
+	WriteLog(log migration.Log) error
+}
+
+// IncrementalLogReader is implemented by drivers that can fetch only the part of the migrations log
+// that was written after the entry with the given id. Entries are returned in the order they were written.
+type IncrementalLogReader interface {
+	ListMigrationsLogAfter(id uint64) (*[]migration.Log, error)
+}
+
+// StateReader is implemented by drivers that can pick the latest log entry of every version
+// on the database side, so that the whole history doesn't have to be transferred and replayed.
+// Entries are returned in the order they were written.
+type StateReader interface {
+	ListMigrationsState() (*[]migration.Log, error)
+}
+
+// ScriptReader is implemented by drivers that can store executed scripts in the migrations log.
+// ReadExecutedScript returns the script of the log entry with the given id.
+type ScriptReader interface {
+	ReadExecutedScript(logID uint64) (string, error)
+}
+
+// MaxVersionReader is implemented by drivers that can cheaply find the highest version whose latest
+// log entry is Up. The second result is false when no version is applied.
+type MaxVersionReader interface {
+	GetMaxAppliedVersion() (migration.Version, bool, error)
+}
+
+// InterruptedReader is implemented by drivers that record executions of migrations that have started
+// but have not completed, e.g. because of a failure halfway through a script executed in chunks.
+// Entries are returned in the order they were written.
+type InterruptedReader interface {
+	ListInterruptedMigrations() (*[]migration.Log, error)
+}
+
+// RunScoper is implemented by drivers that need to prepare for a migration run and clean up after it,
+// e.g. to hold a dedicated connection. BeginRun is called before the first operation of a run
+// and EndRun after the last one, even if the run has failed.
+type RunScoper interface {
+	BeginRun() error
+	EndRun() error
+}
+
+// Locker is implemented by drivers that can take a lock shared by every process migrating the database.
+// Lock is called after BeginRun and returns ErrLockTimeout when the lock is not acquired within timeout.
+// Unlock is called before EndRun.
+type Locker interface {
+	Lock(timeout time.Duration) error
+	Unlock() error
+}
+
+// Transactor is implemented by drivers that can wrap migrations in transactions. Everything the driver does
+// between BeginTx and CommitTx or RollbackTx, including writing the log, belongs to the transaction.
+// TransactionalDDL tells whether schema changes are rolled back too.
+type Transactor interface {
+	TransactionalDDL() bool
+	BeginTx() error
+	CommitTx() error
+	RollbackTx() error
+}
+
+// FailureRecorder is implemented by drivers that can mark a migration as dirty when its execution is
+// aborted by a panic, so that the state of the database is not mistaken for a clean one. Such migrations
+// are listed by InterruptedReader until they are applied successfully.
+type FailureRecorder interface {
+	RecordFailure(mig migration.Migration, dir migration.Direction, cause error) error
+}
+
+// Canceler is implemented by drivers that can abort the migration that is being applied from another goroutine.
+// CancelMigration has no effect when no migration is being applied.
+type Canceler interface {
+	CancelMigration() error
+}
+
+// ChecksumUpdater is implemented by drivers that can replace the checksum recorded with the latest
+// up entry of a version. It is used by Henka.Repair.
+type ChecksumUpdater interface {
+	UpdateChecksum(version migration.Version, checksum string) error
+}
+
+// LogDeleter is implemented by drivers that can remove every log entry of a version. It is used by Henka.Repair.
+type LogDeleter interface {
+	DeleteLog(version migration.Version) error
+}
+
+// RepeatableMigrator is implemented by drivers that can track repeatable migrations apart from versioned ones.
+// ListRepeatableChecksums returns the checksum of the latest execution of every repeatable migration by name.
+// MigrateRepeatable executes the script and records its checksum.
+type RepeatableMigrator interface {
+	ListRepeatableChecksums() (map[string]string, error)
+	MigrateRepeatable(name string, script string) error
+}
+
+// FuncMigrator is implemented by drivers that can apply migrations written in Go. MigrateFunc begins
+// a transaction, calls fn with it and writes the log entry in the same transaction.
+type FuncMigrator interface {
+	MigrateFunc(ctx context.Context, mig migration.Migration, dir migration.Direction, fn migration.Func) error
+}
+
+// SchemaDumper is implemented by drivers that can describe the current structure of the database.
+// The migrations log table is not included into the dump.
+type SchemaDumper interface {
+	DumpSchema() (*schema.Schema, error)
+}
+
+// StatementError is returned by drivers when a statement of a migration script fails.
+// Index is the zero-based position of the statement in the script, -1 when the driver executes
+// the script as a whole and Statement holds the entire script then.
+type StatementError struct {
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e *StatementError) Error() string {
+	if e.Index < 0 {
+		return e.Err.Error()
+	}
+
+	return fmt.Sprintf("statement %d: %s", e.Index+1, e.Err.Error())
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrInvalidLogTable = errors.New("an error has occurred when reading log table")
+	ErrRunInProgress   = errors.New("another migration run is in progress")
+	ErrLockTimeout     = errors.New("timed out waiting for the migration lock")
+	ErrLockLost        = errors.New("the migration lock was lost during the run")
+)
@@ -0,0 +1,49 @@
+package driver
+
+import (
+	"os"
+	"os/user"
+	"runtime/debug"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Executor is who writes log entries, recorded by drivers in the applied_by, hostname and app_version
+// columns of the migrations log, to tell who has applied a migration. Drivers take AppliedBy and AppVersion
+// from their config, see NewExecutor.
+type Executor struct {
+	AppliedBy  string
+	Hostname   string
+	AppVersion string
+}
+
+// NewExecutor takes the identity and the version given in the config of a driver, falling back to the OS user
+// and the version of the main module of the binary.
+func NewExecutor(appliedBy string, appVersion string) Executor {
+	result := Executor{AppliedBy: appliedBy, AppVersion: appVersion}
+
+	if result.AppliedBy == "" {
+		if current, err := user.Current(); err == nil {
+			result.AppliedBy = current.Username
+		}
+	}
+
+	if result.AppVersion == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			result.AppVersion = info.Main.Version
+		}
+	}
+
+	result.Hostname, _ = os.Hostname()
+
+	return result
+}
+
+// ForLog prefers the executor recorded in the entry, e.g. by an importer, to the one of the driver.
+func (e Executor) ForLog(log migration.Log) Executor {
+	if log.AppliedBy == "" && log.Hostname == "" && log.AppVersion == "" {
+		return e
+	}
+
+	return Executor{AppliedBy: log.AppliedBy, Hostname: log.Hostname, AppVersion: log.AppVersion}
+}
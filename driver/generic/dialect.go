@@ -0,0 +1,54 @@
+package generic
+
+// Dialect describes the SQL of a database to the generic driver, so that a database that has a database/sql
+// driver can be migrated without a driver of its own.
+type Dialect interface {
+	// QuoteIdentifier quotes a table name, e.g. "name" or `name`.
+	QuoteIdentifier(name string) string
+
+	// Placeholder returns the placeholder of the query argument at the one-based position, e.g. ? or $1.
+	Placeholder(position int) string
+
+	// CreateLogTable returns the DDL that creates the migrations log table with the quoted name unless it exists.
+	// The table needs these columns, see PostgresLogTable for an example:
+	//
+	//   id                integer, primary key; assigned by the driver
+	//   version           64-bit integer
+	//   migration_name    string
+	//   direction         string of at least 1 character
+	//   start_time        timestamp
+	//   end_time          nullable timestamp
+	//   run_id            nullable string
+	//   checksum          nullable string
+	//   applied_by        nullable string
+	//   hostname          nullable string
+	//   app_version       nullable string
+	//   execution_time_ms nullable 64-bit integer
+	//
+	// Timestamps must be read back as time.Time by the database/sql driver.
+	CreateLogTable(table string) string
+
+	// Now returns the expression of the current time of the database, e.g. CURRENT_TIMESTAMP.
+	Now() string
+
+	// LockStrategy returns how runs of several processes are kept apart, nil if they are not.
+	// It is called once by NewDriver.
+	LockStrategy() LockStrategy
+}
+
+// PostgresLogTable is the DDL of the log table for PostgreSQL, with %s for the table name.
+// It is an example for CreateLogTable of other dialects.
+const PostgresLogTable = "CREATE TABLE IF NOT EXISTS %s (" +
+	"id                bigint       NOT NULL PRIMARY KEY, " +
+	"version           bigint       NOT NULL, " +
+	"migration_name    varchar(255) NOT NULL, " +
+	"direction         varchar(4)   NOT NULL, " +
+	"start_time        timestamptz  NOT NULL, " +
+	"end_time          timestamptz, " +
+	"run_id            varchar(64), " +
+	"checksum          varchar(128), " +
+	"applied_by        varchar(255), " +
+	"hostname          varchar(255), " +
+	"app_version       varchar(255), " +
+	"execution_time_ms bigint" +
+	")"
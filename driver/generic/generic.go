@@ -0,0 +1,393 @@
+package generic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/sqlscript"
+)
+
+type DriverConfig struct {
+	MigrationsTableName string
+
+	// SkipLogTableCreation disables Dialect.CreateLogTable, for users that lack the privilege to create tables.
+	// The table must be created beforehand then.
+	SkipLogTableCreation bool
+
+	// SplitStatements makes Migrate execute scripts statement by statement, for database/sql drivers that
+	// don't accept several statements in one call. See sqlscript.Split.
+	SplitStatements bool
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+// maxAppendAttempts limits how many times a log entry is given the next ID after other writers have taken it.
+const maxAppendAttempts = 10
+
+var ErrLogContention = errors.New("failed to take an ID for the log entry, as other writers keep taking them")
+
+// Execer is the connection the driver needs. It is satisfied by *sql.DB, *sql.Conn, *sqlx.DB and instrumented
+// wrappers. Connections that implement Conn like *sql.DB are needed to run all migrations of a run
+// on a dedicated connection.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type connPool interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+type genericDriver struct {
+	pool    Execer
+	dialect Dialect
+	locker  LockStrategy
+	config  DriverConfig
+
+	// pinned is the connection dedicated to the current run, nil outside of runs
+	pinned *sql.Conn
+	mutex  sync.Mutex
+
+	// tableExists is set once the migrations log table has been created or found
+	tableExists bool
+
+	executor driver.Executor
+}
+
+// NewDriver returns a driver that executes scripts through any database/sql connection, given the dialect
+// of the database. It covers the log, runs and locks, but none of the optional features of full drivers.
+func NewDriver(conn Execer, dialect Dialect, config DriverConfig) driver.Driver {
+	return &genericDriver{
+		pool:     conn,
+		dialect:  dialect,
+		locker:   dialect.LockStrategy(),
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+// BeginRun takes a dedicated connection from the pool, so that session state and session locks of one run
+// live on the same connection. Connections that are not pools are used as is.
+func (drv *genericDriver) BeginRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return driver.ErrRunInProgress
+	}
+
+	pool, ok := drv.pool.(connPool)
+	if !ok {
+		return nil
+	}
+
+	conn, err := pool.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to take a dedicated connection: %w", err)
+	}
+
+	drv.pinned = conn
+
+	return nil
+}
+
+// EndRun returns the dedicated connection to the pool.
+func (drv *genericDriver) EndRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned == nil {
+		return nil
+	}
+
+	err := drv.pinned.Close()
+	drv.pinned = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to release the dedicated connection: %w", err)
+	}
+
+	return nil
+}
+
+// db returns the connection of the current run, or the pool outside of runs.
+func (drv *genericDriver) db() Execer {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return drv.pinned
+	}
+
+	return drv.pool
+}
+
+func (drv *genericDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *genericDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	if err := drv.ensureMigrationsTableExists(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := drv.db().QueryContext(ctx, fmt.Sprintf(
+		"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms FROM %s ORDER BY id",
+		drv.makeEscapedMigrationsTableName(),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+	defer rows.Close()
+
+	result, err := fetchMigrationsLog(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func fetchMigrationsLog(rows *sql.Rows) ([]migration.Log, error) {
+	result := make([]migration.Log, 0)
+
+	for rows.Next() {
+		var log migration.Log
+		var direction string
+		var finishedAt sql.NullTime
+		var runID, checksum, appliedBy, hostname, appVersion sql.NullString
+		var executionTime sql.NullInt64
+
+		err := rows.Scan(&log.ID, &log.Version, &log.Name, &direction, &log.AppliedAt, &finishedAt, &runID, &checksum,
+			&appliedBy, &hostname, &appVersion, &executionTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+		}
+
+		if log.Direction, err = decodeDirection(direction); err != nil {
+			return nil, err
+		}
+
+		log.RunID = runID.String
+		log.Checksum = checksum.String
+		log.Baseline = log.Name == migration.BaselineName
+		log.AppliedBy = appliedBy.String
+		log.Hostname = hostname.String
+		log.AppVersion = appVersion.String
+		log.ExecutionTime = time.Duration(executionTime.Int64) * time.Millisecond
+		log.AppliedAt = log.AppliedAt.UTC()
+
+		if finishedAt.Valid {
+			log.FinishedAt = finishedAt.Time.UTC()
+		}
+
+		result = append(result, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+	}
+
+	return result, nil
+}
+
+func (drv *genericDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext executes the script in a single call, or statement by statement with DriverConfig.SplitStatements.
+// Scripts are not wrapped in transactions, so statements before a failed one stay applied unless the script
+// has transactions of its own.
+func (drv *genericDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	held := drv.currentLease()
+	if err := held.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := held.Bind(ctx)
+	defer cancel()
+
+	if err := drv.ensureMigrationsTableExists(ctx); err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+
+	if err := drv.execScript(ctx, script); err != nil {
+		return err
+	}
+
+	err := drv.appendLog(ctx, migration.Log{
+		Migration:     mig,
+		Direction:     dir,
+		AppliedAt:     startTime,
+		FinishedAt:    time.Now(),
+		Checksum:      migration.Checksum([]byte(script)),
+		ExecutionTime: time.Since(startTime),
+	}, drv.executor)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *genericDriver) execScript(ctx context.Context, script string) error {
+	if !drv.config.SplitStatements {
+		if _, err := drv.db().ExecContext(ctx, script); err != nil {
+			return &driver.StatementError{Index: -1, Statement: script, Err: err}
+		}
+
+		return nil
+	}
+
+	for i, statement := range sqlscript.Split(script) {
+		if _, err := drv.db().ExecContext(ctx, statement); err != nil {
+			return &driver.StatementError{Index: i, Statement: statement, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func (drv *genericDriver) WriteLog(log migration.Log) error {
+	ctx := context.Background()
+
+	if err := drv.ensureMigrationsTableExists(ctx); err != nil {
+		return err
+	}
+
+	if log.FinishedAt.IsZero() {
+		log.FinishedAt = log.AppliedAt
+	}
+
+	if err := drv.appendLog(ctx, log, drv.executor.ForLog(log)); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// appendLog inserts the entry with the ID after the latest one, as there is no portable way to generate IDs.
+// The insert fails on the primary key when another writer has taken the ID in the meantime; the next ID
+// is tried then. Other failures are returned as is.
+func (drv *genericDriver) appendLog(ctx context.Context, log migration.Log, executor driver.Executor) error {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	placeholders := make([]string, 12) //nolint:gomnd
+	for i := range placeholders {
+		placeholders[i] = drv.dialect.Placeholder(i + 1)
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (id, version, migration_name, direction, start_time, end_time, run_id, "+
+		"checksum, applied_by, hostname, app_version, execution_time_ms) VALUES (%s)",
+		tableName, strings.Join(placeholders, ", "),
+	)
+
+	lastID, err := drv.lastLogID(ctx)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		_, err = drv.db().ExecContext(ctx, insert,
+			lastID+1,
+			int64(log.Version),
+			log.Name,
+			encodeDirection(log.Direction),
+			log.AppliedAt.UTC(),
+			log.FinishedAt.UTC(),
+			log.RunID,
+			log.Checksum,
+			executor.AppliedBy,
+			executor.Hostname,
+			executor.AppVersion,
+			log.ExecutionTime.Milliseconds(),
+		)
+		if err == nil {
+			return nil
+		}
+
+		latestID, lastErr := drv.lastLogID(ctx)
+		if lastErr != nil || latestID == lastID {
+			return err //nolint:wrapcheck
+		}
+
+		lastID = latestID
+	}
+
+	return ErrLogContention
+}
+
+func (drv *genericDriver) lastLogID(ctx context.Context) (int64, error) {
+	rows, err := drv.db().QueryContext(ctx,
+		fmt.Sprintf("SELECT COALESCE(MAX(id), 0) FROM %s", drv.makeEscapedMigrationsTableName()))
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+	defer rows.Close()
+
+	var lastID int64
+	if rows.Next() {
+		if err = rows.Scan(&lastID); err != nil {
+			return 0, err //nolint:wrapcheck
+		}
+	}
+
+	return lastID, rows.Err() //nolint:wrapcheck
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
+
+func (drv *genericDriver) makeEscapedMigrationsTableName() string {
+	return drv.dialect.QuoteIdentifier(drv.config.MigrationsTableName)
+}
+
+func (drv *genericDriver) ensureMigrationsTableExists(ctx context.Context) error {
+	drv.mutex.Lock()
+	exists := drv.tableExists || drv.config.SkipLogTableCreation
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if _, err := drv.db().ExecContext(ctx, drv.dialect.CreateLogTable(tableName)); err != nil {
+		return fmt.Errorf("failed to create migrations table %s: %w", tableName, err)
+	}
+
+	drv.mutex.Lock()
+	drv.tableExists = true
+	drv.mutex.Unlock()
+
+	return nil
+}
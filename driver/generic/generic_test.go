@@ -0,0 +1,404 @@
+//nolint:gochecknoglobals
+package generic_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/generic"
+	"github.com/root-talis/henka/migration"
+)
+
+// PostgreSQL versions to test against
+var versions = []string{
+	"postgres:14",
+	"postgres:13",
+}
+
+//
+// -- bootstrap --------------------------------------
+//
+
+type testContainer struct {
+	sync.Mutex
+	ctx       context.Context
+	container testcontainers.Container
+	conn      *sql.DB
+}
+
+var containers = make(map[string]*testContainer)
+
+func TestMain(m *testing.M) {
+	failed := false
+	waitGroup := sync.WaitGroup{}
+
+	for _, version := range versions {
+		version := version
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+			if err := setupTestContainer(version); err != nil {
+				failed = true
+				fmt.Printf("error when creating test container for version %s: %s\n", version, err) //nolint:forbidigo
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	var exitCode int
+	if !failed {
+		exitCode = m.Run()
+	} else {
+		exitCode = -1
+	}
+
+	for version, container := range containers {
+		container := container
+		version := version
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := shutdownTestContainer(version, container); err != nil {
+				fmt.Printf("error when cleaning up container %s: %s\n", version, err) //nolint:forbidigo
+				exitCode = -1
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	os.Exit(exitCode)
+}
+
+func setupTestContainer(version string) error {
+	ctx := context.Background()
+	postgresC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        version,
+			ExposedPorts: []string{"5432/tcp"},
+			Env:          map[string]string{"POSTGRES_PASSWORD": "test"},
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort("5432"),
+				wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+			),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", version, err)
+	}
+
+	container := testContainer{
+		ctx:       ctx,
+		container: postgresC,
+	}
+	containers[version] = &container
+
+	endpoint, err := postgresC.Endpoint(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to get endpoint for test container %s: %w", version, err)
+	}
+
+	conn, err := sql.Open("postgres", fmt.Sprintf("postgres://postgres:test@%s/postgres?sslmode=disable", endpoint))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database in container %s: %w", version, err)
+	}
+
+	container.conn = conn
+
+	return nil
+}
+
+func shutdownTestContainer(version string, container *testContainer) error {
+	fmt.Printf("cleanup %s...\n", version) //nolint:forbidigo
+	container.Lock()
+	defer container.Unlock()
+
+	if container.conn != nil {
+		err := container.conn.Close()
+		if err != nil {
+			return fmt.Errorf("failed to close connection to test database %s: %w", version, err)
+		}
+	}
+
+	err := container.container.Terminate(container.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to terminate test container %s: %w", version, err)
+	}
+
+	fmt.Printf("cleanup %s done\n", version) //nolint:forbidigo
+	return nil
+}
+
+//
+// -- dialect ----------------------------------------
+//
+
+type postgresDialect struct {
+	lockStrategy generic.LockStrategy
+}
+
+func (postgresDialect) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (postgresDialect) Placeholder(position int) string {
+	return fmt.Sprintf("$%d", position)
+}
+
+func (postgresDialect) CreateLogTable(table string) string {
+	return fmt.Sprintf(generic.PostgresLogTable, table)
+}
+
+func (postgresDialect) Now() string {
+	return "now()"
+}
+
+func (d postgresDialect) LockStrategy() generic.LockStrategy {
+	return d.lockStrategy
+}
+
+func newSessionLockDialect() postgresDialect {
+	return postgresDialect{lockStrategy: generic.SessionLock{
+		TryLockQuery: "SELECT pg_try_advisory_lock(hashtext($1))",
+		UnlockQuery:  "SELECT pg_advisory_unlock(hashtext($1))",
+	}}
+}
+
+func newLeaseLockDialect() postgresDialect {
+	return postgresDialect{lockStrategy: &generic.LeaseLock{
+		Table:       "migrations_lock",
+		CreateTable: "CREATE TABLE IF NOT EXISTS migrations_lock (name text PRIMARY KEY, holder text, heartbeat timestamptz)",
+		TTL:         3 * time.Second,
+	}}
+}
+
+//
+// -- templates --------------------------------------
+//
+
+var (
+	defaultDriverConfig = generic.DriverConfig{
+		MigrationsTableName: "migrations_log",
+		AppliedBy:           "tester",
+		AppVersion:          "v1.0.0",
+	}
+
+	migration1Parsed = migration.Log{
+		ID:         1,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 500000000, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+	migration2Parsed = migration.Log{
+		ID:         2,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+
+	migrationScript1 = "CREATE TABLE users (id int PRIMARY KEY, name text);\n" +
+		"INSERT INTO users (id, name) VALUES (1, 'semi;colon');"
+	migrationScript2 = "DROP TABLE users"
+)
+
+//
+// --- tests -----------------------------------------
+//
+
+func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/generic")
+	}
+
+	runForAllPostgresVersions(t, "ListMigrationsLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer dropTables(t, conn)
+
+		drv := generic.NewDriver(conn, newSessionLockDialect(), defaultDriverConfig)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+
+		_, err = conn.Exec("INSERT INTO migrations_log (id, version, migration_name, direction, start_time) VALUES (1, 1, '', 'x', now())")
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestMigrate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/generic")
+	}
+
+	runForAllPostgresVersions(t, "Migrate", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer dropTables(t, conn)
+
+		config := defaultDriverConfig
+		config.SplitStatements = true
+
+		drv := generic.NewDriver(conn, newSessionLockDialect(), config)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		var name string
+		assert.NoError(t, conn.QueryRow("SELECT name FROM users WHERE id = 1").Scan(&name))
+		assert.Equal(t, "semi;colon", name)
+
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Down, migrationScript2))
+
+		err := drv.Migrate(migration1Parsed.Migration, migration.Up, "CREATE TABLE users (id int);\nINSERT INTO nowhere VALUES (1);")
+
+		var statementErr *driver.StatementError
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+		}
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Equal(t, uint64(1), (*actualLog)[0].ID)
+			assert.Equal(t, migration.Up, (*actualLog)[0].Direction)
+			assert.Equal(t, migration.Checksum([]byte(migrationScript1)), (*actualLog)[0].Checksum)
+			assert.Equal(t, "tester", (*actualLog)[0].AppliedBy)
+			assert.WithinDuration(t, time.Now(), (*actualLog)[0].AppliedAt, time.Minute)
+			assert.Equal(t, uint64(2), (*actualLog)[1].ID)
+			assert.Equal(t, migration.Down, (*actualLog)[1].Direction)
+		}
+	})
+}
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/generic")
+	}
+
+	runForAllPostgresVersions(t, "WriteLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer dropTables(t, conn)
+
+		drv := generic.NewDriver(conn, newSessionLockDialect(), defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("generic driver must implement driver.LogWriter")
+		}
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(migration2Parsed))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *actualLog)
+	})
+}
+
+func TestSessionLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/generic")
+	}
+
+	runForAllPostgresVersions(t, "SessionLock", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer dropTables(t, conn)
+
+		first := generic.NewDriver(conn, newSessionLockDialect(), defaultDriverConfig)
+		second := generic.NewDriver(conn, newSessionLockDialect(), defaultDriverConfig)
+
+		assert.NoError(t, first.(driver.RunScoper).BeginRun())
+		assert.NoError(t, second.(driver.RunScoper).BeginRun())
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+
+		assert.NoError(t, first.(driver.RunScoper).EndRun())
+		assert.NoError(t, second.(driver.RunScoper).EndRun())
+	})
+}
+
+func TestLeaseLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/generic")
+	}
+
+	runForAllPostgresVersions(t, "LeaseLock", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer dropTables(t, conn)
+
+		first := generic.NewDriver(conn, newLeaseLockDialect(), defaultDriverConfig)
+		second := generic.NewDriver(conn, newLeaseLockDialect(), defaultDriverConfig)
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		// the heartbeat keeps the lease beyond its TTL
+		time.Sleep(4 * time.Second)
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+	})
+}
+
+//
+// --- utility stuff ---------------------------------
+//
+
+func runForAllPostgresVersions(t *testing.T, baseName string, test func(t *testing.T, version string, conn *sql.DB)) {
+	t.Helper()
+
+	for version, container := range containers {
+		container := container
+		version := version
+		testName := fmt.Sprintf("%s@%s", baseName, version)
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			container.Lock()
+			defer container.Unlock()
+
+			test(t, version, container.conn)
+		})
+	}
+}
+
+func dropTables(t *testing.T, conn *sql.DB) {
+	t.Helper()
+
+	if _, err := conn.Exec("DROP TABLE IF EXISTS migrations_log, migrations_lock, users"); err != nil {
+		t.Fatalf("falied to drop tables after test: %s", err)
+	}
+}
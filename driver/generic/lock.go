@@ -0,0 +1,303 @@
+package generic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver/lease"
+)
+
+// DefaultLeaseTTL is the TTL of LeaseLock when it is zero.
+const DefaultLeaseTTL = 30 * time.Second
+
+// LockStrategy takes the lock shared by every process migrating the database. Lock returns driver.ErrLockTimeout
+// when the lock is not acquired within timeout.
+type LockStrategy interface {
+	Lock(ctx context.Context, target LockTarget, timeout time.Duration) error
+	Unlock(ctx context.Context, target LockTarget) error
+}
+
+// LockTarget is what a LockStrategy locks and the connections it can use.
+type LockTarget struct {
+	// Name is the name of the migrations table.
+	Name string
+
+	// Session is the dedicated connection of the run, for locks that belong to a session.
+	// Pool is the connection given to NewDriver, for locks that are refreshed while migrations run.
+	Session Execer
+	Pool    Execer
+
+	Dialect Dialect
+}
+
+func (drv *genericDriver) Lock(timeout time.Duration) error {
+	if drv.locker == nil {
+		return nil
+	}
+
+	return drv.locker.Lock(context.Background(), drv.lockTarget(), timeout) //nolint:wrapcheck
+}
+
+func (drv *genericDriver) Unlock() error {
+	if drv.locker == nil {
+		return nil
+	}
+
+	return drv.locker.Unlock(context.Background(), drv.lockTarget()) //nolint:wrapcheck
+}
+
+// currentLease is the lease held by a LeaseLock between Lock and Unlock, nil with other strategies.
+func (drv *genericDriver) currentLease() *lease.Lease {
+	if leaseLock, ok := drv.locker.(*LeaseLock); ok {
+		return leaseLock.heldLease()
+	}
+
+	return nil
+}
+
+func (drv *genericDriver) lockTarget() LockTarget {
+	return LockTarget{Name: drv.config.MigrationsTableName, Session: drv.db(), Pool: drv.pool, Dialect: drv.dialect}
+}
+
+// SessionLock takes a lock that belongs to the connection of the run by polling TryLockQuery until it returns
+// true, and releases it with UnlockQuery. Both queries get the name of the migrations table as their only argument,
+// e.g. "SELECT pg_try_advisory_lock(hashtext($1))" and "SELECT pg_advisory_unlock(hashtext($1))" on PostgreSQL.
+type SessionLock struct {
+	TryLockQuery string
+	UnlockQuery  string
+}
+
+func (l SessionLock) Lock(ctx context.Context, target LockTarget, timeout time.Duration) error {
+	return lease.Acquire(timeout, func() (bool, error) { //nolint:wrapcheck
+		return queryBool(ctx, target.Session, l.TryLockQuery, target.Name)
+	})
+}
+
+func (l SessionLock) Unlock(ctx context.Context, target LockTarget) error {
+	if _, err := target.Session.ExecContext(ctx, l.UnlockQuery, target.Name); err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	return nil
+}
+
+func queryBool(ctx context.Context, db Execer, query string, args ...interface{}) (bool, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+	defer rows.Close()
+
+	var result sql.NullBool
+	if rows.Next() {
+		if err = rows.Scan(&result); err != nil {
+			return false, err //nolint:wrapcheck
+		}
+	}
+
+	return result.Bool, rows.Err() //nolint:wrapcheck
+}
+
+// LeaseLock takes a lease row named after the migrations table in Table, for databases without session locks
+// or behind proxies that don't keep sessions. The lease is refreshed through the pool, see package lease, and
+// migrations of a driver whose lease has been lost fail with driver.ErrLockLost.
+// Times come from Dialect.Now, so that clocks of the instances don't matter.
+//
+// Table needs a name string primary key, a nullable holder string and a nullable heartbeat timestamp column.
+// CreateTable is executed before the first lock when set, and must do nothing when the table exists.
+// A LeaseLock holds one lease at a time and must not be shared by drivers.
+type LeaseLock struct {
+	Table       string
+	CreateTable string
+	TTL         time.Duration
+
+	mutex       sync.Mutex
+	tableExists bool
+	held        *lease.Lease
+}
+
+func (l *LeaseLock) Lock(ctx context.Context, target LockTarget, timeout time.Duration) error {
+	if err := l.ensureTableExists(ctx, target); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	holder := lease.NewHolder(hostname)
+
+	err := lease.Acquire(timeout, func() (bool, error) {
+		return l.tryLock(ctx, target, holder)
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	held := lease.Start(holder, l.ttl(), func() (bool, error) {
+		return l.refresh(target, holder)
+	}, nil)
+
+	l.mutex.Lock()
+	l.held = held
+	l.mutex.Unlock()
+
+	return nil
+}
+
+// tryLock inserts the lease row when there is none, and takes it over when it is free or expired. Whether
+// it has expired is told by the database clock; the update only succeeds when nobody has taken it in the meantime.
+func (l *LeaseLock) tryLock(ctx context.Context, target LockTarget, holder string) (bool, error) {
+	dialect := target.Dialect
+	table := dialect.QuoteIdentifier(l.Table)
+
+	rows, err := target.Pool.QueryContext(ctx,
+		fmt.Sprintf("SELECT holder, heartbeat, %s FROM %s WHERE name = %s", dialect.Now(), table, dialect.Placeholder(1)),
+		target.Name,
+	)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	var found bool
+	var currentHolder sql.NullString
+	var heartbeat sql.NullTime
+	var now time.Time
+
+	if rows.Next() {
+		found = true
+		err = rows.Scan(&currentHolder, &heartbeat, &now)
+	}
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	_ = rows.Close()
+
+	switch {
+	case err != nil:
+		return false, err //nolint:wrapcheck
+	case !found:
+		_, err = target.Pool.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (name, holder, heartbeat) VALUES (%s, %s, %s)",
+				table, dialect.Placeholder(1), dialect.Placeholder(2), dialect.Now()),
+			target.Name,
+			holder,
+		)
+
+		// the insert fails when another instance has inserted the row in the meantime, which is found next time
+		return err == nil, nil
+	case currentHolder.Valid && heartbeat.Valid && now.Sub(heartbeat.Time) < l.ttl():
+		return false, nil
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET holder = %s, heartbeat = %s WHERE name = %s AND holder IS NULL",
+		table, dialect.Placeholder(1), dialect.Now(), dialect.Placeholder(2))
+	args := []interface{}{holder, target.Name}
+
+	if currentHolder.Valid {
+		query = fmt.Sprintf("UPDATE %s SET holder = %s, heartbeat = %s WHERE name = %s AND holder = %s",
+			table, dialect.Placeholder(1), dialect.Now(), dialect.Placeholder(2), dialect.Placeholder(3))
+		args = append(args, currentHolder.String)
+	}
+
+	result, err := target.Pool.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	updated, err := result.RowsAffected()
+
+	return updated > 0, err //nolint:wrapcheck
+}
+
+// Unlock stops the heartbeat and frees the lease row, see lease.Lease.Release.
+func (l *LeaseLock) Unlock(ctx context.Context, target LockTarget) error {
+	l.mutex.Lock()
+	held := l.held
+	l.held = nil
+	l.mutex.Unlock()
+
+	return held.Release(func() (bool, error) { //nolint:wrapcheck
+		dialect := target.Dialect
+
+		result, err := target.Pool.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET holder = NULL WHERE name = %s AND holder = %s",
+				dialect.QuoteIdentifier(l.Table), dialect.Placeholder(1), dialect.Placeholder(2)),
+			target.Name,
+			held.Holder,
+		)
+		if err != nil {
+			return false, err //nolint:wrapcheck
+		}
+
+		released, err := result.RowsAffected()
+
+		return err != nil || released > 0, nil
+	})
+}
+
+// refresh moves the heartbeat of the lease forward and reports whether the lease row is still held by the holder.
+func (l *LeaseLock) refresh(target LockTarget, holder string) (bool, error) {
+	ctx := context.Background()
+	dialect := target.Dialect
+	table := dialect.QuoteIdentifier(l.Table)
+
+	result, err := target.Pool.ExecContext(ctx,
+		fmt.Sprintf("UPDATE %s SET heartbeat = %s WHERE name = %s AND holder = %s",
+			table, dialect.Now(), dialect.Placeholder(1), dialect.Placeholder(2)),
+		target.Name,
+		holder,
+	)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated > 0 {
+		return true, nil
+	}
+
+	// some databases, e.g. MySQL, don't count rows whose values have not changed; name is the primary key,
+	// so the count is 0 or 1, which scans as a bool
+	return queryBool(ctx, target.Pool,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE name = %s AND holder = %s",
+			table, dialect.Placeholder(1), dialect.Placeholder(2)),
+		target.Name,
+		holder,
+	)
+}
+
+// heldLease is the lease held between Lock and Unlock, nil when the lock is not held.
+func (l *LeaseLock) heldLease() *lease.Lease {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.held
+}
+
+func (l *LeaseLock) ensureTableExists(ctx context.Context, target LockTarget) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.tableExists || l.CreateTable == "" {
+		return nil
+	}
+
+	if _, err := target.Pool.ExecContext(ctx, l.CreateTable); err != nil {
+		return fmt.Errorf("failed to create lock table %s: %w", l.Table, err)
+	}
+
+	l.tableExists = true
+
+	return nil
+}
+
+func (l *LeaseLock) ttl() time.Duration {
+	if l.TTL <= 0 {
+		return DefaultLeaseTTL
+	}
+
+	return l.TTL
+}
@@ -0,0 +1,187 @@
+// Package lease keeps migration locks that expire unless their holder refreshes them, for drivers of databases
+// without session locks. A holder refreshes its lock every TTL/3, so that the lock is only taken over after
+// the holder has crashed or lost the database for TTL. The lease is lost then: drivers cancel the running migration,
+// and the migrations that follow and the release of the lock fail with driver.ErrLockLost.
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+)
+
+// PollInterval is how often Acquire tries to take a lock held by another instance.
+const PollInterval = 500 * time.Millisecond
+
+// NewHolder identifies the instance holding a lock by a random token, its process ID and hostname.
+func NewHolder(hostname string) string {
+	token := make([]byte, 8) //nolint:gomnd
+	_, _ = rand.Read(token)
+
+	return fmt.Sprintf("%s:%d:%s", hex.EncodeToString(token), os.Getpid(), hostname)
+}
+
+// Acquire calls try every PollInterval until it takes the lock, and fails with driver.ErrLockTimeout
+// once timeout has passed. try reports whether the lock has been taken.
+func Acquire(timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		taken, err := try()
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+
+		if taken {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return driver.ErrLockTimeout
+		}
+
+		time.Sleep(PollInterval)
+	}
+}
+
+// Lease is a lock taken by Holder that is refreshed in the background until Release.
+// Its methods may be called on a nil Lease, which stands for no lock.
+type Lease struct {
+	Holder string
+
+	ttl     time.Duration
+	refresh func() (bool, error)
+	onLost  func(error)
+
+	stop chan struct{}
+	done chan struct{}
+
+	mutex    sync.Mutex
+	lost     error
+	lostChan chan struct{}
+}
+
+// Start refreshes the lock taken by holder with refresh every ttl/3. refresh reports whether the lock
+// is still held by holder; its errors are tried again on the next tick. The lease is lost when the lock
+// has been taken over or not refreshed for ttl, and onLost, if not nil, is called then, e.g. to kill
+// the running statement.
+func Start(holder string, ttl time.Duration, refresh func() (bool, error), onLost func(error)) *Lease {
+	result := &Lease{
+		Holder:   holder,
+		ttl:      ttl,
+		refresh:  refresh,
+		onLost:   onLost,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		lostChan: make(chan struct{}),
+	}
+
+	go result.heartbeat()
+
+	return result
+}
+
+// Release stops refreshing the lock and frees it with release, which reports whether the lock was still held.
+// It returns the error the lease has been lost with, or driver.ErrLockLost when release finds the lock taken over,
+// as the run may not have been protected from other instances then.
+func (l *Lease) Release(release func() (bool, error)) error {
+	if l == nil {
+		return nil
+	}
+
+	close(l.stop)
+	<-l.done
+
+	held, err := release()
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	if lost := l.Err(); lost != nil {
+		return lost
+	}
+
+	if !held {
+		return fmt.Errorf("%w: taken over from %s", driver.ErrLockLost, l.Holder)
+	}
+
+	return nil
+}
+
+// Err returns the error the lease has been lost with, wrapping driver.ErrLockLost, or nil while it is held.
+func (l *Lease) Err() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.lost
+}
+
+// Bind returns a context that is canceled when the lease is lost, so that the running migration is stopped.
+func (l *Lease) Bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if l == nil {
+		return ctx, cancel
+	}
+
+	go func() {
+		select {
+		case <-l.lostChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+func (l *Lease) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3) //nolint:gomnd
+	defer ticker.Stop()
+
+	refreshed := time.Now()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		held, err := l.refresh()
+
+		switch {
+		case err == nil && held:
+			refreshed = time.Now()
+		case err == nil:
+			l.lose(fmt.Errorf("%w: taken over from %s", driver.ErrLockLost, l.Holder))
+			return
+		case time.Since(refreshed) >= l.ttl:
+			l.lose(fmt.Errorf("%w: not refreshed for %s, the last attempt has failed with %v", driver.ErrLockLost, l.ttl, err))
+			return
+		}
+	}
+}
+
+func (l *Lease) lose(err error) {
+	l.mutex.Lock()
+	l.lost = err
+	l.mutex.Unlock()
+
+	close(l.lostChan)
+
+	if l.onLost != nil {
+		l.onLost(err)
+	}
+}
@@ -0,0 +1,100 @@
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
+)
+
+const testTTL = 30 * time.Millisecond
+
+var errRefresh = errors.New("refresh failed")
+
+func TestAcquire(t *testing.T) {
+	t.Parallel()
+
+	attempts := 0
+	err := lease.Acquire(time.Minute, func() (bool, error) {
+		attempts++
+		return attempts == 2, nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	err = lease.Acquire(0, func() (bool, error) { return false, nil })
+	assert.ErrorIs(t, err, driver.ErrLockTimeout)
+
+	err = lease.Acquire(time.Minute, func() (bool, error) { return false, errRefresh })
+	assert.ErrorIs(t, err, errRefresh)
+}
+
+func TestRelease(t *testing.T) {
+	t.Parallel()
+
+	var refreshes int32
+
+	held := lease.Start("holder", testTTL, func() (bool, error) {
+		atomic.AddInt32(&refreshes, 1)
+		return true, nil
+	}, nil)
+
+	time.Sleep(testTTL)
+
+	assert.NoError(t, held.Err())
+	assert.NoError(t, held.Release(func() (bool, error) { return true, nil }))
+	assert.Positive(t, atomic.LoadInt32(&refreshes), "the lease must be refreshed while it is held")
+
+	held = lease.Start("holder", testTTL, func() (bool, error) { return true, nil }, nil)
+	assert.ErrorIs(t, held.Release(func() (bool, error) { return false, nil }), driver.ErrLockLost,
+		"a lock that is not held at release must be reported as lost")
+
+	var nothing *lease.Lease
+	assert.NoError(t, nothing.Err())
+	assert.NoError(t, nothing.Release(func() (bool, error) { return false, errRefresh }))
+}
+
+var lostTestsTable = []struct { // nolint:gochecknoglobals
+	name    string
+	refresh func() (bool, error)
+}{
+	/* s0 */ {name: "taken over", refresh: func() (bool, error) { return false, nil }},
+	/* s1 */ {name: "not refreshed", refresh: func() (bool, error) { return false, errRefresh }},
+}
+
+func TestLost(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range lostTestsTable {
+		c := c
+
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			lost := make(chan error, 1)
+			held := lease.Start("holder", testTTL, c.refresh, func(err error) { lost <- err })
+
+			ctx, cancel := held.Bind(context.Background())
+			defer cancel()
+
+			select {
+			case err := <-lost:
+				assert.ErrorIs(t, err, driver.ErrLockLost)
+			case <-time.After(time.Second):
+				require.Fail(t, "the lease must be lost")
+			}
+
+			<-ctx.Done()
+			assert.ErrorIs(t, held.Err(), driver.ErrLockLost)
+			assert.ErrorIs(t, held.Release(func() (bool, error) { return true, nil }), driver.ErrLockLost)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package driver
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Middleware wraps a driver, e.g. to log, measure or retry its calls, without changing its implementation.
+type Middleware func(Driver) Driver
+
+// Wrapper is implemented by drivers that wrap another one. Optional interfaces are looked up through
+// the whole chain with As, so that middlewares don't have to implement them. Calls made through such
+// interfaces go straight to the driver that implements them: migrations written in Go (FuncMigrator),
+// repeatable migrations (RepeatableMigrator) and recorded failures (FailureRecorder) are not seen
+// by middlewares. Migrate and ListMigrationsLog always go through the whole chain.
+type Wrapper interface {
+	Unwrap() Driver
+}
+
+// Chain wraps drv with middlewares. The first middleware is the outermost one: it sees every call first.
+func Chain(drv Driver, middlewares ...Middleware) Driver {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		drv = middlewares[i](drv)
+	}
+
+	return drv
+}
+
+// As finds the first driver in the chain of wrapped drivers that implements the interface target points to,
+// and sets target to it. It panics if target is not a non-nil pointer to an interface.
+func As(drv Driver, target interface{}) bool {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Interface {
+		panic("driver: target must be a non-nil pointer to an interface")
+	}
+
+	targetType := value.Type().Elem()
+
+	for drv != nil {
+		if reflect.TypeOf(drv).Implements(targetType) {
+			value.Elem().Set(reflect.ValueOf(drv))
+			return true
+		}
+
+		wrapper, ok := drv.(Wrapper)
+		if !ok {
+			return false
+		}
+
+		drv = wrapper.Unwrap()
+	}
+
+	return false
+}
+
+// MigrateHandler applies a migration, see WrapMigrate.
+type MigrateHandler func(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error
+
+// WrapMigrate creates a middleware that intercepts applying migrations. wrap gets the handler of the wrapped
+// driver and returns the one to be used instead. Other calls go straight to the wrapped driver. Only migrations
+// with scripts are intercepted, see Wrapper.
+func WrapMigrate(wrap func(next MigrateHandler) MigrateHandler) Middleware {
+	return func(drv Driver) Driver {
+		next := func(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+			return drv.Migrate(mig, dir, script)
+		}
+
+		if contextDriver, ok := drv.(ContextDriver); ok {
+			next = contextDriver.MigrateContext
+		}
+
+		return &migrateWrapper{base: drv, handler: wrap(next)}
+	}
+}
+
+type migrateWrapper struct {
+	base    Driver
+	handler MigrateHandler
+}
+
+func (w *migrateWrapper) Unwrap() Driver {
+	return w.base
+}
+
+func (w *migrateWrapper) ListMigrationsLog() (*[]migration.Log, error) {
+	return w.base.ListMigrationsLog() //nolint:wrapcheck
+}
+
+func (w *migrateWrapper) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	if contextDriver, ok := w.base.(ContextDriver); ok {
+		return contextDriver.ListMigrationsLogContext(ctx) //nolint:wrapcheck
+	}
+
+	return w.base.ListMigrationsLog() //nolint:wrapcheck
+}
+
+func (w *migrateWrapper) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return w.handler(context.Background(), mig, dir, script)
+}
+
+func (w *migrateWrapper) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	return w.handler(ctx, mig, dir, script)
+}
+
+// Observe calls fn after every migration with its duration and result, e.g. to log it or to record metrics.
+func Observe(fn func(mig migration.Migration, dir migration.Direction, duration time.Duration, err error)) Middleware {
+	return WrapMigrate(func(next MigrateHandler) MigrateHandler {
+		return func(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+			start := time.Now()
+			err := next(ctx, mig, dir, script)
+			fn(mig, dir, time.Since(start), err)
+
+			return err
+		}
+	})
+}
+
+// WarnSlow calls warn for migrations that have taken longer than threshold.
+func WarnSlow(threshold time.Duration, warn func(mig migration.Migration, dir migration.Direction, duration time.Duration)) Middleware {
+	return Observe(func(mig migration.Migration, dir migration.Direction, duration time.Duration, _ error) {
+		if duration > threshold {
+			warn(mig, dir, duration)
+		}
+	})
+}
+
+// Retry applies a migration again, up to attempts times in total, while it fails with an error retryable
+// accepts, waiting delay between attempts. Only errors that leave the database untouched, such as failures
+// to connect, are safe to retry: MySQL doesn't roll back schema changes of a failed script.
+func Retry(attempts uint, delay time.Duration, retryable func(error) bool) Middleware {
+	return WrapMigrate(func(next MigrateHandler) MigrateHandler {
+		return func(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+			var err error
+
+			for attempt := uint(1); ; attempt++ {
+				err = next(ctx, mig, dir, script)
+				if err == nil || attempt >= attempts || !retryable(err) {
+					return err
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return err
+				case <-timer.C:
+				}
+			}
+		}
+	})
+}
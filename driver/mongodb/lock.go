@@ -0,0 +1,112 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/root-talis/henka/driver/lease"
+)
+
+// Lock takes the lock document of the migrations collection with findAndModify: the document is upserted
+// when it is free or expired, and the upsert fails on the unique _id when another instance holds it.
+// Expiry is computed with $$NOW, so that clocks of the instances don't matter. Needs MongoDB 4.2 or later.
+func (drv *mongoDriver) Lock(timeout time.Duration) error {
+	ctx := context.Background()
+	holder := lease.NewHolder(drv.executor.Hostname)
+
+	err := lease.Acquire(timeout, func() (bool, error) {
+		err := drv.lockCollection().FindOneAndUpdate(ctx,
+			bson.D{
+				{Key: "_id", Value: drv.config.MigrationsCollectionName},
+				{Key: "$or", Value: bson.A{
+					bson.D{{Key: "holder", Value: nil}},
+					bson.D{{Key: "$expr", Value: bson.D{{Key: "$lt", Value: bson.A{"$expires_at", "$$NOW"}}}}},
+				}},
+			},
+			drv.makeLockUpdate(holder),
+			options.FindOneAndUpdate().SetUpsert(true),
+		).Err()
+
+		switch {
+		case err == nil, errors.Is(err, mongo.ErrNoDocuments):
+			return true, nil
+		case mongo.IsDuplicateKeyError(err):
+			return false, nil
+		default:
+			return false, err //nolint:wrapcheck
+		}
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	held := lease.Start(holder, drv.lockTTL(), func() (bool, error) {
+		return drv.updateLock(drv.makeLockUpdate(holder), holder)
+	}, nil)
+
+	drv.mutex.Lock()
+	drv.lease = held
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// Unlock stops the heartbeat and frees the lock document, see lease.Lease.Release.
+func (drv *mongoDriver) Unlock() error {
+	drv.mutex.Lock()
+	held := drv.lease
+	drv.lease = nil
+	drv.mutex.Unlock()
+
+	return held.Release(func() (bool, error) { //nolint:wrapcheck
+		return drv.updateLock(bson.D{{Key: "$set", Value: bson.D{{Key: "holder", Value: nil}}}}, held.Holder)
+	})
+}
+
+// currentLease is the lease held between Lock and Unlock, nil when the lock is not held.
+func (drv *mongoDriver) currentLease() *lease.Lease {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	return drv.lease
+}
+
+// updateLock updates the lock document while it is held by the holder, and reports whether it is.
+func (drv *mongoDriver) updateLock(update interface{}, holder string) (bool, error) {
+	result, err := drv.lockCollection().UpdateOne(context.Background(),
+		bson.D{{Key: "_id", Value: drv.config.MigrationsCollectionName}, {Key: "holder", Value: holder}},
+		update,
+	)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// makeLockUpdate is an update pipeline that sets the holder and moves the expiry LockTTL after now.
+func (drv *mongoDriver) makeLockUpdate(holder string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "holder", Value: holder},
+			{Key: "expires_at", Value: bson.D{{Key: "$add", Value: bson.A{"$$NOW", drv.lockTTL().Milliseconds()}}}},
+		}}},
+	}
+}
+
+func (drv *mongoDriver) lockCollection() *mongo.Collection {
+	return drv.database().Collection(drv.config.MigrationsCollectionName + "_lock")
+}
+
+func (drv *mongoDriver) lockTTL() time.Duration {
+	if drv.config.LockTTL <= 0 {
+		return DefaultLockTTL
+	}
+
+	return drv.config.LockTTL
+}
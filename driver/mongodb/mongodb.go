@@ -0,0 +1,296 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
+	"github.com/root-talis/henka/migration"
+)
+
+type DriverConfig struct {
+	// Database is where commands of migrations are run and the migrations log and lock collections are kept.
+	Database                 string
+	MigrationsCollectionName string
+
+	// LockTTL is how long the lock taken by Lock lasts unless it is refreshed, DefaultLockTTL if zero, see package lease.
+	LockTTL time.Duration
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+const DefaultLockTTL = 30 * time.Second
+
+// maxAppendAttempts limits how many times a log entry is given the next ID after other writers have taken it.
+const maxAppendAttempts = 10
+
+var (
+	ErrInvalidScript = errors.New("migration script is not a command document or an array of them")
+	ErrLogContention = errors.New("failed to take an ID for the log entry, as other writers keep taking them")
+)
+
+// logEntry is a document of the migrations collection. IDs are sequential, so that the log is read
+// in the order it was written.
+type logEntry struct {
+	ID              int64     `bson:"_id"`
+	Version         int64     `bson:"version"`
+	Name            string    `bson:"migration_name,omitempty"`
+	Direction       string    `bson:"direction"` // "u" or "d"
+	StartTime       time.Time `bson:"start_time"`
+	EndTime         time.Time `bson:"end_time,omitempty"`
+	RunID           string    `bson:"run_id,omitempty"`
+	Checksum        string    `bson:"checksum,omitempty"`
+	AppliedBy       string    `bson:"applied_by,omitempty"`
+	Hostname        string    `bson:"hostname,omitempty"`
+	AppVersion      string    `bson:"app_version,omitempty"`
+	ExecutionTimeMs int64     `bson:"execution_time_ms,omitempty"`
+}
+
+type mongoDriver struct {
+	client *mongo.Client
+	config DriverConfig
+	mutex  sync.Mutex
+
+	executor driver.Executor
+
+	// lease is the lock document held between Lock and Unlock
+	lease *lease.Lease
+}
+
+// NewDriver returns a driver whose migration scripts are MongoDB commands written in Extended JSON: either a single
+// command document, e.g. {"createIndexes": "users", "indexes": [...]}, or an array of them, which are run in order.
+// Server-side JavaScript is only run where commands take it, e.g. in $where or $function, as eval was removed
+// in MongoDB 4.2.
+func NewDriver(client *mongo.Client, config DriverConfig) driver.Driver {
+	return &mongoDriver{
+		client:   client,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+func (drv *mongoDriver) database() *mongo.Database {
+	return drv.client.Database(drv.config.Database)
+}
+
+func (drv *mongoDriver) collection() *mongo.Collection {
+	return drv.database().Collection(drv.config.MigrationsCollectionName)
+}
+
+func (drv *mongoDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *mongoDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	cursor, err := drv.collection().Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	result := make([]migration.Log, 0)
+
+	for cursor.Next(ctx) {
+		var entry logEntry
+		if err = cursor.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("%w: %s", driver.ErrInvalidLogTable, err.Error())
+		}
+
+		log := migration.Log{
+			ID:            uint64(entry.ID),
+			Migration:     migration.Migration{Version: migration.Version(entry.Version), Name: entry.Name},
+			AppliedAt:     entry.StartTime.UTC(),
+			RunID:         entry.RunID,
+			Checksum:      entry.Checksum,
+			Baseline:      entry.Name == migration.BaselineName,
+			AppliedBy:     entry.AppliedBy,
+			Hostname:      entry.Hostname,
+			AppVersion:    entry.AppVersion,
+			ExecutionTime: time.Duration(entry.ExecutionTimeMs) * time.Millisecond,
+		}
+
+		if !entry.EndTime.IsZero() {
+			log.FinishedAt = entry.EndTime.UTC()
+		}
+
+		if log.Direction, err = decodeDirection(entry.Direction); err != nil {
+			return nil, err
+		}
+
+		result = append(result, log)
+	}
+
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (drv *mongoDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext runs the commands of the script one by one. Commands have no transactions around them,
+// so the ones before a failed command stay applied.
+func (drv *mongoDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	held := drv.currentLease()
+	if err := held.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := held.Bind(ctx)
+	defer cancel()
+
+	commands, err := parseScript(script)
+	if err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+
+	for i, command := range commands {
+		if err = drv.database().RunCommand(ctx, command).Err(); err != nil {
+			index := i
+			if len(commands) == 1 {
+				index = -1
+			}
+
+			return &driver.StatementError{Index: index, Statement: describeCommand(command), Err: err}
+		}
+	}
+
+	err = drv.appendLog(ctx, logEntry{
+		Version:         int64(mig.Version),
+		Name:            mig.Name,
+		Direction:       encodeDirection(dir),
+		StartTime:       startTime.UTC(),
+		EndTime:         time.Now().UTC(),
+		Checksum:        migration.Checksum([]byte(script)),
+		AppliedBy:       drv.executor.AppliedBy,
+		Hostname:        drv.executor.Hostname,
+		AppVersion:      drv.executor.AppVersion,
+		ExecutionTimeMs: time.Since(startTime).Milliseconds(),
+	})
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *mongoDriver) WriteLog(log migration.Log) error {
+	finishedAt := log.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = log.AppliedAt
+	}
+
+	executor := drv.executor.ForLog(log)
+
+	err := drv.appendLog(context.Background(), logEntry{
+		Version:         int64(log.Version),
+		Name:            log.Name,
+		Direction:       encodeDirection(log.Direction),
+		StartTime:       log.AppliedAt.UTC(),
+		EndTime:         finishedAt.UTC(),
+		RunID:           log.RunID,
+		Checksum:        log.Checksum,
+		AppliedBy:       executor.AppliedBy,
+		Hostname:        executor.Hostname,
+		AppVersion:      executor.AppVersion,
+		ExecutionTimeMs: log.ExecutionTime.Milliseconds(),
+	})
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// appendLog inserts the entry with the ID after the latest one. The unique _id index makes the insert fail
+// when another writer has taken the ID in the meantime; the next ID is tried then.
+func (drv *mongoDriver) appendLog(ctx context.Context, entry logEntry) error {
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		var last logEntry
+
+		err := drv.collection().FindOne(ctx, bson.D{}, options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}})).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err //nolint:wrapcheck
+		}
+
+		entry.ID = last.ID + 1
+
+		_, err = drv.collection().InsertOne(ctx, entry)
+		if err == nil {
+			return nil
+		}
+
+		if !mongo.IsDuplicateKeyError(err) {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return ErrLogContention
+}
+
+// parseScript reads a command document or an array of them from Extended JSON.
+func parseScript(script string) ([]bson.D, error) {
+	script = strings.TrimSpace(script)
+	if !strings.HasPrefix(script, "[") {
+		script = "[" + script + "]"
+	}
+
+	var wrapper struct {
+		Commands []bson.D `bson:"commands"`
+	}
+
+	if err := bson.UnmarshalExtJSON([]byte(`{"commands": `+script+`}`), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidScript, err.Error())
+	}
+
+	if len(wrapper.Commands) == 0 {
+		return nil, fmt.Errorf("%w: no commands", ErrInvalidScript)
+	}
+
+	return wrapper.Commands, nil
+}
+
+// describeCommand writes the command back as Extended JSON for error messages.
+func describeCommand(command bson.D) string {
+	description, err := bson.MarshalExtJSON(command, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", command)
+	}
+
+	return string(description)
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
@@ -0,0 +1,342 @@
+//nolint:gochecknoglobals
+package mongodb_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/mongodb"
+	"github.com/root-talis/henka/migration"
+)
+
+// MongoDB versions to test against
+var versions = []string{
+	"mongo:5.0",
+	"mongo:4.4",
+}
+
+//
+// -- bootstrap --------------------------------------
+//
+
+type testContainer struct {
+	sync.Mutex
+	ctx       context.Context
+	container testcontainers.Container
+	client    *mongo.Client
+}
+
+var containers = make(map[string]*testContainer)
+
+func TestMain(m *testing.M) {
+	failed := false
+	waitGroup := sync.WaitGroup{}
+
+	for _, version := range versions {
+		version := version
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+			if err := setupTestContainer(version); err != nil {
+				failed = true
+				fmt.Printf("error when creating test container for version %s: %s\n", version, err) //nolint:forbidigo
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	var exitCode int
+	if !failed {
+		exitCode = m.Run()
+	} else {
+		exitCode = -1
+	}
+
+	for version, container := range containers {
+		container := container
+		version := version
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := shutdownTestContainer(version, container); err != nil {
+				fmt.Printf("error when cleaning up container %s: %s\n", version, err) //nolint:forbidigo
+				exitCode = -1
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	os.Exit(exitCode)
+}
+
+func setupTestContainer(version string) error {
+	ctx := context.Background()
+	mongoC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        version,
+			ExposedPorts: []string{"27017/tcp"},
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort("27017"),
+				wait.ForLog("Waiting for connections"),
+			),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", version, err)
+	}
+
+	container := testContainer{
+		ctx:       ctx,
+		container: mongoC,
+	}
+	containers[version] = &container
+
+	host, err := mongoC.Host(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get host of test container %s: %w", version, err)
+	}
+
+	port, err := mongoC.MappedPort(ctx, "27017")
+	if err != nil {
+		return fmt.Errorf("failed to get port of test container %s: %w", version, err)
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%s", host, port.Port())))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database in container %s: %w", version, err)
+	}
+
+	container.client = client
+
+	return nil
+}
+
+func shutdownTestContainer(version string, container *testContainer) error {
+	fmt.Printf("cleanup %s...\n", version) //nolint:forbidigo
+	container.Lock()
+	defer container.Unlock()
+
+	if container.client != nil {
+		_ = container.client.Disconnect(container.ctx)
+	}
+
+	err := container.container.Terminate(container.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to terminate test container %s: %w", version, err)
+	}
+
+	fmt.Printf("cleanup %s done\n", version) //nolint:forbidigo
+	return nil
+}
+
+//
+// -- templates --------------------------------------
+//
+
+var (
+	defaultDriverConfig = mongodb.DriverConfig{
+		Database:                 "test_database",
+		MigrationsCollectionName: "migrations_log",
+		AppliedBy:                "tester",
+		AppVersion:               "v1.0.0",
+	}
+
+	migration1Parsed = migration.Log{
+		ID:         1,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersCollection"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 500000000, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+	migration2Parsed = migration.Log{
+		ID:         2,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersCollection"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+
+	migrationScript1 = `[
+		{"create": "users"},
+		{"createIndexes": "users", "indexes": [{"key": {"email": 1}, "name": "users_email", "unique": true}]},
+		{"insert": "users", "documents": [{"_id": {"$numberInt": "1"}, "email": "user@example.com"}]}
+	]`
+	migrationScript2 = `{"drop": "users"}`
+)
+
+//
+// --- tests -----------------------------------------
+//
+
+func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mongodb")
+	}
+
+	runForAllMongoVersions(t, "ListMigrationsLog", func(t *testing.T, version string, client *mongo.Client) {
+		t.Helper()
+
+		defer dropDatabase(t, client)
+
+		drv := mongodb.NewDriver(client, defaultDriverConfig)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+
+		_, err = client.Database("test_database").Collection("migrations_log").InsertOne(context.Background(),
+			bson.D{{Key: "_id", Value: int64(1)}, {Key: "version", Value: int64(1)}, {Key: "direction", Value: "x"}})
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestMigrate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mongodb")
+	}
+
+	runForAllMongoVersions(t, "Migrate", func(t *testing.T, version string, client *mongo.Client) {
+		t.Helper()
+
+		defer dropDatabase(t, client)
+
+		drv := mongodb.NewDriver(client, defaultDriverConfig)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		count, err := client.Database("test_database").Collection("users").CountDocuments(context.Background(), bson.D{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Down, migrationScript2))
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up, `[{"create": "users"}, {"create": "users"}]`)
+
+		var statementErr *driver.StatementError
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+		}
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up, `db.users.drop()`)
+		assert.ErrorIs(t, err, mongodb.ErrInvalidScript)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Equal(t, uint64(1), (*actualLog)[0].ID)
+			assert.Equal(t, migration.Up, (*actualLog)[0].Direction)
+			assert.Equal(t, migration.Checksum([]byte(migrationScript1)), (*actualLog)[0].Checksum)
+			assert.Equal(t, "tester", (*actualLog)[0].AppliedBy)
+			assert.WithinDuration(t, time.Now(), (*actualLog)[0].AppliedAt, time.Minute)
+			assert.Equal(t, uint64(2), (*actualLog)[1].ID)
+			assert.Equal(t, migration.Down, (*actualLog)[1].Direction)
+		}
+	})
+}
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mongodb")
+	}
+
+	runForAllMongoVersions(t, "WriteLog", func(t *testing.T, version string, client *mongo.Client) {
+		t.Helper()
+
+		defer dropDatabase(t, client)
+
+		drv := mongodb.NewDriver(client, defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("mongodb driver must implement driver.LogWriter")
+		}
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(migration2Parsed))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *actualLog)
+	})
+}
+
+func TestLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mongodb")
+	}
+
+	runForAllMongoVersions(t, "Lock", func(t *testing.T, version string, client *mongo.Client) {
+		t.Helper()
+
+		defer dropDatabase(t, client)
+
+		config := defaultDriverConfig
+		config.LockTTL = 3 * time.Second
+
+		first := mongodb.NewDriver(client, config)
+		second := mongodb.NewDriver(client, config)
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		// the heartbeat keeps the lock beyond its TTL
+		time.Sleep(4 * time.Second)
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+	})
+}
+
+//
+// --- utility stuff ---------------------------------
+//
+
+func runForAllMongoVersions(t *testing.T, baseName string, test func(t *testing.T, version string, client *mongo.Client)) {
+	t.Helper()
+
+	for version, container := range containers {
+		container := container
+		version := version
+		testName := fmt.Sprintf("%s@%s", baseName, version)
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			container.Lock()
+			defer container.Unlock()
+
+			test(t, version, container.client)
+		})
+	}
+}
+
+func dropDatabase(t *testing.T, client *mongo.Client) {
+	t.Helper()
+
+	if err := client.Database("test_database").Drop(context.Background()); err != nil {
+		t.Fatalf("falied to drop database after test: %s", err)
+	}
+}
@@ -0,0 +1,86 @@
+package mssql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+)
+
+// maxLockNameLength is the limit SQL Server puts on resource names of application locks.
+const maxLockNameLength = 255
+
+// Lock takes an exclusive application lock named after the migrations table with sp_getapplock. The lock
+// belongs to the session, so it is taken on the dedicated connection of the run. Connections that don't
+// implement Conn must be dedicated connections themselves, e.g. *sql.Conn.
+func (drv *mssqlDriver) Lock(timeout time.Duration) error {
+	var found bool
+	var result int
+
+	rows, err := drv.db().QueryContext(context.Background(),
+		"DECLARE @result int; "+
+			"EXEC @result = sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', "+
+			"@LockTimeout = @p2; "+
+			"SELECT @result",
+		drv.lockName(),
+		timeout.Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		found = true
+		if err = rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	// without a row the lock can't be told to be granted
+	if !found {
+		return errors.New("failed to acquire lock: sp_getapplock has returned no result")
+	}
+
+	// 0 and 1 are granted locks, -1 is a timeout, -2 a canceled request, -3 a deadlock and -999 an error.
+	switch {
+	case result >= 0:
+		return nil
+	case result == -1:
+		return driver.ErrLockTimeout
+	default:
+		return fmt.Errorf("failed to acquire lock: sp_getapplock has returned %d", result)
+	}
+}
+
+// Unlock releases the lock taken by Lock.
+func (drv *mssqlDriver) Unlock() error {
+	_, err := drv.db().ExecContext(context.Background(),
+		"EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'",
+		drv.lockName(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *mssqlDriver) lockName() string {
+	name := fmt.Sprintf("henka:%s.%s", drv.schemaName(), drv.config.MigrationsTableName)
+	if len(name) <= maxLockNameLength {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(name))
+
+	return "henka:" + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,23 @@
+package mssql
+
+import "fmt"
+
+// LogTableDDL creates the migrations log table with the escaped name unless it exists. Times are datetime2
+// in UTC, as SQL Server has no session time zone that could tell them apart.
+func LogTableDDL(escapedTableName string) string {
+	return fmt.Sprintf("IF OBJECT_ID(%s, N'U') IS NULL CREATE TABLE %s ("+
+		"id             int identity(1, 1) not null, "+
+		"version        bigint not null, "+
+		"migration_name nvarchar(100) null, "+
+		"direction      char(1) not null, "+ // "u" or "d"
+		"start_time     datetime2(6) not null default SYSUTCDATETIME(), "+
+		"end_time       datetime2(6) null, "+
+		"run_id         varchar(64) null, "+
+		"checksum       char(64) null, "+
+		"applied_by     nvarchar(100) null, "+
+		"hostname       nvarchar(255) null, "+
+		"app_version    nvarchar(100) null, "+
+		"execution_time_ms bigint null, "+
+		"primary key (id)"+
+		")", escapeString(escapedTableName), escapedTableName)
+}
@@ -0,0 +1,384 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+type DriverConfig struct {
+	// SchemaName is the schema of the migrations log table, "dbo" if empty. The database is the one of the connection.
+	SchemaName          string
+	MigrationsTableName string
+
+	// SkipLogTableCreation disables creating the migrations log table, for users that lack the CREATE TABLE
+	// permission. The table must be created beforehand then, see LogTableDDL.
+	SkipLogTableCreation bool
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+// Execer is the connection the driver needs. It is satisfied by *sql.DB, *sql.Conn and instrumented wrappers.
+// Connections that implement Conn like *sql.DB are needed to run all migrations of a run on a dedicated connection,
+// which is where Lock takes its lock.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type connPool interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+type mssqlDriver struct {
+	pool   Execer
+	config DriverConfig
+
+	// pinned is the connection dedicated to the current run, nil outside of runs
+	pinned *sql.Conn
+	mutex  sync.Mutex
+
+	// tableExists is set once the migrations log table has been created or found
+	tableExists bool
+
+	executor driver.Executor
+}
+
+// NewDriver returns a driver for SQL Server and Azure SQL. Queries use @p1 style parameters, which are
+// understood by github.com/microsoft/go-mssqldb and github.com/denisenkom/go-mssqldb.
+func NewDriver(conn Execer, config DriverConfig) driver.Driver {
+	return &mssqlDriver{
+		pool:     conn,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+// BeginRun takes a dedicated connection from the pool, so that the session lock, temporary tables and SET options
+// of one run live on the same connection. Connections that are not pools are used as is.
+func (drv *mssqlDriver) BeginRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return driver.ErrRunInProgress
+	}
+
+	pool, ok := drv.pool.(connPool)
+	if !ok {
+		return nil
+	}
+
+	conn, err := pool.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to take a dedicated connection: %w", err)
+	}
+
+	drv.pinned = conn
+
+	return nil
+}
+
+// EndRun returns the dedicated connection to the pool.
+func (drv *mssqlDriver) EndRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned == nil {
+		return nil
+	}
+
+	err := drv.pinned.Close()
+	drv.pinned = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to release the dedicated connection: %w", err)
+	}
+
+	return nil
+}
+
+// db returns the connection of the current run, or the pool outside of runs.
+func (drv *mssqlDriver) db() Execer {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return drv.pinned
+	}
+
+	return drv.pool
+}
+
+func (drv *mssqlDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *mssqlDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(ctx, &tableName); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	rows, err := drv.db().QueryContext(ctx, fmt.Sprintf(
+		"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms FROM %s ORDER BY id",
+		tableName,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+	defer rows.Close()
+
+	result, err := fetchMigrationsLog(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (drv *mssqlDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+func (drv *mssqlDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(ctx, &tableName); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	startTime := time.Now()
+
+	if err := drv.execScript(ctx, script); err != nil {
+		return err
+	}
+
+	_, err := drv.db().ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms) "+
+			"VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10)", tableName,
+		),
+		int64(mig.Version),
+		mig.Name,
+		encodeDirection(dir),
+		toDatetime2(startTime),
+		toDatetime2(time.Now()),
+		migration.Checksum([]byte(script)),
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+		time.Since(startTime).Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// execScript executes the batches of the script one by one, see splitBatches. Errors are driver.StatementError
+// with the index of the failed batch, or -1 if the script is a single batch.
+func (drv *mssqlDriver) execScript(ctx context.Context, script string) error {
+	batches := splitBatches(script)
+
+	for i, batch := range batches {
+		if _, err := drv.db().ExecContext(ctx, batch); err != nil {
+			index := i
+			if len(batches) == 1 {
+				index = -1
+			}
+
+			return &driver.StatementError{Index: index, Statement: batch, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func (drv *mssqlDriver) WriteLog(log migration.Log) error {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(context.Background(), &tableName); err != nil {
+		return fmt.Errorf("failed to write migration log: %w", err)
+	}
+
+	finishedAt := log.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = log.AppliedAt
+	}
+
+	var runID, checksum *string
+	var executionTime *int64
+	if log.RunID != "" {
+		runID = &log.RunID
+	}
+	if log.Checksum != "" {
+		checksum = &log.Checksum
+	}
+	if log.ExecutionTime > 0 {
+		milliseconds := log.ExecutionTime.Milliseconds()
+		executionTime = &milliseconds
+	}
+
+	executor := drv.executor.ForLog(log)
+
+	_, err := drv.db().ExecContext(context.Background(),
+		fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms) "+
+			"VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9, @p10, @p11)", tableName,
+		),
+		int64(log.Version),
+		log.Name,
+		encodeDirection(log.Direction),
+		toDatetime2(log.AppliedAt),
+		toDatetime2(finishedAt),
+		runID,
+		checksum,
+		executor.AppliedBy,
+		executor.Hostname,
+		executor.AppVersion,
+		executionTime,
+	)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// fetchMigrationsLog scans rows of id, version, migration_name, direction, start_time, end_time, run_id,
+// checksum, applied_by, hostname, app_version and execution_time_ms.
+func fetchMigrationsLog(rows *sql.Rows) ([]migration.Log, error) {
+	result := make([]migration.Log, 0)
+	for rows.Next() {
+		var log migration.Log
+		var version int64
+		var direction string
+		var appliedAt time.Time
+		var finishedAt sql.NullTime
+		var name, runID, checksum, appliedBy, hostname, appVersion sql.NullString
+		var executionTime sql.NullInt64
+
+		err := rows.Scan(&log.ID, &version, &name, &direction, &appliedAt, &finishedAt, &runID, &checksum,
+			&appliedBy, &hostname, &appVersion, &executionTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+		}
+
+		log.Version = migration.Version(version)
+		log.Name = name.String
+
+		log.Direction, err = decodeDirection(direction)
+		if err != nil {
+			return nil, err
+		}
+
+		log.RunID = runID.String
+		log.Checksum = checksum.String
+		log.Baseline = log.Name == migration.BaselineName
+		log.AppliedBy = appliedBy.String
+		log.Hostname = hostname.String
+		log.AppVersion = appVersion.String
+		log.ExecutionTime = time.Duration(executionTime.Int64) * time.Millisecond
+		log.AppliedAt = fromDatetime2(appliedAt)
+
+		if finishedAt.Valid {
+			log.FinishedAt = fromDatetime2(finishedAt.Time)
+		}
+
+		result = append(result, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+	}
+
+	return result, nil
+}
+
+// toDatetime2 converts t to UTC before it is written to a datetime2 column. datetime2 has no time zone, and
+// a time.Time parameter is sent as datetimeoffset, whose local time would be kept when it is converted.
+func toDatetime2(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// fromDatetime2 reads a datetime2 value as UTC, whatever location the SQL driver has given it.
+func fromDatetime2(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
+
+func (drv *mssqlDriver) schemaName() string {
+	if drv.config.SchemaName == "" {
+		return "dbo"
+	}
+
+	return drv.config.SchemaName
+}
+
+func (drv *mssqlDriver) makeEscapedMigrationsTableName() string {
+	return escapeIdentifier(drv.schemaName()) + "." + escapeIdentifier(drv.config.MigrationsTableName)
+}
+
+func (drv *mssqlDriver) ensureMigrationsTableExists(ctx context.Context, escapedTableName *string) error {
+	if drv.config.SkipLogTableCreation {
+		return nil
+	}
+
+	drv.mutex.Lock()
+	exists := drv.tableExists
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	if _, err := drv.db().ExecContext(ctx, LogTableDDL(*escapedTableName)); err != nil {
+		return fmt.Errorf("failed to create migrations table %s: %w", *escapedTableName, err)
+	}
+
+	drv.mutex.Lock()
+	drv.tableExists = true
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// escapeIdentifier quotes a name in brackets, doubling closing brackets in it.
+func escapeIdentifier(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+// escapeString quotes a value as a Unicode string literal, doubling single quotes in it.
+func escapeString(value string) string {
+	return "N'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
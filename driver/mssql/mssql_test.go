@@ -0,0 +1,383 @@
+//nolint:gochecknoglobals
+package mssql_test
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/mssql"
+	"github.com/root-talis/henka/migration"
+)
+
+// SQL Server versions to test against
+var versions = []string{
+	"mcr.microsoft.com/mssql/server:2022-latest",
+	"mcr.microsoft.com/mssql/server:2019-latest",
+}
+
+//
+// -- bootstrap --------------------------------------
+//
+
+type testContainer struct {
+	sync.Mutex
+	ctx       context.Context
+	container testcontainers.Container
+	conn      *sql.DB
+}
+
+var containers = make(map[string]*testContainer)
+
+func TestMain(m *testing.M) {
+	failed := false
+	waitGroup := sync.WaitGroup{}
+
+	for _, version := range versions {
+		version := version
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+			if err := setupTestContainer(version); err != nil {
+				failed = true
+				fmt.Printf("error when creating test container for version %s: %s\n", version, err) //nolint:forbidigo
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	var exitCode int
+	if !failed {
+		exitCode = m.Run()
+	} else {
+		exitCode = -1
+	}
+
+	for version, container := range containers {
+		container := container
+		version := version
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := shutdownTestContainer(version, container); err != nil {
+				fmt.Printf("error when cleaning up container %s: %s\n", version, err) //nolint:forbidigo
+				exitCode = -1
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	os.Exit(exitCode)
+}
+
+func setupTestContainer(version string) error {
+	saPassword := generateRandomPassword()
+	fmt.Printf("%s - sa password: %s\n", version, saPassword) //nolint:forbidigo
+
+	ctx := context.Background()
+	mssqlC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        version,
+			ExposedPorts: []string{"1433/tcp"},
+			WaitingFor: wait.ForAll(
+				wait.ForListeningPort("1433"),
+				wait.ForLog("SQL Server is now ready for client connections"),
+			),
+			Env: map[string]string{
+				"ACCEPT_EULA":       "Y",
+				"MSSQL_SA_PASSWORD": saPassword,
+			},
+		},
+		Started: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", version, err)
+	}
+
+	container := testContainer{
+		ctx:       ctx,
+		container: mssqlC,
+	}
+	containers[version] = &container
+
+	endpoint, err := mssqlC.Endpoint(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to get endpoint for test container %s: %w", version, err)
+	}
+
+	conn, err := sql.Open("sqlserver", fmt.Sprintf("sqlserver://sa:%s@%s?database=master", saPassword, endpoint))
+	if err != nil {
+		return fmt.Errorf("failed to connect to database in container %s: %w", version, err)
+	}
+
+	container.conn = conn
+
+	return nil
+}
+
+func shutdownTestContainer(version string, container *testContainer) error {
+	fmt.Printf("cleanup %s...\n", version) //nolint:forbidigo
+	container.Lock()
+	defer container.Unlock()
+
+	if container.conn != nil {
+		err := container.conn.Close()
+		if err != nil {
+			return fmt.Errorf("failed to close connection to test database %s: %w", version, err)
+		}
+	}
+
+	err := container.container.Terminate(container.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to terminate test container %s: %w", version, err)
+	}
+
+	fmt.Printf("cleanup %s done\n", version) //nolint:forbidigo
+	return nil
+}
+
+// generateRandomPassword satisfies the password policy of SQL Server: upper and lower case letters and digits.
+func generateRandomPassword() string {
+	const length = 8
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("failed to generate a random password: %w", err))
+	}
+	return fmt.Sprintf("Aa1%x", b)
+}
+
+//
+// -- templates --------------------------------------
+//
+
+var (
+	initSchema = []string{
+		"CREATE SCHEMA testSchema",
+	}
+	dropSchema = []string{
+		"DROP TABLE IF EXISTS testSchema.migrations_log",
+		"DROP TABLE IF EXISTS testSchema.users",
+		"DROP SCHEMA testSchema",
+	}
+
+	defaultDriverConfig = mssql.DriverConfig{
+		SchemaName:          "testSchema",
+		MigrationsTableName: "migrations_log",
+		AppliedBy:           "tester",
+		AppVersion:          "v1.0.0",
+	}
+
+	migration1Parsed = migration.Log{
+		ID:         1,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 500000000, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+	migration2Parsed = migration.Log{
+		ID:         2,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+
+	migrationScript1 = "CREATE TABLE testSchema.users (id int identity(1, 1) not null primary key)\n" +
+		"GO\n" +
+		"CREATE PROCEDURE testSchema.count_users AS SELECT COUNT(*) FROM testSchema.users\n" +
+		"GO\n" +
+		"DROP PROCEDURE testSchema.count_users"
+	migrationScript2 = "DROP TABLE testSchema.users"
+)
+
+//
+// --- tests -----------------------------------------
+//
+
+func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mssql")
+	}
+
+	runForAllMssqlVersions(t, "ListMigrationsLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		drv := mssql.NewDriver(conn, defaultDriverConfig)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+
+		var count int
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testSchema.migrations_log").Scan(&count))
+		assert.Equal(t, 0, count)
+
+		_, err = conn.Exec("INSERT INTO testSchema.migrations_log (version, migration_name, direction) VALUES (1, 'bad', 'x')")
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestMigrate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mssql")
+	}
+
+	runForAllMssqlVersions(t, "Migrate", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		drv := mssql.NewDriver(conn, defaultDriverConfig)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+		assert.True(t, tableExists(t, conn, "users"))
+
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Down, migrationScript2))
+		assert.False(t, tableExists(t, conn, "users"))
+
+		err := drv.Migrate(migration1Parsed.Migration, migration.Up, "CREATE TABLE testSchema.users (id int)\nGO\nSELECT * FROM nowhere")
+
+		var statementErr *driver.StatementError
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+		}
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Equal(t, migration.Up, (*actualLog)[0].Direction)
+			assert.Equal(t, migration.Checksum([]byte(migrationScript1)), (*actualLog)[0].Checksum)
+			assert.Equal(t, "tester", (*actualLog)[0].AppliedBy)
+			assert.Equal(t, time.UTC, (*actualLog)[0].AppliedAt.Location())
+			assert.WithinDuration(t, time.Now(), (*actualLog)[0].AppliedAt, time.Minute)
+			assert.Equal(t, migration.Down, (*actualLog)[1].Direction)
+		}
+	})
+}
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mssql")
+	}
+
+	runForAllMssqlVersions(t, "WriteLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer execAll(t, conn, dropSchema)
+		execAll(t, conn, initSchema)
+
+		drv := mssql.NewDriver(conn, defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("mssql driver must implement driver.LogWriter")
+		}
+
+		// times in other locations are stored as UTC
+		elsewhere := migration2Parsed
+		elsewhere.AppliedAt = migration2Parsed.AppliedAt.In(time.FixedZone("UTC+3", 3*60*60))
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(elsewhere))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *actualLog)
+	})
+}
+
+func TestLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mssql")
+	}
+
+	runForAllMssqlVersions(t, "Lock", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		first := mssql.NewDriver(conn, defaultDriverConfig)
+		second := mssql.NewDriver(conn, defaultDriverConfig)
+
+		assert.NoError(t, first.(driver.RunScoper).BeginRun())
+		assert.NoError(t, second.(driver.RunScoper).BeginRun())
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+
+		assert.NoError(t, first.(driver.RunScoper).EndRun())
+		assert.NoError(t, second.(driver.RunScoper).EndRun())
+	})
+}
+
+//
+// --- utility stuff ---------------------------------
+//
+
+func runForAllMssqlVersions(t *testing.T, baseName string, test func(t *testing.T, version string, conn *sql.DB)) {
+	t.Helper()
+
+	for version, container := range containers {
+		container := container
+		version := version
+		testName := fmt.Sprintf("%s@%s", baseName, version)
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			container.Lock()
+			defer container.Unlock()
+
+			test(t, version, container.conn)
+		})
+	}
+}
+
+func execAll(t *testing.T, conn *sql.DB, statements []string) {
+	t.Helper()
+
+	for _, statement := range statements {
+		if _, err := conn.Exec(statement); err != nil {
+			t.Fatalf("failed to execute \"%s\": %s", statement, err)
+		}
+	}
+}
+
+func tableExists(t *testing.T, conn *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := conn.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'testSchema' AND table_name = @p1", name,
+	).Scan(&count)
+	if err != nil {
+		t.Fatalf("failed to look up table %s: %s", name, err)
+	}
+
+	return count > 0
+}
@@ -0,0 +1,40 @@
+package mssql
+
+import (
+	"bufio"
+	"strings"
+)
+
+// splitBatches splits a script into batches at lines that consist of GO alone, as sqlcmd and SQL Server
+// Management Studio do. The server doesn't understand GO, and statements like CREATE PROCEDURE must begin
+// a batch. Empty batches are dropped.
+func splitBatches(script string) []string {
+	batches := make([]string, 0, 1)
+	current := strings.Builder{}
+
+	flush := func() {
+		if batch := strings.TrimSpace(current.String()); batch != "" {
+			batches = append(batches, batch)
+		}
+
+		current.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), len(script)+1)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.EqualFold(strings.TrimSpace(line), "go") {
+			flush()
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+
+	flush()
+
+	return batches
+}
@@ -0,0 +1,200 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/sqlscript"
+)
+
+var ErrScriptChanged = errors.New("script of the interrupted migration has changed")
+
+// migrateInChunks executes the script statement by statement and commits every StatementsPerCommit
+// statements. The number of committed statements is kept in a progress row of the migrations log,
+// which is excluded from listings and replaced with a regular entry once the script is done. The regular
+// entry is inserted rather than updated from the progress row, so that log IDs keep growing in order of completion.
+// When a previous attempt failed, execution resumes after the last committed statement, and the recorded
+// execution time covers only the attempt that has completed the script.
+func (drv *mysqlDriver) migrateInChunks(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	startTime := time.Now()
+	tableName := drv.makeEscapedMigrationsTableName()
+	checksum := migration.Checksum([]byte(script))
+	statements := sqlscript.Split(script)
+
+	storedScript, scriptCodec, err := drv.encodeScript(script)
+	if err != nil {
+		return err
+	}
+
+	progressID, done, err := drv.findProgress(ctx, &tableName, mig, dir, checksum)
+	if err != nil {
+		return err
+	}
+
+	if done > 0 {
+		drv.logger().Info("resuming interrupted migration", "version", mig.Version, "direction", dir, "statements_done", done)
+	}
+
+	for done < len(statements) {
+		end := done + drv.config.StatementsPerCommit
+		if end > len(statements) {
+			end = len(statements)
+		}
+
+		if err = drv.commitChunk(ctx, &tableName, progressID, statements[done:end], end); err != nil {
+			drv.logger().Error("migration chunk failed", "version", mig.Version, "direction", dir, "from", done+1, "to", end, "error", err)
+			return fmt.Errorf("failed to execute statements %d-%d of migration script: %w", done+1, end, err)
+		}
+
+		drv.logger().Debug("committed migration chunk", "version", mig.Version, "direction", dir, "statements_done", end)
+		done = end
+	}
+
+	return drv.completeProgress(ctx, &tableName, progressID, mig, dir, storedScript, scriptCodec, time.Since(startTime))
+}
+
+// findProgress returns the progress row of an interrupted attempt, or inserts a new one.
+func (drv *mysqlDriver) findProgress(
+	ctx context.Context,
+	escapedTableName *string,
+	mig migration.Migration,
+	dir migration.Direction,
+	checksum string,
+) (int64, int, error) {
+	rows, err := drv.query(ctx, fmt.Sprintf(
+		"SELECT id, progress, checksum FROM %s "+
+			"WHERE namespace = ? AND version = ? AND direction = ? AND progress IS NOT NULL AND checksum IS NOT NULL "+
+			"ORDER BY id DESC LIMIT 1",
+		*escapedTableName,
+	), drv.config.Namespace, mig.Version, drv.encodeDirection(dir))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to look up progress of migration: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var id int64
+		var done int
+		var recordedChecksum sql.NullString
+
+		if err = rows.Scan(&id, &done, &recordedChecksum); err != nil {
+			return 0, 0, fmt.Errorf("failed to look up progress of migration: %w", err)
+		}
+
+		if recordedChecksum.String != checksum {
+			return 0, 0, fmt.Errorf("%w: %d_%s", ErrScriptChanged, mig.Version, mig.Name)
+		}
+
+		return id, done, nil
+	}
+
+	result, err := drv.db().ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, checksum, progress, "+
+			"applied_by, hostname, app_version) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)", *escapedTableName,
+		),
+		drv.config.Namespace,
+		mig.Version,
+		mig.Name,
+		drv.encodeDirection(dir),
+		time.Now(),
+		checksum,
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return id, 0, nil
+}
+
+// commitChunk executes statements and moves the progress to done in a single transaction.
+// Note that MySQL commits DDL statements implicitly.
+func (drv *mysqlDriver) commitChunk(
+	ctx context.Context,
+	escapedTableName *string,
+	progressID int64,
+	statements []string,
+	done int,
+) error {
+	tx, err := drv.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	for i, statement := range statements {
+		if _, err = tx.ExecContext(ctx, statement); err != nil {
+			_ = tx.Rollback()
+			return &driver.StatementError{Index: done - len(statements) + i, Statement: statement, Err: err}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET progress = ? WHERE id = ?", *escapedTableName), done, progressID)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error when writing migration progress: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *mysqlDriver) completeProgress(
+	ctx context.Context,
+	escapedTableName *string,
+	progressID int64,
+	mig migration.Migration,
+	dir migration.Direction,
+	storedScript []byte,
+	scriptCodec *string,
+	executionTime time.Duration,
+) error {
+	tx, err := drv.beginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, end_time, checksum, script, script_codec, "+
+			"applied_by, hostname, app_version, execution_time_ms) "+
+			"SELECT namespace, version, migration_name, direction, start_time, ?, checksum, ?, ?, ?, ?, ?, ? FROM %s WHERE id = ?",
+			*escapedTableName, *escapedTableName,
+		),
+		time.Now(),
+		storedScript,
+		scriptCodec,
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+		executionTime.Milliseconds(),
+		progressID,
+	)
+	if err == nil {
+		err = drv.clearProgress(ctx, tx, escapedTableName, mig, dir)
+	}
+
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+// DirectionEncoding is how directions are stored in the direction column of the migrations log.
+type DirectionEncoding struct {
+	Up   string
+	Down string
+}
+
+// nolint:gochecknoglobals
+var (
+	// CharDirections stores "u" and "d". This is the default.
+	CharDirections = DirectionEncoding{Up: "u", Down: "d"}
+
+	// WordDirections stores "up" and "down". The direction column must be wide enough for them.
+	WordDirections = DirectionEncoding{Up: "up", Down: "down"}
+
+	// NumericDirections stores 1 for up and 0 for down.
+	NumericDirections = DirectionEncoding{Up: "1", Down: "0"}
+)
+
+func (drv *mysqlDriver) directions() DirectionEncoding {
+	if drv.config.Directions == (DirectionEncoding{}) {
+		return CharDirections
+	}
+
+	return drv.config.Directions
+}
+
+func (drv *mysqlDriver) encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return drv.directions().Down
+	}
+
+	return drv.directions().Up
+}
+
+// decodeDirection accepts the configured encoding as well as "u", "d", "up" and "down" in any case,
+// so that logs written with another encoding can be read.
+func (drv *mysqlDriver) decodeDirection(value string) (migration.Direction, error) {
+	value = strings.TrimSpace(value)
+	encoding := drv.directions()
+
+	switch {
+	case strings.EqualFold(value, encoding.Up):
+		return migration.Up, nil
+	case strings.EqualFold(value, encoding.Down):
+		return migration.Down, nil
+	}
+
+	switch strings.ToLower(value) {
+	case "u", "up":
+		return migration.Up, nil
+	case "d", "down":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
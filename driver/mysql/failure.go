@@ -0,0 +1,130 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// RecordFailure stores the cause in the progress row of the migration, inserting one if the migration is not
+// executed in chunks. The migration is listed by ListInterruptedMigrations until it is applied successfully.
+// Progress rows without a checksum are not resumed by chunked migrations.
+func (drv *mysqlDriver) RecordFailure(mig migration.Migration, dir migration.Direction, cause error) error {
+	ctx := context.Background()
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	drv.logger().Warn("recording failure of migration", "version", mig.Version, "direction", dir, "error", cause)
+
+	if err := drv.ensureMigrationsTableExists(ctx, &tableName); err != nil {
+		return fmt.Errorf("failed to record migration failure: %w", err)
+	}
+
+	result, err := drv.db().ExecContext(ctx,
+		fmt.Sprintf(
+			"UPDATE %s SET error_message = ? WHERE namespace = ? AND version = ? AND direction = ? AND progress IS NOT NULL",
+			tableName,
+		),
+		cause.Error(),
+		drv.config.Namespace,
+		mig.Version,
+		drv.encodeDirection(dir),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration failure: %w", err)
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated > 0 {
+		return nil
+	}
+
+	_, err = drv.db().ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, progress, error_message, "+
+			"applied_by, hostname, app_version) VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)", tableName,
+		),
+		drv.config.Namespace,
+		mig.Version,
+		mig.Name,
+		drv.encodeDirection(dir),
+		time.Now(),
+		cause.Error(),
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record migration failure: %w", err)
+	}
+
+	return nil
+}
+
+// startAttempt inserts a progress row that marks the migration as started. It has no checksum, so that
+// chunked migrations don't take it for their progress. The row is deleted when the migration is applied.
+func (drv *mysqlDriver) startAttempt(
+	ctx context.Context,
+	escapedTableName *string,
+	mig migration.Migration,
+	dir migration.Direction,
+	startTime time.Time,
+) (int64, error) {
+	result, err := drv.db().ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, progress, "+
+			"applied_by, hostname, app_version) VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?)",
+			*escapedTableName,
+		),
+		drv.config.Namespace,
+		mig.Version,
+		mig.Name,
+		drv.encodeDirection(dir),
+		startTime,
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return id, nil
+}
+
+// failAttempt stores the end time and the cause in the progress row. It is best effort: the failure
+// of the script is what gets reported, and the row marks the migration as dirty either way.
+func (drv *mysqlDriver) failAttempt(escapedTableName *string, attemptID int64, cause error) {
+	_, err := drv.db().ExecContext(context.Background(),
+		fmt.Sprintf("UPDATE %s SET end_time = ?, error_message = ? WHERE id = ?", *escapedTableName),
+		time.Now(),
+		cause.Error(),
+		attemptID,
+	)
+	if err != nil {
+		drv.logger().Error("failed to record migration failure", "error", err)
+	}
+}
+
+// clearProgress deletes progress rows of the migration once it has been applied.
+func (drv *mysqlDriver) clearProgress(
+	ctx context.Context,
+	db Execer,
+	escapedTableName *string,
+	mig migration.Migration,
+	dir migration.Direction,
+) error {
+	_, err := db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND version = ? AND direction = ? AND progress IS NOT NULL",
+			*escapedTableName,
+		),
+		drv.config.Namespace,
+		mig.Version,
+		drv.encodeDirection(dir),
+	)
+
+	return err //nolint:wrapcheck
+}
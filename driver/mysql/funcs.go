@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// MigrateFunc applies a migration written in Go. The function and the log entry share a transaction,
+// but MySQL commits DDL statements implicitly, so functions should stick to data changes.
+func (drv *mysqlDriver) MigrateFunc(ctx context.Context, mig migration.Migration, dir migration.Direction, fn migration.Func) (err error) {
+	endRun, err := drv.useDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if endErr := endRun(); endErr != nil && err == nil {
+			err = endErr
+		}
+	}()
+
+	tableName := drv.makeEscapedMigrationsTableName()
+	startTime := time.Now()
+
+	attemptID, err := drv.startAttempt(ctx, &tableName, mig, dir, startTime)
+	if err != nil {
+		return err
+	}
+
+	tx, err := drv.beginTx(ctx)
+	if err != nil {
+		drv.failAttempt(&tableName, attemptID, err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err = fn(ctx, tx); err != nil {
+		_ = tx.Rollback()
+
+		drv.logger().Error("migration function failed", "version", mig.Version, "direction", dir, "error", err)
+		drv.failAttempt(&tableName, attemptID, err)
+
+		return fmt.Errorf("failed to execute migration function: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, end_time, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", tableName,
+		),
+		drv.config.Namespace,
+		mig.Version,
+		mig.Name,
+		drv.encodeDirection(dir),
+		startTime,
+		time.Now(),
+		migration.Checksum(nil),
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+		time.Since(startTime).Milliseconds(),
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	if err = drv.clearProgress(ctx, tx, &tableName, mig, dir); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
+)
+
+// leaseNamespace keeps the lease row apart from log entries, which are all read within a namespace.
+// The lease is shared by every namespace of the table, as the GET_LOCK lock is.
+const (
+	leaseNamespace     = "henka:lease"
+	leaseName          = "<< lease >>"
+	maxLeaseHolderSize = 64
+)
+
+// DefaultTiDBLeaseTTL is the lease TTL with DriverConfig.TiDB unless DriverConfig.LeaseTTL is set.
+const DefaultTiDBLeaseTTL = 30 * time.Second
+
+// acquireLease takes the lease row of the migrations table: run_id holds the holder and end_time the latest
+// heartbeat. The lease is taken over when it is free or its heartbeat is older than LeaseTTL. Times come
+// from the database, so that clocks of the instances don't matter.
+func (drv *mysqlDriver) acquireLease(timeout time.Duration) error {
+	ctx := context.Background()
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(ctx, &tableName); err != nil {
+		return fmt.Errorf("failed to acquire lease: %w", err)
+	}
+
+	id, err := drv.findLeaseRow(ctx, &tableName)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lease: %w", err)
+	}
+
+	holder := lease.NewHolder(drv.executor.Hostname)
+	if len(holder) > maxLeaseHolderSize {
+		holder = holder[:maxLeaseHolderSize]
+	}
+
+	err = lease.Acquire(timeout, func() (bool, error) {
+		result, err := drv.pool.ExecContext(ctx,
+			fmt.Sprintf("UPDATE %s SET run_id = ?, start_time = NOW(), end_time = NOW() "+
+				"WHERE id = ? AND (run_id IS NULL OR end_time IS NULL OR end_time < NOW() - INTERVAL ? SECOND)",
+				tableName,
+			),
+			holder,
+			id,
+			leaseSeconds(drv.leaseTTL()),
+		)
+		if err != nil {
+			return false, err //nolint:wrapcheck
+		}
+
+		updated, err := result.RowsAffected()
+
+		return err == nil && updated > 0, nil
+	})
+	if errors.Is(err, driver.ErrLockTimeout) {
+		drv.logger().Warn("timed out waiting for the migration lease", "table", tableName, "timeout", timeout)
+	}
+
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	held := lease.Start(holder, drv.leaseTTL(),
+		func() (bool, error) { return drv.refreshLease(&tableName, id, holder) },
+		drv.loseLease,
+	)
+
+	drv.mutex.Lock()
+	drv.lease = held
+	drv.leaseID = id
+	drv.mutex.Unlock()
+
+	drv.logger().Debug("acquired migration lease", "table", tableName, "holder", holder)
+
+	return nil
+}
+
+// releaseLease stops the heartbeat and frees the lease row, see lease.Lease.Release.
+func (drv *mysqlDriver) releaseLease() error {
+	drv.mutex.Lock()
+	held := drv.lease
+	id := drv.leaseID
+	drv.lease = nil
+	drv.mutex.Unlock()
+
+	err := held.Release(func() (bool, error) {
+		result, err := drv.pool.ExecContext(context.Background(),
+			fmt.Sprintf("UPDATE %s SET run_id = NULL WHERE id = ? AND run_id = ?", drv.makeEscapedMigrationsTableName()),
+			id,
+			held.Holder,
+		)
+		if err != nil {
+			return false, err //nolint:wrapcheck
+		}
+
+		released, err := result.RowsAffected()
+
+		return err != nil || released > 0, nil
+	})
+	if errors.Is(err, ErrLockLost) {
+		drv.logger().Error("the migration lease was lost during the run", "holder", held.Holder, "error", err)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// currentLease is the lease held between Lock and Unlock, nil if leases are not used.
+func (drv *mysqlDriver) currentLease() *lease.Lease {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	return drv.lease
+}
+
+// refreshLease moves the heartbeat of the lease forward and reports whether the lease row is still held.
+func (drv *mysqlDriver) refreshLease(escapedTableName *string, id int64, holder string) (bool, error) {
+	ctx := context.Background()
+
+	result, err := drv.pool.ExecContext(ctx,
+		fmt.Sprintf("UPDATE %s SET end_time = NOW() WHERE id = ? AND run_id = ?", *escapedTableName),
+		id,
+		holder,
+	)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+
+	if updated, err := result.RowsAffected(); err == nil && updated > 0 {
+		return true, nil
+	}
+
+	// MySQL doesn't count rows whose values have not changed, e.g. when end_time is refreshed within the same second.
+	rows, err := drv.pool.QueryContext(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id = ? AND run_id = ?", *escapedTableName),
+		id,
+		holder,
+	)
+	if err != nil {
+		return false, err //nolint:wrapcheck
+	}
+	defer rows.Close()
+
+	var count int64
+
+	if rows.Next() {
+		if err = rows.Scan(&count); err != nil {
+			return false, err //nolint:wrapcheck
+		}
+	}
+
+	return count > 0, rows.Err() //nolint:wrapcheck
+}
+
+// loseLease kills the statement of the running migration, as the run is not protected from other instances
+// anymore. Migrations that follow fail with the error, and so does Unlock.
+func (drv *mysqlDriver) loseLease(err error) {
+	drv.logger().Error("the migration lease was lost during the run", "error", err)
+
+	// CancelMigration logs its failures.
+	_ = drv.CancelMigration()
+}
+
+// findLeaseRow returns the ID of the lease row, inserting it if the table has none. Should several
+// instances insert one at once, the earliest row is the lease and the rest are ignored.
+func (drv *mysqlDriver) findLeaseRow(ctx context.Context, escapedTableName *string) (int64, error) {
+	id, err := drv.queryLeaseRow(ctx, escapedTableName)
+	if err != nil || id.Valid {
+		return id.Int64, err
+	}
+
+	_, err = drv.pool.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name) VALUES (?, 0, ?)", *escapedTableName),
+		leaseNamespace,
+		leaseName,
+	)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	id, err = drv.queryLeaseRow(ctx, escapedTableName)
+
+	return id.Int64, err
+}
+
+func (drv *mysqlDriver) queryLeaseRow(ctx context.Context, escapedTableName *string) (sql.NullInt64, error) {
+	var id sql.NullInt64
+
+	rows, err := drv.pool.QueryContext(ctx,
+		fmt.Sprintf("SELECT MIN(id) FROM %s WHERE namespace = ?", *escapedTableName),
+		leaseNamespace,
+	)
+	if err != nil {
+		return id, err //nolint:wrapcheck
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&id)
+	}
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	return id, err //nolint:wrapcheck
+}
+
+// leaseTTL is DriverConfig.LeaseTTL, or DefaultTiDBLeaseTTL for TiDB. Locks are leases when it is not zero.
+func (drv *mysqlDriver) leaseTTL() time.Duration {
+	if drv.config.LeaseTTL == 0 && drv.config.TiDB {
+		return DefaultTiDBLeaseTTL
+	}
+
+	return drv.config.LeaseTTL
+}
+
+func leaseSeconds(ttl time.Duration) int64 {
+	return int64(math.Ceil(ttl.Seconds()))
+}
@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+)
+
+// maxLockNameLength is the limit MySQL puts on names of user-level locks.
+const maxLockNameLength = 64
+
+// ErrLockLost is driver.ErrLockLost, kept for callers that match it by this name.
+var ErrLockLost = driver.ErrLockLost
+
+// Lock takes a user-level lock named after the migrations table with GET_LOCK. The lock belongs to
+// the connection, so it is taken on the dedicated connection of the run, and MySQL releases it
+// when the connection is closed or dropped, e.g. after the process has crashed. Connections that don't implement
+// Conn must be dedicated connections themselves, e.g. *sql.Conn. With DriverConfig.LeaseTTL or DriverConfig.TiDB,
+// a lease row in the migrations table is taken instead.
+func (drv *mysqlDriver) Lock(timeout time.Duration) error {
+	if drv.leaseTTL() > 0 {
+		return drv.acquireLease(timeout)
+	}
+
+	return drv.getLock(timeout)
+}
+
+func (drv *mysqlDriver) getLock(timeout time.Duration) error {
+	ctx := context.Background()
+
+	name, err := drv.lockName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	var acquired sql.NullInt64
+
+	rows, err := drv.query(ctx, "SELECT GET_LOCK(?, ?)", name, int64(math.Ceil(timeout.Seconds())))
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err = rows.Scan(&acquired); err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+	}
+
+	if acquired.Int64 != 1 {
+		drv.logger().Warn("timed out waiting for the migration lock", "lock", name, "timeout", timeout)
+		return driver.ErrLockTimeout
+	}
+
+	return nil
+}
+
+// Unlock releases the lock taken by Lock.
+func (drv *mysqlDriver) Unlock() error {
+	if drv.leaseTTL() > 0 {
+		return drv.releaseLease()
+	}
+
+	return drv.releaseLock()
+}
+
+// releaseLock releases the lock with RELEASE_LOCK, which tells whether the connection still held it.
+// It didn't when the connection has been dropped and the lock released by MySQL, so that the run may not have
+// been protected from other processes.
+func (drv *mysqlDriver) releaseLock() error {
+	ctx := context.Background()
+
+	name, err := drv.lockName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+
+	rows, err := drv.query(ctx, "SELECT RELEASE_LOCK(?)", name)
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	defer rows.Close()
+
+	var released sql.NullInt64
+
+	if rows.Next() {
+		if err = rows.Scan(&released); err != nil {
+			return fmt.Errorf("failed to release lock: %w", err)
+		}
+	}
+
+	if released.Int64 != 1 {
+		drv.logger().Error("the migration lock was lost during the run", "lock", name)
+		return fmt.Errorf("%w: %s", ErrLockLost, name)
+	}
+
+	return nil
+}
+
+// lockName names the lock after the schema and the migrations table, as GET_LOCK locks are shared by the server.
+func (drv *mysqlDriver) lockName(ctx context.Context) (string, error) {
+	databaseName, err := drv.databaseName(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("henka:%s.%s", databaseName, drv.config.MigrationsTableName)
+	if len(name) <= maxLockNameLength {
+		return name, nil
+	}
+
+	hash := sha256.Sum256([]byte(name))
+
+	return "henka:" + hex.EncodeToString(hash[:])[:maxLockNameLength-len("henka:")], nil
+}
+
+// Lock of mapped tables always takes a GET_LOCK lock, as there is no place for the lease row.
+func (drv *mappedDriver) Lock(timeout time.Duration) error {
+	if drv.base.config.LeaseTTL > 0 {
+		return fmt.Errorf("%w: leases are not supported with mapped columns", ErrInvalidLogColumns)
+	}
+
+	return drv.base.getLock(timeout)
+}
+
+func (drv *mappedDriver) Unlock() error {
+	return drv.base.releaseLock()
+}
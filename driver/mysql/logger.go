@@ -0,0 +1,26 @@
+package mysql
+
+// Logger receives structured log lines of the driver. Args are alternating keys and values.
+// It is satisfied by *slog.Logger and henka.Logger.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// logger returns DriverConfig.Logger, or a logger that discards everything.
+func (drv *mysqlDriver) logger() Logger {
+	if drv.config.Logger == nil {
+		return nopLogger{}
+	}
+
+	return drv.config.Logger
+}
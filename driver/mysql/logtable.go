@@ -0,0 +1,250 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/driver"
+)
+
+// LogTableNamePlaceholder is replaced with the escaped migrations log table name in LogTableTemplate.
+const LogTableNamePlaceholder = "{{table}}"
+
+// DefaultLogTableTemplate creates the migrations log table unless DriverConfig.LogTableTemplate is set.
+// Custom templates may add columns and table options, but must keep the columns of this one. The options
+// of DriverConfig.LogTableCharset, LogTableCollation and LogTableEngine are appended to this template only.
+const DefaultLogTableTemplate = "CREATE TABLE IF NOT EXISTS " + LogTableNamePlaceholder + " (" +
+	"id             int not null auto_increment, " +
+	"version        bigint, " +
+	"migration_name varchar(100) null, " +
+	"direction      char(1) null, " + // "u" or "d"
+	"start_time     datetime default CURRENT_TIMESTAMP not null, " +
+	"end_time       datetime null, " +
+	"run_id         varchar(64) null, " +
+	"checksum       char(64) null, " +
+	"progress       int null, " + // committed statements of an unfinished chunked migration
+	"script         longblob null, " +
+	"script_codec   varchar(16) null, " +
+	"error_message  text null, " +
+	"namespace      varchar(64) not null default '', " +
+	"applied_by     varchar(100) null, " +
+	"hostname       varchar(255) null, " +
+	"app_version    varchar(100) null, " +
+	"execution_time_ms bigint null, " +
+	"primary key (id)" +
+	")"
+
+// DefaultLogTableCharset is the character set of the log table unless DriverConfig.LogTableCharset is set.
+const DefaultLogTableCharset = "utf8mb4"
+
+// TiDBTableOptions are appended to DefaultLogTableTemplate with DriverConfig.TiDB. TiDB servers allocate
+// auto-increment IDs from caches of their own, which would break the order of log entries. The option is
+// in a TiDB comment, so that MySQL ignores it; versions of TiDB that don't know it ignore it as well.
+const TiDBTableOptions = " /*T![auto_id_cache] AUTO_ID_CACHE=1 */"
+
+// logTableColumns are the columns the driver reads and writes, with the definitions of DefaultLogTableTemplate
+// that upgradeLogTable adds them with. Base columns are in every layout of the log, so that tables without them
+// are not taken for logs.
+var logTableColumns = []logTableColumn{ // nolint:gochecknoglobals
+	{"id", "int not null auto_increment", false},
+	{"version", "bigint", true},
+	{"migration_name", "varchar(100) null", true},
+	{"direction", "char(1) null", true},
+	{"start_time", "datetime default CURRENT_TIMESTAMP not null", true},
+	{"end_time", "datetime null", true},
+	{"run_id", "varchar(64) null", false},
+	{"checksum", "char(64) null", false},
+	{"progress", "int null", false},
+	{"script", "longblob null", false},
+	{"script_codec", "varchar(16) null", false},
+	{"error_message", "text null", false},
+	{"namespace", "varchar(64) not null default ''", false},
+	{"applied_by", "varchar(100) null", false},
+	{"hostname", "varchar(255) null", false},
+	{"app_version", "varchar(100) null", false},
+	{"execution_time_ms", "bigint null", false},
+}
+
+type logTableColumn struct {
+	name       string
+	definition string
+	base       bool
+}
+
+func (drv *mysqlDriver) makeLogTableDDL(escapedTableName string) string {
+	template := drv.config.LogTableTemplate
+	if template == "" {
+		template = DefaultLogTableTemplate + drv.makeLogTableOptions()
+		if drv.config.TiDB {
+			template += TiDBTableOptions
+		}
+	}
+
+	return strings.ReplaceAll(template, LogTableNamePlaceholder, escapedTableName)
+}
+
+func (drv *mysqlDriver) makeLogTableOptions() string {
+	options := ""
+	if drv.config.LogTableEngine != "" {
+		options += fmt.Sprintf(" ENGINE = '%s'", escapeMysqlString(drv.config.LogTableEngine))
+	}
+
+	charset := drv.config.LogTableCharset
+	if charset == "" {
+		charset = DefaultLogTableCharset
+	}
+
+	options += fmt.Sprintf(" DEFAULT CHARACTER SET = '%s'", escapeMysqlString(charset))
+	if drv.config.LogTableCollation != "" {
+		options += fmt.Sprintf(" COLLATE = '%s'", escapeMysqlString(drv.config.LogTableCollation))
+	}
+
+	return options
+}
+
+// execLogTableDDL executes DDL of the log table with DriverConfig.LogTableSQLMode in effect, if it is set.
+// The mode is set on a connection of its own, or on the connection of the run and restored afterwards,
+// so that migrations run with the sql_mode of the server.
+func (drv *mysqlDriver) execLogTableDDL(ctx context.Context, ddl string) error {
+	db := drv.db()
+
+	if drv.config.LogTableSQLMode == "" {
+		_, err := db.ExecContext(ctx, ddl)
+		return err //nolint:wrapcheck
+	}
+
+	if pool, ok := db.(connPool); ok {
+		conn, err := pool.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to take a connection: %w", err)
+		}
+		defer conn.Close()
+
+		db = conn
+	}
+
+	_, err := db.ExecContext(ctx, "SET @henka_sql_mode = @@SESSION.sql_mode, SESSION sql_mode = ?", drv.config.LogTableSQLMode)
+	if err != nil {
+		return fmt.Errorf("failed to set sql_mode: %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, ddl)
+
+	if _, restoreErr := db.ExecContext(ctx, "SET SESSION sql_mode = @henka_sql_mode"); err == nil && restoreErr != nil {
+		return fmt.Errorf("failed to restore sql_mode: %w", restoreErr)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// checkLogTableColumns makes sure that a table created from a custom template has all the columns the driver needs.
+func (drv *mysqlDriver) checkLogTableColumns(ctx context.Context) error {
+	missing, err := drv.findMissingLogTableColumns(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for _, column := range missing {
+			names = append(names, column.name)
+		}
+
+		return fmt.Errorf("%w: missing columns %s", driver.ErrInvalidLogTable, strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// upgradeLogTable brings a log table created by an older version of the driver to the current layout
+// by adding the columns it lacks, including the id column that the log tables of the legacy mig driver
+// don't have. Entries of such tables are numbered in the order they are stored, which is the order they were
+// written in for InnoDB tables without a primary key. Existing entries get the defaults of the added columns.
+// Tables that lack base columns are not logs of any version and are rejected.
+func (drv *mysqlDriver) upgradeLogTable(ctx context.Context, escapedTableName string) error {
+	missing, err := drv.findMissingLogTableColumns(ctx)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+
+	clauses := make([]string, 0, len(missing)+1)
+	missingBase := make([]string, 0)
+
+	for _, column := range missing {
+		if column.base {
+			missingBase = append(missingBase, column.name)
+			continue
+		}
+
+		if column.name == "id" {
+			clauses = append(clauses, "ADD COLUMN id "+column.definition+" FIRST", "ADD PRIMARY KEY (id)")
+			continue
+		}
+
+		clauses = append(clauses, "ADD COLUMN "+column.name+" "+column.definition)
+	}
+
+	if len(missingBase) > 0 {
+		return fmt.Errorf("%w: %s lacks columns %s of migration logs",
+			driver.ErrInvalidLogTable, escapedTableName, strings.Join(missingBase, ", "))
+	}
+
+	drv.logger().Warn("upgrading migrations table", "table", escapedTableName, "changes", strings.Join(clauses, ", "))
+
+	err = drv.execLogTableDDL(ctx, fmt.Sprintf("ALTER TABLE %s %s", escapedTableName, strings.Join(clauses, ", ")))
+	if err == nil {
+		return nil
+	}
+
+	// another process may have upgraded the table in the meantime
+	if missing, checkErr := drv.findMissingLogTableColumns(ctx); checkErr == nil && len(missing) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("failed to upgrade migrations table %s: %w", escapedTableName, err)
+}
+
+// findMissingLogTableColumns lists the columns the driver needs that the log table lacks.
+func (drv *mysqlDriver) findMissingLogTableColumns(ctx context.Context) ([]logTableColumn, error) {
+	databaseName, err := drv.databaseName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := drv.db().QueryContext(
+		ctx,
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?",
+		databaseName,
+		drv.config.MigrationsTableName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool)
+
+	for rows.Next() {
+		var column string
+		if err = rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("failed to list columns: %w", err)
+		}
+
+		present[strings.ToLower(column)] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+
+	missing := make([]logTableColumn, 0)
+
+	for _, column := range logTableColumns {
+		if !present[column.name] {
+			missing = append(missing, column)
+		}
+	}
+
+	return missing, nil
+}
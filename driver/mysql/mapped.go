@@ -0,0 +1,211 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
+)
+
+var ErrInvalidLogColumns = errors.New("invalid log columns mapping")
+
+// LogColumns maps the migrations log onto an existing table with a schema of its own, e.g. a history
+// table of a homegrown tool. Version, Name and AppliedAt are required.
+type LogColumns struct {
+	Version   string
+	Name      string
+	AppliedAt string
+
+	// ID is an auto-incremented column. Without it, entries are ordered by AppliedAt and Version.
+	ID string
+
+	// Direction is stored with DriverConfig.Directions. Without it, every row is an applied version,
+	// and down migrations delete the rows of their version.
+	Direction string
+}
+
+// mappedDriver reads and appends to a table mapped with LogColumns. Features that need columns of
+// the henka log table, such as chunked migrations and stored scripts, are not available with it.
+type mappedDriver struct {
+	base    *mysqlDriver
+	columns LogColumns
+}
+
+func (drv *mappedDriver) BeginRun() error {
+	return drv.base.BeginRun()
+}
+
+func (drv *mappedDriver) EndRun() error {
+	return drv.base.EndRun()
+}
+
+func (drv *mappedDriver) CancelMigration() error {
+	return drv.base.CancelMigration()
+}
+
+func (drv *mappedDriver) DumpSchema() (*schema.Schema, error) {
+	return drv.base.DumpSchema()
+}
+
+func (drv *mappedDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *mappedDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	if err := drv.checkColumns(); err != nil {
+		return nil, err
+	}
+
+	selected := []string{drv.column(drv.columns.Version), drv.column(drv.columns.Name), drv.column(drv.columns.AppliedAt)}
+	if drv.columns.Direction != "" {
+		selected = append(selected, drv.column(drv.columns.Direction))
+	}
+
+	order := drv.column(drv.columns.AppliedAt) + ", " + drv.column(drv.columns.Version)
+	if drv.columns.ID != "" {
+		selected = append(selected, drv.column(drv.columns.ID))
+		order = drv.column(drv.columns.ID)
+	}
+
+	rows, err := drv.base.query(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY %s",
+		strings.Join(selected, ", "), drv.base.makeEscapedMigrationsTableName(), order,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]migration.Log, 0)
+
+	for rows.Next() {
+		var log migration.Log
+		var appliedAt, direction sql.NullString
+
+		dest := []interface{}{&log.Version, &log.Name, &appliedAt}
+		if drv.columns.Direction != "" {
+			dest = append(dest, &direction)
+		}
+		if drv.columns.ID != "" {
+			dest = append(dest, &log.ID)
+		}
+
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+		}
+
+		if drv.columns.Direction != "" {
+			if log.Direction, err = drv.base.decodeDirection(direction.String); err != nil {
+				return nil, err
+			}
+		}
+
+		log.AppliedAt, err = time.Parse("2006-01-02 15:04:05", appliedAt.String)
+		if err != nil {
+			log.AppliedAt = time.Time{}
+		}
+
+		log.Baseline = log.Name == migration.BaselineName
+
+		result = append(result, log)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (drv *mappedDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+func (drv *mappedDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) (err error) {
+	if err = drv.checkColumns(); err != nil {
+		return err
+	}
+
+	endRun, err := drv.base.useDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if endErr := endRun(); endErr != nil && err == nil {
+			err = endErr
+		}
+	}()
+
+	if err = drv.base.execScript(ctx, drv.base.db(), script); err != nil {
+		return err
+	}
+
+	return drv.writeLog(ctx, migration.Log{Migration: mig, Direction: dir, AppliedAt: time.Now()})
+}
+
+func (drv *mappedDriver) WriteLog(log migration.Log) error {
+	return drv.writeLog(context.Background(), log)
+}
+
+func (drv *mappedDriver) writeLog(ctx context.Context, log migration.Log) error {
+	if err := drv.checkColumns(); err != nil {
+		return err
+	}
+
+	tableName := drv.base.makeEscapedMigrationsTableName()
+
+	if drv.columns.Direction == "" && log.Direction == migration.Down {
+		_, err := drv.base.db().ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE %s = ?", tableName, drv.column(drv.columns.Version)),
+			log.Version,
+		)
+		if err != nil {
+			return fmt.Errorf("error when writing migration log: %w", err)
+		}
+
+		return nil
+	}
+
+	columns := []string{drv.column(drv.columns.Version), drv.column(drv.columns.Name), drv.column(drv.columns.AppliedAt)}
+	values := []interface{}{log.Version, log.Name, log.AppliedAt}
+
+	if drv.columns.Direction != "" {
+		columns = append(columns, drv.column(drv.columns.Direction))
+		values = append(values, drv.base.encodeDirection(log.Direction))
+	}
+
+	_, err := drv.base.db().ExecContext(ctx,
+		fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES (?%s)",
+			tableName, strings.Join(columns, ", "), strings.Repeat(", ?", len(columns)-1),
+		),
+		values...,
+	)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *mappedDriver) checkColumns() error {
+	if drv.columns.Version == "" || drv.columns.Name == "" || drv.columns.AppliedAt == "" {
+		return fmt.Errorf("%w: version, name and applied at columns are required", ErrInvalidLogColumns)
+	}
+
+	if drv.base.config.Namespace != "" {
+		return fmt.Errorf("%w: namespaces are not supported with mapped columns", ErrInvalidLogColumns)
+	}
+
+	return nil
+}
+
+func (drv *mappedDriver) column(name string) string {
+	return fmt.Sprintf("`%s`", escapeMysqlString(name))
+}
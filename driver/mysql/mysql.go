@@ -1,51 +1,424 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
 	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
 )
 
 type DriverConfig struct {
+	// DatabaseName is the schema of the migrations table and of DumpSchema. When it is empty, the schema selected
+	// by the DSN is used and the migrations table is not qualified, for users that may not name other schemas.
+	// CreateDatabaseIfMissing has no effect then. Otherwise scripts are executed with the schema selected by USE.
 	DatabaseName        string
 	MigrationsTableName string
+
+	// StatementsPerCommit makes Migrate split scripts into statements and commit every StatementsPerCommit
+	// of them, recording progress in the migrations log. A migration that fails halfway resumes after
+	// the last commit when it is retried with the same script. Zero executes scripts in a single call.
+	StatementsPerCommit int
+
+	// SplitStatements makes Migrate execute scripts statement by statement instead of in a single call. It is needed
+	// for scripts with DELIMITER directives, e.g. around triggers and stored procedures, as the server doesn't
+	// understand them. See sqlscript.Split. Scripts are always split when StatementsPerCommit is set.
+	SplitStatements bool
+
+	// StoreScripts makes Migrate save executed scripts in the migrations log. They are read back with ReadExecutedScript.
+	StoreScripts bool
+
+	// ScriptCodec encodes stored scripts, e.g. GzipCodec. Nil stores scripts as is.
+	ScriptCodec ScriptCodec
+
+	// SkipLogTableCreation disables CREATE TABLE IF NOT EXISTS for the migrations log, for users that lack
+	// the CREATE privilege. The table must be created beforehand then.
+	SkipLogTableCreation bool
+
+	// LogTableTemplate overrides DefaultLogTableTemplate, e.g. to add table options or columns. The table name is
+	// substituted for LogTableNamePlaceholder. The created table is checked to have all the columns the driver needs.
+	LogTableTemplate string
+
+	// LogTableCharset, LogTableCollation and LogTableEngine are the table options of the log table created from
+	// DefaultLogTableTemplate. The charset is DefaultLogTableCharset, and the collation and engine are the defaults
+	// of the server when empty. Custom templates carry table options of their own.
+	LogTableCharset   string
+	LogTableCollation string
+	LogTableEngine    string
+
+	// LogTableSQLMode is the sql_mode the log table is created and upgraded with, for servers whose sql_mode
+	// rejects the DDL, e.g. with modes enforced by hosting providers. Empty uses the sql_mode of the server.
+	LogTableSQLMode string
+
+	// Directions is how directions are written to the log, CharDirections if zero. Reading accepts
+	// "u", "d", "up" and "down" as well, so that logs written by other tools can be read as is.
+	Directions DirectionEncoding
+
+	// LogColumns maps the log onto an existing table instead of the one henka creates. See LogColumns.
+	LogColumns *LogColumns
+
+	// Logger receives log lines about the log table, executed chunks and failures. Nil disables logging.
+	Logger Logger
+
+	// Namespace separates independent streams of migrations, e.g. of several services, that share
+	// the migrations log table. Every stream sees only its own entries, so versions may repeat across streams.
+	// Not supported with LogColumns.
+	Namespace string
+
+	// CreateDatabaseIfMissing creates DatabaseName before it is first used, so that a fresh server can be
+	// bootstrapped without manual steps. CharacterSet and Collation of the created database default to
+	// the ones of the server when empty. The CREATE privilege is needed then.
+	CreateDatabaseIfMissing bool
+	CharacterSet            string
+	Collation               string
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor. Not recorded with LogColumns.
+	AppliedBy  string
+	AppVersion string
+
+	// LeaseTTL makes Lock take a lease row in the migrations table instead of a GET_LOCK lock, which belongs
+	// to a connection and is lost behind proxies and load balancers that don't keep sessions. The holder refreshes
+	// the lease every LeaseTTL/3 through the connection given to NewDriver, which should be a pool then. A lease
+	// that has not been refreshed for LeaseTTL is expired and taken over, e.g. after the holder has crashed.
+	// A holder whose lease has been taken over or could not be refreshed for LeaseTTL kills the running statement,
+	// and later migrations and Unlock fail with ErrLockLost.
+	// The lease row belongs to the reserved "henka:lease" namespace. Not supported with LogColumns.
+	LeaseTTL time.Duration
+
+	// TiDB adjusts the driver to TiDB: Lock takes a lease, DefaultTiDBLeaseTTL long unless LeaseTTL is set, as GET_LOCK
+	// is a no-op before TiDB 5.3, and the default log table caches one auto-increment ID at a time, so that IDs of log
+	// entries written through different TiDB servers are in order. See TiDBTableOptions.
+	TiDB bool
+}
+
+var (
+	ErrTransactionsNotSupported = errors.New("connection does not support transactions")
+	ErrNoDatabaseSelected       = errors.New("no database is selected by DriverConfig.DatabaseName or the DSN")
+)
+
+// Execer is the connection the driver needs. It is satisfied by *sql.DB, *sql.Conn, *sqlx.DB and instrumented
+// wrappers. Connections that also implement BeginTx are needed for StatementsPerCommit, and connections
+// that implement Conn like *sql.DB are needed to run all migrations of a run on a dedicated connection.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+type connPool interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
 }
 
 type mysqlDriver struct {
-	conn   *sql.DB
+	pool   Execer
 	config DriverConfig
+
+	// pinned is the connection dedicated to the current run, nil outside of runs
+	pinned   *sql.Conn
+	pinnedID uint64
+	mutex    sync.Mutex
+
+	// inTx is set between BeginTx and CommitTx or RollbackTx
+	inTx bool
+
+	// tableExists is set once the migrations log table has been created or found
+	tableExists bool
+
+	// databaseExists is set once the database has been created or found, see DriverConfig.CreateDatabaseIfMissing
+	databaseExists bool
+	databaseMutex  sync.Mutex
+
+	// currentDatabase is the schema selected by the DSN, found once when DriverConfig.DatabaseName is empty
+	currentDatabase string
+
+	executor driver.Executor
+
+	// lease is the lease row with ID leaseID held between Lock and Unlock, see DriverConfig.LeaseTTL and DriverConfig.TiDB
+	lease   *lease.Lease
+	leaseID int64
+}
+
+func NewDriver(conn Execer, config DriverConfig) driver.Driver {
+	drv := &mysqlDriver{
+		pool:     conn,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+
+	if config.LogColumns != nil {
+		return &mappedDriver{base: drv, columns: *config.LogColumns}
+	}
+
+	return drv
+}
+
+// BeginRun takes a dedicated connection from the pool, so that session variables, locks and
+// temporary tables created by migrations of one run live on the same connection. Connections that are not
+// pools are used as is. The database of the config is selected on the connection once it exists.
+func (drv *mysqlDriver) BeginRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return driver.ErrRunInProgress
+	}
+
+	ctx := context.Background()
+
+	pool, ok := drv.pool.(connPool)
+	if !ok {
+		return drv.selectDatabase(ctx, drv.pool)
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to take a dedicated connection: %w", err)
+	}
+
+	if err = drv.selectDatabase(ctx, conn); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	if err = conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&drv.pinnedID); err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("failed to get id of the dedicated connection: %w", err)
+	}
+
+	drv.pinned = conn
+
+	return nil
+}
+
+// EndRun returns the dedicated connection to the pool.
+func (drv *mysqlDriver) EndRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned == nil {
+		return nil
+	}
+
+	err := drv.pinned.Close()
+	drv.pinned = nil
+	drv.inTx = false
+
+	if err != nil {
+		return fmt.Errorf("failed to release the dedicated connection: %w", err)
+	}
+
+	return nil
+}
+
+// selectDatabase creates the database of the config if it is missing and selects it on the connection.
+func (drv *mysqlDriver) selectDatabase(ctx context.Context, conn Execer) error {
+	if err := drv.ensureDatabaseExists(ctx, conn); err != nil {
+		return err
+	}
+
+	if drv.config.DatabaseName == "" {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("USE `%s`", escapeMysqlString(drv.config.DatabaseName))); err != nil {
+		return fmt.Errorf("failed to select database %s: %w", drv.config.DatabaseName, err)
+	}
+
+	return nil
+}
+
+// useDatabase selects the database of the config for scripts executed outside of runs, e.g. when the driver
+// is used directly, as USE only applies to a single connection of a pool. Pools are given a run of their own,
+// which is ended by the returned function, and the database is selected on other connections as they are dedicated.
+func (drv *mysqlDriver) useDatabase(ctx context.Context) (func() error, error) {
+	noop := func() error { return nil }
+
+	drv.mutex.Lock()
+	pinned := drv.pinned != nil
+	drv.mutex.Unlock()
+
+	if pinned || drv.config.DatabaseName == "" {
+		return noop, nil
+	}
+
+	if _, ok := drv.pool.(connPool); ok {
+		if err := drv.BeginRun(); err != nil {
+			return nil, err
+		}
+
+		return drv.EndRun, nil
+	}
+
+	return noop, drv.selectDatabase(ctx, drv.pool)
 }
 
-func NewDriver(conn *sql.DB, config DriverConfig) driver.Driver {
-	conn.Exec(fmt.Sprintf("use %s", escapeMysqlString(config.DatabaseName))) // todo: do this before migration and then revert
+// CancelMigration kills the statement that is being executed on the dedicated connection of the current run.
+// Nothing can be canceled outside of runs, or when the connection is not a pool.
+func (drv *mysqlDriver) CancelMigration() error {
+	drv.mutex.Lock()
+	pinned, id := drv.pinned != nil, drv.pinnedID
+	drv.mutex.Unlock()
 
-	return &mysqlDriver{
-		conn:   conn,
-		config: config,
+	if !pinned {
+		return nil
 	}
+
+	drv.logger().Warn("killing the query of the running migration", "connection_id", id)
+
+	if _, err := drv.pool.ExecContext(context.Background(), fmt.Sprintf("KILL QUERY %d", id)); err != nil {
+		drv.logger().Error("failed to kill the query of the running migration", "connection_id", id, "error", err)
+		return fmt.Errorf("failed to cancel migration: %w", err)
+	}
+
+	return nil
+}
+
+// beginTx begins a transaction on the connection of the current run, or on the pool outside of runs.
+func (drv *mysqlDriver) beginTx(ctx context.Context) (*sql.Tx, error) {
+	beginner, ok := drv.db().(txBeginner)
+	if !ok {
+		return nil, ErrTransactionsNotSupported
+	}
+
+	return beginner.BeginTx(ctx, nil) //nolint:wrapcheck
+}
+
+// db returns the connection of the current run, or the pool outside of runs.
+func (drv *mysqlDriver) db() Execer {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return drv.pinned
+	}
+
+	return drv.pool
 }
 
 func (drv *mysqlDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.listMigrationsLog(context.Background(), 0)
+}
+
+func (drv *mysqlDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	return drv.listMigrationsLog(ctx, 0)
+}
+
+func (drv *mysqlDriver) ListMigrationsLogAfter(id uint64) (*[]migration.Log, error) {
+	return drv.listMigrationsLog(context.Background(), id)
+}
+
+// ListMigrationsState picks the latest entry of every version with a join instead of a window function,
+// so that it works on MySQL 5.6 and MariaDB 10.2 as well.
+func (drv *mysqlDriver) ListMigrationsState() (*[]migration.Log, error) {
 	tableName := drv.makeEscapedMigrationsTableName()
 
-	if err := drv.ensureMigrationsTableExists(&tableName); err != nil {
+	if err := drv.ensureMigrationsTableExists(context.Background(), &tableName); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	rows, err := drv.query(context.Background(), fmt.Sprintf(
+		"SELECT l.id, l.version, l.migration_name, l.direction, l.start_time, l.end_time, l.run_id, l.checksum, "+
+			"l.applied_by, l.hostname, l.app_version, l.execution_time_ms FROM %s l "+
+			"INNER JOIN (SELECT MAX(id) AS id FROM %s WHERE namespace = ? AND progress IS NULL GROUP BY version) latest "+
+			"ON latest.id = l.id ORDER BY l.id",
+		tableName, tableName,
+	), drv.config.Namespace)
+	if err != nil {
 		return nil, fmt.Errorf("failed to list applied versions: %w", err)
 	}
+	defer rows.Close()
+
+	result, err := drv.fetchMigrationsLog(rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ListInterruptedMigrations lists progress rows of chunked migrations that have not completed.
+func (drv *mysqlDriver) ListInterruptedMigrations() (*[]migration.Log, error) {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(context.Background(), &tableName); err != nil {
+		return nil, fmt.Errorf("failed to list interrupted migrations: %w", err)
+	}
 
-	rows, err := drv.query(fmt.Sprintf(
-		"SELECT version, migration_name, direction, start_time FROM %s ORDER BY id",
+	rows, err := drv.query(context.Background(), fmt.Sprintf(
+		"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms, error_message "+
+			"FROM %s WHERE namespace = ? AND progress IS NOT NULL ORDER BY id",
 		tableName,
-	))
+	), drv.config.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interrupted migrations: %w", err)
+	}
+	defer rows.Close()
+
+	result, err := drv.fetchMigrationsLog(rows, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (drv *mysqlDriver) GetMaxAppliedVersion() (migration.Version, bool, error) {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(context.Background(), &tableName); err != nil {
+		return 0, false, fmt.Errorf("failed to get max applied version: %w", err)
+	}
+
+	rows, err := drv.query(context.Background(), fmt.Sprintf(
+		"SELECT MAX(l.version) FROM %s l "+
+			"INNER JOIN (SELECT MAX(id) AS id FROM %s WHERE namespace = ? AND progress IS NULL GROUP BY version) latest "+
+			"ON latest.id = l.id WHERE l.direction = ? AND l.version <> ?",
+		tableName, tableName,
+	), drv.config.Namespace, drv.encodeDirection(migration.Up), repeatableVersion)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get max applied version: %w", err)
+	}
+	defer rows.Close()
+
+	var version sql.NullInt64
+	if rows.Next() {
+		if err = rows.Scan(&version); err != nil {
+			return 0, false, fmt.Errorf("failed to get max applied version: %w", err)
+		}
+	}
+
+	return migration.Version(version.Int64), version.Valid, nil
+}
+
+func (drv *mysqlDriver) listMigrationsLog(ctx context.Context, afterID uint64) (*[]migration.Log, error) {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(ctx, &tableName); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	rows, err := drv.query(ctx, fmt.Sprintf(
+		"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms FROM %s "+
+			"WHERE namespace = ? AND id > ? AND progress IS NULL ORDER BY id",
+		tableName,
+	), drv.config.Namespace, afterID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list applied versions: %w", err)
 	}
 	defer rows.Close()
 
-	result, err := drv.fetchMigrationsLog(rows)
+	result, err := drv.fetchMigrationsLog(rows, false)
 	if err != nil {
 		return nil, err
 	}
@@ -54,17 +427,151 @@ func (drv *mysqlDriver) ListMigrationsLog() (*[]migration.Log, error) {
 }
 
 func (drv *mysqlDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
-	drv.conn.Exec(script) // todo: check for errors
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext executes the script and writes its log entry. A progress row that marks the migration
+// as started is committed first, so that a crash is noticed afterwards: the migration is listed
+// by ListInterruptedMigrations until it is applied.
+//
+// When the script consists of data changes only and no transaction has been started with BeginTx, the script,
+// the log entry and the removal of the progress row are committed in one transaction. Nothing but the progress row
+// survives a crash then, and retrying the migration is safe. Otherwise statements executed before a crash
+// or a failure stay applied, as DDL statements commit implicitly, and the progress row marks the database as dirty
+// until the migration is repaired or applied.
+func (drv *mysqlDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) (err error) {
+	if err = drv.currentLease().Err(); err != nil {
+		return err
+	}
+
+	endRun, err := drv.useDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if endErr := endRun(); endErr != nil && err == nil {
+			err = endErr
+		}
+	}()
+
+	if drv.config.StatementsPerCommit > 0 {
+		return drv.migrateInChunks(ctx, mig, dir, script)
+	}
+
+	storedScript, scriptCodec, err := drv.encodeScript(script)
+	if err != nil {
+		return err
+	}
+
+	tableName := drv.makeEscapedMigrationsTableName()
+	startTime := time.Now()
+
+	attemptID, err := drv.startAttempt(ctx, &tableName, mig, dir, startTime)
+	if err != nil {
+		return err
+	}
+
+	entry := appliedEntry{mig: mig, dir: dir, script: script, storedScript: storedScript, scriptCodec: scriptCodec, startTime: startTime}
+
+	if drv.canWrapInTx(script) {
+		return drv.migrateInTx(ctx, &tableName, attemptID, entry)
+	}
+
+	if err = drv.execScript(ctx, drv.db(), script); err != nil {
+		drv.logger().Error("migration script failed", "version", mig.Version, "direction", dir, "error", err)
+		drv.failAttempt(&tableName, attemptID, errors.Unwrap(err))
+
+		return err
+	}
+
+	if err = drv.writeAppliedEntry(ctx, drv.db(), &tableName, entry); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
 
-	_, err := drv.conn.Exec(
-		fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time)"+
-			"VALUES (?, ?, ?, ?, ?)", drv.makeEscapedMigrationsTableName(),
+	return nil
+}
+
+// appliedEntry is the log entry of a migration whose script has been executed.
+type appliedEntry struct {
+	mig          migration.Migration
+	dir          migration.Direction
+	script       string
+	storedScript []byte
+	scriptCodec  *string
+	startTime    time.Time
+}
+
+// writeAppliedEntry inserts the log entry and deletes the progress rows of the migration.
+func (drv *mysqlDriver) writeAppliedEntry(ctx context.Context, db Execer, escapedTableName *string, entry appliedEntry) error {
+	_, err := db.ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, end_time, checksum, script, script_codec, "+
+			"applied_by, hostname, app_version, execution_time_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", *escapedTableName,
 		),
-		mig.Version,
-		mig.Name,
-		fmt.Sprintf("%c", dir),
-		time.Now(),
+		drv.config.Namespace,
+		entry.mig.Version,
+		entry.mig.Name,
+		drv.encodeDirection(entry.dir),
+		entry.startTime,
 		time.Now(),
+		migration.Checksum([]byte(entry.script)),
+		entry.storedScript,
+		entry.scriptCodec,
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+		time.Since(entry.startTime).Milliseconds(),
+	)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return drv.clearProgress(ctx, db, escapedTableName, entry.mig, entry.dir)
+}
+
+func (drv *mysqlDriver) WriteLog(log migration.Log) error {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(context.Background(), &tableName); err != nil {
+		return fmt.Errorf("failed to write migration log: %w", err)
+	}
+
+	finishedAt := log.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = log.AppliedAt
+	}
+
+	var runID, checksum *string
+	var executionTime *int64
+	if log.RunID != "" {
+		runID = &log.RunID
+	}
+	if log.Checksum != "" {
+		checksum = &log.Checksum
+	}
+	if log.ExecutionTime > 0 {
+		milliseconds := log.ExecutionTime.Milliseconds()
+		executionTime = &milliseconds
+	}
+
+	executor := drv.executor.ForLog(log)
+
+	_, err := drv.db().ExecContext(context.Background(),
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", tableName,
+		),
+		drv.config.Namespace,
+		log.Version,
+		log.Name,
+		drv.encodeDirection(log.Direction),
+		log.AppliedAt,
+		finishedAt,
+		runID,
+		checksum,
+		executor.AppliedBy,
+		executor.Hostname,
+		executor.AppVersion,
+		executionTime,
 	)
 	if err != nil {
 		return fmt.Errorf("error when writing migration log: %w", err)
@@ -73,19 +580,75 @@ func (drv *mysqlDriver) Migrate(mig migration.Migration, dir migration.Direction
 	return nil
 }
 
-func (drv *mysqlDriver) fetchMigrationsLog(rows *sql.Rows) ([]migration.Log, error) {
+func (drv *mysqlDriver) DumpSchema() (*schema.Schema, error) {
+	ctx := context.Background()
+
+	databaseName, err := drv.databaseName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := drv.db().QueryContext(ctx,
+		"SELECT table_name, column_name, column_type, is_nullable, column_key "+
+			"FROM information_schema.columns "+
+			"WHERE table_schema = ? AND table_name <> ? "+
+			"ORDER BY table_name, ordinal_position",
+		databaseName,
+		drv.config.MigrationsTableName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query database structure: %w", err)
+	}
+	defer rows.Close()
+
+	result := schema.Schema{}
+	for rows.Next() {
+		var tableName, isNullable, columnKey string
+		var column schema.Column
+
+		if err = rows.Scan(&tableName, &column.Name, &column.Type, &isNullable, &columnKey); err != nil {
+			return nil, fmt.Errorf("failed to read database structure: %w", err)
+		}
+
+		column.Nullable = isNullable == "YES"
+		column.PrimaryKey = columnKey == "PRI"
+
+		if len(result.Tables) == 0 || result.Tables[len(result.Tables)-1].Name != tableName {
+			result.Tables = append(result.Tables, schema.Table{Name: tableName})
+		}
+
+		table := &result.Tables[len(result.Tables)-1]
+		table.Columns = append(table.Columns, column)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read database structure: %w", err)
+	}
+
+	return &result, nil
+}
+
+// fetchMigrationsLog scans rows of id, version, migration_name, direction, start_time, end_time, run_id,
+// checksum, applied_by, hostname, app_version and execution_time_ms, followed by error_message if withError is set. Entries of repeatable migrations are skipped.
+func (drv *mysqlDriver) fetchMigrationsLog(rows *sql.Rows, withError bool) ([]migration.Log, error) {
 	result := make([]migration.Log, 0)
 	for rows.Next() {
 		var log migration.Log
 		var appliedAt string
 		var direction string
+		var finishedAt, runID, checksum, errorMessage sql.NullString
+		var appliedBy, hostname, appVersion sql.NullString
+		var executionTime sql.NullInt64
+
+		dest := []interface{}{
+			&log.ID, &log.Version, &log.Name, &direction, &appliedAt, &finishedAt, &runID, &checksum,
+			&appliedBy, &hostname, &appVersion, &executionTime,
+		}
+		if withError {
+			dest = append(dest, &errorMessage)
+		}
 
-		err := rows.Scan(
-			&log.Version,
-			&log.Name,
-			&direction,
-			&appliedAt,
-		)
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
 		}
@@ -93,28 +656,42 @@ func (drv *mysqlDriver) fetchMigrationsLog(rows *sql.Rows) ([]migration.Log, err
 			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
 		}
 
-		switch strings.ToLower(direction) {
-		case "u":
-			log.Direction = migration.Up
-		case "d":
-			log.Direction = migration.Down
-		default:
-			return nil, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, direction)
+		if log.Version == repeatableVersion {
+			continue
 		}
 
+		log.Direction, err = drv.decodeDirection(direction)
+		if err != nil {
+			return nil, err
+		}
+
+		log.RunID = runID.String
+		log.Checksum = checksum.String
+		log.Baseline = log.Name == migration.BaselineName
+		log.Namespace = drv.config.Namespace
+		log.Error = errorMessage.String
+		log.AppliedBy = appliedBy.String
+		log.Hostname = hostname.String
+		log.AppVersion = appVersion.String
+		log.ExecutionTime = time.Duration(executionTime.Int64) * time.Millisecond
+
 		log.AppliedAt, err = time.Parse("2006-01-02 15:04:05", appliedAt)
 		if err != nil {
 			log.AppliedAt = time.Time{}
 		}
 
+		if finishedAt.Valid {
+			log.FinishedAt, _ = time.Parse("2006-01-02 15:04:05", finishedAt.String)
+		}
+
 		result = append(result, log)
 	}
 
 	return result, nil
 }
 
-func (drv *mysqlDriver) query(query string) (*sql.Rows, error) {
-	rows, err := drv.conn.Query(query)
+func (drv *mysqlDriver) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := drv.db().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute a query: %w", err)
 	}
@@ -125,6 +702,10 @@ func (drv *mysqlDriver) query(query string) (*sql.Rows, error) {
 }
 
 func (drv *mysqlDriver) makeEscapedMigrationsTableName() string {
+	if drv.config.DatabaseName == "" {
+		return fmt.Sprintf("`%s`", escapeMysqlString(drv.config.MigrationsTableName))
+	}
+
 	return fmt.Sprintf(
 		"`%s`.`%s`",
 		escapeMysqlString(drv.config.DatabaseName),
@@ -132,24 +713,115 @@ func (drv *mysqlDriver) makeEscapedMigrationsTableName() string {
 	)
 }
 
-func (drv *mysqlDriver) ensureMigrationsTableExists(escapedTableName *string) error {
-	_, err := drv.conn.Exec(fmt.Sprintf(
-		"CREATE TABLE IF NOT EXISTS %s ("+
-			"id             int not null auto_increment, "+
-			"version        bigint, "+
-			"migration_name varchar(100) null, "+
-			"direction      char(1) null, "+ // "u" or "d"
-			"start_time     datetime default CURRENT_TIMESTAMP not null, "+
-			"end_time       datetime null, "+
-			"primary key (id)"+
-			") default charset utf8",
-		*escapedTableName,
-	))
+func (drv *mysqlDriver) ensureMigrationsTableExists(ctx context.Context, escapedTableName *string) error {
+	if err := drv.ensureDatabaseExists(ctx, drv.db()); err != nil {
+		return err
+	}
 
+	if drv.config.SkipLogTableCreation {
+		return nil
+	}
+
+	drv.mutex.Lock()
+	exists := drv.tableExists
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	drv.logger().Debug("creating migrations table if it does not exist", "table", *escapedTableName)
+
+	err := drv.execLogTableDDL(ctx, drv.makeLogTableDDL(*escapedTableName))
 	if err != nil {
+		drv.logger().Error("failed to create migrations table", "table", *escapedTableName, "error", err)
 		return fmt.Errorf("failed to create migrations table %s: %w", *escapedTableName, err)
 	}
 
+	if drv.config.LogTableTemplate != "" {
+		if err = drv.checkLogTableColumns(ctx); err != nil {
+			return fmt.Errorf("migrations table %s does not fit the driver: %w", *escapedTableName, err)
+		}
+	} else if err = drv.upgradeLogTable(ctx, *escapedTableName); err != nil {
+		drv.logger().Error("failed to upgrade migrations table", "table", *escapedTableName, "error", err)
+		return err
+	}
+
+	drv.mutex.Lock()
+	drv.tableExists = true
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// databaseName returns DriverConfig.DatabaseName, or the schema selected by the DSN when it is empty.
+func (drv *mysqlDriver) databaseName(ctx context.Context) (string, error) {
+	if drv.config.DatabaseName != "" {
+		return drv.config.DatabaseName, nil
+	}
+
+	drv.databaseMutex.Lock()
+	current := drv.currentDatabase
+	drv.databaseMutex.Unlock()
+
+	if current != "" {
+		return current, nil
+	}
+
+	rows, err := drv.query(ctx, "SELECT DATABASE()")
+	if err != nil {
+		return "", fmt.Errorf("failed to find the current database: %w", err)
+	}
+	defer rows.Close()
+
+	var name sql.NullString
+	if rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			return "", fmt.Errorf("failed to find the current database: %w", err)
+		}
+	}
+
+	if !name.Valid || name.String == "" {
+		return "", ErrNoDatabaseSelected
+	}
+
+	drv.databaseMutex.Lock()
+	drv.currentDatabase = name.String
+	drv.databaseMutex.Unlock()
+
+	return name.String, nil
+}
+
+// ensureDatabaseExists creates the database if DriverConfig.CreateDatabaseIfMissing is set, see databaseExists.
+func (drv *mysqlDriver) ensureDatabaseExists(ctx context.Context, db Execer) error {
+	if !drv.config.CreateDatabaseIfMissing || drv.config.DatabaseName == "" {
+		return nil
+	}
+
+	drv.databaseMutex.Lock()
+	defer drv.databaseMutex.Unlock()
+
+	if drv.databaseExists {
+		return nil
+	}
+
+	ddl := fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`", escapeMysqlString(drv.config.DatabaseName))
+	if drv.config.CharacterSet != "" {
+		ddl += fmt.Sprintf(" CHARACTER SET '%s'", escapeMysqlString(drv.config.CharacterSet))
+	}
+	if drv.config.Collation != "" {
+		ddl += fmt.Sprintf(" COLLATE '%s'", escapeMysqlString(drv.config.Collation))
+	}
+
+	drv.logger().Debug("creating database if it does not exist", "database", drv.config.DatabaseName)
+
+	if _, err := db.ExecContext(ctx, ddl); err != nil {
+		drv.logger().Error("failed to create database", "database", drv.config.DatabaseName, "error", err)
+		return fmt.Errorf("failed to create database %s: %w", drv.config.DatabaseName, err)
+	}
+
+	drv.databaseExists = true
+
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/rand"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -218,6 +219,17 @@ var (
 		"direction      char(1) null, " + // "u" or "d"
 		"start_time     datetime default CURRENT_TIMESTAMP not null, " +
 		"end_time       datetime null, " +
+		"run_id         varchar(64) null, " +
+		"checksum       char(64) null, " +
+		"progress       int null, " +
+		"script         longblob null, " +
+		"script_codec   varchar(16) null, " +
+		"error_message  text null, " +
+		"namespace      varchar(64) not null default '', " +
+		"applied_by     varchar(100) null, " +
+		"hostname       varchar(255) null, " +
+		"app_version    varchar(100) null, " +
+		"execution_time_ms bigint null, " +
 		"primary key (id)" +
 		") default charset utf8;"
 	initDatabaseWithBadTableStructure = initEmptyDatabase +
@@ -240,24 +252,32 @@ var (
 	migrationErr1Sql = insertMigration + "(\"20220118120101\", \"createPermissionsTable\", \"x\", \"2022-01-19 10:04:00\", \"2022-01-19 10:04:01\");"
 
 	migration1Parsed = migration.Log{
-		Migration: migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
-		Direction: migration.Up,
-		AppliedAt: time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		ID:         1,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 0, time.UTC),
 	}
 	migration2Parsed = migration.Log{
-		Migration: migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
-		Direction: migration.Down,
-		AppliedAt: time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		ID:         2,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
 	}
 	migration3Parsed = migration.Log{
-		Migration: migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
-		Direction: migration.Up,
-		AppliedAt: time.Date(2022, 1, 19, 10, 3, 0, 0, time.UTC),
+		ID:         3,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 3, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 3, 1, 0, time.UTC),
 	}
 	migration4Parsed = migration.Log{
-		Migration: migration.Migration{Version: 20220118120101, Name: "createPermissionsTable"},
-		Direction: migration.Up,
-		AppliedAt: time.Date(2022, 1, 19, 10, 4, 0, 0, time.UTC),
+		ID:         4,
+		Migration:  migration.Migration{Version: 20220118120101, Name: "createPermissionsTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 4, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 4, 1, 0, time.UTC),
 	}
 	migrationsSet1Parsed = []migration.Log{
 		migration1Parsed, migration2Parsed, migration3Parsed, migration4Parsed,
@@ -439,6 +459,72 @@ func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
 	})
 }
 
+func TestListMigrationsLogAfter(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "ListMigrationsLogAfter", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithMigrationsSet1)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv, ok := mysql.NewDriver(conn, defaultDriverConfig).(driver.IncrementalLogReader)
+		if !ok {
+			t.Fatalf("mysql driver must implement driver.IncrementalLogReader")
+		}
+
+		actualLog, err := drv.ListMigrationsLogAfter(migration2Parsed.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration3Parsed, migration4Parsed}, *actualLog)
+
+		actualLog, err = drv.ListMigrationsLogAfter(migration4Parsed.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+	})
+}
+
+func TestListMigrationsState(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "ListMigrationsState", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithMigrationsSet1)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv, ok := mysql.NewDriver(conn, defaultDriverConfig).(driver.StateReader)
+		if !ok {
+			t.Fatalf("mysql driver must implement driver.StateReader")
+		}
+
+		actualLog, err := drv.ListMigrationsState()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration3Parsed, migration4Parsed}, *actualLog)
+	})
+}
+
 //
 // --- Migrate test ----------------------------------
 //
@@ -559,6 +645,53 @@ func runTestMigrations(t *testing.T, migrations []migrationDescr, expectMigratio
 	}
 }
 
+//
+// --- WriteLog test ---------------------------------
+//
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "WriteLog", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("mysql driver must implement driver.LogWriter")
+		}
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(migration4Parsed))
+
+		assert.Equal(t, []logBrief{
+			makeLogBrief(migration1Parsed, false, false),
+			makeLogBrief(migration4Parsed, false, false),
+		}, getMigrationsLog(t, conn))
+
+		secondEntry := migration4Parsed
+		secondEntry.ID = 2
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration1Parsed, secondEntry}, *actualLog)
+	})
+}
+
 //
 // --- utility stuff ---------------------------------
 //
@@ -728,3 +861,1458 @@ func runValidationStatements(t *testing.T, validateStatements validateStatements
 		}()
 	}
 }
+
+//
+// --- chunked Migrate test ---------------------------------
+//
+
+func TestMigrateInChunks(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "MigrateInChunks", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.StatementsPerCommit = 2
+		drv := mysql.NewDriver(conn, config)
+
+		script := "CREATE TABLE testDatabase.seed (id int not null, primary key (id));\n" +
+			"INSERT INTO testDatabase.seed VALUES (1);\n" +
+			"INSERT INTO testDatabase.seed VALUES (2);\n" +
+			"INSERT INTO testDatabase.later VALUES (3);\n"
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up, script)
+		assert.Error(t, err, "the last statement refers to a table that does not exist yet")
+
+		var progress int
+		assert.NoError(t, conn.QueryRow("SELECT progress FROM testDatabase.migrations_log").Scan(&progress))
+		assert.Equal(t, 2, progress)
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Empty(t, *log, "unfinished migrations must not be listed")
+
+		reader, ok := drv.(driver.InterruptedReader)
+		assert.True(t, ok)
+
+		interrupted, err := reader.ListInterruptedMigrations()
+		assert.NoError(t, err)
+		if assert.Len(t, *interrupted, 1) {
+			assert.Equal(t, migration1Parsed.Version, (*interrupted)[0].Version)
+		}
+
+		_, err = conn.Exec("CREATE TABLE testDatabase.later (id int not null)")
+		assert.NoError(t, err)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, script))
+
+		interrupted, err = reader.ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Empty(t, *interrupted, "completed migrations must not be listed as interrupted")
+		assert.Equal(t, []logBrief{makeLogBrief(migration1Parsed, false, false)}, getMigrationsLog(t, conn))
+
+		var seeded int
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testDatabase.seed").Scan(&seeded))
+		assert.Equal(t, 2, seeded, "committed statements must not be executed twice")
+
+		err = drv.Migrate(migration4Parsed.Migration, migration.Up, "INSERT INTO testDatabase.missing VALUES (1)")
+		assert.Error(t, err)
+
+		err = drv.Migrate(migration4Parsed.Migration, migration.Up, "INSERT INTO testDatabase.later VALUES (1)")
+		assert.ErrorIs(t, err, mysql.ErrScriptChanged)
+	})
+}
+
+func TestSplitStatements(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "SplitStatements", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.SplitStatements = true
+		drv := mysql.NewDriver(conn, config)
+
+		script := "CREATE TABLE testDatabase.seed (id int not null);\n" +
+			"DELIMITER $$\n" +
+			"CREATE TRIGGER testDatabase.seed_id BEFORE INSERT ON testDatabase.seed FOR EACH ROW\n" +
+			"BEGIN\n  SET NEW.id = NEW.id * 10;\nEND$$\n" +
+			"DELIMITER ;\n" +
+			"INSERT INTO testDatabase.seed VALUES (1);\n"
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, script))
+
+		var id int
+		assert.NoError(t, conn.QueryRow("SELECT id FROM testDatabase.seed").Scan(&id))
+		assert.Equal(t, 10, id, "the trigger must be created as a whole")
+
+		err = drv.Migrate(migration4Parsed.Migration, migration.Up, "SELECT 1;\nINSERT INTO testDatabase.missing VALUES (1);")
+
+		var statementErr *driver.StatementError
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+			assert.Equal(t, "INSERT INTO testDatabase.missing VALUES (1)", statementErr.Statement)
+		}
+	})
+}
+
+func TestExecutorMetadata(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "ExecutorMetadata", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.AppliedBy = "deployer"
+		config.AppVersion = "v1.2.3"
+		drv := mysql.NewDriver(conn, config)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, "SELECT 1"))
+
+		writer, ok := drv.(driver.LogWriter)
+		assert.True(t, ok)
+
+		assert.NoError(t, writer.WriteLog(migration.Log{
+			Migration:  migration4Parsed.Migration,
+			Direction:  migration.Up,
+			AppliedAt:  time.Now(),
+			AppliedBy:  "legacy",
+			Hostname:   "old-host",
+			AppVersion: "v0.1.0",
+		}))
+
+		hostname, _ := os.Hostname()
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		if assert.Len(t, *log, 2) {
+			assert.Equal(t, "deployer", (*log)[0].AppliedBy)
+			assert.Equal(t, hostname, (*log)[0].Hostname)
+			assert.Equal(t, "v1.2.3", (*log)[0].AppVersion)
+
+			assert.Equal(t, "legacy", (*log)[1].AppliedBy, "entries written with an executor must keep it")
+			assert.Equal(t, "old-host", (*log)[1].Hostname)
+			assert.Equal(t, "v0.1.0", (*log)[1].AppVersion)
+		}
+	})
+}
+
+func TestExecutionTime(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "ExecutionTime", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, "SELECT SLEEP(0.2)"))
+
+		reader, ok := drv.(driver.StateReader)
+		assert.True(t, ok)
+
+		state, err := reader.ListMigrationsState()
+		assert.NoError(t, err)
+		if assert.Len(t, *state, 1) {
+			assert.GreaterOrEqual(t, (*state)[0].ExecutionTime, 200*time.Millisecond)
+			assert.Less(t, (*state)[0].ExecutionTime, time.Minute)
+		}
+	})
+}
+
+//
+// --- GetMaxAppliedVersion test ---------------------------------
+//
+
+func TestGetMaxAppliedVersion(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "GetMaxAppliedVersion", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		reader, ok := mysql.NewDriver(conn, defaultDriverConfig).(driver.MaxVersionReader)
+		if !ok {
+			t.Fatalf("mysql driver must implement driver.MaxVersionReader")
+		}
+
+		_, anyApplied, err := reader.GetMaxAppliedVersion()
+		assert.NoError(t, err)
+		assert.False(t, anyApplied)
+
+		_, err = conn.Exec(migration1Sql + migration4Sql)
+		assert.NoError(t, err)
+
+		maxVersion, anyApplied, err := reader.GetMaxAppliedVersion()
+		assert.NoError(t, err)
+		assert.True(t, anyApplied)
+		assert.Equal(t, migration4Parsed.Version, maxVersion)
+
+		_, err = conn.Exec(insertMigration + "(\"20220118120101\", \"createPermissionsTable\", \"d\", \"2022-01-19 10:05:00\", \"2022-01-19 10:05:01\");")
+		assert.NoError(t, err)
+
+		maxVersion, _, err = reader.GetMaxAppliedVersion()
+		assert.NoError(t, err)
+		assert.Equal(t, migration1Parsed.Version, maxVersion, "reverted versions must not count")
+	})
+}
+
+//
+// --- stored scripts test ---------------------------------
+//
+
+func TestGzipCodec(t *testing.T) {
+	t.Parallel()
+
+	encoded, err := mysql.GzipCodec.Encode([]byte(migrationScript1))
+	assert.NoError(t, err)
+	assert.NotEqual(t, migrationScript1, string(encoded))
+
+	decoded, err := mysql.GzipCodec.Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, migrationScript1, string(decoded))
+
+	_, err = mysql.GzipCodec.Decode([]byte(migrationScript1))
+	assert.Error(t, err)
+}
+
+func TestStoreScripts(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "StoreScripts", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		plain := defaultDriverConfig
+		plain.StoreScripts = true
+		compressed := plain
+		compressed.ScriptCodec = mysql.GzipCodec
+
+		assert.NoError(t, mysql.NewDriver(conn, defaultDriverConfig).Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+		assert.NoError(t, mysql.NewDriver(conn, plain).Migrate(migration1Parsed.Migration, migration.Down, migrationScript2))
+		assert.NoError(t, mysql.NewDriver(conn, compressed).Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		reader, ok := mysql.NewDriver(conn, defaultDriverConfig).(driver.ScriptReader)
+		if !ok {
+			t.Fatalf("mysql driver must implement driver.ScriptReader")
+		}
+
+		_, err = reader.ReadExecutedScript(1)
+		assert.ErrorIs(t, err, mysql.ErrScriptNotStored)
+
+		script, err := reader.ReadExecutedScript(2)
+		assert.NoError(t, err)
+		assert.Equal(t, migrationScript2, script)
+
+		script, err = reader.ReadExecutedScript(3)
+		assert.NoError(t, err)
+		assert.Equal(t, migrationScript1, script)
+	})
+}
+
+//
+// --- log table creation test ---------------------------------
+//
+
+func TestLogTableCreation(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "LogTableCreation", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		skipping := defaultDriverConfig
+		skipping.SkipLogTableCreation = true
+
+		_, err = mysql.NewDriver(conn, skipping).ListMigrationsLog()
+		assert.Error(t, err, "table must not be created when creation is skipped")
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+		_, err = drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		_, err = conn.Exec("DROP TABLE testDatabase.migrations_log")
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.Error(t, err, "table existence must be checked once per driver")
+	})
+}
+
+var upgradeLogTableTests = []struct { // nolint:gochecknoglobals
+	name             string
+	initialStructure string
+}{
+	/* s0 */ {
+		name: "s0 - should upgrade the first layout of the log",
+		initialStructure: initEmptyDatabase +
+			"CREATE TABLE testDatabase.migrations_log (" +
+			"id             int not null auto_increment, " +
+			"version        bigint, " +
+			"migration_name varchar(100) null, " +
+			"direction      char(1) null, " +
+			"start_time     datetime default CURRENT_TIMESTAMP not null, " +
+			"end_time       datetime null, " +
+			"primary key (id)" +
+			") default charset utf8;" +
+			migration1Sql + migration2Sql,
+	},
+	/* s1 */ {
+		name: "s1 - should upgrade the layout of the legacy mig driver that has no id",
+		initialStructure: initEmptyDatabase +
+			"CREATE TABLE testDatabase.migrations_log (" +
+			"version        bigint, " +
+			"migration_name varchar(100) null, " +
+			"direction      char(1) null, " +
+			"start_time     datetime default CURRENT_TIMESTAMP not null, " +
+			"end_time       datetime null" +
+			") default charset utf8;" +
+			migration1Sql + migration2Sql,
+	},
+}
+
+func TestUpgradeLogTable(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "UpgradeLogTable", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		for _, test := range upgradeLogTableTests {
+			test := test
+			t.Run(test.name, func(t *testing.T) {
+				_, err := conn.Exec(test.initialStructure)
+				if err != nil {
+					t.Fatalf("error when initializing database: %s", err)
+				}
+
+				defer func() {
+					_, err := conn.Exec(dropDatabase)
+					if err != nil {
+						t.Fatalf("falied to drop database after test: %s", err)
+					}
+				}()
+
+				drv := mysql.NewDriver(conn, defaultDriverConfig)
+
+				log, err := drv.ListMigrationsLog()
+				assert.NoError(t, err)
+				assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *log, "entries must keep their order")
+
+				assert.NoError(t, drv.Migrate(migration4Parsed.Migration, migration.Up, ""))
+
+				log, err = mysql.NewDriver(conn, defaultDriverConfig).ListMigrationsLog()
+				if assert.NoError(t, err) && assert.Len(t, *log, 3) {
+					assert.Equal(t, migration4Parsed.Version, (*log)[2].Version)
+					assert.Equal(t, migration.Checksum([]byte("")), (*log)[2].Checksum)
+				}
+			})
+		}
+	})
+}
+
+func TestLogTableTemplate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "LogTableTemplate", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		custom := defaultDriverConfig
+		custom.LogTableTemplate = strings.Replace(
+			mysql.DefaultLogTableTemplate, "primary key (id)", "deployed_by varchar(64) null, primary key (id)", 1,
+		) + " engine InnoDB"
+
+		_, err = mysql.NewDriver(conn, custom).ListMigrationsLog()
+		assert.NoError(t, err)
+
+		var columns int
+		assert.NoError(t, conn.QueryRow(
+			"SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = 'testDatabase' AND column_name = 'deployed_by'",
+		).Scan(&columns))
+		assert.Equal(t, 1, columns)
+
+		_, err = conn.Exec("DROP TABLE testDatabase.migrations_log")
+		assert.NoError(t, err)
+
+		incomplete := defaultDriverConfig
+		incomplete.LogTableTemplate = "CREATE TABLE IF NOT EXISTS " + mysql.LogTableNamePlaceholder +
+			" (id int not null auto_increment, version bigint, primary key (id))"
+
+		_, err = mysql.NewDriver(conn, incomplete).ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestLogTableOptions(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "LogTableOptions", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		tableOptions := func() (engine string, collation string) {
+			assert.NoError(t, conn.QueryRow(
+				"SELECT engine, table_collation FROM information_schema.tables "+
+					"WHERE table_schema = 'testDatabase' AND table_name = 'migrations_log'",
+			).Scan(&engine, &collation))
+
+			return engine, collation
+		}
+
+		_, err = mysql.NewDriver(conn, defaultDriverConfig).ListMigrationsLog()
+		assert.NoError(t, err)
+
+		_, collation := tableOptions()
+		assert.True(t, strings.HasPrefix(collation, "utf8mb4_"), "log table must default to utf8mb4, got %s", collation)
+
+		_, err = conn.Exec("DROP TABLE testDatabase.migrations_log")
+		assert.NoError(t, err)
+
+		custom := defaultDriverConfig
+		custom.LogTableCharset = "latin1"
+		custom.LogTableCollation = "latin1_bin"
+		custom.LogTableEngine = "MyISAM"
+		custom.LogTableSQLMode = "NO_ENGINE_SUBSTITUTION"
+
+		drv := mysql.NewDriver(conn, custom)
+		scoper := drv.(driver.RunScoper)
+
+		assert.NoError(t, scoper.BeginRun())
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up,
+			"CREATE TABLE testDatabase.modes AS SELECT @@SESSION.sql_mode AS mode, @@GLOBAL.sql_mode AS global_mode"))
+		assert.NoError(t, scoper.EndRun())
+
+		engine, collation := tableOptions()
+		assert.Equal(t, "MyISAM", engine)
+		assert.Equal(t, "latin1_bin", collation)
+
+		var mode, globalMode string
+		assert.NoError(t, conn.QueryRow("SELECT mode, global_mode FROM testDatabase.modes").Scan(&mode, &globalMode))
+		assert.Equal(t, globalMode, mode, "sql_mode of the log table must not leak into migrations")
+	})
+}
+
+func TestDirectionEncoding(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "DirectionEncoding", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.Directions = mysql.WordDirections
+		config.LogTableTemplate = strings.Replace(
+			mysql.DefaultLogTableTemplate, "direction      char(1) null", "direction varchar(4) null", 1,
+		)
+		drv := mysql.NewDriver(conn, config)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+
+		var direction string
+		assert.NoError(t, conn.QueryRow("SELECT direction FROM testDatabase.migrations_log").Scan(&direction))
+		assert.Equal(t, "up", direction)
+
+		_, err = conn.Exec(
+			"INSERT INTO testDatabase.migrations_log (version, migration_name, direction) VALUES (?, ?, 'D')",
+			migration1Parsed.Version, migration1Parsed.Name,
+		)
+		assert.NoError(t, err)
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		if assert.Len(t, *log, 2) {
+			assert.Equal(t, migration.Up, (*log)[0].Direction)
+			assert.Equal(t, migration.Down, (*log)[1].Direction, "logs written by other tools must be read")
+		}
+
+		_, err = conn.Exec(
+			"INSERT INTO testDatabase.migrations_log (version, migration_name, direction) VALUES (?, ?, 'x')",
+			migration1Parsed.Version, migration1Parsed.Name,
+		)
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestLogColumns(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "LogColumns", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase +
+			"CREATE TABLE testDatabase.schema_history (" +
+			"rev varchar(20) not null, " +
+			"title varchar(200) not null, " +
+			"installed_on datetime not null, " +
+			"primary key (rev)" +
+			");" +
+			"INSERT INTO testDatabase.schema_history VALUES ('20210124131258', 'initial_structure', '2021-01-24 13:20:00');",
+		)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.MigrationsTableName = "schema_history"
+		config.LogColumns = &mysql.LogColumns{Version: "rev", Name: "title", AppliedAt: "installed_on"}
+		drv := mysql.NewDriver(conn, config)
+
+		_, ok := drv.(driver.StateReader)
+		assert.False(t, ok, "optional features that need henka log columns must not be advertised")
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{{
+			Migration: migration.Migration{Version: 20210124131258, Name: "initial_structure"},
+			Direction: migration.Up,
+			AppliedAt: time.Date(2021, 1, 24, 13, 20, 0, 0, time.UTC),
+		}}, *log)
+
+		assert.NoError(t, drv.Migrate(migration.Migration{Version: 20210124132201, Name: "indexes"}, migration.Up, ""))
+
+		var count int
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testDatabase.schema_history").Scan(&count))
+		assert.Equal(t, 2, count)
+
+		assert.NoError(t, drv.Migrate(migration.Migration{Version: 20210124132201, Name: "indexes"}, migration.Down, ""))
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testDatabase.schema_history").Scan(&count))
+		assert.Equal(t, 1, count, "down migrations must delete rows when there is no direction column")
+
+		config.LogColumns = &mysql.LogColumns{Version: "rev"}
+		_, err = mysql.NewDriver(conn, config).ListMigrationsLog()
+		assert.ErrorIs(t, err, mysql.ErrInvalidLogColumns)
+	})
+}
+
+// minimalConn hides everything but ExecContext and QueryContext of the wrapped connection.
+type minimalConn struct {
+	db *sql.DB
+}
+
+func (c minimalConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(ctx, query, args...)
+}
+
+func (c minimalConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(ctx, query, args...)
+}
+
+func TestMinimalConnection(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "MinimalConnection", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(minimalConn{db: conn}, defaultDriverConfig)
+
+		scoper, ok := drv.(driver.RunScoper)
+		assert.True(t, ok)
+		assert.NoError(t, scoper.BeginRun())
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, scoper.EndRun())
+
+		assert.Equal(t, []logBrief{makeLogBrief(migration1Parsed, false, false)}, getMigrationsLog(t, conn))
+
+		config := defaultDriverConfig
+		config.StatementsPerCommit = 1
+		err = mysql.NewDriver(minimalConn{db: conn}, config).Migrate(migration4Parsed.Migration, migration.Up, "SELECT 1")
+		assert.ErrorIs(t, err, mysql.ErrTransactionsNotSupported)
+	})
+}
+
+func TestRecordFailure(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "RecordFailure", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+
+		recorder, ok := drv.(driver.FailureRecorder)
+		assert.True(t, ok)
+		assert.NoError(t, recorder.RecordFailure(migration1Parsed.Migration, migration.Up, errors.New("boom")))
+
+		var message string
+		assert.NoError(t, conn.QueryRow("SELECT error_message FROM testDatabase.migrations_log").Scan(&message))
+		assert.Equal(t, "boom", message)
+
+		interrupted, err := drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Len(t, *interrupted, 1)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+
+		interrupted, err = drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Empty(t, *interrupted, "a successful attempt must clear the failure")
+	})
+}
+
+func TestMigrateContext(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "MigrateContext", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv, ok := mysql.NewDriver(conn, defaultDriverConfig).(driver.ContextDriver)
+		if !assert.True(t, ok) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err = drv.MigrateContext(ctx, migration1Parsed.Migration, migration.Up, "SELECT SLEEP(5)")
+		assert.Error(t, err, "the script must be interrupted by the deadline")
+
+		log, err := drv.ListMigrationsLogContext(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, *log)
+	})
+}
+
+func TestRepair(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "Repair", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Up, ""))
+
+		assert.NoError(t, drv.(driver.ChecksumUpdater).UpdateChecksum(migration1Parsed.Version, "0000"))
+
+		var checksum string
+		assert.NoError(t, conn.QueryRow(
+			"SELECT checksum FROM testDatabase.migrations_log WHERE version = ?", migration1Parsed.Version,
+		).Scan(&checksum))
+		assert.Equal(t, "0000", checksum)
+
+		assert.NoError(t, drv.(driver.LogDeleter).DeleteLog(migration2Parsed.Version))
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Len(t, *log, 1)
+		assert.Equal(t, migration1Parsed.Version, (*log)[0].Version)
+	})
+}
+
+func TestBaselineMarker(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "BaselineMarker", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+
+		err = drv.(driver.LogWriter).WriteLog(migration.Log{
+			Migration: migration.Migration{Version: migration2Parsed.Version, Name: migration.BaselineName},
+			Direction: migration.Up,
+			AppliedAt: migration2Parsed.AppliedAt,
+			Baseline:  true,
+		})
+		assert.NoError(t, err)
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Len(t, *log, 1)
+		assert.True(t, (*log)[0].Baseline)
+		assert.Equal(t, migration2Parsed.Version, (*log)[0].Version)
+	})
+}
+
+func TestLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "Lock", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		first := mysql.NewDriver(conn, defaultDriverConfig)
+		second := mysql.NewDriver(conn, defaultDriverConfig)
+
+		assert.NoError(t, first.(driver.RunScoper).BeginRun())
+		assert.NoError(t, second.(driver.RunScoper).BeginRun())
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+		assert.ErrorIs(t, second.(driver.Locker).Unlock(), mysql.ErrLockLost, "the lock has been released already")
+
+		assert.NoError(t, first.(driver.RunScoper).EndRun())
+		assert.NoError(t, second.(driver.RunScoper).EndRun())
+	})
+}
+
+func TestLockReleasedWithConnection(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "LockReleasedWithConnection", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		first := mysql.NewDriver(conn, defaultDriverConfig)
+		second := mysql.NewDriver(conn, defaultDriverConfig)
+
+		assert.NoError(t, first.(driver.RunScoper).BeginRun())
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+
+		var holder int64
+		assert.NoError(t, conn.QueryRow("SELECT IS_USED_LOCK('henka:testDatabase.migrations_log')").Scan(&holder))
+
+		_, err = conn.Exec(fmt.Sprintf("KILL %d", holder))
+		assert.NoError(t, err)
+
+		assert.NoError(t, second.(driver.RunScoper).BeginRun())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second), "the lock of a dropped connection must be released")
+		assert.NoError(t, second.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.RunScoper).EndRun())
+
+		assert.Error(t, first.(driver.Locker).Unlock(), "the lost lock must be reported")
+		_ = first.(driver.RunScoper).EndRun()
+	})
+}
+
+func TestLease(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "Lease", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		_, err = conn.Exec("INSERT INTO testDatabase.migrations_log (namespace, version, migration_name, run_id, end_time) " +
+			"VALUES ('henka:lease', 0, '<< lease >>', 'crashed', NOW() - INTERVAL 1 HOUR)")
+		assert.NoError(t, err)
+
+		config := defaultDriverConfig
+		config.LeaseTTL = 3 * time.Second
+		first := mysql.NewDriver(conn, config)
+		second := mysql.NewDriver(conn, config)
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second), "an expired lease must be taken over")
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		time.Sleep(config.LeaseTTL + time.Second)
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout, "the heartbeat must keep the lease")
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+
+		log, err := first.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Empty(t, *log, "the lease must not be listed")
+	})
+}
+
+func TestLeaseLost(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "LeaseLost", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.LeaseTTL = 3 * time.Second
+		drv := mysql.NewDriver(conn, config)
+
+		assert.NoError(t, drv.(driver.Locker).Lock(time.Second))
+
+		_, err = conn.Exec("UPDATE testDatabase.migrations_log SET run_id = 'another' WHERE namespace = 'henka:lease'")
+		assert.NoError(t, err)
+
+		time.Sleep(config.LeaseTTL)
+
+		err = drv.Migrate(migration.Migration{Version: 1, Name: "first"}, migration.Up, "SELECT 1;")
+		assert.ErrorIs(t, err, mysql.ErrLockLost, "migrations must fail once the lease has been taken over")
+		assert.ErrorIs(t, drv.(driver.Locker).Unlock(), mysql.ErrLockLost, "the lost lease must be reported")
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Empty(t, *log)
+	})
+}
+
+func TestTiDB(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "TiDB", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.TiDB = true
+		drv := mysql.NewDriver(conn, config)
+
+		_, err = drv.ListMigrationsLog()
+		assert.NoError(t, err, "TiDB table options must be ignored by MySQL")
+
+		assert.NoError(t, drv.(driver.Locker).Lock(time.Second))
+
+		var holders int
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testDatabase.migrations_log "+
+			"WHERE namespace = 'henka:lease' AND run_id IS NOT NULL").Scan(&holders))
+		assert.Equal(t, 1, holders, "a lease must be taken instead of GET_LOCK")
+
+		assert.NoError(t, drv.(driver.Locker).Unlock())
+	})
+}
+
+func TestTransactions(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "Transactions", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+		transactor := drv.(driver.Transactor)
+
+		assert.False(t, transactor.TransactionalDDL())
+		assert.ErrorIs(t, transactor.BeginTx(), mysql.ErrTransactionsNotSupported, "a pool needs a dedicated connection")
+
+		assert.NoError(t, drv.(driver.RunScoper).BeginRun())
+		_, err = drv.ListMigrationsLog() // creates the log table before the transaction, as DDL commits implicitly
+		assert.NoError(t, err)
+		assert.NoError(t, transactor.BeginTx())
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, transactor.RollbackTx())
+		assert.NoError(t, drv.(driver.RunScoper).EndRun())
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Empty(t, *log, "the log entry must be rolled back")
+	})
+}
+
+func TestMigrateRecordsAttempts(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "MigrateRecordsAttempts", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+
+		assert.Error(t, drv.Migrate(migration1Parsed.Migration, migration.Up, "THIS IS NOT SQL"))
+
+		interrupted, err := drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Len(t, *interrupted, 1)
+		assert.Equal(t, migration1Parsed.Version, (*interrupted)[0].Version)
+		assert.Contains(t, (*interrupted)[0].Error, "syntax")
+		assert.False(t, (*interrupted)[0].FinishedAt.IsZero())
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Empty(t, *log, "a failed attempt must not be listed as applied")
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		interrupted, err = drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Empty(t, *interrupted)
+	})
+}
+
+func TestMigrateDataChangesInTransaction(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "MigrateDataChangesInTransaction", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable + "CREATE TABLE testDatabase.seed (id int not null, primary key (id));")
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up,
+			"-- seed\nINSERT INTO testDatabase.seed VALUES (1);\nINSERT INTO testDatabase.missing VALUES (2);")
+		assert.Error(t, err)
+
+		var seeded int
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testDatabase.seed").Scan(&seeded))
+		assert.Equal(t, 0, seeded, "data changes of a failed script must be rolled back")
+
+		interrupted, err := drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Len(t, *interrupted, 1, "the failed attempt must be recorded")
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up,
+			"CREATE TABLE testDatabase.other (id int);\nINSERT INTO testDatabase.seed VALUES (1);\nINSERT INTO testDatabase.missing VALUES (2);")
+		assert.Error(t, err)
+
+		assert.NoError(t, conn.QueryRow("SELECT COUNT(*) FROM testDatabase.seed").Scan(&seeded))
+		assert.Equal(t, 1, seeded, "scripts with DDL can't be rolled back")
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, "INSERT INTO testDatabase.seed VALUES (2)"))
+
+		interrupted, err = drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Empty(t, *interrupted)
+		assert.Equal(t, []logBrief{makeLogBrief(migration1Parsed, false, false)}, getMigrationsLog(t, conn))
+	})
+}
+
+func TestRepeatable(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "Repeatable", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+		repeatable := drv.(driver.RepeatableMigrator)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, repeatable.MigrateRepeatable("views", "SELECT 1"))
+		assert.NoError(t, repeatable.MigrateRepeatable("views", "SELECT 2"))
+
+		checksums, err := repeatable.ListRepeatableChecksums()
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"views": migration.Checksum([]byte("SELECT 2"))}, checksums)
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Len(t, *log, 1)
+
+		reader, ok := drv.(driver.StateReader)
+		assert.True(t, ok)
+
+		state, err := reader.ListMigrationsState()
+		assert.NoError(t, err)
+		assert.Len(t, *state, 1)
+	})
+}
+
+func TestNamespaces(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "Namespaces", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		billingConfig := defaultDriverConfig
+		billingConfig.Namespace = "billing"
+
+		defaultDrv := mysql.NewDriver(conn, defaultDriverConfig)
+		billing := mysql.NewDriver(conn, billingConfig)
+
+		assert.NoError(t, defaultDrv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, billing.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, billing.Migrate(migration1Parsed.Migration, migration.Down, ""))
+
+		log, err := defaultDrv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Len(t, *log, 1)
+
+		log, err = billing.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *log, 2) {
+			assert.Equal(t, "billing", (*log)[1].Namespace)
+			assert.Equal(t, migration.Down, (*log)[1].Direction)
+		}
+
+		state, err := defaultDrv.(driver.StateReader).ListMigrationsState()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *state, 1) {
+			assert.Equal(t, migration.Up, (*state)[0].Direction)
+		}
+	})
+}
+
+func TestMigrateFunc(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "MigrateFunc", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initDatabaseWithEmptyTable)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		drv := mysql.NewDriver(conn, defaultDriverConfig)
+		migrator := drv.(driver.FuncMigrator)
+
+		errBackfill := errors.New("backfill failed")
+		err = migrator.MigrateFunc(context.Background(), migration1Parsed.Migration, migration.Up,
+			func(ctx context.Context, tx *sql.Tx) error {
+				return errBackfill
+			})
+		assert.ErrorIs(t, err, errBackfill)
+
+		interrupted, err := drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Len(t, *interrupted, 1)
+
+		err = migrator.MigrateFunc(context.Background(), migration1Parsed.Migration, migration.Up,
+			func(ctx context.Context, tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "SELECT 1")
+				return err
+			})
+		assert.NoError(t, err)
+
+		log, err := drv.ListMigrationsLog()
+		if assert.NoError(t, err) && assert.Len(t, *log, 1) {
+			assert.Equal(t, migration1Parsed.Migration, (*log)[0].Migration)
+			assert.Equal(t, migration.Checksum(nil), (*log)[0].Checksum)
+		}
+
+		interrupted, err = drv.(driver.InterruptedReader).ListInterruptedMigrations()
+		assert.NoError(t, err)
+		assert.Empty(t, *interrupted)
+	})
+}
+
+func TestCreateDatabaseIfMissing(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "CreateDatabaseIfMissing", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		config := defaultDriverConfig
+		config.CreateDatabaseIfMissing = true
+		config.CharacterSet = "utf8mb4"
+		config.Collation = "utf8mb4_bin"
+
+		drv := mysql.NewDriver(conn, config)
+
+		log, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Empty(t, *log)
+
+		var charset, collation string
+		err = conn.QueryRow("SELECT default_character_set_name, default_collation_name FROM information_schema.schemata "+
+			"WHERE schema_name = 'testDatabase'").Scan(&charset, &collation)
+		assert.NoError(t, err)
+		assert.Equal(t, "utf8mb4", charset)
+		assert.Equal(t, "utf8mb4_bin", collation)
+
+		assert.NoError(t, drv.(driver.RunScoper).BeginRun())
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, ""))
+		assert.NoError(t, drv.(driver.RunScoper).EndRun())
+	})
+}
+
+func TestDatabaseFromDSN(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/mysql")
+	}
+
+	runForAllMysqlVersions(t, "DatabaseFromDSN", func(t *testing.T, version string, conn *sql.DB) {
+		t.Helper()
+
+		_, err := conn.Exec(initEmptyDatabase)
+		if err != nil {
+			t.Fatalf("error when initializing database: %s", err)
+		}
+
+		defer func() {
+			_, err := conn.Exec(dropDatabase)
+			if err != nil {
+				t.Fatalf("falied to drop database after test: %s", err)
+			}
+		}()
+
+		// a dedicated connection stands in for a DSN that selects the database
+		session, err := conn.Conn(context.Background())
+		if err != nil {
+			t.Fatalf("failed to take a connection: %s", err)
+		}
+		defer session.Close()
+
+		_, err = session.ExecContext(context.Background(), "USE testDatabase")
+		assert.NoError(t, err)
+
+		drv := mysql.NewDriver(session, mysql.DriverConfig{MigrationsTableName: "migrations_log"})
+
+		assert.NoError(t, drv.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		var holder sql.NullInt64
+		assert.NoError(t, conn.QueryRow("SELECT IS_USED_LOCK('henka:testDatabase.migrations_log')").Scan(&holder))
+		assert.True(t, holder.Valid, "the lock must be named after the current database")
+		assert.NoError(t, drv.(driver.Locker).Unlock())
+
+		log, err := mysql.NewDriver(conn, defaultDriverConfig).ListMigrationsLog()
+		if assert.NoError(t, err) && assert.Len(t, *log, 1) {
+			assert.Equal(t, migration1Parsed.Version, (*log)[0].Version)
+		}
+
+		dumped, err := drv.(driver.SchemaDumper).DumpSchema()
+		if assert.NoError(t, err) {
+			_, found := dumped.Table("users")
+			assert.True(t, found, "schema of the current database must be dumped")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// UpdateChecksum replaces the checksum of the latest up entry of the version.
+func (drv *mysqlDriver) UpdateChecksum(version migration.Version, checksum string) error {
+	_, err := drv.db().ExecContext(context.Background(),
+		fmt.Sprintf(
+			"UPDATE %s SET checksum = ? WHERE namespace = ? AND version = ? AND direction = ? AND progress IS NULL "+
+				"ORDER BY id DESC LIMIT 1",
+			drv.makeEscapedMigrationsTableName(),
+		),
+		checksum,
+		drv.config.Namespace,
+		version,
+		drv.encodeDirection(migration.Up),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update checksum: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteLog removes every entry of the version, including progress rows.
+func (drv *mysqlDriver) DeleteLog(version migration.Version) error {
+	_, err := drv.db().ExecContext(context.Background(),
+		fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND version = ?", drv.makeEscapedMigrationsTableName()),
+		drv.config.Namespace,
+		version,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete migration log: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *mappedDriver) DeleteLog(version migration.Version) error {
+	if err := drv.checkColumns(); err != nil {
+		return err
+	}
+
+	_, err := drv.base.db().ExecContext(context.Background(),
+		fmt.Sprintf("DELETE FROM %s WHERE %s = ?", drv.base.makeEscapedMigrationsTableName(), drv.column(drv.columns.Version)),
+		version,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete migration log: %w", err)
+	}
+
+	return nil
+}
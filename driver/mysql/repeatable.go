@@ -0,0 +1,117 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// repeatableVersion is the version repeatable migrations are recorded with. Their entries are left out
+// of the versioned log.
+const repeatableVersion = 0
+
+// ListRepeatableChecksums returns checksums of the latest executions of repeatable migrations.
+func (drv *mysqlDriver) ListRepeatableChecksums() (map[string]string, error) {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err := drv.ensureMigrationsTableExists(context.Background(), &tableName); err != nil {
+		return nil, fmt.Errorf("failed to list repeatable migrations: %w", err)
+	}
+
+	rows, err := drv.query(context.Background(), fmt.Sprintf(
+		"SELECT l.migration_name, l.checksum FROM %s l "+
+			"INNER JOIN (SELECT MAX(id) AS id FROM %s WHERE namespace = ? AND version = ? AND progress IS NULL "+
+			"GROUP BY migration_name) latest ON latest.id = l.id",
+		tableName, tableName,
+	), drv.config.Namespace, repeatableVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repeatable migrations: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+
+	for rows.Next() {
+		var name string
+		var checksum sql.NullString
+
+		if err = rows.Scan(&name, &checksum); err != nil {
+			return nil, fmt.Errorf("failed to list repeatable migrations: %w", err)
+		}
+
+		if checksum.Valid {
+			result[name] = checksum.String
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list repeatable migrations: %w", err)
+	}
+
+	return result, nil
+}
+
+// MigrateRepeatable executes the script and records it with repeatableVersion.
+func (drv *mysqlDriver) MigrateRepeatable(name string, script string) (err error) {
+	if err = drv.currentLease().Err(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	endRun, err := drv.useDatabase(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if endErr := endRun(); endErr != nil && err == nil {
+			err = endErr
+		}
+	}()
+
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	if err = drv.ensureMigrationsTableExists(ctx, &tableName); err != nil {
+		return fmt.Errorf("failed to apply repeatable migration: %w", err)
+	}
+
+	storedScript, scriptCodec, err := drv.encodeScript(script)
+	if err != nil {
+		return err
+	}
+
+	startTime := time.Now()
+
+	if err = drv.execScript(ctx, drv.db(), script); err != nil {
+		drv.logger().Error("repeatable migration script failed", "name", name, "error", err)
+		return err
+	}
+
+	_, err = drv.db().ExecContext(ctx,
+		fmt.Sprintf("INSERT INTO %s (namespace, version, migration_name, direction, start_time, end_time, checksum, script, script_codec, "+
+			"applied_by, hostname, app_version, execution_time_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", tableName,
+		),
+		drv.config.Namespace,
+		repeatableVersion,
+		name,
+		drv.encodeDirection(migration.Up),
+		startTime,
+		time.Now(),
+		migration.Checksum([]byte(script)),
+		storedScript,
+		scriptCodec,
+		drv.executor.AppliedBy,
+		drv.executor.Hostname,
+		drv.executor.AppVersion,
+		time.Since(startTime).Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package mysql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ScriptCodec encodes scripts that are stored in the migrations log, e.g. to compress them.
+// Name is stored next to every script, so that it can be decoded later. It must not exceed 16 characters.
+type ScriptCodec interface {
+	Name() string
+	Encode(script []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+var (
+	ErrUnknownScriptCodec = errors.New("script is encoded with an unknown codec")
+	ErrScriptNotStored    = errors.New("script of the log entry is not stored")
+)
+
+// GzipCodec compresses stored scripts with gzip. Codecs based on other algorithms, e.g. zstd,
+// can be plugged in through DriverConfig.ScriptCodec.
+var GzipCodec ScriptCodec = gzipCodec{} //nolint:gochecknoglobals
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string {
+	return "gzip"
+}
+
+func (gzipCodec) Encode(script []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	writer := gzip.NewWriter(&buffer)
+
+	if _, err := writer.Write(script); err != nil {
+		return nil, fmt.Errorf("failed to compress script: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress script: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (gzipCodec) Decode(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress script: %w", err)
+	}
+	defer reader.Close()
+
+	script, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress script: %w", err)
+	}
+
+	return script, nil
+}
+
+// encodeScript prepares the script and the name of its codec for the log. Both are nil unless StoreScripts is set.
+func (drv *mysqlDriver) encodeScript(script string) ([]byte, *string, error) {
+	if !drv.config.StoreScripts {
+		return nil, nil, nil
+	}
+
+	if drv.config.ScriptCodec == nil {
+		return []byte(script), nil, nil
+	}
+
+	data, err := drv.config.ScriptCodec.Encode([]byte(script))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode script with %s: %w", drv.config.ScriptCodec.Name(), err)
+	}
+
+	codec := drv.config.ScriptCodec.Name()
+
+	return data, &codec, nil
+}
+
+// ReadExecutedScript returns the script stored with the log entry. Scripts are stored when StoreScripts is set.
+func (drv *mysqlDriver) ReadExecutedScript(logID uint64) (string, error) {
+	rows, err := drv.query(context.Background(), fmt.Sprintf(
+		"SELECT script, script_codec FROM %s WHERE id = ?", drv.makeEscapedMigrationsTableName(),
+	), logID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read executed script: %w", err)
+	}
+	defer rows.Close()
+
+	var data []byte
+	var codec sql.NullString
+
+	if rows.Next() {
+		if err = rows.Scan(&data, &codec); err != nil {
+			return "", fmt.Errorf("failed to read executed script: %w", err)
+		}
+	}
+
+	if data == nil {
+		return "", fmt.Errorf("%w: %d", ErrScriptNotStored, logID)
+	}
+
+	if !codec.Valid {
+		return string(data), nil
+	}
+
+	for _, known := range []ScriptCodec{drv.config.ScriptCodec, GzipCodec} {
+		if known != nil && known.Name() == codec.String {
+			script, err := known.Decode(data)
+			if err != nil {
+				return "", fmt.Errorf("failed to decode script with %s: %w", codec.String, err)
+			}
+
+			return string(script), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnknownScriptCodec, codec.String)
+}
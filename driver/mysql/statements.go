@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/sqlscript"
+)
+
+// execScript executes a migration script on db, statement by statement if SplitStatements is set.
+func (drv *mysqlDriver) execScript(ctx context.Context, db Execer, script string) error {
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+
+	if !drv.config.SplitStatements {
+		if _, err := db.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("failed to execute migration script: %w", &driver.StatementError{Index: -1, Statement: script, Err: err})
+		}
+
+		return nil
+	}
+
+	for i, statement := range sqlscript.Split(script) {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to execute migration script: %w", &driver.StatementError{Index: i, Statement: statement, Err: err})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/sqlscript"
+)
+
+var ErrChunkedTransaction = errors.New("migrations executed in chunks can't be wrapped in a transaction")
+
+// TransactionalDDL is false: MySQL commits the current transaction implicitly before and after most DDL statements.
+func (drv *mysqlDriver) TransactionalDDL() bool {
+	return false
+}
+
+// BeginTx starts a transaction on the dedicated connection of the run, so that scripts and log entries written
+// until CommitTx or RollbackTx belong to it. Outside of runs it fails unless the connection is a dedicated
+// one, e.g. *sql.Conn. It can't be combined with StatementsPerCommit, which commits on its own.
+func (drv *mysqlDriver) BeginTx() error {
+	if drv.config.StatementsPerCommit > 0 {
+		return ErrChunkedTransaction
+	}
+
+	drv.mutex.Lock()
+	_, isPool := drv.pool.(connPool)
+	pinned := drv.pinned != nil
+	drv.mutex.Unlock()
+
+	if isPool && !pinned {
+		return fmt.Errorf("%w: no dedicated connection outside of runs", ErrTransactionsNotSupported)
+	}
+
+	if err := drv.execTx("START TRANSACTION"); err != nil {
+		return err
+	}
+
+	drv.setInTx(true)
+
+	return nil
+}
+
+func (drv *mysqlDriver) CommitTx() error {
+	defer drv.setInTx(false)
+
+	return drv.execTx("COMMIT")
+}
+
+func (drv *mysqlDriver) RollbackTx() error {
+	defer drv.setInTx(false)
+
+	return drv.execTx("ROLLBACK")
+}
+
+func (drv *mysqlDriver) setInTx(inTx bool) {
+	drv.mutex.Lock()
+	drv.inTx = inTx
+	drv.mutex.Unlock()
+}
+
+func (drv *mysqlDriver) execTx(statement string) error {
+	if _, err := drv.db().ExecContext(context.Background(), statement); err != nil {
+		return fmt.Errorf("failed to execute %s: %w", statement, err)
+	}
+
+	return nil
+}
+
+// transactionalKeywords are the statements that don't commit implicitly, see
+// https://dev.mysql.com/doc/refman/8.0/en/implicit-commit.html. Stored procedures may commit, so CALL is not one of them.
+var transactionalKeywords = map[string]bool{ //nolint:gochecknoglobals
+	"INSERT":  true,
+	"UPDATE":  true,
+	"DELETE":  true,
+	"REPLACE": true,
+	"SELECT":  true,
+	"WITH":    true,
+	"DO":      true,
+}
+
+// canWrapInTx tells whether the script can share a transaction with its log entry: it has to consist of statements
+// that don't commit implicitly, the connection has to support transactions, and no transaction of BeginTx
+// may be open, as starting another one would commit it.
+func (drv *mysqlDriver) canWrapInTx(script string) bool {
+	drv.mutex.Lock()
+	inTx := drv.inTx
+	drv.mutex.Unlock()
+
+	if inTx {
+		return false
+	}
+
+	if _, ok := drv.db().(txBeginner); !ok {
+		return false
+	}
+
+	statements := sqlscript.Split(script)
+	if len(statements) == 0 {
+		return false
+	}
+
+	for _, statement := range statements {
+		if !transactionalKeywords[sqlscript.Keyword(statement)] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// migrateInTx executes the script and writes its log entry in one transaction. The progress row of the attempt
+// has been committed before, and it is updated with the cause when the transaction is rolled back.
+func (drv *mysqlDriver) migrateInTx(ctx context.Context, escapedTableName *string, attemptID int64, entry appliedEntry) error {
+	tx, err := drv.beginTx(ctx)
+	if err != nil {
+		drv.failAttempt(escapedTableName, attemptID, err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err = drv.execScript(ctx, tx, entry.script); err != nil {
+		_ = tx.Rollback()
+
+		drv.logger().Error("migration script failed", "version", entry.mig.Version, "direction", entry.dir, "error", err)
+		drv.failAttempt(escapedTableName, attemptID, errors.Unwrap(err))
+
+		return err
+	}
+
+	if err = drv.writeAppliedEntry(ctx, tx, escapedTableName, entry); err != nil {
+		_ = tx.Rollback()
+
+		drv.failAttempt(escapedTableName, attemptID, err)
+
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		drv.failAttempt(escapedTableName, attemptID, err)
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *mappedDriver) TransactionalDDL() bool {
+	return drv.base.TransactionalDDL()
+}
+
+func (drv *mappedDriver) BeginTx() error {
+	return drv.base.BeginTx()
+}
+
+func (drv *mappedDriver) CommitTx() error {
+	return drv.base.CommitTx()
+}
+
+func (drv *mappedDriver) RollbackTx() error {
+	return drv.base.RollbackTx()
+}
@@ -0,0 +1,525 @@
+package snowflake
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+type DriverConfig struct {
+	// Warehouse, Database, Schema and Role are selected with USE on every connection the driver works with.
+	// Empty ones are left as the defaults of the user. Database and Schema are also where the log table is kept.
+	// Names are used as given and are case-sensitive, e.g. an unquoted analytics is "ANALYTICS".
+	Warehouse string
+	Database  string
+	Schema    string
+	Role      string
+
+	MigrationsTableName string
+
+	// SessionParameters are set with ALTER SESSION after the USE statements, e.g. QUERY_TAG or TIMEZONE.
+	// MULTI_STATEMENT_COUNT is always set to 0, so that scripts can have any number of statements.
+	SessionParameters map[string]string
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+var ErrInvalidConfig = errors.New("invalid snowflake driver config")
+
+// Execer is the connection the driver needs. It is satisfied by *sql.DB, *sql.Conn and instrumented wrappers.
+// Session state of Snowflake belongs to a connection, so connections that implement Conn like *sql.DB are asked
+// for a dedicated connection per run, or per operation outside of runs, which is set up before it is used.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type connPool interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+type snowflakeDriver struct {
+	pool   Execer
+	config DriverConfig
+
+	// pinned is the connection dedicated to the current run, nil outside of runs
+	pinned *sql.Conn
+	mutex  sync.Mutex
+
+	// sessionReady is set once a connection that is not a pool has been set up
+	sessionReady bool
+
+	// tableExists is set once the migrations log table has been created or found
+	tableExists bool
+
+	executor driver.Executor
+}
+
+// NewDriver returns a driver for Snowflake. Queries use ? parameters, as understood by github.com/snowflakedb/gosnowflake.
+func NewDriver(conn Execer, config DriverConfig) driver.Driver {
+	return &snowflakeDriver{
+		pool:     conn,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+// BeginRun takes a dedicated connection from the pool and sets up its session, so that every migration
+// of the run sees the same warehouse, role and session parameters. Connections that are not pools are used as is.
+func (drv *snowflakeDriver) BeginRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned != nil {
+		return driver.ErrRunInProgress
+	}
+
+	pool, ok := drv.pool.(connPool)
+	if !ok {
+		return nil
+	}
+
+	conn, err := drv.openSession(context.Background(), pool)
+	if err != nil {
+		return err
+	}
+
+	drv.pinned = conn
+
+	return nil
+}
+
+// EndRun returns the dedicated connection to the pool.
+func (drv *snowflakeDriver) EndRun() error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.pinned == nil {
+		return nil
+	}
+
+	err := drv.pinned.Close()
+	drv.pinned = nil
+
+	if err != nil {
+		return fmt.Errorf("failed to release the dedicated connection: %w", err)
+	}
+
+	return nil
+}
+
+// withSession calls fn with the connection of the current run. Outside of runs, fn gets a connection of its own
+// that is set up with setupSession, or the connection given to NewDriver when it is not a pool.
+func (drv *snowflakeDriver) withSession(ctx context.Context, fn func(db Execer) error) error {
+	drv.mutex.Lock()
+	pinned := drv.pinned
+	drv.mutex.Unlock()
+
+	if pinned != nil {
+		return fn(pinned)
+	}
+
+	pool, ok := drv.pool.(connPool)
+	if !ok {
+		if err := drv.ensureSessionReady(ctx); err != nil {
+			return err
+		}
+
+		return fn(drv.pool)
+	}
+
+	conn, err := drv.openSession(ctx, pool)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return fn(conn)
+}
+
+func (drv *snowflakeDriver) openSession(ctx context.Context, pool connPool) (*sql.Conn, error) {
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take a dedicated connection: %w", err)
+	}
+
+	if err = drv.setupSession(ctx, conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (drv *snowflakeDriver) ensureSessionReady(ctx context.Context) error {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	if drv.sessionReady {
+		return nil
+	}
+
+	if err := drv.setupSession(ctx, drv.pool); err != nil {
+		return err
+	}
+
+	drv.sessionReady = true
+
+	return nil
+}
+
+// setupSession selects the role, warehouse, database and schema of the config and sets session parameters.
+func (drv *snowflakeDriver) setupSession(ctx context.Context, db Execer) error {
+	statements, err := drv.makeSessionStatements()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		if _, err = db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to set up session with \"%s\": %w", statement, err)
+		}
+	}
+
+	return nil
+}
+
+func (drv *snowflakeDriver) makeSessionStatements() ([]string, error) {
+	statements := make([]string, 0)
+
+	uses := []struct{ kind, name string }{
+		{"ROLE", drv.config.Role},
+		{"WAREHOUSE", drv.config.Warehouse},
+		{"DATABASE", drv.config.Database},
+		{"SCHEMA", drv.config.Schema},
+	}
+	for _, use := range uses {
+		if use.name != "" {
+			statements = append(statements, fmt.Sprintf("USE %s %s", use.kind, escapeIdentifier(use.name)))
+		}
+	}
+
+	parameters := make([]string, 0, len(drv.config.SessionParameters))
+	for name := range drv.config.SessionParameters {
+		if !isParameterName(name) {
+			return nil, fmt.Errorf("%w: \"%s\" is not a session parameter", ErrInvalidConfig, name)
+		}
+
+		parameters = append(parameters, name)
+	}
+
+	sort.Strings(parameters)
+
+	for _, name := range parameters {
+		statements = append(statements,
+			fmt.Sprintf("ALTER SESSION SET %s = %s", name, escapeString(drv.config.SessionParameters[name])))
+	}
+
+	return append(statements, "ALTER SESSION SET MULTI_STATEMENT_COUNT = 0"), nil
+}
+
+func (drv *snowflakeDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *snowflakeDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	var result []migration.Log
+
+	err := drv.withSession(ctx, func(db Execer) error {
+		tableName := drv.makeEscapedMigrationsTableName()
+
+		if err := drv.ensureMigrationsTableExists(ctx, db, &tableName); err != nil {
+			return err
+		}
+
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(
+			"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+				"applied_by, hostname, app_version, execution_time_ms FROM %s ORDER BY id",
+			tableName,
+		))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer rows.Close()
+
+		result, err = fetchMigrationsLog(rows)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (drv *snowflakeDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext executes the script in a single call. DDL statements of Snowflake commit implicitly,
+// so a script that fails halfway leaves the statements before the failed one applied.
+func (drv *snowflakeDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.withSession(ctx, func(db Execer) error {
+		tableName := drv.makeEscapedMigrationsTableName()
+
+		if err := drv.ensureMigrationsTableExists(ctx, db, &tableName); err != nil {
+			return fmt.Errorf("error when writing migration log: %w", err)
+		}
+
+		startTime := time.Now()
+
+		if _, err := db.ExecContext(ctx, script); err != nil {
+			return &driver.StatementError{Index: -1, Statement: script, Err: err}
+		}
+
+		_, err := db.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time, checksum, "+
+				"applied_by, hostname, app_version, execution_time_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", tableName,
+			),
+			int64(mig.Version),
+			mig.Name,
+			encodeDirection(dir),
+			toTimestampNTZ(startTime),
+			toTimestampNTZ(time.Now()),
+			migration.Checksum([]byte(script)),
+			drv.executor.AppliedBy,
+			drv.executor.Hostname,
+			drv.executor.AppVersion,
+			time.Since(startTime).Milliseconds(),
+		)
+		if err != nil {
+			return fmt.Errorf("error when writing migration log: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (drv *snowflakeDriver) WriteLog(log migration.Log) error {
+	finishedAt := log.FinishedAt
+	if finishedAt.IsZero() {
+		finishedAt = log.AppliedAt
+	}
+
+	var runID, checksum sql.NullString
+	var executionTime sql.NullInt64
+	if log.RunID != "" {
+		runID = sql.NullString{String: log.RunID, Valid: true}
+	}
+	if log.Checksum != "" {
+		checksum = sql.NullString{String: log.Checksum, Valid: true}
+	}
+	if log.ExecutionTime > 0 {
+		executionTime = sql.NullInt64{Int64: log.ExecutionTime.Milliseconds(), Valid: true}
+	}
+
+	executor := drv.executor.ForLog(log)
+	ctx := context.Background()
+
+	return drv.withSession(ctx, func(db Execer) error {
+		tableName := drv.makeEscapedMigrationsTableName()
+
+		if err := drv.ensureMigrationsTableExists(ctx, db, &tableName); err != nil {
+			return fmt.Errorf("failed to write migration log: %w", err)
+		}
+
+		_, err := db.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO %s (version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+				"applied_by, hostname, app_version, execution_time_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", tableName,
+			),
+			int64(log.Version),
+			log.Name,
+			encodeDirection(log.Direction),
+			toTimestampNTZ(log.AppliedAt),
+			toTimestampNTZ(finishedAt),
+			runID,
+			checksum,
+			executor.AppliedBy,
+			executor.Hostname,
+			executor.AppVersion,
+			executionTime,
+		)
+		if err != nil {
+			return fmt.Errorf("error when writing migration log: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// fetchMigrationsLog scans rows of id, version, migration_name, direction, start_time, end_time, run_id,
+// checksum, applied_by, hostname, app_version and execution_time_ms.
+func fetchMigrationsLog(rows *sql.Rows) ([]migration.Log, error) {
+	result := make([]migration.Log, 0)
+	for rows.Next() {
+		var log migration.Log
+		var version int64
+		var direction string
+		var appliedAt time.Time
+		var finishedAt sql.NullTime
+		var name, runID, checksum, appliedBy, hostname, appVersion sql.NullString
+		var executionTime sql.NullInt64
+
+		err := rows.Scan(&log.ID, &version, &name, &direction, &appliedAt, &finishedAt, &runID, &checksum,
+			&appliedBy, &hostname, &appVersion, &executionTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+		}
+
+		log.Version = migration.Version(version)
+		log.Name = name.String
+
+		log.Direction, err = decodeDirection(direction)
+		if err != nil {
+			return nil, err
+		}
+
+		log.RunID = runID.String
+		log.Checksum = checksum.String
+		log.Baseline = log.Name == migration.BaselineName
+		log.AppliedBy = appliedBy.String
+		log.Hostname = hostname.String
+		log.AppVersion = appVersion.String
+		log.ExecutionTime = time.Duration(executionTime.Int64) * time.Millisecond
+		log.AppliedAt = fromTimestampNTZ(appliedAt)
+
+		if finishedAt.Valid {
+			log.FinishedAt = fromTimestampNTZ(finishedAt.Time)
+		}
+
+		result = append(result, log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+	}
+
+	return result, nil
+}
+
+// toTimestampNTZ converts t to UTC, which is what the TIMESTAMP_NTZ columns of the log hold, so that the log
+// does not depend on the TIMEZONE parameter of sessions.
+func toTimestampNTZ(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// fromTimestampNTZ reads a TIMESTAMP_NTZ value as UTC, whatever location the SQL driver has given it.
+func fromTimestampNTZ(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
+
+// makeEscapedMigrationsTableName qualifies the table with Database and Schema of the config, if set,
+// so that the log stays in place when migrations select other schemas.
+func (drv *snowflakeDriver) makeEscapedMigrationsTableName() string {
+	parts := make([]string, 0, 3) //nolint:gomnd
+
+	if drv.config.Database != "" {
+		parts = append(parts, escapeIdentifier(drv.config.Database))
+	}
+
+	if drv.config.Schema != "" {
+		parts = append(parts, escapeIdentifier(drv.config.Schema))
+	} else if drv.config.Database != "" {
+		parts = append(parts, "") // the default schema of the database, as in db..table
+	}
+
+	return strings.Join(append(parts, escapeIdentifier(drv.config.MigrationsTableName)), ".")
+}
+
+func (drv *snowflakeDriver) ensureMigrationsTableExists(ctx context.Context, db Execer, escapedTableName *string) error {
+	drv.mutex.Lock()
+	exists := drv.tableExists
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, makeLogTableDDL(*escapedTableName)); err != nil {
+		return fmt.Errorf("failed to create migrations table %s: %w", *escapedTableName, err)
+	}
+
+	drv.mutex.Lock()
+	drv.tableExists = true
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// makeLogTableDDL creates the log table. Snowflake doesn't enforce primary keys, and identity values are only
+// increasing with ORDER, which the log relies on to be read in the order it was written.
+func makeLogTableDDL(escapedTableName string) string {
+	return "CREATE TABLE IF NOT EXISTS " + escapedTableName + " (" +
+		"id             number(38, 0) identity start 1 increment 1 order, " +
+		"version        number(38, 0) not null, " +
+		"migration_name varchar(100) null, " +
+		"direction      char(1) not null, " + // "u" or "d"
+		"start_time     timestamp_ntz(6) not null, " +
+		"end_time       timestamp_ntz(6) null, " +
+		"run_id         varchar(64) null, " +
+		"checksum       char(64) null, " +
+		"applied_by     varchar(100) null, " +
+		"hostname       varchar(255) null, " +
+		"app_version    varchar(100) null, " +
+		"execution_time_ms number(38, 0) null, " +
+		"primary key (id)" +
+		")"
+}
+
+// escapeIdentifier quotes a name in double quotes, doubling double quotes in it.
+func escapeIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// escapeString quotes a value as a string literal, escaping backslashes and single quotes in it.
+func escapeString(value string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", `\'`) + "'"
+}
+
+// isParameterName accepts names of session parameters, which are letters, digits and underscores.
+func isParameterName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, character := range name {
+		isLetter := character >= 'a' && character <= 'z' || character >= 'A' && character <= 'Z'
+		isDigit := character >= '0' && character <= '9'
+
+		if !isLetter && !isDigit && character != '_' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,108 @@
+package snowflake_test
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/snowflake"
+	"github.com/root-talis/henka/migration"
+)
+
+var errScript = errors.New("SQL compilation error")
+
+// recordingConn records executed statements and fails the ones that contain fail.
+type recordingConn struct {
+	executed []string
+	fail     string
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ ...interface{}) (sql.Result, error) {
+	c.executed = append(c.executed, query)
+
+	if c.fail != "" && strings.Contains(query, c.fail) {
+		return nil, errScript
+	}
+
+	return sqldriver.RowsAffected(1), nil
+}
+
+func (c *recordingConn) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	panic("recordingConn can't be queried")
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	conn := recordingConn{}
+	drv := snowflake.NewDriver(&conn, snowflake.DriverConfig{
+		Warehouse:           "TRANSFORMING",
+		Database:            "ANALYTICS",
+		Schema:              "STAGING",
+		Role:                "TRANSFORMER",
+		MigrationsTableName: "MIGRATIONS_LOG",
+		SessionParameters:   map[string]string{"TIMEZONE": "UTC", "QUERY_TAG": "henka's"},
+	})
+
+	mig := migration.Migration{Version: 20220118115519, Name: "create_orders"}
+	assert.NoError(t, drv.Migrate(mig, migration.Up, "CREATE TABLE orders (id int); CREATE VIEW v AS SELECT * FROM orders"))
+	assert.NoError(t, drv.Migrate(mig, migration.Down, "DROP VIEW v; DROP TABLE orders"))
+
+	if !assert.Len(t, conn.executed, 12) {
+		return
+	}
+
+	assert.Equal(t, []string{
+		`USE ROLE "TRANSFORMER"`,
+		`USE WAREHOUSE "TRANSFORMING"`,
+		`USE DATABASE "ANALYTICS"`,
+		`USE SCHEMA "STAGING"`,
+		`ALTER SESSION SET QUERY_TAG = 'henka\'s'`,
+		`ALTER SESSION SET TIMEZONE = 'UTC'`,
+		`ALTER SESSION SET MULTI_STATEMENT_COUNT = 0`,
+	}, conn.executed[:7], "session must be set up once")
+
+	assert.True(t, strings.HasPrefix(conn.executed[7], `CREATE TABLE IF NOT EXISTS "ANALYTICS"."STAGING"."MIGRATIONS_LOG" (`))
+	assert.Equal(t, "CREATE TABLE orders (id int); CREATE VIEW v AS SELECT * FROM orders", conn.executed[8])
+	assert.True(t, strings.HasPrefix(conn.executed[9], `INSERT INTO "ANALYTICS"."STAGING"."MIGRATIONS_LOG" (`))
+	assert.Equal(t, "DROP VIEW v; DROP TABLE orders", conn.executed[10], "log table must be created once")
+}
+
+func TestMigrateFailure(t *testing.T) {
+	t.Parallel()
+
+	conn := recordingConn{fail: "orders"}
+	drv := snowflake.NewDriver(&conn, snowflake.DriverConfig{MigrationsTableName: "MIGRATIONS_LOG"})
+
+	err := drv.Migrate(migration.Migration{Version: 1, Name: "create_orders"}, migration.Up, "CREATE TABLE orders (id int)")
+	assert.ErrorIs(t, err, errScript)
+
+	var statementErr *driver.StatementError
+	if assert.ErrorAs(t, err, &statementErr) {
+		assert.Equal(t, -1, statementErr.Index)
+	}
+
+	for _, statement := range conn.executed {
+		assert.False(t, strings.HasPrefix(statement, "INSERT"), "failed migrations must not be logged")
+	}
+}
+
+func TestInvalidSessionParameter(t *testing.T) {
+	t.Parallel()
+
+	conn := recordingConn{}
+	drv := snowflake.NewDriver(&conn, snowflake.DriverConfig{
+		MigrationsTableName: "MIGRATIONS_LOG",
+		SessionParameters:   map[string]string{"TIMEZONE = 'UTC'; DROP TABLE x; --": ""},
+	})
+
+	err := drv.Migrate(migration.Migration{Version: 1, Name: "create_orders"}, migration.Up, "CREATE TABLE orders (id int)")
+	assert.ErrorIs(t, err, snowflake.ErrInvalidConfig)
+	assert.Empty(t, conn.executed)
+}
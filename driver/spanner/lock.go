@@ -0,0 +1,120 @@
+package spanner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+
+	"github.com/root-talis/henka/driver/lease"
+)
+
+// Lock takes the row of the migrations table in the lock table in a read-write transaction: the row is taken
+// when it is free or has expired, and inserted when it doesn't exist. The row expires after DriverConfig.LockTTL
+// unless its holder refreshes it. Times come from the database, so that clocks of the instances don't matter.
+func (drv *spannerDriver) Lock(timeout time.Duration) error {
+	ctx := context.Background()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	holder := lease.NewHolder(drv.executor.Hostname)
+	tableName := drv.makeEscapedLockTableName()
+
+	err := lease.Acquire(timeout, func() (taken bool, err error) {
+		_, err = drv.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+			params := drv.makeLockParams(holder)
+
+			updated, err := txn.Update(ctx, spanner.Statement{
+				SQL: fmt.Sprintf("UPDATE %s SET holder = @holder, "+
+					"expires_at = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl MILLISECOND) "+
+					"WHERE name = @name AND (holder IS NULL OR expires_at < CURRENT_TIMESTAMP())", tableName),
+				Params: params,
+			})
+			if err != nil || updated > 0 {
+				taken = updated > 0
+				return err //nolint:wrapcheck
+			}
+
+			inserted, err := txn.Update(ctx, spanner.Statement{
+				SQL: fmt.Sprintf("INSERT INTO %[1]s (name, holder, expires_at) "+
+					"SELECT @name, @holder, TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl MILLISECOND) "+
+					"FROM UNNEST([1]) WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE name = @name)", tableName),
+				Params: params,
+			})
+			taken = inserted > 0
+
+			return err //nolint:wrapcheck
+		})
+
+		return taken, err //nolint:wrapcheck
+	})
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	held := lease.Start(holder, drv.lockTTL(), func() (bool, error) {
+		return drv.updateLock(context.Background(),
+			"expires_at = TIMESTAMP_ADD(CURRENT_TIMESTAMP(), INTERVAL @ttl MILLISECOND)", holder)
+	}, nil)
+
+	drv.mutex.Lock()
+	drv.lease = held
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+// Unlock stops the heartbeat and frees the lock row, see lease.Lease.Release.
+func (drv *spannerDriver) Unlock() error {
+	drv.mutex.Lock()
+	held := drv.lease
+	drv.lease = nil
+	drv.mutex.Unlock()
+
+	return held.Release(func() (bool, error) { //nolint:wrapcheck
+		return drv.updateLock(context.Background(), "holder = NULL", held.Holder)
+	})
+}
+
+// currentLease is the lease held between Lock and Unlock, nil when the lock is not held.
+func (drv *spannerDriver) currentLease() *lease.Lease {
+	drv.mutex.Lock()
+	defer drv.mutex.Unlock()
+
+	return drv.lease
+}
+
+// updateLock sets columns of the lock row while it is held by the holder, and reports whether it is.
+func (drv *spannerDriver) updateLock(ctx context.Context, set string, holder string) (bool, error) {
+	var updated int64
+
+	_, err := drv.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) (err error) {
+		updated, err = txn.Update(ctx, spanner.Statement{
+			SQL:    fmt.Sprintf("UPDATE %s SET %s WHERE name = @name AND holder = @holder", drv.makeEscapedLockTableName(), set),
+			Params: drv.makeLockParams(holder),
+		})
+
+		return err //nolint:wrapcheck
+	})
+
+	return updated > 0, err //nolint:wrapcheck
+}
+
+func (drv *spannerDriver) makeLockParams(holder string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":   drv.config.MigrationsTableName,
+		"holder": holder,
+		"ttl":    drv.lockTTL().Milliseconds(),
+	}
+}
+
+func (drv *spannerDriver) lockTTL() time.Duration {
+	if drv.config.LockTTL <= 0 {
+		return DefaultLockTTL
+	}
+
+	return drv.config.LockTTL
+}
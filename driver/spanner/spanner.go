@@ -0,0 +1,481 @@
+package spanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	"google.golang.org/api/iterator"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/driver/lease"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/sqlscript"
+)
+
+type DriverConfig struct {
+	MigrationsTableName string
+
+	// DDLPollInterval is how often the operation of a schema change is polled until it is done,
+	// DefaultDDLPollInterval if zero.
+	DDLPollInterval time.Duration
+
+	// LockTTL is how long the lock taken by Lock lasts unless it is refreshed, DefaultLockTTL if zero, see package lease.
+	LockTTL time.Duration
+
+	// AppliedBy and AppVersion are recorded with log entries, see driver.Executor.
+	AppliedBy  string
+	AppVersion string
+}
+
+const (
+	DefaultDDLPollInterval = time.Second
+	DefaultLockTTL         = 30 * time.Second
+)
+
+type spannerDriver struct {
+	client *spanner.Client
+	admin  *database.DatabaseAdminClient
+	config DriverConfig
+	mutex  sync.Mutex
+
+	// tablesExist is set once the migrations log and lock tables have been created or found
+	tablesExist bool
+
+	executor driver.Executor
+
+	// lease is the lock row held between Lock and Unlock
+	lease *lease.Lease
+}
+
+// NewDriver returns a driver that executes scripts on the database of the client. Schema changes can't be made
+// in transactions on Spanner, so they are submitted through the admin client, while DML statements run
+// in read-write transactions of the client.
+func NewDriver(client *spanner.Client, admin *database.DatabaseAdminClient, config DriverConfig) driver.Driver {
+	return &spannerDriver{
+		client:   client,
+		admin:    admin,
+		config:   config,
+		executor: driver.NewExecutor(config.AppliedBy, config.AppVersion),
+	}
+}
+
+func (drv *spannerDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return drv.ListMigrationsLogContext(context.Background())
+}
+
+func (drv *spannerDriver) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return nil, fmt.Errorf("failed to list applied versions: %w", err)
+	}
+
+	rows := drv.client.Single().Query(ctx, spanner.Statement{SQL: fmt.Sprintf(
+		"SELECT id, version, migration_name, direction, start_time, end_time, run_id, checksum, "+
+			"applied_by, hostname, app_version, execution_time_ms FROM %s ORDER BY id",
+		drv.makeEscapedMigrationsTableName(),
+	)})
+	defer rows.Stop()
+
+	result := make([]migration.Log, 0)
+
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to query migrations log table: %w", err)
+		}
+
+		log, err := decodeLog(row)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, log)
+	}
+
+	return &result, nil
+}
+
+func decodeLog(row *spanner.Row) (migration.Log, error) {
+	var log migration.Log
+	var id, version int64
+	var name, direction, runID, checksum, appliedBy, hostname, appVersion spanner.NullString
+	var finishedAt spanner.NullTime
+	var executionTime spanner.NullInt64
+
+	err := row.Columns(&id, &version, &name, &direction, &log.AppliedAt, &finishedAt, &runID, &checksum,
+		&appliedBy, &hostname, &appVersion, &executionTime)
+	if err != nil {
+		return log, fmt.Errorf("%w: %s", driver.ErrInvalidLogTable, err.Error())
+	}
+
+	if log.Direction, err = decodeDirection(direction.StringVal); err != nil {
+		return log, err
+	}
+
+	log.ID = uint64(id)
+	log.Version = migration.Version(version)
+	log.Name = name.StringVal
+	log.RunID = runID.StringVal
+	log.Checksum = checksum.StringVal
+	log.Baseline = log.Name == migration.BaselineName
+	log.AppliedBy = appliedBy.StringVal
+	log.Hostname = hostname.StringVal
+	log.AppVersion = appVersion.StringVal
+	log.ExecutionTime = time.Duration(executionTime.Int64) * time.Millisecond
+	log.AppliedAt = log.AppliedAt.UTC()
+
+	if finishedAt.Valid {
+		log.FinishedAt = finishedAt.Time.UTC()
+	}
+
+	return log, nil
+}
+
+func (drv *spannerDriver) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return drv.MigrateContext(context.Background(), mig, dir, script)
+}
+
+// MigrateContext executes the script in batches of consecutive statements of the same kind: schema changes
+// are submitted together as one long-running operation, which is polled until it is done, and DML statements
+// run together in one read-write transaction. Batches before a failed one stay applied, and so do schema
+// changes of the failed batch that have been committed before the failed statement.
+func (drv *spannerDriver) MigrateContext(ctx context.Context, mig migration.Migration, dir migration.Direction, script string) error {
+	held := drv.currentLease()
+	if err := held.Err(); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := held.Bind(ctx)
+	defer cancel()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	startTime := time.Now()
+	statements := sqlscript.Split(script)
+
+	for _, batch := range makeBatches(statements) {
+		var err error
+		var failed int
+
+		if batch.ddl {
+			failed, err = drv.updateSchema(ctx, statements[batch.start:batch.end])
+		} else {
+			failed, err = drv.updateData(ctx, statements[batch.start:batch.end])
+		}
+
+		if err != nil {
+			index := batch.start + failed
+			if len(statements) == 1 {
+				index = -1
+			}
+
+			return &driver.StatementError{Index: index, Statement: statements[batch.start+failed], Err: err}
+		}
+	}
+
+	err := drv.appendLog(ctx, migration.Log{
+		Migration:     mig,
+		Direction:     dir,
+		AppliedAt:     startTime,
+		FinishedAt:    time.Now(),
+		Checksum:      migration.Checksum([]byte(script)),
+		ExecutionTime: time.Since(startTime),
+	}, drv.executor)
+	if err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+func (drv *spannerDriver) WriteLog(log migration.Log) error {
+	ctx := context.Background()
+
+	if err := drv.ensureTablesExist(ctx); err != nil {
+		return fmt.Errorf("failed to write migration log: %w", err)
+	}
+
+	if log.FinishedAt.IsZero() {
+		log.FinishedAt = log.AppliedAt
+	}
+
+	if err := drv.appendLog(ctx, log, drv.executor.ForLog(log)); err != nil {
+		return fmt.Errorf("error when writing migration log: %w", err)
+	}
+
+	return nil
+}
+
+// appendLog inserts the entry with the ID after the latest one. Read-write transactions are serializable,
+// so concurrent writers never take the same ID.
+func (drv *spannerDriver) appendLog(ctx context.Context, log migration.Log, executor driver.Executor) error {
+	tableName := drv.makeEscapedMigrationsTableName()
+
+	_, err := drv.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		_, err := txn.Update(ctx, spanner.Statement{
+			SQL: fmt.Sprintf("INSERT INTO %[1]s (id, version, migration_name, direction, start_time, end_time, run_id, "+
+				"checksum, applied_by, hostname, app_version, execution_time_ms) "+
+				"SELECT IFNULL(MAX(id), 0) + 1, @version, @name, @direction, @start_time, @end_time, @run_id, "+
+				"@checksum, @applied_by, @hostname, @app_version, @execution_time_ms FROM %[1]s", tableName,
+			),
+			Params: map[string]interface{}{
+				"version":           int64(log.Version),
+				"name":              log.Name,
+				"direction":         encodeDirection(log.Direction),
+				"start_time":        log.AppliedAt.UTC(),
+				"end_time":          log.FinishedAt.UTC(),
+				"run_id":            log.RunID,
+				"checksum":          log.Checksum,
+				"applied_by":        executor.AppliedBy,
+				"hostname":          executor.Hostname,
+				"app_version":       executor.AppVersion,
+				"execution_time_ms": log.ExecutionTime.Milliseconds(),
+			},
+		})
+
+		return err //nolint:wrapcheck
+	})
+
+	return err //nolint:wrapcheck
+}
+
+// updateSchema submits the statements as one schema change and polls its operation until it is done.
+// Spanner commits the statements one by one, so on failure the index of the first statement
+// that hasn't been committed is returned along with the error.
+func (drv *spannerDriver) updateSchema(ctx context.Context, statements []string) (int, error) {
+	operation, err := drv.admin.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:   drv.client.DatabaseName(),
+		Statements: statements,
+	})
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	ticker := time.NewTicker(drv.ddlPollInterval())
+	defer ticker.Stop()
+
+	for {
+		err = operation.Poll(ctx)
+		if err != nil || operation.Done() {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("schema change %s is still running: %w", operation.Name(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	if err == nil {
+		return 0, nil
+	}
+
+	committed := 0
+	if metadata, metadataErr := operation.Metadata(); metadataErr == nil && metadata != nil {
+		committed = len(metadata.GetCommitTimestamps())
+	}
+
+	if committed >= len(statements) {
+		committed = len(statements) - 1
+	}
+
+	return committed, err //nolint:wrapcheck
+}
+
+// updateData runs the statements in one read-write transaction and returns the index of the failed statement
+// along with the error. The transaction may be retried as a whole when Spanner aborts it.
+func (drv *spannerDriver) updateData(ctx context.Context, statements []string) (int, error) {
+	failed := 0
+
+	_, err := drv.client.ReadWriteTransaction(ctx, func(ctx context.Context, txn *spanner.ReadWriteTransaction) error {
+		for i, statement := range statements {
+			failed = i
+
+			if _, err := txn.Update(ctx, spanner.Statement{SQL: statement}); err != nil {
+				return err //nolint:wrapcheck
+			}
+		}
+
+		return nil
+	})
+
+	return failed, err //nolint:wrapcheck
+}
+
+// batch is a range of consecutive statements of a script that are all either schema changes or DML.
+type batch struct {
+	start, end int
+	ddl        bool
+}
+
+func makeBatches(statements []string) []batch {
+	batches := make([]batch, 0)
+
+	for i, statement := range statements {
+		ddl := isSchemaChange(statement)
+
+		if len(batches) > 0 && batches[len(batches)-1].ddl == ddl {
+			batches[len(batches)-1].end = i + 1
+			continue
+		}
+
+		batches = append(batches, batch{start: i, end: i + 1, ddl: ddl})
+	}
+
+	return batches
+}
+
+// isSchemaChange tells whether the statement is DDL, which has to be submitted through the admin API.
+func isSchemaChange(statement string) bool {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToUpper(fields[0]) {
+	case "CREATE", "ALTER", "DROP", "GRANT", "REVOKE", "ANALYZE":
+		return true
+	default:
+		return false
+	}
+}
+
+func encodeDirection(dir migration.Direction) string {
+	if dir == migration.Down {
+		return "d"
+	}
+
+	return "u"
+}
+
+func decodeDirection(value string) (migration.Direction, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "u":
+		return migration.Up, nil
+	case "d":
+		return migration.Down, nil
+	}
+
+	return migration.Up, fmt.Errorf("%w: direction \"%s\" is unknown", driver.ErrInvalidLogTable, value)
+}
+
+func (drv *spannerDriver) ddlPollInterval() time.Duration {
+	if drv.config.DDLPollInterval <= 0 {
+		return DefaultDDLPollInterval
+	}
+
+	return drv.config.DDLPollInterval
+}
+
+func (drv *spannerDriver) makeEscapedMigrationsTableName() string {
+	return escapeIdentifier(drv.config.MigrationsTableName)
+}
+
+func (drv *spannerDriver) makeEscapedLockTableName() string {
+	return escapeIdentifier(drv.config.MigrationsTableName + "_lock")
+}
+
+// ensureTablesExist looks the tables up in INFORMATION_SCHEMA before creating them, as Spanner has
+// no CREATE TABLE IF NOT EXISTS.
+func (drv *spannerDriver) ensureTablesExist(ctx context.Context) error {
+	drv.mutex.Lock()
+	exists := drv.tablesExist
+	drv.mutex.Unlock()
+
+	if exists {
+		return nil
+	}
+
+	statements := make([]string, 0, 2) //nolint:gomnd
+
+	for _, table := range drv.makeTablesDDL() {
+		found, err := drv.tableExists(ctx, table.name)
+		if err != nil {
+			return fmt.Errorf("failed to create migrations table %s: %w", drv.makeEscapedMigrationsTableName(), err)
+		}
+
+		if !found {
+			statements = append(statements, table.ddl)
+		}
+	}
+
+	if len(statements) > 0 {
+		if _, err := drv.updateSchema(ctx, statements); err != nil {
+			return fmt.Errorf("failed to create migrations table %s: %w", drv.makeEscapedMigrationsTableName(), err)
+		}
+	}
+
+	drv.mutex.Lock()
+	drv.tablesExist = true
+	drv.mutex.Unlock()
+
+	return nil
+}
+
+func (drv *spannerDriver) tableExists(ctx context.Context, name string) (bool, error) {
+	rows := drv.client.Single().Query(ctx, spanner.Statement{
+		SQL:    "SELECT 1 FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = '' AND TABLE_NAME = @name",
+		Params: map[string]interface{}{"name": name},
+	})
+	defer rows.Stop()
+
+	_, err := rows.Next()
+	if errors.Is(err, iterator.Done) {
+		return false, nil
+	}
+
+	return err == nil, err //nolint:wrapcheck
+}
+
+type tableDDL struct {
+	name string
+	ddl  string
+}
+
+func (drv *spannerDriver) makeTablesDDL() []tableDDL {
+	return []tableDDL{
+		{
+			name: drv.config.MigrationsTableName,
+			ddl: fmt.Sprintf("CREATE TABLE %s ("+
+				"id                INT64 NOT NULL, "+
+				"version           INT64 NOT NULL, "+
+				"migration_name    STRING(MAX), "+
+				"direction         STRING(1) NOT NULL, "+ // "u" or "d"
+				"start_time        TIMESTAMP NOT NULL, "+
+				"end_time          TIMESTAMP, "+
+				"run_id            STRING(MAX), "+
+				"checksum          STRING(MAX), "+
+				"applied_by        STRING(MAX), "+
+				"hostname          STRING(MAX), "+
+				"app_version       STRING(MAX), "+
+				"execution_time_ms INT64"+
+				") PRIMARY KEY (id)", drv.makeEscapedMigrationsTableName()),
+		},
+		{
+			name: drv.config.MigrationsTableName + "_lock",
+			ddl: fmt.Sprintf("CREATE TABLE %s ("+
+				"name       STRING(MAX) NOT NULL, "+
+				"holder     STRING(MAX), "+
+				"expires_at TIMESTAMP"+
+				") PRIMARY KEY (name)", drv.makeEscapedLockTableName()),
+		},
+	}
+}
+
+// escapeIdentifier quotes a name in backticks. Backticks can't be escaped in Spanner identifiers, so they are dropped.
+func escapeIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "") + "`"
+}
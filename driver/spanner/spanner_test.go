@@ -0,0 +1,415 @@
+//nolint:gochecknoglobals
+package spanner_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"github.com/stretchr/testify/assert"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"google.golang.org/api/option"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	instancepb "google.golang.org/genproto/googleapis/spanner/admin/instance/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/root-talis/henka/driver"
+	henkaspanner "github.com/root-talis/henka/driver/spanner"
+	"github.com/root-talis/henka/migration"
+)
+
+// Spanner emulator versions to test against
+var versions = []string{
+	"gcr.io/cloud-spanner-emulator/emulator:1.4.2",
+	"gcr.io/cloud-spanner-emulator/emulator:1.3.0",
+}
+
+const (
+	testInstance = "projects/test-project/instances/test-instance"
+	testDatabase = testInstance + "/databases/test-database"
+)
+
+//
+// -- bootstrap --------------------------------------
+//
+
+type testContainer struct {
+	sync.Mutex
+	ctx       context.Context
+	container testcontainers.Container
+	options   []option.ClientOption
+	admin     *database.DatabaseAdminClient
+}
+
+var containers = make(map[string]*testContainer)
+
+func TestMain(m *testing.M) {
+	failed := false
+	waitGroup := sync.WaitGroup{}
+
+	for _, version := range versions {
+		version := version
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+			if err := setupTestContainer(version); err != nil {
+				failed = true
+				fmt.Printf("error when creating test container for version %s: %s\n", version, err) //nolint:forbidigo
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	var exitCode int
+	if !failed {
+		exitCode = m.Run()
+	} else {
+		exitCode = -1
+	}
+
+	for version, container := range containers {
+		container := container
+		version := version
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := shutdownTestContainer(version, container); err != nil {
+				fmt.Printf("error when cleaning up container %s: %s\n", version, err) //nolint:forbidigo
+				exitCode = -1
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+	os.Exit(exitCode)
+}
+
+func setupTestContainer(version string) error {
+	ctx := context.Background()
+	spannerC, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        version,
+			ExposedPorts: []string{"9010/tcp"},
+			WaitingFor:   wait.ForLog("gRPC server listening"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create container %s: %w", version, err)
+	}
+
+	container := testContainer{
+		ctx:       ctx,
+		container: spannerC,
+	}
+	containers[version] = &container
+
+	host, err := spannerC.Host(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get host of test container %s: %w", version, err)
+	}
+
+	port, err := spannerC.MappedPort(ctx, "9010")
+	if err != nil {
+		return fmt.Errorf("failed to get port of test container %s: %w", version, err)
+	}
+
+	container.options = []option.ClientOption{
+		option.WithEndpoint(fmt.Sprintf("%s:%s", host, port.Port())),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+
+	instanceAdmin, err := instance.NewInstanceAdminClient(ctx, container.options...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to emulator in container %s: %w", version, err)
+	}
+	defer instanceAdmin.Close()
+
+	operation, err := instanceAdmin.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
+		Parent:     "projects/test-project",
+		InstanceId: "test-instance",
+		Instance: &instancepb.Instance{
+			Config:      "projects/test-project/instanceConfigs/emulator-config",
+			DisplayName: "test-instance",
+			NodeCount:   1,
+		},
+	})
+	if err == nil {
+		_, err = operation.Wait(ctx)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to create instance in container %s: %w", version, err)
+	}
+
+	container.admin, err = database.NewDatabaseAdminClient(ctx, container.options...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to emulator in container %s: %w", version, err)
+	}
+
+	return nil
+}
+
+func shutdownTestContainer(version string, container *testContainer) error {
+	fmt.Printf("cleanup %s...\n", version) //nolint:forbidigo
+	container.Lock()
+	defer container.Unlock()
+
+	if container.admin != nil {
+		_ = container.admin.Close()
+	}
+
+	err := container.container.Terminate(container.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to terminate test container %s: %w", version, err)
+	}
+
+	fmt.Printf("cleanup %s done\n", version) //nolint:forbidigo
+	return nil
+}
+
+//
+// -- templates --------------------------------------
+//
+
+var (
+	defaultDriverConfig = henkaspanner.DriverConfig{
+		MigrationsTableName: "migrations_log",
+		DDLPollInterval:     100 * time.Millisecond,
+		AppliedBy:           "tester",
+		AppVersion:          "v1.0.0",
+	}
+
+	migration1Parsed = migration.Log{
+		ID:         1,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Up,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 0, 1, 500000000, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+	migration2Parsed = migration.Log{
+		ID:         2,
+		Migration:  migration.Migration{Version: 20220118115519, Name: "createUsersTable"},
+		Direction:  migration.Down,
+		AppliedAt:  time.Date(2022, 1, 19, 10, 2, 0, 0, time.UTC),
+		FinishedAt: time.Date(2022, 1, 19, 10, 2, 1, 0, time.UTC),
+		AppliedBy:  "tester",
+		AppVersion: "v1.0.0",
+	}
+
+	migrationScript1 = "CREATE TABLE users (id INT64 NOT NULL, name STRING(MAX)) PRIMARY KEY (id);\n" +
+		"CREATE INDEX users_name ON users (name);\n" +
+		"INSERT INTO users (id, name) VALUES (1, 'semi;colon');\n" +
+		"INSERT INTO users (id, name) VALUES (2, 'second');"
+	migrationScript2 = "DELETE FROM users WHERE true;\nDROP INDEX users_name;\nDROP TABLE users"
+)
+
+//
+// --- tests -----------------------------------------
+//
+
+func TestListMigrationsLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/spanner")
+	}
+
+	runForAllEmulatorVersions(t, "ListMigrationsLog", func(t *testing.T, version string, client *spanner.Client, admin *database.DatabaseAdminClient) {
+		t.Helper()
+
+		drv := henkaspanner.NewDriver(client, admin, defaultDriverConfig)
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{}, *actualLog)
+
+		_, err = client.Apply(context.Background(), []*spanner.Mutation{
+			spanner.Insert("migrations_log",
+				[]string{"id", "version", "direction", "start_time"},
+				[]interface{}{1, 1, "x", time.Now()}),
+		})
+		assert.NoError(t, err)
+
+		_, err = drv.ListMigrationsLog()
+		assert.ErrorIs(t, err, driver.ErrInvalidLogTable)
+	})
+}
+
+func TestMigrate(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/spanner")
+	}
+
+	runForAllEmulatorVersions(t, "Migrate", func(t *testing.T, version string, client *spanner.Client, admin *database.DatabaseAdminClient) {
+		t.Helper()
+
+		drv := henkaspanner.NewDriver(client, admin, defaultDriverConfig)
+
+		assert.NoError(t, drv.Migrate(migration1Parsed.Migration, migration.Up, migrationScript1))
+
+		var name string
+		row, err := client.Single().ReadRow(context.Background(), "users", spanner.Key{1}, []string{"name"})
+		if assert.NoError(t, err) {
+			assert.NoError(t, row.Column(0, &name))
+			assert.Equal(t, "semi;colon", name)
+		}
+
+		assert.NoError(t, drv.Migrate(migration2Parsed.Migration, migration.Down, migrationScript2))
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up,
+			"CREATE TABLE users (id INT64 NOT NULL) PRIMARY KEY (id);\n"+
+				"CREATE TABLE users (id INT64 NOT NULL) PRIMARY KEY (id);\n"+
+				"INSERT INTO users (id) VALUES (1);")
+
+		var statementErr *driver.StatementError
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+		}
+
+		err = drv.Migrate(migration1Parsed.Migration, migration.Up, "INSERT INTO users (id) VALUES (2);\nINSERT INTO nowhere (id) VALUES (1);")
+		if assert.ErrorAs(t, err, &statementErr) {
+			assert.Equal(t, 1, statementErr.Index)
+		}
+
+		_, err = client.Single().ReadRow(context.Background(), "users", spanner.Key{2}, []string{"id"})
+		assert.Equal(t, codes.NotFound, spanner.ErrCode(err), "DML of a failed batch must be rolled back")
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+
+		if assert.Len(t, *actualLog, 2) {
+			assert.Equal(t, uint64(1), (*actualLog)[0].ID)
+			assert.Equal(t, migration.Up, (*actualLog)[0].Direction)
+			assert.Equal(t, migration.Checksum([]byte(migrationScript1)), (*actualLog)[0].Checksum)
+			assert.Equal(t, "tester", (*actualLog)[0].AppliedBy)
+			assert.WithinDuration(t, time.Now(), (*actualLog)[0].AppliedAt, time.Minute)
+			assert.Equal(t, uint64(2), (*actualLog)[1].ID)
+			assert.Equal(t, migration.Down, (*actualLog)[1].Direction)
+		}
+	})
+}
+
+func TestWriteLog(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/spanner")
+	}
+
+	runForAllEmulatorVersions(t, "WriteLog", func(t *testing.T, version string, client *spanner.Client, admin *database.DatabaseAdminClient) {
+		t.Helper()
+
+		drv := henkaspanner.NewDriver(client, admin, defaultDriverConfig)
+		writer, ok := drv.(driver.LogWriter)
+		if !ok {
+			t.Fatalf("spanner driver must implement driver.LogWriter")
+		}
+
+		assert.NoError(t, writer.WriteLog(migration1Parsed))
+		assert.NoError(t, writer.WriteLog(migration2Parsed))
+
+		actualLog, err := drv.ListMigrationsLog()
+		assert.NoError(t, err)
+		assert.Equal(t, []migration.Log{migration1Parsed, migration2Parsed}, *actualLog)
+	})
+}
+
+func TestLock(t *testing.T) { //nolint:paralleltest,tparallel
+	if testing.Short() {
+		t.Skip("skipping integration test for driver/spanner")
+	}
+
+	runForAllEmulatorVersions(t, "Lock", func(t *testing.T, version string, client *spanner.Client, admin *database.DatabaseAdminClient) {
+		t.Helper()
+
+		config := defaultDriverConfig
+		config.LockTTL = 3 * time.Second
+
+		first := henkaspanner.NewDriver(client, admin, config)
+		second := henkaspanner.NewDriver(client, admin, config)
+
+		assert.NoError(t, first.(driver.Locker).Lock(time.Second))
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		// the heartbeat keeps the lock beyond its TTL
+		time.Sleep(4 * time.Second)
+		assert.ErrorIs(t, second.(driver.Locker).Lock(time.Second), driver.ErrLockTimeout)
+
+		assert.NoError(t, first.(driver.Locker).Unlock())
+		assert.NoError(t, second.(driver.Locker).Lock(time.Second))
+		assert.NoError(t, second.(driver.Locker).Unlock())
+	})
+}
+
+//
+// --- utility stuff ---------------------------------
+//
+
+func runForAllEmulatorVersions(
+	t *testing.T,
+	baseName string,
+	test func(t *testing.T, version string, client *spanner.Client, admin *database.DatabaseAdminClient),
+) {
+	t.Helper()
+
+	for version, container := range containers {
+		container := container
+		version := version
+		testName := fmt.Sprintf("%s@%s", baseName, version)
+		t.Run(testName, func(t *testing.T) {
+			t.Parallel()
+			container.Lock()
+			defer container.Unlock()
+
+			client := createDatabase(t, container)
+			defer dropDatabase(t, container, client)
+
+			test(t, version, client, container.admin)
+		})
+	}
+}
+
+func createDatabase(t *testing.T, container *testContainer) *spanner.Client {
+	t.Helper()
+
+	operation, err := container.admin.CreateDatabase(container.ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          testInstance,
+		CreateStatement: "CREATE DATABASE `test-database`",
+	})
+	if err == nil {
+		_, err = operation.Wait(container.ctx)
+	}
+
+	if err != nil {
+		t.Fatalf("failed to create database for test: %s", err)
+	}
+
+	client, err := spanner.NewClient(container.ctx, testDatabase, container.options...)
+	if err != nil {
+		t.Fatalf("failed to connect to database for test: %s", err)
+	}
+
+	return client
+}
+
+func dropDatabase(t *testing.T, container *testContainer, client *spanner.Client) {
+	t.Helper()
+
+	client.Close()
+
+	if err := container.admin.DropDatabase(container.ctx, &databasepb.DropDatabaseRequest{Database: testDatabase}); err != nil {
+		t.Fatalf("falied to drop database after test: %s", err)
+	}
+}
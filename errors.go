@@ -0,0 +1,209 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+var (
+	ErrIrreversibleMigration = errors.New("migration can't be undone")
+	ErrOutOfOrderMigration   = errors.New("pending migration is older than the latest applied one")
+	ErrDirtyMigration        = errors.New("migration has not completed its previous execution")
+	ErrNotApplied            = errors.New("migration is not applied")
+	ErrMissingMigration      = errors.New("applied migration is missing from the source")
+	ErrMissingDownScript     = errors.New("down script of migration can't be read")
+
+	// ErrLockTimeout is returned when another run holds the migration lock for longer than Options.LockTimeout.
+	ErrLockTimeout = driver.ErrLockTimeout
+)
+
+// markedError is an error marked with one of the Err... values. errors.Is matches the mark as well as
+// the errors err wraps, and errors.As finds the ones err wraps, e.g. driver.StatementError.
+type markedError struct {
+	mark   error
+	detail string
+	err    error
+}
+
+func markError(mark error, detail string, err error) error {
+	return &markedError{mark: mark, detail: detail, err: err}
+}
+
+func (e *markedError) Error() string {
+	return fmt.Sprintf("%s%s: %s", e.mark, e.detail, e.err)
+}
+
+func (e *markedError) Unwrap() error {
+	return e.err
+}
+
+func (e *markedError) Is(target error) bool {
+	return target == e.mark //nolint:errorlint,goerr113
+}
+
+// MigrationError ties one of the Err... values to the migration it is about, so that callers can check
+// the kind of the error with errors.Is and get the migration with errors.As.
+type MigrationError struct {
+	migration.Migration
+	Err error
+
+	// Detail is appended to the message, e.g. the failure of a dirty migration.
+	Detail string
+}
+
+func newMigrationError(err error, mig migration.Migration) *MigrationError {
+	return &MigrationError{Migration: mig, Err: err}
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("%s: %s%s", e.Err, describeMigration(e.Migration), e.Detail)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// DowngradeBlockedError lists every migration that prevents a downgrade from starting, so that all of them
+// can be dealt with at once. errors.Is matches the error of any blocker, errors.As finds the first one.
+type DowngradeBlockedError struct {
+	Blockers []*MigrationError
+}
+
+func (e *DowngradeBlockedError) Error() string {
+	messages := make([]string, 0, len(e.Blockers))
+	for _, blocker := range e.Blockers {
+		messages = append(messages, blocker.Error())
+	}
+
+	return fmt.Sprintf("downgrade is blocked by %d migration(s): %s", len(e.Blockers), strings.Join(messages, "; "))
+}
+
+func (e *DowngradeBlockedError) Is(target error) bool {
+	for _, blocker := range e.Blockers {
+		if errors.Is(blocker, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *DowngradeBlockedError) Unwrap() error {
+	if len(e.Blockers) == 0 {
+		return nil
+	}
+
+	return e.Blockers[0]
+}
+
+// statementSnippetLength is the number of characters of the failed statement kept in MigrationFailedError.
+const statementSnippetLength = 200
+
+// MigrationFailedError is returned when the driver fails to apply a migration.
+type MigrationFailedError struct {
+	migration.Migration
+	Direction migration.Direction
+
+	// StatementIndex is the zero-based position of the failed statement in the script, -1 if unknown.
+	StatementIndex int
+
+	// Statement is the beginning of the failed statement, or of the whole script if the driver
+	// doesn't tell which statement has failed. Empty if the driver has not reported it.
+	Statement string
+
+	Err error
+}
+
+func newMigrationFailedError(mig migration.Migration, direction migration.Direction, err error) *MigrationFailedError {
+	failure := &MigrationFailedError{
+		Migration:      mig,
+		Direction:      direction,
+		StatementIndex: -1,
+		Err:            err,
+	}
+
+	var statementErr *driver.StatementError
+	if errors.As(err, &statementErr) {
+		failure.StatementIndex = statementErr.Index
+		failure.Statement = snippet(statementErr.Statement)
+	}
+
+	return failure
+}
+
+func (e *MigrationFailedError) Error() string {
+	message := strings.Builder{}
+	fmt.Fprintf(&message, "failed to apply migration %s (%s)", describeMigration(e.Migration), e.Direction)
+
+	if e.StatementIndex >= 0 {
+		fmt.Fprintf(&message, " at statement %d", e.StatementIndex+1)
+	}
+
+	if e.Statement != "" {
+		fmt.Fprintf(&message, " \"%s\"", e.Statement)
+	}
+
+	fmt.Fprintf(&message, ": %s", e.Err)
+
+	return message.String()
+}
+
+func (e *MigrationFailedError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is wrapped into MigrationFailedError when the driver or the source panics while applying a migration.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value the code has panicked with if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// recoverPanic runs fn and turns a panic into PanicError.
+func recoverPanic(fn func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
+
+// snippet collapses whitespace of a statement and cuts it to statementSnippetLength characters.
+func snippet(statement string) string {
+	collapsed := strings.Join(strings.Fields(statement), " ")
+
+	runes := []rune(collapsed)
+	if len(runes) <= statementSnippetLength {
+		return collapsed
+	}
+
+	return string(runes[:statementSnippetLength]) + "..."
+}
+
+// describeMigration names the migration in errors: by version and name, or by name if it is repeatable.
+func describeMigration(mig migration.Migration) string {
+	if isRepeatable(mig) {
+		return "repeatable " + mig.Name
+	}
+
+	return fmt.Sprintf("%d_%s", mig.Version, mig.Name)
+}
@@ -0,0 +1,71 @@
+package henka
+
+import (
+	"time"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Event is one of MigrationStarted, MigrationFinished, MigrationFailed and ValidationCompleted.
+type Event interface {
+	event()
+}
+
+// MigrationStarted is emitted before a migration of a plan is executed. Index is its zero-based
+// position in the plan and Total is the length of the plan. Repeatable migrations, which have no version,
+// are a plan of their own that follows the versioned one.
+type MigrationStarted struct {
+	migration.Migration
+	Direction migration.Direction
+	Index     int
+	Total     int
+}
+
+// MigrationFinished is emitted after a migration is applied.
+type MigrationFinished struct {
+	migration.Migration
+	Direction migration.Direction
+	Index     int
+	Total     int
+	Duration  time.Duration
+}
+
+// MigrationFailed is emitted when a migration fails. The run stops after it.
+type MigrationFailed struct {
+	migration.Migration
+	Direction migration.Direction
+	Index     int
+	Total     int
+	Duration  time.Duration
+	Err       error
+}
+
+// ValidationCompleted is emitted when the state of migrations is evaluated, by Validate, Status
+// and by Upgrade when checksums are verified.
+type ValidationCompleted struct {
+	Result *ValidationResult
+}
+
+func (MigrationStarted) event()    {}
+func (MigrationFinished) event()   {}
+func (MigrationFailed) event()     {}
+func (ValidationCompleted) event() {}
+
+// Observer receives events synchronously, from the goroutine that runs the engine.
+// Observers that do slow work, e.g. network calls, should hand events over to another goroutine.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc adapts a function to Observer.
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+func (m *henkaImpl) emit(event Event) {
+	if m.options.Observer != nil {
+		m.options.Observer.Observe(event)
+	}
+}
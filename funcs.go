@@ -0,0 +1,43 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+var ErrFuncMigrationsNotSupported = errors.New("driver does not support migrations written in Go")
+
+// migrateFunc applies a migration written in Go.
+func (m *run) migrateFunc(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+	fn migration.Func,
+) error {
+	var migrator driver.FuncMigrator
+	if !driver.As(m.driver, &migrator) {
+		return fmt.Errorf("%w: %T", ErrFuncMigrationsNotSupported, m.driver)
+	}
+
+	return migrator.MigrateFunc(ctx, mig, direction, fn) //nolint:wrapcheck
+}
+
+// migrationFunc returns the Go function of the migration, nil if it is an SQL script.
+func (m *run) migrationFunc(mig migration.Migration, direction migration.Direction) (migration.Func, error) {
+	var funcSource source2.FuncSource
+	if !source2.As(m.source, &funcSource) {
+		return nil, nil
+	}
+
+	fn, err := funcSource.MigrationFunc(mig, direction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function of migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return fn, nil
+}
@@ -1,8 +1,12 @@
 package henka
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/root-talis/henka/driver"
@@ -14,153 +18,1049 @@ import (
 
 type Henka interface {
 	Validate() (*ValidationResult, error)
+	Status() (*ValidationResult, error)
+
+	// Upgrade applies pending migrations up to maxVersion, then repeatable migrations that are new or have changed.
 	Upgrade(maxVersion migration.Version) error
+
+	// UpgradeWithResult is Upgrade that reports the migrations applied during the run and the one that has failed.
+	// The result is returned even if the upgrade has failed.
+	UpgradeWithResult(maxVersion migration.Version) (*UpgradeResult, error)
+
+	// UpgradeAll upgrades to the highest version available in the source.
+	UpgradeAll() error
+
+	// UpgradeUntil upgrades to the latest available version that stands for a moment not later than t.
+	// Available versions must be timestamps.
+	UpgradeUntil(t time.Time) error
+
 	Downgrade(toVersion migration.Version) error
+	DowngradeToTime(t time.Time) error
+
+	// Reset reverts every applied migration. It fails if any of them has no down script.
+	Reset() error
+
+	// UpgradeTo and DowngradeTo target the migration with the given name instead of a version.
+	// The name must belong to a single migration of the source.
+	UpgradeTo(name string) error
+	DowngradeTo(name string) error
+
+	// UpgradeSteps applies the next n pending migrations, DowngradeSteps reverts the latest n applied ones.
+	UpgradeSteps(n uint) error
+	DowngradeSteps(n uint) error
+
+	// RequireUpToDate fails with NotUpToDateError if any migration is pending or missing, e.g. to refuse
+	// starting an application against an outdated schema.
+	RequireUpToDate() error
+
+	// Dirty lists executions of migrations that have started but not completed, including the failed ones,
+	// in the order they were written. It is always empty unless the driver implements driver.InterruptedReader.
+	Dirty() ([]migration.Log, error)
+
+	// Reapply executes the up script of an applied migration again and logs it as a new entry.
+	Reapply(version migration.Version) error
+
+	// Baseline marks every migration up to version as applied without executing it, so that henka
+	// can be adopted on a database that already has a schema. The migrations log must be empty.
+	Baseline(version migration.Version) error
+
+	// Repair fixes drift between the migrations log and the source, see RepairOptions.
+	Repair(opts RepairOptions) (*RepairResult, error)
+
+	// PlanUpgrade and PlanDowngrade return the migrations Upgrade and Downgrade would apply, in order,
+	// with their scripts, including repeatable migrations of an upgrade. Nothing is executed.
+	PlanUpgrade(maxVersion migration.Version) ([]PlannedMigration, error)
+	PlanDowngrade(toVersion migration.Version) ([]PlannedMigration, error)
+
+	// ValidateContext, UpgradeContext and DowngradeContext pass ctx to sources and drivers that
+	// implement source.ContextSource and driver.ContextDriver. Runs stop before the next migration once ctx is done.
+	ValidateContext(ctx context.Context) (*ValidationResult, error)
+	UpgradeContext(ctx context.Context, maxVersion migration.Version) error
+	DowngradeContext(ctx context.Context, toVersion migration.Version) error
 }
 
 type ValidationResult struct {
-	Migrations   []migration.State
-	AppliedCount uint
-	PendingCount uint
-	MissingCount uint
+	Migrations   []migration.State `json:"migrations"`
+	AppliedCount uint              `json:"applied_count"`
+	PendingCount uint              `json:"pending_count"`
+	MissingCount uint              `json:"missing_count"`
+
+	// BaselinedCount is the number of migrations treated as applied because of the baseline.
+	BaselinedCount uint `json:"baselined_count"`
+
+	// SkippedCount is the number of pending migrations skipped because of Options.SkipVersions.
+	SkippedCount uint `json:"skipped_count"`
+
+	// DirtyCount is the number of migrations with an execution that has started but has not completed.
+	// It is always zero unless the driver implements driver.InterruptedReader.
+	DirtyCount uint `json:"dirty_count"`
+
+	// FailedCount is the number of dirty migrations whose latest execution has failed.
+	FailedCount uint `json:"failed_count"`
+
+	// UndoableAppliedCount is the number of applied migrations that have a down script.
+	UndoableAppliedCount uint `json:"undoable_applied_count"`
+
+	// LastAppliedVersion is the latest version applied to the database, including Missing ones. Zero if none.
+	LastAppliedVersion migration.Version `json:"last_applied_version"`
+
+	// FirstPendingVersion is the earliest pending version. Zero if none.
+	FirstPendingVersion migration.Version `json:"first_pending_version"`
+
+	// OutOfOrderCount is the number of pending migrations older than LastAppliedVersion.
+	OutOfOrderCount uint `json:"out_of_order_count"`
+}
+
+// MarshalJSON encodes Migrations as an empty list rather than null when there are none.
+func (r ValidationResult) MarshalJSON() ([]byte, error) {
+	type plainResult ValidationResult
+
+	if r.Migrations == nil {
+		r.Migrations = []migration.State{}
+	}
+
+	return json.Marshal(plainResult(r)) //nolint:wrapcheck
 }
 
 // ---
 
 type henkaImpl struct {
-	source source2.Source
-	driver driver.Driver
+	source  source2.Source
+	driver  driver.Driver
+	options Options
+
+	applied appliedStateCache
 }
 
 // ---
 
-func New(source source2.Source, driver driver.Driver) Henka {
+func New(source source2.Source, drv driver.Driver, opts ...Option) Henka {
+	options := Options{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return &henkaImpl{
-		source: source,
-		driver: driver,
+		source:  source2.Chain(source, options.SourceMiddlewares...),
+		driver:  driver.Chain(drv, options.DriverMiddlewares...),
+		options: options,
 	}
 }
 
 // ---
 
+// Validate merges the source listing with the applied state in a single pass. Both are walked in ascending
+// version order, so that neither the listing nor the result have to be looked up or sorted.
 func (m *henkaImpl) Validate() (*ValidationResult, error) {
-	availableMigrations, err := m.source.GetAvailableMigrations()
+	return m.ValidateContext(context.Background())
+}
+
+func (m *henkaImpl) ValidateContext(ctx context.Context) (*ValidationResult, error) {
+	return m.newRun(ctx).validate()
+}
+
+func (m *run) validate() (*ValidationResult, error) {
+	result := ValidationResult{
+		Migrations: make([]migration.State, 0),
+	}
+
+	err := m.mergeStates(true, func(state migration.State) error {
+		result.add(state)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get the list of available migrations: %w", err)
+		return nil, err
+	}
+
+	if err = m.markOutOfOrder(&result); err != nil {
+		return nil, err
+	}
+
+	if m.options.VerifyChecksums {
+		if err = m.verifyChecksums(result.Migrations); err != nil {
+			return nil, fmt.Errorf("failed to verify checksums: %w", err)
+		}
+	}
+
+	if m.options.Dependencies {
+		if err = m.checkDependencies(result.Migrations); err != nil {
+			return nil, fmt.Errorf("failed to verify dependencies: %w", err)
+		}
 	}
 
-	appliedMigrations, err := m.loadSortedMigrationsFromDB()
+	m.emit(ValidationCompleted{Result: &result})
+
+	return &result, nil
+}
+
+// markOutOfOrder flags pending migrations older than the latest applied one, and rejects them
+// under OutOfOrderReject.
+func (m *run) markOutOfOrder(r *ValidationResult) error {
+	if r.LastAppliedVersion == 0 {
+		return nil
+	}
+
+	for i := range r.Migrations {
+		state := &r.Migrations[i]
+		if state.Status != migration.Pending || m.compareVersions(state.Version, r.LastAppliedVersion) >= 0 {
+			continue
+		}
+
+		if m.options.OutOfOrder == OutOfOrderReject {
+			return newMigrationError(ErrOutOfOrderMigration, state.Migration)
+		}
+
+		state.OutOfOrder = true
+		r.OutOfOrderCount++
+	}
+
+	return nil
+}
+
+// add counts the state in. States are added in version order.
+func (r *ValidationResult) add(state migration.State) {
+	switch state.Status {
+	case migration.Pending:
+		r.PendingCount++
+		if r.FirstPendingVersion == 0 {
+			r.FirstPendingVersion = state.Version
+		}
+	case migration.Missing:
+		r.MissingCount++
+		r.LastAppliedVersion = state.Version
+	case migration.Baselined:
+		r.BaselinedCount++
+		r.LastAppliedVersion = state.Version
+	case migration.Skipped:
+		r.SkippedCount++
+	default:
+		r.AppliedCount++
+		r.LastAppliedVersion = state.Version
+		if state.CanUndo {
+			r.UndoableAppliedCount++
+		}
+	}
+
+	if state.Dirty {
+		r.DirtyCount++
+	}
+
+	if state.Failed {
+		r.FailedCount++
+	}
+
+	r.Migrations = append(r.Migrations, state)
+}
+
+// mergeStates walks the source listing and the applied state in version order and emits the state of every
+// version. Versions that are present in the log but not in the source are emitted as Missing. Returning
+// source.ErrStopWalk from emit stops the walk without an error. See walkAvailableMigrations for cache.
+func (m *run) mergeStates(cache bool, emit func(migration.State) error) error {
+	appliedMigrations, err := m.getAppliedMigrations()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+		return fmt.Errorf("failed to get the list of applied migrations: %w", err)
 	}
 
-	result := ValidationResult{
-		Migrations: make([]migration.State, 0, len(*availableMigrations)),
+	applied := m.sortedStates(appliedMigrations)
+	baseline := m.baseline(appliedMigrations)
+
+	dirty, err := m.listInterruptedVersions()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of interrupted migrations: %w", err)
+	}
+
+	var previous migration.Version
+	first := true
+	stopped := false
+
+	emitOrStop := func(state migration.State) error {
+		var attempt migration.Log
+		attempt, state.Dirty = dirty[state.Version]
+		state.Error = attempt.Error
+		state.Failed = attempt.Error != ""
+
+		err := emit(state)
+		if errors.Is(err, source2.ErrStopWalk) {
+			stopped = true
+		}
+
+		return err
 	}
 
-	addAppliedMigrations(&result, appliedMigrations, availableMigrations)
-	addMissingMigrations(&result, appliedMigrations, availableMigrations)
+	err = m.walkAvailableMigrations(cache, func(available migration.Description) error {
+		if !first && m.compareVersions(available.Version, previous) <= 0 {
+			return fmt.Errorf("%w: %d is listed after %d", source2.ErrMigrationsNotSorted, available.Version, previous)
+		}
+
+		previous = available.Version
+		first = false
+
+		for len(applied) > 0 && m.compareVersions(applied[0].Version, available.Version) < 0 {
+			if applied[0].Status != migration.Baselined {
+				if err := emitOrStop(missingState(applied[0])); err != nil {
+					return err
+				}
+			}
+
+			applied = applied[1:]
+		}
+
+		var entry migration.State
+		if len(applied) > 0 && applied[0].Version == available.Version {
+			entry = applied[0]
+			applied = applied[1:]
+		}
+
+		if entry.Status == migration.Pending && m.isBaselined(available.Version, baseline) {
+			entry = baseline
+		}
+
+		if entry.Status == migration.Pending && m.options.SkipVersions[available.Version] {
+			entry.Status = migration.Skipped
+		}
 
-	sort.Slice(result.Migrations, func(i, j int) bool {
-		return result.Migrations[i].Version < result.Migrations[j].Version
+		return emitOrStop(availableState(available, entry))
 	})
+	if err != nil {
+		return fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
 
-	return &result, nil
+	if stopped {
+		return nil
+	}
+
+	for _, entry := range applied {
+		if entry.Status == migration.Baselined {
+			continue
+		}
+
+		if err = emitOrStop(missingState(entry)); err != nil {
+			if errors.Is(err, source2.ErrStopWalk) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listInterruptedVersions returns the latest interrupted execution of every version. It returns nothing unless
+// the driver implements driver.InterruptedReader.
+func (m *run) listInterruptedVersions() (map[migration.Version]migration.Log, error) {
+	var reader driver.InterruptedReader
+	if !driver.As(m.driver, &reader) {
+		return nil, nil
+	}
+
+	interrupted, err := reader.ListInterruptedMigrations()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	result := make(map[migration.Version]migration.Log, len(*interrupted))
+	for _, log := range *interrupted {
+		result[log.Version] = log
+	}
+
+	return result, nil
+}
+
+func (m *henkaImpl) Dirty() ([]migration.Log, error) {
+	var reader driver.InterruptedReader
+	if !driver.As(m.driver, &reader) {
+		return make([]migration.Log, 0), nil
+	}
+
+	interrupted, err := reader.ListInterruptedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of interrupted migrations: %w", err)
+	}
+
+	return *interrupted, nil
 }
 
-func addAppliedMigrations(
-	result *ValidationResult,
-	appliedMigrations *map[migration.Version]migration.State,
-	availableMigrations *[]migration.Description,
-) {
-	for _, availableMigration := range *availableMigrations {
-		entry, ok := (*appliedMigrations)[availableMigration.Version]
+// checkDirty refuses to run while executions of migrations have not completed, unless Options.Resume is set.
+func (m *run) checkDirty() error {
+	if m.options.Resume {
+		return nil
+	}
+
+	dirty, err := m.listInterruptedVersions()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of interrupted migrations: %w", err)
+	}
+
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	versions := make([]migration.Version, 0, len(dirty))
+	for version := range dirty {
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return m.compareVersions(versions[i], versions[j]) < 0
+	})
+
+	attempt := dirty[versions[0]]
+	dirtyErr := newMigrationError(ErrDirtyMigration, attempt.Migration)
+
+	if attempt.Error != "" {
+		dirtyErr.Detail = fmt.Sprintf(" has failed: %s", attempt.Error)
+	}
+
+	dirtyErr.Detail += " (resume to execute it again)"
+
+	return dirtyErr
+}
+
+// availableState is the state of a migration that exists in the source. entry is its applied state, zero if never applied.
+func availableState(available migration.Description, entry migration.State) migration.State {
+	return migration.State{
+		Description: available,
+		Status:      entry.Status,
+		AppliedAt:   entry.AppliedAt,
+		Checksum:    entry.Checksum,
+		Duration:    entry.Duration,
+	}
+}
+
+// missingState is the state of a version that is present in the log but not in the source.
+func missingState(applied migration.State) migration.State {
+	applied.Description.CanUndo = false
+
+	return migration.State{
+		Description: applied.Description,
+		Status:      migration.Missing,
+		AppliedAt:   applied.AppliedAt,
+		Checksum:    applied.Checksum,
+		Duration:    applied.Duration,
+	}
+}
+
+func (m *henkaImpl) sortedStates(states *map[migration.Version]migration.State) []migration.State {
+	result := make([]migration.State, 0, len(*states))
+	for _, state := range *states {
+		result = append(result, state)
+	}
 
-		var status migration.Status
-		if ok {
-			status = entry.Status
-		} else {
-			status = migration.Pending
+	sort.Slice(result, func(i, j int) bool {
+		return m.compareVersions(result[i].Version, result[j].Version) < 0
+	})
+
+	return result
+}
+
+func (m *henkaImpl) Upgrade(maxVersion migration.Version) error {
+	return m.UpgradeContext(context.Background(), maxVersion)
+}
+
+func (m *henkaImpl) UpgradeContext(ctx context.Context, maxVersion migration.Version) error {
+	r := m.newRun(ctx)
+
+	return r.inRun(func() error {
+		return r.upgrade(maxVersion)
+	})
+}
+
+// UpgradeWithResult is Upgrade that also tells which migrations were applied and which one has failed.
+func (m *henkaImpl) UpgradeWithResult(maxVersion migration.Version) (*UpgradeResult, error) {
+	r := m.newRun(context.Background())
+
+	report, err := r.inReportedRun(func() error {
+		return r.upgrade(maxVersion)
+	})
+
+	return &UpgradeResult{Applied: report.Applied, Failed: report.Failed, Err: err}, err
+}
+
+func (m *run) upgrade(maxVersion migration.Version) error {
+	repeatable, err := m.planRepeatable()
+	if err != nil {
+		return err
+	}
+
+	if m.options.SkipWhenUpToDate && len(repeatable) == 0 {
+		upToDate, err := m.isUpToDate(maxVersion)
+		if err != nil {
+			return err
 		}
 
-		if status == migration.Pending {
-			result.PendingCount++
-		} else {
-			result.AppliedCount++
+		if upToDate {
+			return nil
 		}
+	}
 
-		result.Migrations = append(result.Migrations, migration.State{
-			Description: availableMigration,
-			Status:      status,
-			AppliedAt:   entry.AppliedAt,
+	if m.options.VerifyChecksums {
+		err := m.phase(PhaseValidate, migration.Migration{}, func() error {
+			_, err := m.validate()
+			return err
 		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.options.RejectMissing {
+		if err := m.phase(PhaseValidate, migration.Migration{}, m.checkMissing); err != nil {
+			return err
+		}
+	}
+
+	var plan []migration.Migration
+
+	err = m.phase(PhasePlan, migration.Migration{}, func() (err error) {
+		plan, err = m.planUpgrade(maxVersion)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to plan upgrade: %w", err)
+	}
+
+	m.logger().Info("planned upgrade", "max_version", maxVersion, "migrations", len(plan))
+
+	return m.withSchemaSnapshots(func() error {
+		if err := m.execute(plan, migration.Up, nil); err != nil {
+			return err
+		}
+
+		return m.executeRepeatable(repeatable)
+	})
+}
+
+func (m *henkaImpl) UpgradeAll() error {
+	target, err := m.newRun(context.Background()).resolveLatestVersion()
+	if err != nil {
+		return fmt.Errorf("failed to resolve upgrade target: %w", err)
+	}
+
+	return m.Upgrade(target)
+}
+
+// resolveLatestVersion returns the highest available version, zero if there is none.
+func (m *run) resolveLatestVersion() (migration.Version, error) {
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	var target migration.Version
+	for _, descr := range *available {
+		if target == 0 || m.compareVersions(descr.Version, target) > 0 {
+			target = descr.Version
+		}
+	}
+
+	return target, nil
+}
+
+// UpgradeUntil upgrades to the latest available version that stands for a moment not later than t,
+// e.g. to reproduce the schema as of a past incident. Available versions must be timestamps.
+func (m *henkaImpl) UpgradeUntil(t time.Time) error {
+	target, err := m.newRun(context.Background()).resolveAvailableTimeTarget(t)
+	if err != nil {
+		return fmt.Errorf("failed to resolve upgrade target: %w", err)
+	}
+
+	return m.Upgrade(target)
+}
+
+// resolveAvailableTimeTarget returns the latest available version not later than t, zero if there is none.
+func (m *run) resolveAvailableTimeTarget(t time.Time) (migration.Version, error) {
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	var target migration.Version
+
+	for _, descr := range *available {
+		createdAt, err := descr.Version.Time()
+		if err != nil {
+			return 0, err //nolint:wrapcheck
+		}
+
+		if !createdAt.After(t) && (target == 0 || m.compareVersions(descr.Version, target) > 0) {
+			target = descr.Version
+		}
+	}
+
+	return target, nil
+}
+
+// checkMissing fails if any applied migration is absent from the source.
+func (m *run) checkMissing() error {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	known := make(map[migration.Version]struct{}, len(*available))
+	for _, descr := range *available {
+		known[descr.Version] = struct{}{}
+	}
+
+	missing := make([]string, 0)
+
+	for _, state := range m.sortedStates(appliedMigrations) {
+		if _, ok := known[state.Version]; !ok && state.Status == migration.Applied {
+			missing = append(missing, fmt.Sprintf("%d_%s", state.Version, state.Name))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingMigration, strings.Join(missing, ", "))
 	}
+
+	return nil
+}
+
+// isUpToDate compares the highest applied version with the highest available one that is not past maxVersion.
+// It is false when the driver can't tell the highest applied version cheaply. Drivers compare versions
+// numerically, so it is false with custom orderings too.
+func (m *run) isUpToDate(maxVersion migration.Version) (bool, error) {
+	var reader driver.MaxVersionReader
+	if !driver.As(m.driver, &reader) || m.options.Ordering != nil {
+		return false, nil
+	}
+
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return false, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	var target migration.Version
+	for _, descr := range *available {
+		if m.compareVersions(descr.Version, maxVersion) <= 0 && (target == 0 || m.compareVersions(descr.Version, target) > 0) {
+			target = descr.Version
+		}
+	}
+
+	if target == 0 {
+		return true, nil
+	}
+
+	applied, anyApplied, err := reader.GetMaxAppliedVersion()
+	if err != nil {
+		return false, fmt.Errorf("failed to get the highest applied version: %w", err)
+	}
+
+	return anyApplied && m.compareVersions(applied, target) >= 0, nil
+}
+
+// compareVersions orders versions with Options.Ordering. Zero stands for no version, e.g. the target of
+// a downgrade that reverts everything, so it goes before every version whatever the ordering is.
+func (m *henkaImpl) compareVersions(a, b migration.Version) int {
+	switch {
+	case a == b:
+		return 0
+	case a == 0:
+		return -1
+	case b == 0:
+		return 1
+	}
+
+	if m.options.Ordering == nil {
+		return migration.NumericOrdering.Compare(a, b)
+	}
+
+	return m.options.Ordering.Compare(a, b)
+}
+
+// planUpgrade walks available migrations up to maxVersion and picks the ones that are not applied.
+// Sources that can be walked lazily are not listed past maxVersion, unless already listed during the run.
+// Pending migrations older than the latest applied one are handled according to Options.OutOfOrder.
+func (m *run) planUpgrade(maxVersion migration.Version) ([]migration.Migration, error) {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	latest := m.latestApplied(appliedMigrations)
+	baseline := m.baseline(appliedMigrations)
+	plan := make([]migration.Migration, 0)
+
+	err = m.walkAvailableMigrations(false, func(descr migration.Description) error {
+		if m.compareVersions(descr.Version, maxVersion) > 0 {
+			return source2.ErrStopWalk
+		}
+
+		if state, ok := (*appliedMigrations)[descr.Version]; ok && state.Status == migration.Applied {
+			return nil
+		}
+
+		if m.isBaselined(descr.Version, baseline) {
+			return nil
+		}
+
+		if m.options.SkipVersions[descr.Version] {
+			m.logger().Debug("skipped migration", "version", descr.Version, "name", descr.Name)
+			return nil
+		}
+
+		if excluded, err := m.excludedByTags(descr.Migration); err != nil || excluded {
+			if excluded {
+				m.logger().Debug("skipped migration because of its tags", "version", descr.Version, "name", descr.Name)
+			}
+
+			return err
+		}
+
+		if latest != 0 && m.compareVersions(descr.Version, latest) < 0 {
+			switch m.options.OutOfOrder {
+			case OutOfOrderReject:
+				return newMigrationError(ErrOutOfOrderMigration, descr.Migration)
+			case OutOfOrderSkip:
+				m.logger().Warn("skipped out-of-order migration", "version", descr.Version, "name", descr.Name)
+
+				if m.snapshot != nil {
+					m.snapshot.report.Skipped = append(m.snapshot.report.Skipped, descr.Migration)
+				}
+
+				return nil
+			case OutOfOrderWarn:
+				m.logger().Warn("applying out-of-order migration", "version", descr.Version, "name", descr.Name, "latest", latest)
+			case OutOfOrderApply:
+			}
+		}
+
+		plan = append(plan, descr.Migration)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	if m.options.Dependencies {
+		return m.orderByDependencies(plan, appliedMigrations, baseline)
+	}
+
+	return plan, nil
+}
+
+// latestApplied returns the latest applied or baselined version, zero if there is none.
+func (m *run) latestApplied(appliedMigrations *map[migration.Version]migration.State) migration.Version {
+	var latest migration.Version
+
+	for version, state := range *appliedMigrations {
+		if state.Status != migration.Applied && state.Status != migration.Baselined {
+			continue
+		}
+
+		if latest == 0 || m.compareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+
+	return latest
+}
+
+// Downgrade reverts applied migrations later than toVersion, latest first. Nothing is reverted if any of them
+// can't be undone, unless Options.ForceDowngrade is set: such migrations are then marked as reverted in the log
+// without executing any script.
+func (m *henkaImpl) Downgrade(toVersion migration.Version) error {
+	return m.DowngradeContext(context.Background(), toVersion)
+}
+
+func (m *henkaImpl) DowngradeContext(ctx context.Context, toVersion migration.Version) error {
+	r := m.newRun(ctx)
+
+	return r.inRun(func() error {
+		var plan []migration.Migration
+		var forced map[migration.Version]bool
+
+		err := r.phase(PhasePlan, migration.Migration{}, func() (err error) {
+			plan, forced, err = r.planDowngrade(toVersion)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to plan downgrade: %w", err)
+		}
+
+		m.logger().Info("planned downgrade", "to_version", toVersion, "migrations", len(plan), "forced", len(forced))
+
+		return r.execute(plan, migration.Down, forced)
+	})
 }
 
-func addMissingMigrations(
-	result *ValidationResult,
-	appliedMigrations *map[migration.Version]migration.State,
-	availableMigrations *[]migration.Description,
-) {
-	for _, applied := range *appliedMigrations {
-		found := false
+// planDowngrade picks applied migrations later than toVersion in reverse order. forced are the ones
+// that can't be undone and are planned because of Options.ForceDowngrade. Down scripts of the rest are
+// read from the source beforehand; migrations that can't be undone are reported together in DowngradeBlockedError.
+func (m *run) planDowngrade(toVersion migration.Version) ([]migration.Migration, map[migration.Version]bool, error) {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	undoable := make(map[migration.Version]bool, len(*available))
+	for _, descr := range *available {
+		undoable[descr.Version] = descr.CanUndo
+	}
+
+	applied := m.sortedStates(appliedMigrations)
+	plan := make([]migration.Migration, 0)
+	forced := make(map[migration.Version]bool)
+	blocked := &DowngradeBlockedError{}
 
-		for _, available := range *availableMigrations {
-			if applied.Version == available.Version {
-				found = true
+	for i := len(applied) - 1; i >= 0; i-- {
+		state := applied[i]
+		if state.Status != migration.Applied || m.compareVersions(state.Version, toVersion) <= 0 {
+			continue
+		}
+
+		if !undoable[state.Version] {
+			if !m.options.ForceDowngrade {
+				blocked.Blockers = append(blocked.Blockers, newMigrationError(ErrIrreversibleMigration, state.Migration))
 				continue
 			}
+
+			forced[state.Version] = true
+		} else if err = m.checkDownScript(state.Migration); err != nil {
+			blocker := newMigrationError(ErrMissingDownScript, state.Migration)
+			blocker.Detail = ": " + err.Error()
+			blocked.Blockers = append(blocked.Blockers, blocker)
+
+			continue
 		}
 
-		applied.Description.CanUndo = false
+		plan = append(plan, state.Migration)
+	}
 
-		if !found {
-			result.Migrations = append(result.Migrations, migration.State{
-				Description: applied.Description,
-				Status:      migration.Missing,
-				AppliedAt:   applied.AppliedAt,
-			})
-			result.MissingCount++
+	if len(blocked.Blockers) > 0 {
+		return nil, nil, blocked
+	}
+
+	return plan, forced, nil
+}
+
+// checkDownScript reads the down script of the migration, so that a downgrade is refused before it starts
+// rather than failing halfway because of a script the source can't provide.
+func (m *run) checkDownScript(mig migration.Migration) error {
+	return recoverPanic(func() error {
+		_, err := readScript(m.ctx, m.source, mig, migration.Down)
+		return err
+	})
+}
+
+// DowngradeToTime downgrades to the latest applied version that stands for a moment not later than t,
+// so that every migration created after t is reverted. Applied versions must be timestamps.
+func (m *henkaImpl) DowngradeToTime(t time.Time) error {
+	target, err := m.newRun(context.Background()).resolveTimeTarget(t)
+	if err != nil {
+		return fmt.Errorf("failed to resolve downgrade target: %w", err)
+	}
+
+	return m.Downgrade(target)
+}
+
+// resolveTimeTarget returns the latest applied version not later than t, zero if there is none.
+func (m *run) resolveTimeTarget(t time.Time) (migration.Version, error) {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	var target migration.Version
+
+	for version, state := range *appliedMigrations {
+		if state.Status != migration.Applied {
+			continue
+		}
+
+		appliedTime, err := version.Time()
+		if err != nil {
+			return 0, err //nolint:wrapcheck
+		}
+
+		if !appliedTime.After(t) && (target == 0 || m.compareVersions(version, target) > 0) {
+			target = version
 		}
 	}
+
+	return target, nil
 }
 
-func (m *henkaImpl) Upgrade(maxVersion migration.Version) error {
+// execute applies the plan in its order. Migrations in withoutScript are applied with an empty script.
+// Migrations are wrapped in transactions according to Options.Transactions.
+func (m *run) execute(
+	plan []migration.Migration,
+	direction migration.Direction,
+	withoutScript map[migration.Version]bool,
+) error {
+	if len(plan) == 0 {
+		return nil
+	}
+
+	if err := m.checkTransactions(); err != nil {
+		return err
+	}
+
+	if err := m.checkDirty(); err != nil {
+		return err
+	}
+
+	if m.options.Transactions == WrapWholeRun {
+		return m.inTransaction(func() error {
+			return m.executePlan(plan, direction, withoutScript)
+		})
+	}
+
+	return m.executePlan(plan, direction, withoutScript)
+}
+
+func (m *run) executePlan(
+	plan []migration.Migration,
+	direction migration.Direction,
+	withoutScript map[migration.Version]bool,
+) error {
+	scripted := make([]migration.Migration, 0, len(plan))
+	for _, mig := range plan {
+		if !withoutScript[mig.Version] {
+			scripted = append(scripted, mig)
+		}
+	}
+
+	fetcher := m.prefetch(scripted, direction)
+	defer fetcher.stop()
+
+	taken := 0
+
+	for index, mig := range plan {
+		if m.options.Shutdown != nil && m.options.Shutdown.isStopped() {
+			return fmt.Errorf("%w before migration %d_%s", ErrInterrupted, mig.Version, mig.Name)
+		}
+
+		if err := m.ctx.Err(); err != nil {
+			return fmt.Errorf("run was canceled before migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+
+		readScript := func() ([]byte, error) { return nil, nil }
+
+		if !withoutScript[mig.Version] {
+			i := taken
+			taken++
+			readScript = func() ([]byte, error) { return fetcher.take(i) }
+		}
+
+		apply := func() error { return m.migrate(mig, direction, readScript) }
+		if m.options.Transactions == WrapEachMigration {
+			migrate := apply
+			apply = func() error { return m.inTransaction(migrate) }
+		}
+
+		if err := m.executeStep(mig, direction, index, len(plan), apply); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (m *henkaImpl) Downgrade(toVersion migration.Version) error {
+// executeStep applies a migration of a plan with apply, emitting events and recording the outcome
+// in the report of the run.
+func (m *run) executeStep(mig migration.Migration, direction migration.Direction, index, total int, apply func() error) error {
+	m.emit(MigrationStarted{Migration: mig, Direction: direction, Index: index, Total: total})
+	start := time.Now()
+
+	if err := apply(); err != nil {
+		m.emit(MigrationFailed{
+			Migration: mig, Direction: direction, Index: index, Total: total, Duration: time.Since(start), Err: err,
+		})
+
+		if m.snapshot != nil {
+			failed := mig
+			m.snapshot.report.Failed = &failed
+		}
+
+		return err
+	}
+
+	if m.snapshot != nil {
+		m.snapshot.report.Applied = append(m.snapshot.report.Applied,
+			AppliedMigration{Migration: mig, Direction: direction, Duration: time.Since(start)})
+	}
+
+	m.emit(MigrationFinished{Migration: mig, Direction: direction, Index: index, Total: total, Duration: time.Since(start)})
+
 	return nil
 }
 
-func (m *henkaImpl) loadSortedMigrationsFromDB() (*map[migration.Version]migration.State, error) {
-	migrations, err := m.driver.ListMigrationsLog()
+// migrate applies a migration with the script returned by readScript.
+func (m *run) migrate(mig migration.Migration, direction migration.Direction, readScript func() ([]byte, error)) error {
+	var script []byte
+
+	start := time.Now()
+	m.logger().Info("applying migration", "version", mig.Version, "name", mig.Name, "direction", direction)
+
+	err := m.phase(PhaseReadScript, mig, func() error {
+		return recoverPanic(func() (err error) {
+			script, err = readScript()
+			return err
+		})
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to load migrations from db: %w", err)
+		m.logger().Error("failed to read migration", "version", mig.Version, "name", mig.Name, "error", err)
+		return fmt.Errorf("failed to read migration %d_%s: %w", mig.Version, mig.Name, err)
 	}
 
-	result := make(map[migration.Version]migration.State, len(*migrations))
-	for _, mig := range *migrations {
-		var status migration.Status
-		var appliedAt time.Time
+	if err = m.confirm(mig, direction, string(script)); err != nil {
+		return err
+	}
 
-		switch mig.Direction {
-		case migration.Up:
-			status = migration.Applied
-			appliedAt = mig.AppliedAt
-		case migration.Down:
-			status = migration.Pending
-		}
+	var timedOut bool
+
+	err = m.phase(PhaseMigrate, mig, func() error {
+		return recoverPanic(func() (err error) {
+			timedOut, err = m.withMigrationTimeout(func(ctx context.Context) error {
+				return m.migrateWithDriver(ctx, mig, direction, string(script))
+			})
+
+			return err
+		})
+	})
+	m.invalidateAppliedMigrations()
+
+	if err == nil {
+		m.logger().Info("applied migration",
+			"version", mig.Version, "name", mig.Name, "direction", direction, "duration", time.Since(start))
+
+		return nil
+	}
+
+	m.logger().Error("migration failed",
+		"version", mig.Version, "name", mig.Name, "direction", direction, "duration", time.Since(start), "error", err)
+
+	canceled := m.options.Shutdown != nil && m.options.Shutdown.isCanceled()
 
-		result[mig.Version] = migration.State{
-			Description: migration.Description{
-				Migration: mig.Migration,
-				CanUndo:   false,
-			},
-			Status:    status,
-			AppliedAt: appliedAt,
+	var panicErr *PanicError
+	var recorder driver.FailureRecorder
+	if !isRepeatable(mig) && driver.As(m.driver, &recorder) && (canceled || timedOut || errors.As(err, &panicErr)) {
+		if recordErr := recorder.RecordFailure(mig, direction, err); recordErr != nil {
+			err = fmt.Errorf("%w (failed to record the failure: %s)", err, recordErr)
 		}
 	}
 
-	return &result, nil
+	failure := newMigrationFailedError(mig, direction, err)
+	switch {
+	case canceled:
+		failure.Err = markError(ErrInterrupted, "", failure.Err)
+	case timedOut:
+		failure.Err = markError(ErrMigrationTimeout, fmt.Sprintf(" after %s", m.options.MigrationTimeout), failure.Err)
+	}
+
+	return failure
 }
@@ -1,15 +1,28 @@
 package henka_test
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/driver"
 	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
+	"github.com/root-talis/henka/source"
+	"github.com/root-talis/henka/source/gosource"
 )
 
 // -- testing double for source ----------
@@ -27,8 +40,16 @@ func (m *sourceMock) GetAvailableMigrations() (*[]migration.Description, error)
 	return &m.availableMigrations.descr, m.availableMigrations.err
 }
 
-func (m *sourceMock) ReadMigration(migration migration.Migration, direction migration.Direction) (io.Reader, error) {
-	return nil, nil
+func (m *sourceMock) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	if mig.Version == brokenVersion {
+		return nil, ErrAny
+	}
+
+	return strings.NewReader(makeScript(mig, direction)), nil
+}
+
+func makeScript(mig migration.Migration, direction migration.Direction) string {
+	return fmt.Sprintf("-- %d_%s.%c", mig.Version, mig.Name, direction)
 }
 
 // -- testing double for driver ----------
@@ -38,18 +59,45 @@ type driverListAppliedMigrationsResult struct {
 	err error
 }
 
+type driverMigrateCall struct {
+	migration migration.Migration
+	direction migration.Direction
+	script    string
+}
+
 type driverMock struct {
 	appliedMigrations driverListAppliedMigrationsResult
+	migrateCalls      []driverMigrateCall
+	migrateErr        error
 }
 
 func (m *driverMock) ListMigrationsLog() (*[]migration.Log, error) {
 	return &m.appliedMigrations.log, m.appliedMigrations.err
 }
 
-func (m *driverMock) Migrate(migration.Migration, migration.Direction, string) error {
+func (m *driverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	if m.migrateErr != nil {
+		return m.migrateErr
+	}
+
+	m.migrateCalls = append(m.migrateCalls, driverMigrateCall{migration: mig, direction: direction, script: script})
+	m.appliedMigrations.log = append(m.appliedMigrations.log, migration.Log{
+		Migration: mig,
+		Direction: direction,
+		AppliedAt: time.Unix(99999, 0),
+	})
+
 	return nil
 }
 
+func makeMigrateCall(mig migration.Description, direction migration.Direction) driverMigrateCall {
+	return driverMigrateCall{
+		migration: mig.Migration,
+		direction: direction,
+		script:    makeScript(mig.Migration, direction),
+	}
+}
+
 //
 // -- Tests for Henka.Validate() ------------
 //
@@ -66,6 +114,9 @@ func disableUndo(mig migration.Description) migration.Description {
 	return mig
 }
 
+// brokenVersion is a version that sourceMock fails to read.
+const brokenVersion = 20000101000000
+
 var ErrAny = errors.New("test error")
 
 var validateTestsTable = []struct { // nolint:gochecknoglobals
@@ -107,6 +158,8 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: migrations[1], Status: migration.Pending},
 			},
 			PendingCount: 1,
+
+			FirstPendingVersion: migrations[1].Version,
 		},
 	},
 	/* s2 */ {
@@ -123,6 +176,8 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: migrations[1], Status: migration.Pending},
 			},
 			PendingCount: 2,
+
+			FirstPendingVersion: migrations[0].Version,
 		},
 	},
 	/* s3 */ {
@@ -140,6 +195,9 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: migrations[0], Status: migration.Applied, AppliedAt: time.Unix(12345, 0)},
 			},
 			AppliedCount: 1,
+
+			UndoableAppliedCount: 1,
+			LastAppliedVersion:   migrations[0].Version,
 		},
 	},
 	/* s4 */ {
@@ -159,6 +217,9 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: migrations[2], Status: migration.Applied, AppliedAt: time.Unix(12346, 0)},
 			},
 			AppliedCount: 2,
+
+			UndoableAppliedCount: 2,
+			LastAppliedVersion:   migrations[2].Version,
 		},
 	},
 	/* s5 */ {
@@ -176,6 +237,8 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: disableUndo(migrations[1]), Status: migration.Missing, AppliedAt: time.Unix(12345, 0)},
 			},
 			MissingCount: 1,
+
+			LastAppliedVersion: migrations[1].Version,
 		},
 	},
 	/* s6 */ {
@@ -195,6 +258,8 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: disableUndo(migrations[2]), Status: migration.Missing, AppliedAt: time.Unix(12346, 0)},
 			},
 			MissingCount: 2,
+
+			LastAppliedVersion: migrations[2].Version,
 		},
 	},
 	/* s7 */ {
@@ -217,6 +282,9 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 			},
 			AppliedCount: 2,
 			MissingCount: 1,
+
+			UndoableAppliedCount: 2,
+			LastAppliedVersion:   migrations[2].Version,
 		},
 	},
 	/* s8 */ {
@@ -235,6 +303,8 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: migrations[1], Status: migration.Pending},
 			},
 			PendingCount: 1,
+
+			FirstPendingVersion: migrations[1].Version,
 		},
 	},
 	/* s9 */ {
@@ -258,6 +328,8 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 				{Description: migrations[2], Status: migration.Pending},
 			},
 			PendingCount: 2,
+
+			FirstPendingVersion: migrations[1].Version,
 		},
 	},
 	/* s10 */ {
@@ -279,6 +351,10 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 			},
 			AppliedCount: 1,
 			PendingCount: 1,
+
+			UndoableAppliedCount: 1,
+			LastAppliedVersion:   migrations[1].Version,
+			FirstPendingVersion:  migrations[2].Version,
 		},
 	},
 	/* s11 */ {
@@ -302,6 +378,10 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 			},
 			AppliedCount: 1,
 			PendingCount: 1,
+
+			UndoableAppliedCount: 1,
+			LastAppliedVersion:   migrations[1].Version,
+			FirstPendingVersion:  migrations[2].Version,
 		},
 	},
 	/* s12 */ {
@@ -322,13 +402,18 @@ var validateTestsTable = []struct { // nolint:gochecknoglobals
 		expectedResult: henka.ValidationResult{
 			Migrations: []migration.State{
 				{Description: migrations[0], Status: migration.Applied, AppliedAt: time.Unix(12349, 0)},
-				{Description: migrations[1], Status: migration.Pending},
+				{Description: migrations[1], Status: migration.Pending, OutOfOrder: true},
 				{Description: disableUndo(migrations[2]), Status: migration.Missing, AppliedAt: time.Unix(12350, 0)},
 				{Description: migrations[3], Status: migration.Pending},
 			},
 			PendingCount: 2,
 			AppliedCount: 1,
 			MissingCount: 1,
+
+			UndoableAppliedCount: 1,
+			LastAppliedVersion:   migrations[2].Version,
+			FirstPendingVersion:  migrations[1].Version,
+			OutOfOrderCount:      1,
 		},
 	},
 
@@ -381,3 +466,3226 @@ func TestValidate(t *testing.T) {
 		})
 	}
 }
+
+//
+// -- Tests for Henka.Upgrade() ------------
+//
+
+var upgradeTestsTable = []struct { // nolint:gochecknoglobals
+	name                string
+	availableMigrations []migration.Description
+	appliedMigrations   driverListAppliedMigrationsResult
+	migrateErr          error
+	maxVersion          migration.Version
+
+	expectedCalls []driverMigrateCall
+	expectError   bool
+}{
+	// -- success cases: ---
+	/* s0 */ {
+		name:                "s0: should do nothing when there are no migrations",
+		availableMigrations: []migration.Description{},
+		maxVersion:          migrations[3].Version,
+	},
+	/* s1 */ {
+		name:                "s1: should apply all pending migrations",
+		availableMigrations: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		maxVersion:          migrations[3].Version,
+		expectedCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[0], migration.Up),
+			makeMigrateCall(migrations[1], migration.Up),
+			makeMigrateCall(migrations[2], migration.Up),
+		},
+	},
+	/* s2 */ {
+		name:                "s2: should not apply migrations above maxVersion",
+		availableMigrations: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		maxVersion:          migrations[1].Version,
+		expectedCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[0], migration.Up),
+			makeMigrateCall(migrations[1], migration.Up),
+		},
+	},
+	/* s3 */ {
+		name:                "s3: should skip applied migrations",
+		availableMigrations: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		appliedMigrations: driverListAppliedMigrationsResult{
+			log: []migration.Log{
+				{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0)},
+				{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12346, 0)},
+				{Migration: migrations[1].Migration, Direction: migration.Down, AppliedAt: time.Unix(12347, 0)},
+			},
+		},
+		maxVersion: migrations[3].Version,
+		expectedCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[1], migration.Up),
+			makeMigrateCall(migrations[2], migration.Up),
+		},
+	},
+
+	// -- error cases: -----
+	/* e0 */ {
+		name:                "e0: should fail when driver fails",
+		availableMigrations: []migration.Description{migrations[0]},
+		migrateErr:          ErrAny,
+		maxVersion:          migrations[3].Version,
+		expectError:         true,
+	},
+	/* e1 */ {
+		name: "e1: should fail when source fails to read a script",
+		availableMigrations: []migration.Description{
+			migrations[0],
+			{Migration: migration.Migration{Version: brokenVersion, Name: "broken"}},
+		},
+		maxVersion:  migrations[3].Version,
+		expectError: true,
+	},
+	/* e2 */ {
+		name:                "e2: should fail when driver fails to list migrations",
+		availableMigrations: []migration.Description{migrations[0]},
+		appliedMigrations:   driverListAppliedMigrationsResult{err: ErrAny},
+		maxVersion:          migrations[3].Version,
+		expectError:         true,
+	},
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should apply pending migrations in order.")
+
+	for _, test := range upgradeTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{descr: test.availableMigrations}}
+			drv := driverMock{appliedMigrations: test.appliedMigrations, migrateErr: test.migrateErr}
+
+			migrator := henka.New(&src, &drv)
+			err := migrator.Upgrade(test.maxVersion)
+
+			if test.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedCalls, drv.migrateCalls)
+			}
+		})
+	}
+}
+
+//
+// -- Tests for Henka.Downgrade() ------------
+//
+
+func appliedLog(descr ...migration.Description) driverListAppliedMigrationsResult {
+	log := make([]migration.Log, 0, len(descr))
+	for i, mig := range descr {
+		log = append(log, migration.Log{Migration: mig.Migration, Direction: migration.Up, AppliedAt: time.Unix(int64(12345+i), 0)})
+	}
+
+	return driverListAppliedMigrationsResult{log: log}
+}
+
+var downgradeTestsTable = []struct { // nolint:gochecknoglobals
+	name                string
+	availableMigrations []migration.Description
+	appliedMigrations   driverListAppliedMigrationsResult
+	toVersion           migration.Version
+	force               bool
+
+	expectedCalls []driverMigrateCall
+	expectError   error
+}{
+	// -- success cases: ---
+	/* s0 */ {
+		name:                "s0: should do nothing when nothing is applied",
+		availableMigrations: []migration.Description{migrations[0], migrations[1]},
+		toVersion:           0,
+	},
+	/* s1 */ {
+		name:                "s1: should revert applied migrations after toVersion in reverse order",
+		availableMigrations: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		appliedMigrations:   appliedLog(migrations[0], migrations[1], migrations[2]),
+		toVersion:           migrations[0].Version,
+		expectedCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[2], migration.Down),
+			makeMigrateCall(migrations[1], migration.Down),
+		},
+	},
+	/* s2 */ {
+		name:                "s2: should skip pending migrations",
+		availableMigrations: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		appliedMigrations:   appliedLog(migrations[0], migrations[2]),
+		toVersion:           0,
+		expectedCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[2], migration.Down),
+			makeMigrateCall(migrations[0], migration.Down),
+		},
+	},
+	/* s3 */ {
+		name:                "s3: should mark irreversible migrations as reverted when forced",
+		availableMigrations: []migration.Description{migrations[0], migrations[3]},
+		appliedMigrations:   appliedLog(migrations[0], migrations[3]),
+		toVersion:           0,
+		force:               true,
+		expectedCalls: []driverMigrateCall{
+			{migration: migrations[3].Migration, direction: migration.Down, script: ""},
+			makeMigrateCall(migrations[0], migration.Down),
+		},
+	},
+
+	// -- error cases: -----
+	/* e0 */ {
+		name:                "e0: should refuse to revert migrations without down scripts",
+		availableMigrations: []migration.Description{migrations[0], migrations[3]},
+		appliedMigrations:   appliedLog(migrations[0], migrations[3]),
+		toVersion:           0,
+		expectError:         henka.ErrIrreversibleMigration,
+	},
+	/* e1 */ {
+		name:                "e1: should refuse to revert missing migrations",
+		availableMigrations: []migration.Description{migrations[0]},
+		appliedMigrations:   appliedLog(migrations[0], migrations[1]),
+		toVersion:           0,
+		expectError:         henka.ErrIrreversibleMigration,
+	},
+}
+
+func TestDowngrade(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should revert applied migrations in reverse order.")
+
+	for _, test := range downgradeTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{descr: test.availableMigrations}}
+			drv := driverMock{appliedMigrations: test.appliedMigrations}
+
+			opts := []henka.Option{}
+			if test.force {
+				opts = append(opts, henka.WithForceDowngrade())
+			}
+
+			err := henka.New(&src, &drv, opts...).Downgrade(test.toVersion)
+
+			if test.expectError != nil {
+				assert.ErrorIs(t, err, test.expectError)
+				assert.Empty(t, drv.migrateCalls, "nothing must be reverted when the plan is refused")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedCalls, drv.migrateCalls)
+			}
+		})
+	}
+}
+
+func TestDowngradeReportsAllBlockers(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should refuse a downgrade listing every migration that can't be undone, before reverting anything.")
+
+	broken := migration.Description{Migration: migration.Migration{Version: brokenVersion, Name: "broken"}, CanUndo: true}
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{broken, migrations[0], migrations[3]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(broken, migrations[0], migrations[3])}
+
+	err := henka.New(&src, &drv).Downgrade(0)
+
+	assert.ErrorIs(t, err, henka.ErrIrreversibleMigration)
+	assert.ErrorIs(t, err, henka.ErrMissingDownScript)
+	assert.Empty(t, drv.migrateCalls, "nothing must be reverted when the plan is refused")
+
+	var blocked *henka.DowngradeBlockedError
+	if assert.ErrorAs(t, err, &blocked) && assert.Len(t, blocked.Blockers, 2) {
+		assert.Equal(t, migrations[3].Migration, blocked.Blockers[0].Migration)
+		assert.Equal(t, broken.Migration, blocked.Blockers[1].Migration)
+	}
+
+	err = henka.New(&src, &drv, henka.WithForceDowngrade()).Downgrade(0)
+	assert.ErrorIs(t, err, henka.ErrMissingDownScript)
+	assert.NotErrorIs(t, err, henka.ErrIrreversibleMigration)
+	assert.Empty(t, drv.migrateCalls)
+}
+
+//
+// -- Tests for incremental log reading ------------
+//
+
+type incrementalDriverMock struct {
+	driverMock
+	fullReads  int
+	afterCalls []uint64
+}
+
+func (m *incrementalDriverMock) ListMigrationsLog() (*[]migration.Log, error) {
+	m.fullReads++
+	return m.driverMock.ListMigrationsLog()
+}
+
+func (m *incrementalDriverMock) ListMigrationsLogAfter(id uint64) (*[]migration.Log, error) {
+	m.afterCalls = append(m.afterCalls, id)
+
+	result := make([]migration.Log, 0)
+	for _, entry := range m.appliedMigrations.log {
+		if entry.ID > id {
+			result = append(result, entry)
+		}
+	}
+
+	return &result, nil
+}
+
+func TestValidateReadsLogIncrementally(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := incrementalDriverMock{driverMock: driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{
+			{ID: 1, Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0)},
+			{ID: 2, Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12346, 0)},
+		},
+	}}}
+
+	migrator := henka.New(&src, &drv)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), result.AppliedCount)
+
+	drv.appliedMigrations.log = append(drv.appliedMigrations.log,
+		migration.Log{ID: 3, Migration: migrations[1].Migration, Direction: migration.Down, AppliedAt: time.Unix(12347, 0)},
+	)
+
+	result, err = migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.State{
+		{Description: migrations[0], Status: migration.Applied, AppliedAt: time.Unix(12345, 0)},
+		{Description: migrations[1], Status: migration.Pending},
+	}, result.Migrations)
+
+	_, err = migrator.Validate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, drv.fullReads)
+	assert.Equal(t, []uint64{2, 3}, drv.afterCalls)
+}
+
+//
+// -- Tests for lazy source listing ------------
+//
+
+type walkingSourceMock struct {
+	sourceMock
+	visited []migration.Version
+}
+
+func (m *walkingSourceMock) GetAvailableMigrations() (*[]migration.Description, error) {
+	panic("walkingSourceMock must only be walked")
+}
+
+func (m *walkingSourceMock) WalkAvailableMigrations(fn func(migration.Description) error) error {
+	for _, descr := range m.availableMigrations.descr {
+		m.visited = append(m.visited, descr.Version)
+
+		if err := fn(descr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestUpgradeStopsWalkingAtMaxVersion(t *testing.T) {
+	t.Parallel()
+
+	src := walkingSourceMock{sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2], migrations[3]},
+	}}}
+	drv := driverMock{}
+
+	migrator := henka.New(&src, &drv)
+	assert.NoError(t, migrator.Upgrade(migrations[1].Version))
+
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[1], migration.Up),
+	}, drv.migrateCalls)
+	assert.Equal(t, []migration.Version{migrations[0].Version, migrations[1].Version, migrations[2].Version}, src.visited)
+}
+
+//
+// -- Tests for database-side state computation ------------
+//
+
+type stateReaderDriverMock struct {
+	driverMock
+	state []migration.Log
+}
+
+func (m *stateReaderDriverMock) ListMigrationsLog() (*[]migration.Log, error) {
+	panic("stateReaderDriverMock must not be asked for the whole log")
+}
+
+func (m *stateReaderDriverMock) ListMigrationsState() (*[]migration.Log, error) {
+	return &m.state, nil
+}
+
+func TestValidateUsesDriverComputedState(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := stateReaderDriverMock{state: []migration.Log{
+		{ID: 3, Migration: migrations[1].Migration, Direction: migration.Down, AppliedAt: time.Unix(12347, 0)},
+		{ID: 4, Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12348, 0)},
+	}}
+
+	result, err := henka.New(&src, &drv).Validate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, henka.ValidationResult{
+		Migrations: []migration.State{
+			{Description: migrations[0], Status: migration.Applied, AppliedAt: time.Unix(12348, 0)},
+			{Description: migrations[1], Status: migration.Pending},
+			{Description: migrations[2], Status: migration.Pending},
+		},
+		AppliedCount:         1,
+		PendingCount:         2,
+		UndoableAppliedCount: 1,
+		LastAppliedVersion:   migrations[0].Version,
+		FirstPendingVersion:  migrations[1].Version,
+	}, *result)
+}
+
+type interruptedDriverMock struct {
+	driverMock
+	interrupted []migration.Log
+}
+
+func (m *interruptedDriverMock) ListInterruptedMigrations() (*[]migration.Log, error) {
+	return &m.interrupted, nil
+}
+
+func TestValidateCountsDirtyMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := interruptedDriverMock{
+		driverMock: driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+			log: []migration.Log{
+				{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0)},
+			},
+		}},
+		interrupted: []migration.Log{
+			{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12346, 0)},
+		},
+	}
+
+	result, err := henka.New(&src, &drv).Validate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, henka.ValidationResult{
+		Migrations: []migration.State{
+			{Description: migrations[0], Status: migration.Applied, AppliedAt: time.Unix(12345, 0)},
+			{Description: migrations[1], Status: migration.Pending, Dirty: true},
+		},
+		AppliedCount:         1,
+		PendingCount:         1,
+		DirtyCount:           1,
+		UndoableAppliedCount: 1,
+		LastAppliedVersion:   migrations[0].Version,
+		FirstPendingVersion:  migrations[1].Version,
+	}, *result)
+}
+
+func TestValidateReportsFailedMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := interruptedDriverMock{
+		interrupted: []migration.Log{
+			{Migration: migrations[0].Migration, Direction: migration.Up, Error: "first attempt"},
+			{Migration: migrations[0].Migration, Direction: migration.Up, Error: "syntax error"},
+			{Migration: migrations[1].Migration, Direction: migration.Up},
+		},
+	}
+
+	result, err := henka.New(&src, &drv).Validate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.State{
+		{Description: migrations[0], Status: migration.Pending, Dirty: true, Failed: true, Error: "syntax error"},
+		{Description: migrations[1], Status: migration.Pending, Dirty: true},
+	}, result.Migrations)
+	assert.Equal(t, uint(2), result.DirtyCount)
+	assert.Equal(t, uint(1), result.FailedCount)
+}
+
+func TestValidateReportsFailedMissingMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := interruptedDriverMock{
+		driverMock: driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])},
+		interrupted: []migration.Log{
+			{Migration: migrations[1].Migration, Direction: migration.Down, Error: "syntax error"},
+		},
+	}
+
+	result, err := henka.New(&src, &drv).Validate()
+
+	assert.NoError(t, err)
+	if assert.Len(t, result.Migrations, 2) {
+		assert.Equal(t, migration.Missing, result.Migrations[1].Status)
+		assert.True(t, result.Migrations[1].Dirty)
+		assert.True(t, result.Migrations[1].Failed)
+		assert.Equal(t, "syntax error", result.Migrations[1].Error)
+	}
+}
+
+func TestDirty(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	interrupted := []migration.Log{
+		{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0), Error: "syntax error"},
+		{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12346, 0)},
+	}
+	drv := interruptedDriverMock{interrupted: interrupted}
+
+	dirty, err := henka.New(&src, &drv).Dirty()
+	assert.NoError(t, err)
+	assert.Equal(t, interrupted, dirty)
+
+	dirty, err = henka.New(&src, &driverMock{}).Dirty()
+	assert.NoError(t, err)
+	assert.Empty(t, dirty)
+}
+
+func TestDirtyMigrationsBlockRuns(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := interruptedDriverMock{
+		driverMock: driverMock{appliedMigrations: appliedLog(migrations[0])},
+		interrupted: []migration.Log{
+			{Migration: migrations[1].Migration, Direction: migration.Up, Error: "syntax error"},
+		},
+	}
+
+	err := henka.New(&src, &drv).UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrDirtyMigration)
+	assert.Contains(t, err.Error(), "syntax error")
+	assert.Empty(t, drv.migrateCalls)
+
+	assert.ErrorIs(t, henka.New(&src, &drv).Downgrade(0), henka.ErrDirtyMigration)
+	assert.Empty(t, drv.migrateCalls)
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithResume()).UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[1], migration.Up)}, drv.migrateCalls)
+}
+
+//
+// -- Tests for run scoping ------------
+//
+
+type runScopedDriverMock struct {
+	driverMock
+	events []string
+}
+
+func (m *runScopedDriverMock) BeginRun() error {
+	m.events = append(m.events, "begin")
+	return nil
+}
+
+func (m *runScopedDriverMock) EndRun() error {
+	m.events = append(m.events, "end")
+	return nil
+}
+
+func (m *runScopedDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	m.events = append(m.events, fmt.Sprintf("migrate %d", mig.Version))
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func TestUpgradeIsScopedToRun(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+
+	drv := runScopedDriverMock{}
+	assert.NoError(t, henka.New(&src, &drv).Upgrade(migrations[3].Version))
+	assert.Equal(t, []string{
+		"begin",
+		fmt.Sprintf("migrate %d", migrations[0].Version),
+		fmt.Sprintf("migrate %d", migrations[1].Version),
+		"end",
+	}, drv.events)
+
+	failingDrv := runScopedDriverMock{driverMock: driverMock{migrateErr: ErrAny}}
+	assert.ErrorIs(t, henka.New(&src, &failingDrv).Upgrade(migrations[3].Version), ErrAny)
+	assert.Equal(t, []string{"begin", fmt.Sprintf("migrate %d", migrations[0].Version), "end"}, failingDrv.events)
+}
+
+//
+// -- Tests for checksum verification ------------
+//
+
+func TestValidateVerifiesChecksums(t *testing.T) {
+	t.Parallel()
+
+	broken := migration.Description{Migration: migration.Migration{Version: brokenVersion, Name: "broken"}}
+	checksum := func(mig migration.Description) string {
+		return migration.Checksum([]byte(makeScript(mig.Migration, migration.Up)))
+	}
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2], migrations[3]},
+	}}
+
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+		{Migration: migrations[0].Migration, Direction: migration.Up, Checksum: checksum(migrations[0])},
+		{Migration: migrations[1].Migration, Direction: migration.Up, Checksum: "0000"},
+		{Migration: migrations[2].Migration, Direction: migration.Up},
+		{Migration: migrations[3].Migration, Direction: migration.Up, Checksum: "0000"},
+		{Migration: migrations[3].Migration, Direction: migration.Down},
+	}}}
+
+	_, err := henka.New(&src, &drv).Validate()
+	assert.NoError(t, err, "checksums must not be verified unless enabled")
+
+	_, err = henka.New(&src, &drv, henka.WithChecksumVerification(), henka.WithChecksumWorkers(2)).Validate()
+	assert.ErrorIs(t, err, henka.ErrChecksumMismatch)
+	assert.Contains(t, err.Error(), fmt.Sprintf("%d_%s", migrations[1].Version, migrations[1].Name))
+	assert.NotContains(t, err.Error(), fmt.Sprintf("%d_%s", migrations[0].Version, migrations[0].Name))
+	assert.NotContains(t, err.Error(), fmt.Sprintf("%d_%s", migrations[3].Version, migrations[3].Name))
+
+	drv.appliedMigrations.log[1].Checksum = checksum(migrations[1])
+	_, err = henka.New(&src, &drv, henka.WithChecksumVerification()).Validate()
+	assert.NoError(t, err)
+
+	src.availableMigrations.descr = append([]migration.Description{broken}, src.availableMigrations.descr...)
+	drv.appliedMigrations.log = append(drv.appliedMigrations.log,
+		migration.Log{Migration: broken.Migration, Direction: migration.Up, Checksum: "0000"})
+
+	_, err = henka.New(&src, &drv, henka.WithChecksumVerification()).Validate()
+	assert.ErrorIs(t, err, ErrAny)
+}
+
+//
+// -- Tests for per-run caching ------------
+//
+
+type countingSourceMock struct {
+	sourceMock
+	listCalls int
+}
+
+func (m *countingSourceMock) GetAvailableMigrations() (*[]migration.Description, error) {
+	m.listCalls++
+	return m.sourceMock.GetAvailableMigrations()
+}
+
+type countingDriverMock struct {
+	driverMock
+	listCalls int
+}
+
+func (m *countingDriverMock) ListMigrationsLog() (*[]migration.Log, error) {
+	m.listCalls++
+	return m.driverMock.ListMigrationsLog()
+}
+
+func TestUpgradeReadsSourceAndLogOncePerRun(t *testing.T) {
+	t.Parallel()
+
+	src := countingSourceMock{sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}}
+	drv := countingDriverMock{driverMock: driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{{Migration: migrations[0].Migration, Direction: migration.Up}},
+	}}}
+
+	migrator := henka.New(&src, &drv, henka.WithChecksumVerification())
+	assert.NoError(t, migrator.Upgrade(migrations[2].Version))
+
+	assert.Equal(t, 1, src.listCalls)
+	assert.Equal(t, 1, drv.listCalls)
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[1], migration.Up),
+		makeMigrateCall(migrations[2], migration.Up),
+	}, drv.migrateCalls)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), result.AppliedCount, "state must be reloaded after the run")
+	assert.Equal(t, 2, src.listCalls)
+	assert.Equal(t, 2, drv.listCalls)
+}
+
+//
+// -- Tests for the up-to-date fast path ------------
+//
+
+type maxVersionDriverMock struct {
+	countingDriverMock
+	maxVersion migration.Version
+	anyApplied bool
+}
+
+func (m *maxVersionDriverMock) GetMaxAppliedVersion() (migration.Version, bool, error) {
+	return m.maxVersion, m.anyApplied, nil
+}
+
+func TestUpgradeSkipsWhenUpToDate(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+
+	upToDate := maxVersionDriverMock{maxVersion: migrations[2].Version, anyApplied: true}
+	assert.NoError(t, henka.New(&src, &upToDate, henka.WithSkipWhenUpToDate()).Upgrade(migrations[3].Version))
+	assert.Equal(t, 0, upToDate.listCalls, "log must not be read when nothing is newer")
+	assert.Empty(t, upToDate.migrateCalls)
+
+	belowTarget := maxVersionDriverMock{maxVersion: migrations[0].Version, anyApplied: true}
+	belowTarget.appliedMigrations.log = []migration.Log{{Migration: migrations[0].Migration, Direction: migration.Up}}
+	assert.NoError(t, henka.New(&src, &belowTarget, henka.WithSkipWhenUpToDate()).Upgrade(migrations[1].Version))
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[1], migration.Up)}, belowTarget.migrateCalls)
+
+	empty := maxVersionDriverMock{}
+	assert.NoError(t, henka.New(&src, &empty, henka.WithSkipWhenUpToDate()).Upgrade(migrations[0].Version))
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, empty.migrateCalls)
+
+	disabled := maxVersionDriverMock{maxVersion: migrations[2].Version, anyApplied: true}
+	assert.NoError(t, henka.New(&src, &disabled).Upgrade(migrations[2].Version))
+	assert.Equal(t, 1, disabled.listCalls)
+}
+
+func TestValidateRejectsUnsortedSource(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[1], migrations[0]},
+	}}
+
+	_, err := henka.New(&src, &driverMock{}).Validate()
+	assert.ErrorIs(t, err, source.ErrMigrationsNotSorted)
+}
+
+//
+// -- Tests for run reports ------------
+//
+
+func TestUpgradeReportsPhases(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{{Migration: migrations[0].Migration, Direction: migration.Up}},
+	}}
+
+	reports := make([]henka.RunReport, 0)
+	migrator := henka.New(&src, &drv, henka.WithChecksumVerification(), henka.WithRunReport(func(report henka.RunReport) {
+		reports = append(reports, report)
+	}))
+
+	assert.NoError(t, migrator.Upgrade(migrations[1].Version))
+
+	if !assert.Len(t, reports, 1) {
+		return
+	}
+
+	phases := make([]string, 0)
+	for _, timing := range reports[0].Phases {
+		phases = append(phases, fmt.Sprintf("%s %d", timing.Phase, timing.Migration.Version))
+	}
+
+	assert.Equal(t, []string{
+		"load_log 0",
+		"list_source 0",
+		"validate 0",
+		"plan 0",
+		fmt.Sprintf("read_script %d", migrations[1].Version),
+		fmt.Sprintf("migrate %d", migrations[1].Version),
+	}, phases)
+	assert.NoError(t, reports[0].Err)
+
+	drv.migrateErr = ErrAny
+	src.availableMigrations.descr = append(src.availableMigrations.descr, migrations[2])
+
+	assert.ErrorIs(t, migrator.Upgrade(migrations[2].Version), ErrAny)
+	if assert.Len(t, reports, 2) {
+		assert.ErrorIs(t, reports[1].Err, ErrAny)
+	}
+}
+
+func TestConcurrentRunsKeepTheirOwnReports(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{
+			{Migration: migrations[0].Migration, Direction: migration.Up},
+			{Migration: migrations[1].Migration, Direction: migration.Up},
+		},
+	}}
+
+	var mutex sync.Mutex
+	reports := make([]henka.RunReport, 0)
+	migrator := henka.New(&src, &drv, henka.WithRunReport(func(report henka.RunReport) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reports = append(reports, report)
+	}))
+
+	const runs = 8
+
+	var wait sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			assert.NoError(t, migrator.Upgrade(migrations[1].Version))
+		}()
+	}
+	wait.Wait()
+
+	if assert.Len(t, reports, runs) {
+		for _, report := range reports {
+			loads := 0
+			for _, timing := range report.Phases {
+				if timing.Phase == henka.PhaseLoadLog {
+					loads++
+				}
+			}
+
+			assert.Equal(t, 1, loads, "every run must report only its own phases")
+		}
+	}
+}
+
+//
+// -- Tests for prefetching ------------
+//
+
+type notifyingSourceMock struct {
+	sourceMock
+	reads chan migration.Version
+}
+
+func (m *notifyingSourceMock) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	m.reads <- mig.Version
+	return m.sourceMock.ReadMigration(mig, direction)
+}
+
+type waitingDriverMock struct {
+	driverMock
+	reads        chan migration.Version
+	readsAheadOf map[migration.Version][]migration.Version
+}
+
+// Migrate records which scripts had been read before the migration was done.
+func (m *waitingDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	time.Sleep(10 * time.Millisecond)
+
+	ahead := make([]migration.Version, 0)
+	for len(m.reads) > 0 {
+		ahead = append(ahead, <-m.reads)
+	}
+
+	m.readsAheadOf[mig.Version] = ahead
+
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func TestUpgradePrefetchesScripts(t *testing.T) {
+	t.Parallel()
+
+	run := func(opts ...henka.Option) map[migration.Version][]migration.Version {
+		reads := make(chan migration.Version, 10)
+		src := notifyingSourceMock{reads: reads, sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+			descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		}}}
+		drv := waitingDriverMock{reads: reads, readsAheadOf: make(map[migration.Version][]migration.Version)}
+
+		assert.NoError(t, henka.New(&src, &drv, opts...).Upgrade(migrations[2].Version))
+		assert.Equal(t, []driverMigrateCall{
+			makeMigrateCall(migrations[0], migration.Up),
+			makeMigrateCall(migrations[1], migration.Up),
+			makeMigrateCall(migrations[2], migration.Up),
+		}, drv.migrateCalls)
+
+		return drv.readsAheadOf
+	}
+
+	withoutPrefetch := run()
+	assert.Equal(t, []migration.Version{migrations[0].Version}, withoutPrefetch[migrations[0].Version])
+	assert.Equal(t, []migration.Version{migrations[1].Version}, withoutPrefetch[migrations[1].Version])
+
+	withPrefetch := run(henka.WithPrefetch(1))
+	assert.Equal(t, []migration.Version{migrations[0].Version, migrations[1].Version}, withPrefetch[migrations[0].Version],
+		"the next script must be read while the current one is executed")
+	assert.Equal(t, []migration.Version{migrations[2].Version}, withPrefetch[migrations[1].Version])
+}
+
+//
+// -- Tests for migration failures ------------
+//
+
+func TestUpgradeReturnsMigrationFailedError(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+
+	statement := "INSERT INTO users\n  VALUES " + strings.Repeat("(1), ", 100) + "(1)"
+	drv := driverMock{migrateErr: fmt.Errorf("failed to execute migration script: %w", &driver.StatementError{
+		Index: 2, Statement: statement, Err: ErrAny,
+	})}
+
+	err := henka.New(&src, &drv).Upgrade(migrations[0].Version)
+	assert.ErrorIs(t, err, ErrAny)
+
+	var failure *henka.MigrationFailedError
+	if !assert.ErrorAs(t, err, &failure) {
+		return
+	}
+
+	assert.Equal(t, migrations[0].Migration, failure.Migration)
+	assert.Equal(t, migration.Up, failure.Direction)
+	assert.Equal(t, 2, failure.StatementIndex)
+	assert.True(t, strings.HasPrefix(failure.Statement, "INSERT INTO users VALUES (1), (1),"))
+	assert.Less(t, len(failure.Statement), len(statement))
+	assert.Contains(t, err.Error(), "at statement 3")
+
+	drv.migrateErr = ErrAny
+	err = henka.New(&src, &drv).Upgrade(migrations[0].Version)
+	if assert.ErrorAs(t, err, &failure) {
+		assert.Equal(t, -1, failure.StatementIndex)
+		assert.Empty(t, failure.Statement)
+	}
+}
+
+type panickingDriverMock struct {
+	driverMock
+	recorded []error
+}
+
+func (m *panickingDriverMock) Migrate(migration.Migration, migration.Direction, string) error {
+	panic(ErrAny)
+}
+
+func (m *panickingDriverMock) RecordFailure(_ migration.Migration, _ migration.Direction, cause error) error {
+	m.recorded = append(m.recorded, cause)
+	return nil
+}
+
+func TestUpgradeRecoversPanics(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := panickingDriverMock{}
+
+	err := henka.New(&src, &drv).Upgrade(migrations[1].Version)
+	assert.ErrorIs(t, err, ErrAny)
+
+	var failure *henka.MigrationFailedError
+	if assert.ErrorAs(t, err, &failure) {
+		assert.Equal(t, migrations[0].Migration, failure.Migration)
+	}
+
+	var panicErr *henka.PanicError
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, ErrAny, panicErr.Value)
+		assert.Contains(t, string(panicErr.Stack), "panickingDriverMock")
+	}
+
+	if assert.Len(t, drv.recorded, 1, "the failure must be recorded through the driver") {
+		assert.ErrorAs(t, drv.recorded[0], &panicErr)
+	}
+}
+
+//
+// -- Tests for version ordering ------------
+//
+
+func TestCustomVersionOrdering(t *testing.T) {
+	t.Parallel()
+
+	positions := map[migration.Version]int{
+		migrations[0].Version: 0,
+		migrations[2].Version: 1,
+		migrations[1].Version: 2,
+		migrations[3].Version: 3,
+	}
+	ordering := migration.OrderingFunc(func(a, b migration.Version) int {
+		return positions[a] - positions[b]
+	})
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{{Migration: migrations[3].Migration, Direction: migration.Up}},
+	}}
+	migrator := henka.New(&src, &drv, henka.WithVersionOrdering(ordering))
+
+	assert.NoError(t, migrator.Upgrade(migrations[2].Version))
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[2], migration.Up),
+	}, drv.migrateCalls)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+
+	versions := make([]migration.Version, 0)
+	for _, state := range result.Migrations {
+		versions = append(versions, state.Version)
+	}
+
+	assert.Equal(t, []migration.Version{
+		migrations[0].Version, migrations[2].Version, migrations[1].Version, migrations[3].Version,
+	}, versions)
+	assert.Equal(t, uint(1), result.MissingCount)
+}
+
+func TestExplicitOrderingDowngradesEverything(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should treat the zero version as the start of history whatever the ordering is.")
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{}
+	migrator := henka.New(&src, &drv, henka.WithVersionOrdering(
+		migration.ExplicitOrdering(migrations[2].Version, migrations[0].Version, migrations[1].Version),
+	))
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.NoError(t, migrator.Reset())
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[2], migration.Up),
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[1], migration.Up),
+		makeMigrateCall(migrations[1], migration.Down),
+		makeMigrateCall(migrations[0], migration.Down),
+		makeMigrateCall(migrations[2], migration.Down),
+	}, drv.migrateCalls)
+}
+
+//
+// -- Tests for graceful shutdown ------------
+//
+
+type cancelableDriverMock struct {
+	driverMock
+	shutdown *henka.Shutdown
+	canceled chan struct{}
+}
+
+func (m *cancelableDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	if m.canceled == nil {
+		m.shutdown.Stop()
+		return m.driverMock.Migrate(mig, direction, script)
+	}
+
+	go func() { _ = m.shutdown.Cancel() }()
+	<-m.canceled
+
+	return ErrAny
+}
+
+func (m *cancelableDriverMock) CancelMigration() error {
+	close(m.canceled)
+	return nil
+}
+
+func TestShutdownStopsBetweenMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	shutdown := henka.NewShutdown()
+	drv := cancelableDriverMock{shutdown: shutdown}
+
+	var report henka.RunReport
+	err := henka.New(&src, &drv, henka.WithShutdown(shutdown), henka.WithRunReport(func(r henka.RunReport) {
+		report = r
+	})).Upgrade(migrations[1].Version)
+
+	assert.ErrorIs(t, err, henka.ErrInterrupted)
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, drv.migrateCalls,
+		"the running migration must finish and the next one must not start")
+	assert.ErrorIs(t, report.Err, henka.ErrInterrupted)
+}
+
+func TestShutdownCancelsRunningMigration(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	shutdown := henka.NewShutdown()
+	drv := cancelableDriverMock{shutdown: shutdown, canceled: make(chan struct{})}
+
+	err := henka.New(&src, &drv, henka.WithShutdown(shutdown)).Upgrade(migrations[1].Version)
+
+	assert.ErrorIs(t, err, henka.ErrInterrupted)
+	assert.ErrorIs(t, err, ErrAny, "the error of the driver must be kept")
+
+	var failure *henka.MigrationFailedError
+	if assert.ErrorAs(t, err, &failure) {
+		assert.Equal(t, migrations[0].Migration, failure.Migration)
+	}
+}
+
+//
+// -- Tests for Henka.DowngradeToTime() ------------
+//
+
+func TestDowngradeToTime(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1], migrations[2])}
+
+	// migrations[1] is 2021-01-24 13:22:01
+	err := henka.New(&src, &drv).DowngradeToTime(time.Date(2021, 1, 24, 14, 0, 0, 0, time.UTC))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[2], migration.Down)}, drv.migrateCalls)
+}
+
+func TestDowngradeToTimeRequiresTimestampVersions(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{
+			{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0)},
+		},
+	}}
+
+	err := henka.New(&src, &drv).DowngradeToTime(time.Date(2021, 1, 24, 14, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Empty(t, drv.migrateCalls)
+
+	drv.appliedMigrations.log = append(drv.appliedMigrations.log, migration.Log{
+		Migration: migration.Migration{Version: 42, Name: "not_a_timestamp"}, Direction: migration.Up,
+	})
+
+	err = henka.New(&src, &drv).DowngradeToTime(time.Date(2021, 1, 24, 14, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, migration.ErrInvalidVersion)
+}
+
+func TestUpgradeUntil(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{}
+
+	// migrations[1] is 2021-01-24 13:22:01
+	err := henka.New(&src, &drv).UpgradeUntil(time.Date(2021, 1, 24, 14, 0, 0, 0, time.UTC))
+
+	assert.NoError(t, err)
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[1], migration.Up),
+	}, drv.migrateCalls)
+
+	src.availableMigrations.descr = append(src.availableMigrations.descr, migration.Description{
+		Migration: migration.Migration{Version: 42, Name: "not_a_timestamp"},
+	})
+
+	err = henka.New(&src, &drv).UpgradeUntil(time.Date(2021, 1, 24, 14, 0, 0, 0, time.UTC))
+	assert.ErrorIs(t, err, migration.ErrInvalidVersion)
+}
+
+//
+// -- Tests for Options.OutOfOrder ------------
+//
+
+var outOfOrderTestsTable = []struct { // nolint:gochecknoglobals
+	name   string
+	policy henka.OutOfOrderPolicy
+
+	expectedMigrateCalls []driverMigrateCall
+	expectedSkipped      []migration.Migration
+	expectWarning        bool
+	expectError          bool
+}{
+	/* s0 */ {
+		name:   "s0: should apply out-of-order migrations in version order",
+		policy: henka.OutOfOrderApply,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[1], migration.Up),
+			makeMigrateCall(migrations[3], migration.Up),
+		},
+	},
+	/* s1 */ {
+		name:   "s1: should skip out-of-order migrations",
+		policy: henka.OutOfOrderSkip,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[3], migration.Up),
+		},
+		expectedSkipped: []migration.Migration{migrations[1].Migration},
+	},
+	/* s2 */ {
+		name:   "s2: should apply out-of-order migrations with a warning",
+		policy: henka.OutOfOrderWarn,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[1], migration.Up),
+			makeMigrateCall(migrations[3], migration.Up),
+		},
+		expectWarning: true,
+	},
+	/* e0 */ {
+		name:        "e0: should reject out-of-order migrations",
+		policy:      henka.OutOfOrderReject,
+		expectError: true,
+	},
+}
+
+func TestOutOfOrderPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range outOfOrderTestsTable {
+		test := testCase
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+				descr: []migration.Description{migrations[0], migrations[1], migrations[2], migrations[3]},
+			}}
+			drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[2])}
+
+			var report henka.RunReport
+			logger := recordingLogger{}
+			migrator := henka.New(&src, &drv,
+				henka.WithOutOfOrderPolicy(test.policy),
+				henka.WithRunReport(func(r henka.RunReport) { report = r }),
+				henka.WithLogger(&logger),
+			)
+
+			validation, validateErr := migrator.Validate()
+			upgradeErr := migrator.UpgradeAll()
+
+			if test.expectError {
+				assert.ErrorIs(t, validateErr, henka.ErrOutOfOrderMigration)
+				assert.ErrorIs(t, upgradeErr, henka.ErrOutOfOrderMigration)
+				assert.Empty(t, drv.migrateCalls)
+
+				return
+			}
+
+			assert.NoError(t, validateErr)
+			assert.NoError(t, upgradeErr)
+			assert.Equal(t, uint(1), validation.OutOfOrderCount)
+			assert.True(t, validation.Migrations[1].OutOfOrder)
+			assert.Equal(t, test.expectedMigrateCalls, drv.migrateCalls)
+			assert.Equal(t, test.expectedSkipped, report.Skipped)
+
+			warning := loggedLine{level: "warn", msg: "applying out-of-order migration"}
+			if test.expectWarning {
+				assert.Contains(t, logger.lines, warning)
+			} else {
+				assert.NotContains(t, logger.lines, warning)
+			}
+		})
+	}
+}
+
+//
+// -- Tests for Henka.UpgradeAll() ------------
+//
+
+func TestUpgradeAll(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0])}
+
+	err := henka.New(&src, &drv).UpgradeAll()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[1], migration.Up),
+		makeMigrateCall(migrations[2], migration.Up),
+	}, drv.migrateCalls)
+}
+
+func TestUpgradeAllWithoutMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{}
+	drv := driverMock{}
+
+	assert.NoError(t, henka.New(&src, &drv).UpgradeAll())
+	assert.Empty(t, drv.migrateCalls)
+}
+
+//
+// -- Tests for Henka.UpgradeSteps() and Henka.DowngradeSteps() ------------
+//
+
+var stepsTestsTable = []struct { // nolint:gochecknoglobals
+	name              string
+	appliedMigrations driverListAppliedMigrationsResult
+	upgrade           bool
+	steps             uint
+
+	expectedMigrateCalls []driverMigrateCall
+}{
+	/* s0 */ {
+		name:              "s0: should apply the next 2 pending migrations",
+		appliedMigrations: appliedLog(migrations[0]),
+		upgrade:           true,
+		steps:             2,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[1], migration.Up),
+			makeMigrateCall(migrations[2], migration.Up),
+		},
+	},
+	/* s1 */ {
+		name:              "s1: should apply every pending migration when there are fewer than requested",
+		appliedMigrations: appliedLog(migrations[0], migrations[1]),
+		upgrade:           true,
+		steps:             5,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[2], migration.Up),
+		},
+	},
+	/* s2 */ {
+		name:              "s2: should do nothing when nothing is pending",
+		appliedMigrations: appliedLog(migrations[0], migrations[1], migrations[2]),
+		upgrade:           true,
+		steps:             1,
+	},
+	/* s3 */ {
+		name:              "s3: should revert the latest applied migration",
+		appliedMigrations: appliedLog(migrations[0], migrations[1], migrations[2]),
+		steps:             1,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[2], migration.Down),
+		},
+	},
+	/* s4 */ {
+		name:              "s4: should revert every applied migration when there are fewer than requested",
+		appliedMigrations: appliedLog(migrations[0], migrations[1]),
+		steps:             3,
+		expectedMigrateCalls: []driverMigrateCall{
+			makeMigrateCall(migrations[1], migration.Down),
+			makeMigrateCall(migrations[0], migration.Down),
+		},
+	},
+	/* s5 */ {
+		name:              "s5: should do nothing with zero steps",
+		appliedMigrations: appliedLog(migrations[0]),
+		steps:             0,
+	},
+}
+
+func TestSteps(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range stepsTestsTable {
+		test := testCase
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+				descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+			}}
+			drv := driverMock{appliedMigrations: test.appliedMigrations}
+
+			var err error
+			if test.upgrade {
+				err = henka.New(&src, &drv).UpgradeSteps(test.steps)
+			} else {
+				err = henka.New(&src, &drv).DowngradeSteps(test.steps)
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedMigrateCalls, drv.migrateCalls)
+		})
+	}
+}
+
+//
+// -- Tests for context propagation ------------
+//
+
+type contextKey struct{}
+
+type contextDriverMock struct {
+	driverMock
+	cancel   context.CancelFunc
+	received []interface{}
+}
+
+func (m *contextDriverMock) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	m.received = append(m.received, ctx.Value(contextKey{}))
+	return m.driverMock.ListMigrationsLog()
+}
+
+func (m *contextDriverMock) MigrateContext(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+	script string,
+) error {
+	m.received = append(m.received, ctx.Value(contextKey{}))
+	m.cancel()
+
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func TestUpgradeContext(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "run"))
+	defer cancel()
+
+	drv := contextDriverMock{cancel: cancel}
+
+	err := henka.New(&src, &drv).UpgradeContext(ctx, migrations[1].Version)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, drv.migrateCalls,
+		"migrations must not start once the context is done")
+	assert.NotEmpty(t, drv.received)
+
+	for _, value := range drv.received {
+		assert.Equal(t, "run", value, "the context must be passed to the driver")
+	}
+}
+
+type recordingContextDriverMock struct {
+	driverMock
+	mutex    sync.Mutex
+	received []int
+}
+
+func (m *recordingContextDriverMock) ListMigrationsLogContext(ctx context.Context) (*[]migration.Log, error) {
+	// give other calls the chance to replace the context of the engine
+	runtime.Gosched()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	value, _ := ctx.Value(contextKey{}).(int)
+	m.received = append(m.received, value)
+
+	return m.driverMock.ListMigrationsLog()
+}
+
+func (m *recordingContextDriverMock) MigrateContext(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+	script string,
+) error {
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func TestConcurrentValidateContext(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := recordingContextDriverMock{}
+	migrator := henka.New(&src, &drv)
+
+	const calls = 8
+
+	var wait sync.WaitGroup
+	for i := 1; i <= calls; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			_, err := migrator.ValidateContext(context.WithValue(context.Background(), contextKey{}, i))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wait.Wait()
+
+	sort.Ints(drv.received)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8}, drv.received, "every call must keep its own context")
+}
+
+//
+// -- Tests for dry runs ------------
+//
+
+func TestPlanUpgrade(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0])}
+
+	plan, err := henka.New(&src, &drv).PlanUpgrade(migrations[2].Version)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []henka.PlannedMigration{
+		{Migration: migrations[1].Migration, Direction: migration.Up, Script: makeScript(migrations[1].Migration, migration.Up)},
+		{Migration: migrations[2].Migration, Direction: migration.Up, Script: makeScript(migrations[2].Migration, migration.Up)},
+	}, plan)
+	assert.Empty(t, drv.migrateCalls, "nothing must be executed")
+}
+
+func TestPlanDowngrade(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[3]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[3])}
+
+	_, err := henka.New(&src, &drv).PlanDowngrade(0)
+	assert.ErrorIs(t, err, henka.ErrIrreversibleMigration)
+
+	plan, err := henka.New(&src, &drv, henka.WithForceDowngrade()).PlanDowngrade(0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []henka.PlannedMigration{
+		{Migration: migrations[3].Migration, Direction: migration.Down, Forced: true},
+		{Migration: migrations[0].Migration, Direction: migration.Down, Script: makeScript(migrations[0].Migration, migration.Down)},
+	}, plan)
+	assert.Empty(t, drv.migrateCalls, "nothing must be executed")
+}
+
+//
+// -- Tests for Henka.Status() ------------
+//
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+		{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(100, 0), FinishedAt: time.Unix(105, 0)},
+		{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(110, 0), FinishedAt: time.Unix(111, 0)},
+		{Migration: migrations[1].Migration, Direction: migration.Down, AppliedAt: time.Unix(120, 0), FinishedAt: time.Unix(121, 0)},
+		{Migration: migrations[0].Migration, Direction: migration.Down, AppliedAt: time.Unix(130, 0), FinishedAt: time.Unix(131, 0)},
+		{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(140, 0), FinishedAt: time.Unix(142, 0)},
+	}}}
+
+	result, err := henka.New(&src, &drv).Status()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.State{
+		{
+			Description:   migrations[0],
+			Status:        migration.Applied,
+			AppliedAt:     time.Unix(140, 0),
+			AppliedTimes:  2,
+			RevertedTimes: 1,
+			Duration:      2 * time.Second,
+		},
+		{
+			Description:   migrations[1],
+			Status:        migration.Pending,
+			AppliedTimes:  1,
+			RevertedTimes: 1,
+			Duration:      time.Second,
+		},
+	}, result.Migrations)
+	assert.Equal(t, uint(1), result.AppliedCount)
+	assert.Equal(t, uint(1), result.PendingCount)
+}
+
+func TestValidateReportsDuration(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+		{
+			Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(100, 0), FinishedAt: time.Unix(102, 0),
+			ExecutionTime: 1500 * time.Millisecond,
+		},
+		{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(110, 0), FinishedAt: time.Unix(113, 0)},
+	}}}
+
+	result, err := henka.New(&src, &drv).Validate()
+
+	assert.NoError(t, err)
+	if assert.Len(t, result.Migrations, 3) {
+		assert.Equal(t, 1500*time.Millisecond, result.Migrations[0].Duration, "recorded execution time must be preferred")
+		assert.Equal(t, 3*time.Second, result.Migrations[1].Duration, "duration must fall back to the finish time")
+		assert.Zero(t, result.Migrations[2].Duration, "pending migrations have no duration")
+	}
+}
+
+func TestValidationResultJSON(t *testing.T) {
+	t.Parallel()
+
+	encoded, err := json.Marshal(henka.ValidationResult{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"migrations": [], "applied_count": 0, "pending_count": 0, "missing_count": 0,
+		"baselined_count": 0, "skipped_count": 0, "dirty_count": 0, "failed_count": 0, "undoable_applied_count": 0,
+		"last_applied_version": 0, "first_pending_version": 0, "out_of_order_count": 0}`, string(encoded))
+
+	encoded, err = json.Marshal(&henka.ValidationResult{
+		Migrations:          []migration.State{{Description: migrations[0], Status: migration.Pending}},
+		PendingCount:        1,
+		FirstPendingVersion: migrations[0].Version,
+	})
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, []interface{}{map[string]interface{}{
+		"version": float64(migrations[0].Version), "name": migrations[0].Name, "can_undo": migrations[0].CanUndo,
+		"status": "pending", "applied_at": nil,
+	}}, decoded["migrations"])
+	assert.Equal(t, float64(1), decoded["pending_count"])
+}
+
+//
+// -- Tests for Henka.Repair() ------------
+//
+
+type repairDriverMock struct {
+	driverMock
+	updated map[migration.Version]string
+	deleted []migration.Version
+}
+
+func (m *repairDriverMock) UpdateChecksum(version migration.Version, checksum string) error {
+	m.updated[version] = checksum
+	return nil
+}
+
+func (m *repairDriverMock) DeleteLog(version migration.Version) error {
+	m.deleted = append(m.deleted, version)
+	return nil
+}
+
+func TestRepair(t *testing.T) {
+	t.Parallel()
+
+	checksum := migration.Checksum([]byte(makeScript(migrations[0].Migration, migration.Up)))
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[3]},
+	}}
+	drv := repairDriverMock{
+		driverMock: driverMock{appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+			{Migration: migrations[0].Migration, Direction: migration.Up, Checksum: checksum},
+			{Migration: migrations[1].Migration, Direction: migration.Up, Checksum: "0000"},
+			{Migration: migrations[2].Migration, Direction: migration.Up},
+		}}},
+		updated: map[migration.Version]string{},
+	}
+
+	migrator := henka.New(&src, &drv)
+
+	result, err := migrator.Repair(henka.RepairOptions{UpdateChecksums: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Migration{migrations[1].Migration}, result.UpdatedChecksums)
+	assert.Empty(t, result.RemovedMissing)
+	assert.Equal(t, map[migration.Version]string{
+		migrations[1].Version: migration.Checksum([]byte(makeScript(migrations[1].Migration, migration.Up))),
+	}, drv.updated)
+	assert.Empty(t, drv.deleted)
+
+	result, err = migrator.Repair(henka.RepairOptions{RemoveMissing: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Migration{migrations[2].Migration}, result.RemovedMissing)
+	assert.Equal(t, []migration.Version{migrations[2].Version}, drv.deleted)
+	assert.Empty(t, drv.migrateCalls)
+}
+
+type incrementalRepairDriverMock struct {
+	incrementalDriverMock
+}
+
+func (m *incrementalRepairDriverMock) UpdateChecksum(version migration.Version, checksum string) error {
+	for i := range m.appliedMigrations.log {
+		if m.appliedMigrations.log[i].Version == version {
+			m.appliedMigrations.log[i].Checksum = checksum
+		}
+	}
+
+	return nil
+}
+
+func (m *incrementalRepairDriverMock) DeleteLog(version migration.Version) error {
+	kept := make([]migration.Log, 0)
+	for _, entry := range m.appliedMigrations.log {
+		if entry.Version != version {
+			kept = append(kept, entry)
+		}
+	}
+
+	m.appliedMigrations.log = kept
+
+	return nil
+}
+
+func TestValidateAfterRepair(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := incrementalRepairDriverMock{incrementalDriverMock{driverMock: driverMock{
+		appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+			{ID: 1, Migration: migrations[0].Migration, Direction: migration.Up},
+			{ID: 2, Migration: migrations[1].Migration, Direction: migration.Up, Checksum: "0000"},
+			{ID: 3, Migration: migrations[2].Migration, Direction: migration.Up},
+		}},
+	}}}
+
+	migrator := henka.New(&src, &drv)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), result.MissingCount)
+
+	_, err = migrator.Repair(henka.RepairOptions{UpdateChecksums: true, RemoveMissing: true})
+	assert.NoError(t, err)
+
+	result, err = migrator.Validate()
+	if assert.NoError(t, err) && assert.Len(t, result.Migrations, 2) {
+		assert.Equal(t, uint(0), result.MissingCount, "deleted entries must not be reported by the same instance")
+		assert.Equal(t, migration.Checksum([]byte(makeScript(migrations[1].Migration, migration.Up))),
+			result.Migrations[1].Checksum, "rewritten checksums must be reloaded")
+	}
+}
+
+type lockingRepairDriverMock struct {
+	lockingDriverMock
+}
+
+func (m *lockingRepairDriverMock) UpdateChecksum(migration.Version, string) error {
+	m.calls = append(m.calls, "update")
+	return nil
+}
+
+func (m *lockingRepairDriverMock) DeleteLog(migration.Version) error {
+	m.calls = append(m.calls, "delete")
+	return nil
+}
+
+func TestRepairTakesLock(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := lockingRepairDriverMock{lockingDriverMock{driverMock: driverMock{
+		appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+			{Migration: migrations[0].Migration, Direction: migration.Up, Checksum: "0000"},
+			{Migration: migrations[1].Migration, Direction: migration.Up},
+		}},
+	}}}
+
+	_, err := henka.New(&src, &drv).Repair(henka.RepairOptions{UpdateChecksums: true, RemoveMissing: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lock", "update", "delete", "unlock"}, drv.calls, "the log must be rewritten under the lock")
+
+	drv.calls = nil
+	drv.lockErr = driver.ErrLockTimeout
+
+	_, err = henka.New(&src, &drv).Repair(henka.RepairOptions{UpdateChecksums: true})
+	assert.ErrorIs(t, err, driver.ErrLockTimeout)
+	assert.Equal(t, []string{"lock"}, drv.calls)
+}
+
+func TestRepairRequiresDriverSupport(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{}
+	drv := driverMock{}
+
+	_, err := henka.New(&src, &drv).Repair(henka.RepairOptions{UpdateChecksums: true})
+	assert.ErrorIs(t, err, henka.ErrRepairNotSupported)
+
+	_, err = henka.New(&src, &drv).Repair(henka.RepairOptions{RemoveMissing: true})
+	assert.ErrorIs(t, err, henka.ErrRepairNotSupported)
+
+	_, err = henka.New(&src, &drv).Repair(henka.RepairOptions{})
+	assert.NoError(t, err)
+}
+
+//
+// -- Tests for Henka.Baseline() ------------
+//
+
+type logWriterDriverMock struct {
+	driverMock
+}
+
+func (m *logWriterDriverMock) WriteLog(log migration.Log) error {
+	m.appliedMigrations.log = append(m.appliedMigrations.log, log)
+	return nil
+}
+
+func TestBaseline(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2], migrations[3]},
+	}}
+	drv := logWriterDriverMock{}
+
+	migrator := henka.New(&src, &drv)
+
+	assert.NoError(t, migrator.Baseline(migrations[1].Version))
+	assert.ErrorIs(t, migrator.Baseline(migrations[2].Version), henka.ErrLogNotEmpty)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), result.BaselinedCount)
+	assert.Equal(t, uint(2), result.PendingCount)
+	assert.Equal(t, uint(0), result.MissingCount)
+	assert.Equal(t, uint(0), result.OutOfOrderCount)
+	assert.Equal(t, migrations[1].Version, result.LastAppliedVersion)
+	assert.Equal(t, migration.Baselined, result.Migrations[0].Status)
+	assert.Equal(t, migration.Baselined, result.Migrations[1].Status)
+	assert.Equal(t, migration.Pending, result.Migrations[2].Status)
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[2], migration.Up),
+		makeMigrateCall(migrations[3], migration.Up),
+	}, drv.migrateCalls)
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithForceDowngrade()).Downgrade(0))
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[2], migration.Up),
+		makeMigrateCall(migrations[3], migration.Up),
+		{migration: migrations[3].Migration, direction: migration.Down},
+		makeMigrateCall(migrations[2], migration.Down),
+	}, drv.migrateCalls, "baselined migrations must not be reverted")
+}
+
+func TestBaselineBetweenMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[2]},
+	}}
+	drv := logWriterDriverMock{}
+
+	migrator := henka.New(&src, &drv)
+	assert.NoError(t, migrator.Baseline(migrations[1].Version))
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Len(t, result.Migrations, 2, "the baseline entry must not be listed as missing")
+	assert.Equal(t, migration.Baselined, result.Migrations[0].Status)
+	assert.Equal(t, migration.Pending, result.Migrations[1].Status)
+}
+
+type lockingLogWriterDriverMock struct {
+	lockingDriverMock
+}
+
+func (m *lockingLogWriterDriverMock) WriteLog(log migration.Log) error {
+	m.calls = append(m.calls, "write")
+	m.appliedMigrations.log = append(m.appliedMigrations.log, log)
+
+	return nil
+}
+
+func TestBaselineTakesLock(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := lockingLogWriterDriverMock{}
+
+	assert.NoError(t, henka.New(&src, &drv).Baseline(migrations[0].Version))
+	assert.Equal(t, []string{"lock", "write", "unlock"}, drv.calls, "the log must be checked and written under the lock")
+
+	drv.calls = nil
+	drv.lockErr = driver.ErrLockTimeout
+
+	assert.ErrorIs(t, henka.New(&src, &drv).Baseline(migrations[1].Version), driver.ErrLockTimeout)
+	assert.Equal(t, []string{"lock"}, drv.calls)
+}
+
+func TestBaselineRequiresLogWriter(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{}
+	drv := driverMock{}
+
+	assert.ErrorIs(t, henka.New(&src, &drv).Baseline(migrations[0].Version), henka.ErrBaselineNotSupported)
+}
+
+//
+// -- Tests for Options.Logger ------------
+//
+
+type loggedLine struct {
+	level string
+	msg   string
+}
+
+type recordingLogger struct {
+	lines []loggedLine
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...interface{}) { l.record("debug", msg) }
+func (l *recordingLogger) Info(msg string, _ ...interface{})  { l.record("info", msg) }
+func (l *recordingLogger) Warn(msg string, _ ...interface{})  { l.record("warn", msg) }
+func (l *recordingLogger) Error(msg string, _ ...interface{}) { l.record("error", msg) }
+
+func (l *recordingLogger) record(level, msg string) {
+	l.lines = append(l.lines, loggedLine{level: level, msg: msg})
+}
+
+func TestLogger(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := driverMock{}
+	logger := recordingLogger{}
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithLogger(&logger)).Upgrade(migrations[1].Version))
+	assert.Contains(t, logger.lines, loggedLine{level: "info", msg: "planned upgrade"})
+	assert.Contains(t, logger.lines, loggedLine{level: "info", msg: "applied migration"})
+	assert.Equal(t, loggedLine{level: "info", msg: "migration run finished"}, logger.lines[len(logger.lines)-1])
+
+	logger.lines = nil
+	drv.migrateErr = ErrAny
+
+	assert.Error(t, henka.New(&src, &drv, henka.WithLogger(&logger)).Downgrade(0))
+	assert.Contains(t, logger.lines, loggedLine{level: "error", msg: "migration failed"})
+	assert.Equal(t, loggedLine{level: "error", msg: "migration run failed"}, logger.lines[len(logger.lines)-1])
+}
+
+//
+// -- Tests for Options.Observer ------------
+//
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := driverMock{}
+
+	events := make([]henka.Event, 0)
+	observer := henka.ObserverFunc(func(event henka.Event) {
+		events = append(events, event)
+	})
+
+	migrator := henka.New(&src, &drv, henka.WithObserver(observer), henka.WithChecksumVerification())
+	assert.NoError(t, migrator.Upgrade(migrations[1].Version))
+
+	assert.Len(t, events, 5)
+	assert.IsType(t, henka.ValidationCompleted{}, events[0])
+	assert.Equal(t, uint(2), events[0].(henka.ValidationCompleted).Result.PendingCount)
+	assert.Equal(t, henka.MigrationStarted{Migration: migrations[0].Migration, Direction: migration.Up, Index: 0, Total: 2}, events[1])
+	assert.IsType(t, henka.MigrationFinished{}, events[2])
+	assert.Equal(t, henka.MigrationStarted{Migration: migrations[1].Migration, Direction: migration.Up, Index: 1, Total: 2}, events[3])
+	assert.Equal(t, migrations[1].Migration, events[4].(henka.MigrationFinished).Migration)
+
+	events = events[:0]
+	drv.migrateErr = ErrAny
+
+	assert.Error(t, migrator.Downgrade(0))
+	assert.Len(t, events, 2)
+	assert.IsType(t, henka.MigrationStarted{}, events[0])
+
+	failed, ok := events[1].(henka.MigrationFailed)
+	assert.True(t, ok)
+	assert.Equal(t, migrations[1].Migration, failed.Migration)
+	assert.ErrorIs(t, failed.Err, ErrAny)
+}
+
+//
+// -- Tests for driver.Locker ------------
+//
+
+type lockingDriverMock struct {
+	driverMock
+	lockErr error
+	calls   []string
+	timeout time.Duration
+}
+
+func (m *lockingDriverMock) Lock(timeout time.Duration) error {
+	m.calls = append(m.calls, "lock")
+	m.timeout = timeout
+
+	return m.lockErr
+}
+
+func (m *lockingDriverMock) Unlock() error {
+	m.calls = append(m.calls, "unlock")
+	return nil
+}
+
+func (m *lockingDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	m.calls = append(m.calls, "migrate")
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func TestLocker(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := lockingDriverMock{}
+
+	assert.NoError(t, henka.New(&src, &drv).UpgradeAll())
+	assert.Equal(t, []string{"lock", "migrate", "unlock"}, drv.calls)
+	assert.Equal(t, henka.DefaultLockTimeout, drv.timeout)
+
+	drv.calls = nil
+	drv.lockErr = driver.ErrLockTimeout
+
+	err := henka.New(&src, &drv, henka.WithLockTimeout(time.Second)).Downgrade(0)
+	assert.ErrorIs(t, err, driver.ErrLockTimeout)
+	assert.Equal(t, []string{"lock"}, drv.calls)
+	assert.Equal(t, time.Second, drv.timeout)
+}
+
+//
+// -- Tests for Options.Transactions ------------
+//
+
+type transactorDriverMock struct {
+	driverMock
+	calls []string
+}
+
+func (m *transactorDriverMock) TransactionalDDL() bool { return true }
+func (m *transactorDriverMock) BeginTx() error         { m.calls = append(m.calls, "begin"); return nil }
+func (m *transactorDriverMock) CommitTx() error        { m.calls = append(m.calls, "commit"); return nil }
+func (m *transactorDriverMock) RollbackTx() error      { m.calls = append(m.calls, "rollback"); return nil }
+
+func (m *transactorDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	m.calls = append(m.calls, "migrate")
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+var transactionsTestsTable = []struct { // nolint:gochecknoglobals
+	name       string
+	policy     henka.TransactionPolicy
+	migrateErr error
+
+	expectedCalls []string
+}{
+	/* s0 */ {
+		name:          "s0: should not begin transactions without a policy",
+		policy:        henka.NoTransactions,
+		expectedCalls: []string{"migrate", "migrate"},
+	},
+	/* s1 */ {
+		name:          "s1: should wrap each migration",
+		policy:        henka.WrapEachMigration,
+		expectedCalls: []string{"begin", "migrate", "commit", "begin", "migrate", "commit"},
+	},
+	/* s2 */ {
+		name:          "s2: should wrap the whole run",
+		policy:        henka.WrapWholeRun,
+		expectedCalls: []string{"begin", "migrate", "migrate", "commit"},
+	},
+	/* e0 */ {
+		name:          "e0: should roll back a failed migration",
+		policy:        henka.WrapEachMigration,
+		migrateErr:    ErrAny,
+		expectedCalls: []string{"begin", "migrate", "rollback"},
+	},
+	/* e1 */ {
+		name:          "e1: should roll back the whole run",
+		policy:        henka.WrapWholeRun,
+		migrateErr:    ErrAny,
+		expectedCalls: []string{"begin", "migrate", "rollback"},
+	},
+}
+
+func TestTransactions(t *testing.T) {
+	t.Parallel()
+
+	for _, testCase := range transactionsTestsTable {
+		test := testCase
+
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+				descr: []migration.Description{migrations[0], migrations[1]},
+			}}
+			drv := transactorDriverMock{driverMock: driverMock{migrateErr: test.migrateErr}}
+
+			err := henka.New(&src, &drv, henka.WithTransactions(test.policy)).UpgradeAll()
+
+			if test.migrateErr != nil {
+				assert.ErrorIs(t, err, test.migrateErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, test.expectedCalls, drv.calls)
+		})
+	}
+}
+
+func TestTransactionsRequireDriverSupport(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := driverMock{}
+
+	err := henka.New(&src, &drv, henka.WithTransactions(henka.WrapEachMigration)).UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrTransactionsNotSupported)
+	assert.Empty(t, drv.migrateCalls)
+
+	_, err = henka.NewBuilder().Source(&src).Driver(&drv).Transactions(henka.WrapWholeRun).Build()
+	assert.ErrorIs(t, err, henka.ErrInvalidConfig)
+}
+
+//
+// -- Tests for Henka.Reapply() ------------
+//
+
+func TestReapply(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+
+	migrator := henka.New(&src, &drv)
+
+	assert.NoError(t, migrator.Reapply(migrations[0].Version))
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, drv.migrateCalls)
+	assert.Len(t, drv.appliedMigrations.log, 3, "reapplying must be logged as a new entry")
+
+	assert.ErrorIs(t, migrator.Reapply(migrations[2].Version), henka.ErrNotApplied)
+	assert.ErrorIs(t, migrator.Reapply(migrations[3].Version), source.ErrMigrationNotFound)
+	assert.Len(t, drv.migrateCalls, 1)
+}
+
+//
+// -- Tests for Options.RejectMissing ------------
+//
+
+func TestRejectMissing(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+
+	err := henka.New(&src, &drv, henka.WithRejectMissing()).UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrMissingMigration)
+	assert.Contains(t, err.Error(), "20210124132201_indexes")
+	assert.Empty(t, drv.migrateCalls)
+
+	assert.NoError(t, henka.New(&src, &drv).UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[2], migration.Up)}, drv.migrateCalls)
+}
+
+//
+// -- Tests for Henka.UpgradeTo() and Henka.DowngradeTo() ------------
+//
+
+func TestTargetByName(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{}
+
+	migrator := henka.New(&src, &drv)
+
+	assert.NoError(t, migrator.UpgradeTo("indexes"))
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[1], migration.Up),
+	}, drv.migrateCalls)
+
+	assert.NoError(t, migrator.DowngradeTo("initial_structure"))
+	assert.Equal(t, makeMigrateCall(migrations[1], migration.Down), drv.migrateCalls[2])
+	assert.Len(t, drv.migrateCalls, 3)
+
+	assert.ErrorIs(t, migrator.UpgradeTo("no_such_migration"), source.ErrMigrationNotFound)
+}
+
+func TestTargetByAmbiguousName(t *testing.T) {
+	t.Parallel()
+
+	duplicate := migration.Description{Migration: migration.Migration{Version: 20210124140000, Name: "indexes"}}
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], duplicate},
+	}}
+	drv := driverMock{}
+
+	assert.ErrorIs(t, henka.New(&src, &drv).UpgradeTo("indexes"), henka.ErrAmbiguousName)
+	assert.Empty(t, drv.migrateCalls)
+}
+
+//
+// -- Tests for henka.WithSkipVersions() -----------------------------
+//
+
+func TestSkipVersions(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{}
+
+	migrator := henka.New(&src, &drv, henka.WithSkipVersions(migrations[1].Version))
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[2], migration.Up),
+	}, drv.migrateCalls)
+
+	drv.appliedMigrations = appliedLog(migrations[0], migrations[2])
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), result.SkippedCount)
+	assert.Equal(t, uint(0), result.PendingCount)
+	assert.Equal(t, migration.Skipped, result.Migrations[1].Status)
+	assert.False(t, result.Migrations[1].OutOfOrder)
+
+	assert.NoError(t, migrator.UpgradeSteps(1))
+	assert.Len(t, drv.migrateCalls, 2)
+}
+
+//
+// -- Tests for henka.WithIncludeTags() and henka.WithExcludeTags() --
+//
+
+type taggedSourceMock struct {
+	sourceMock
+	tags map[migration.Version][]string
+}
+
+func (m *taggedSourceMock) MigrationTags(mig migration.Migration) ([]string, error) {
+	return m.tags[mig.Version], nil
+}
+
+// nolint:gochecknoglobals
+var tagsTestTable = []struct {
+	name     string
+	opts     []henka.Option
+	expected []migration.Migration
+}{
+	/* s0 */ {
+		name:     "s0: should apply everything without filters",
+		expected: []migration.Migration{migrations[0].Migration, migrations[1].Migration, migrations[2].Migration},
+	},
+	/* s1 */ {
+		name:     "s1: should apply untagged migrations and the ones with included tags",
+		opts:     []henka.Option{henka.WithIncludeTags("prod-only")},
+		expected: []migration.Migration{migrations[0].Migration, migrations[2].Migration},
+	},
+	/* s2 */ {
+		name:     "s2: should leave out migrations with excluded tags",
+		opts:     []henka.Option{henka.WithExcludeTags("test-data")},
+		expected: []migration.Migration{migrations[0].Migration, migrations[2].Migration},
+	},
+	/* s3 */ {
+		name:     "s3: should let excluded tags win over included ones",
+		opts:     []henka.Option{henka.WithIncludeTags("seed", "prod-only"), henka.WithExcludeTags("test-data")},
+		expected: []migration.Migration{migrations[0].Migration, migrations[2].Migration},
+	},
+}
+
+func TestTags(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range tagsTestTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := taggedSourceMock{
+				sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+					descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+				}},
+				tags: map[migration.Version][]string{
+					migrations[1].Version: {"seed", "test-data"},
+					migrations[2].Version: {"prod-only"},
+				},
+			}
+			drv := driverMock{}
+
+			assert.NoError(t, henka.New(&src, &drv, test.opts...).UpgradeAll())
+
+			applied := make([]migration.Migration, 0, len(drv.migrateCalls))
+			for _, call := range drv.migrateCalls {
+				applied = append(applied, call.migration)
+			}
+
+			assert.Equal(t, test.expected, applied)
+		})
+	}
+}
+
+func TestTagsRequireSourceSupport(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := driverMock{}
+
+	assert.ErrorIs(t, henka.New(&src, &drv, henka.WithIncludeTags("seed")).UpgradeAll(), henka.ErrTagsNotSupported)
+	assert.Empty(t, drv.migrateCalls)
+
+	_, err := henka.NewBuilder().Source(&src).Driver(&drv).IncludeTags("seed").Build()
+	assert.ErrorIs(t, err, henka.ErrInvalidConfig)
+}
+
+//
+// -- Tests for migration dependencies ------------
+//
+
+type dependentSourceMock struct {
+	sourceMock
+	dependencies map[migration.Version][]migration.Version
+}
+
+func (m *dependentSourceMock) MigrationDependencies(mig migration.Migration) ([]migration.Version, error) {
+	return m.dependencies[mig.Version], nil
+}
+
+func makeDependentSource(dependencies map[migration.Version][]migration.Version) dependentSourceMock {
+	return dependentSourceMock{
+		sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+			descr: []migration.Description{migrations[0], migrations[1], migrations[2], migrations[3]},
+		}},
+		dependencies: dependencies,
+	}
+}
+
+func TestUpgradeOrdersByDependencies(t *testing.T) {
+	t.Parallel()
+
+	src := makeDependentSource(map[migration.Version][]migration.Version{
+		migrations[1].Version: {migrations[3].Version},
+		migrations[2].Version: {migrations[0].Version},
+	})
+	drv := driverMock{}
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithDependencies()).UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[2], migration.Up),
+		makeMigrateCall(migrations[3], migration.Up),
+		makeMigrateCall(migrations[1], migration.Up),
+	}, drv.migrateCalls)
+}
+
+func TestUpgradeRejectsUnsatisfiedDependencies(t *testing.T) {
+	t.Parallel()
+
+	src := makeDependentSource(map[migration.Version][]migration.Version{
+		migrations[1].Version: {migrations[3].Version},
+	})
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0])}
+
+	err := henka.New(&src, &drv, henka.WithDependencies()).Upgrade(migrations[2].Version)
+	assert.ErrorIs(t, err, henka.ErrUnsatisfiedDependency)
+	assert.Empty(t, drv.migrateCalls)
+
+	var migrationErr *henka.MigrationError
+	if assert.ErrorAs(t, err, &migrationErr) {
+		assert.Equal(t, migrations[1].Version, migrationErr.Version)
+	}
+}
+
+func TestUpgradeAcceptsAppliedDependencies(t *testing.T) {
+	t.Parallel()
+
+	src := makeDependentSource(map[migration.Version][]migration.Version{
+		migrations[2].Version: {migrations[0].Version},
+	})
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithDependencies()).Upgrade(migrations[2].Version))
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[2], migration.Up)}, drv.migrateCalls)
+}
+
+// nolint:gochecknoglobals
+var dependenciesValidationTestTable = []struct {
+	name         string
+	dependencies map[migration.Version][]migration.Version
+	expectedErr  error
+}{
+	/* s0 */ {
+		name: "s0: should accept dependencies on available migrations",
+		dependencies: map[migration.Version][]migration.Version{
+			migrations[1].Version: {migrations[0].Version, migrations[3].Version},
+		},
+	},
+	/* e0 */ {
+		name: "e0: should report a dependency on an unknown version",
+		dependencies: map[migration.Version][]migration.Version{
+			migrations[1].Version: {20200101000000},
+		},
+		expectedErr: henka.ErrMissingDependency,
+	},
+	/* e1 */ {
+		name: "e1: should report a cycle",
+		dependencies: map[migration.Version][]migration.Version{
+			migrations[0].Version: {migrations[2].Version},
+			migrations[1].Version: {migrations[0].Version},
+			migrations[2].Version: {migrations[1].Version},
+		},
+		expectedErr: henka.ErrDependencyCycle,
+	},
+	/* e2 */ {
+		name: "e2: should report a migration depending on itself",
+		dependencies: map[migration.Version][]migration.Version{
+			migrations[3].Version: {migrations[3].Version},
+		},
+		expectedErr: henka.ErrDependencyCycle,
+	},
+}
+
+func TestValidateDependencies(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range dependenciesValidationTestTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := makeDependentSource(test.dependencies)
+			drv := driverMock{}
+
+			_, err := henka.New(&src, &drv, henka.WithDependencies()).Validate()
+			if test.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, test.expectedErr)
+			}
+		})
+	}
+}
+
+func TestDependenciesRequireSourceSupport(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := driverMock{}
+
+	assert.ErrorIs(t, henka.New(&src, &drv, henka.WithDependencies()).UpgradeAll(), henka.ErrDependenciesNotSupported)
+	assert.Empty(t, drv.migrateCalls)
+
+	_, err := henka.NewBuilder().Source(&src).Driver(&drv).Dependencies().Build()
+	assert.ErrorIs(t, err, henka.ErrInvalidConfig)
+}
+
+//
+// -- Tests for repeatable migrations --------------------------------
+//
+
+type repeatableSourceMock struct {
+	sourceMock
+	scripts map[string]string
+	names   []string
+}
+
+func (m *repeatableSourceMock) ListRepeatableMigrations() ([]string, error) {
+	return m.names, nil
+}
+
+func (m *repeatableSourceMock) ReadRepeatableMigration(name string) (io.Reader, error) {
+	return strings.NewReader(m.scripts[name]), nil
+}
+
+type repeatableDriverMock struct {
+	driverMock
+	checksums map[string]string
+	executed  []string
+}
+
+func (m *repeatableDriverMock) ListRepeatableChecksums() (map[string]string, error) {
+	return m.checksums, nil
+}
+
+func (m *repeatableDriverMock) MigrateRepeatable(name string, script string) error {
+	m.executed = append(m.executed, name)
+	m.checksums[name] = migration.Checksum([]byte(script))
+
+	return nil
+}
+
+func TestRepeatable(t *testing.T) {
+	t.Parallel()
+
+	src := repeatableSourceMock{
+		sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+			descr: []migration.Description{migrations[0]},
+		}},
+		names:   []string{"procedures", "views"},
+		scripts: map[string]string{"procedures": "CREATE PROCEDURE p", "views": "CREATE VIEW v"},
+	}
+	drv := repeatableDriverMock{checksums: map[string]string{}}
+
+	migrator := henka.New(&src, &drv)
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, drv.migrateCalls)
+	assert.Equal(t, []string{"procedures", "views"}, drv.executed)
+
+	drv.appliedMigrations = appliedLog(migrations[0])
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []string{"procedures", "views"}, drv.executed)
+
+	src.scripts["views"] = "CREATE OR REPLACE VIEW v"
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []string{"procedures", "views", "views"}, drv.executed)
+	assert.Len(t, drv.migrateCalls, 1)
+}
+
+type upToDateRepeatableDriverMock struct {
+	repeatableDriverMock
+}
+
+func (m *upToDateRepeatableDriverMock) GetMaxAppliedVersion() (migration.Version, bool, error) {
+	return migrations[0].Version, true, nil
+}
+
+func TestRepeatableWhenUpToDate(t *testing.T) {
+	t.Parallel()
+
+	src := repeatableSourceMock{
+		sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+			descr: []migration.Description{migrations[0]},
+		}},
+		names:   []string{"views"},
+		scripts: map[string]string{"views": "CREATE VIEW v"},
+	}
+	drv := upToDateRepeatableDriverMock{repeatableDriverMock{
+		driverMock: driverMock{appliedMigrations: appliedLog(migrations[0])},
+		checksums:  map[string]string{"views": migration.Checksum([]byte("CREATE VIEW v"))},
+	}}
+
+	reports := make([]henka.RunReport, 0)
+	migrator := henka.New(&src, &drv, henka.WithSkipWhenUpToDate(), henka.WithRunReport(func(report henka.RunReport) {
+		reports = append(reports, report)
+	}))
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Empty(t, drv.executed)
+
+	src.scripts["views"] = "CREATE OR REPLACE VIEW v"
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []string{"views"}, drv.executed, "changed repeatable migrations must be applied when up to date")
+	assert.Empty(t, drv.migrateCalls)
+
+	if assert.Len(t, reports, 2) && assert.Len(t, reports[1].Applied, 1) {
+		assert.Equal(t, migration.Migration{Name: "views"}, reports[1].Applied[0].Migration)
+	}
+}
+
+func TestRepeatableGoesThroughMigrationPath(t *testing.T) {
+	t.Parallel()
+
+	src := repeatableSourceMock{
+		names:   []string{"cleanup", "views"},
+		scripts: map[string]string{"cleanup": "DROP VIEW old_v", "views": "CREATE VIEW v"},
+	}
+	drv := repeatableDriverMock{checksums: map[string]string{}}
+
+	plan, err := henka.New(&src, &drv).PlanUpgrade(migrations[3].Version)
+	assert.NoError(t, err)
+	assert.Equal(t, []henka.PlannedMigration{
+		{Migration: migration.Migration{Name: "cleanup"}, Direction: migration.Up, Script: "DROP VIEW old_v", Repeatable: true},
+		{Migration: migration.Migration{Name: "views"}, Direction: migration.Up, Script: "CREATE VIEW v", Repeatable: true},
+	}, plan)
+	assert.Empty(t, drv.executed, "planning must not execute anything")
+
+	events := make([]string, 0)
+	migrator := henka.New(&src, &drv,
+		henka.WithConfirm(func(mig migration.Migration, direction migration.Direction, statements []string) bool {
+			return false
+		}),
+		henka.WithObserver(henka.ObserverFunc(func(event henka.Event) {
+			events = append(events, fmt.Sprintf("%T", event))
+		})),
+	)
+
+	err = migrator.UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrNotConfirmed)
+	assert.Empty(t, drv.executed, "destructive repeatable migrations must be confirmed")
+	assert.Equal(t, []string{"henka.MigrationStarted", "henka.MigrationFailed"}, events)
+}
+
+func TestRepeatableRequiresDriverSupport(t *testing.T) {
+	t.Parallel()
+
+	src := repeatableSourceMock{names: []string{"views"}, scripts: map[string]string{"views": "CREATE VIEW v"}}
+
+	assert.ErrorIs(t, henka.New(&src, &driverMock{}).UpgradeAll(), henka.ErrRepeatableNotSupported)
+}
+
+//
+// -- Tests for Henka.Reset() ----------------------------------------
+//
+
+func TestReset(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+
+	assert.NoError(t, henka.New(&src, &drv).Reset())
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[1], migration.Down),
+		makeMigrateCall(migrations[0], migration.Down),
+	}, drv.migrateCalls)
+}
+
+func TestResetRefusesIrreversibleMigrations(t *testing.T) {
+	t.Parallel()
+
+	irreversible := migration.Description{Migration: migrations[0].Migration}
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{irreversible, migrations[1]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+
+	err := henka.New(&src, &drv, henka.WithForceDowngrade()).Reset()
+	assert.ErrorIs(t, err, henka.ErrIrreversibleMigration)
+	assert.Empty(t, drv.migrateCalls)
+}
+
+//
+// -- Tests for Henka.UpgradeWithResult() ----------------------------
+//
+
+type failingDriverMock struct {
+	driverMock
+	failOn migration.Version
+}
+
+func (m *failingDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	if mig.Version == m.failOn {
+		return ErrAny
+	}
+
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func TestUpgradeWithResult(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := failingDriverMock{failOn: migrations[1].Version}
+
+	result, err := henka.New(&src, &drv).UpgradeWithResult(migrations[2].Version)
+	assert.ErrorIs(t, err, ErrAny)
+
+	if assert.NotNil(t, result) {
+		assert.ErrorIs(t, result.Err, ErrAny)
+		assert.Len(t, result.Applied, 1)
+		assert.Equal(t, migrations[0].Migration, result.Applied[0].Migration)
+		assert.Equal(t, migration.Up, result.Applied[0].Direction)
+		assert.Equal(t, &migrations[1].Migration, result.Failed)
+	}
+
+	drv.failOn = 0
+
+	result, err = henka.New(&src, &drv).UpgradeWithResult(migrations[2].Version)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Failed)
+	assert.Len(t, result.Applied, 2)
+}
+
+//
+// -- Tests for henka.MigrationError ---------------------------------
+//
+
+func TestMigrationError(t *testing.T) {
+	t.Parallel()
+
+	irreversible := migration.Description{Migration: migrations[1].Migration}
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], irreversible, migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: appliedLog(migrations[1])}
+
+	err := henka.New(&src, &drv).Downgrade(0)
+	assert.ErrorIs(t, err, henka.ErrIrreversibleMigration)
+
+	var migrationErr *henka.MigrationError
+	if assert.ErrorAs(t, err, &migrationErr) {
+		assert.Equal(t, migrations[1].Migration, migrationErr.Migration)
+	}
+
+	err = henka.New(&src, &drv, henka.WithOutOfOrderPolicy(henka.OutOfOrderReject)).UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrOutOfOrderMigration)
+
+	if assert.ErrorAs(t, err, &migrationErr) {
+		assert.Equal(t, migrations[0].Migration, migrationErr.Migration)
+		assert.Equal(t, "pending migration is older than the latest applied one: 20210124131258_initial_structure",
+			migrationErr.Error())
+	}
+
+	assert.ErrorIs(t, henka.ErrLockTimeout, driver.ErrLockTimeout)
+}
+
+//
+// -- Tests for henka.WithMigrationTimeout() -------------------------
+//
+
+type slowDriverMock struct {
+	driverMock
+	canceled int32
+	recorded []error
+}
+
+func (m *slowDriverMock) MigrateContext(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+	script string,
+) error {
+	if mig.Version == migrations[1].Version {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return m.driverMock.Migrate(mig, direction, script)
+}
+
+func (m *slowDriverMock) ListMigrationsLogContext(context.Context) (*[]migration.Log, error) {
+	return m.driverMock.ListMigrationsLog()
+}
+
+func (m *slowDriverMock) CancelMigration() error {
+	atomic.AddInt32(&m.canceled, 1)
+	return nil
+}
+
+func (m *slowDriverMock) RecordFailure(_ migration.Migration, _ migration.Direction, cause error) error {
+	m.recorded = append(m.recorded, cause)
+	return nil
+}
+
+func TestMigrationTimeout(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := slowDriverMock{}
+
+	err := henka.New(&src, &drv, henka.WithMigrationTimeout(10*time.Millisecond)).UpgradeAll()
+
+	assert.ErrorIs(t, err, henka.ErrMigrationTimeout)
+	assert.ErrorIs(t, err, context.Canceled, "the error of the driver must be kept")
+
+	var failure *henka.MigrationFailedError
+	if assert.ErrorAs(t, err, &failure) {
+		assert.Equal(t, migrations[1].Migration, failure.Migration)
+	}
+
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, drv.migrateCalls)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&drv.canceled))
+	assert.Len(t, drv.recorded, 1)
+}
+
+//
+// -- Tests for henka.WithConfirm() ----------------------------------
+//
+
+type scriptedSourceMock struct {
+	taggedSourceMock
+	scripts map[migration.Version]string
+}
+
+func (m *scriptedSourceMock) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	if script, ok := m.scripts[mig.Version]; ok {
+		return strings.NewReader(script), nil
+	}
+
+	return m.sourceMock.ReadMigration(mig, direction)
+}
+
+func TestConfirm(t *testing.T) {
+	t.Parallel()
+
+	src := scriptedSourceMock{
+		taggedSourceMock: taggedSourceMock{
+			sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+				descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+			}},
+			tags: map[migration.Version][]string{migrations[2].Version: {henka.DestructiveTag}},
+		},
+		scripts: map[migration.Version]string{migrations[1].Version: "DROP INDEX a ON b; CREATE INDEX c ON b (d)"},
+	}
+	drv := driverMock{}
+
+	var asked []migration.Migration
+	var statements [][]string
+
+	confirmed := map[migration.Version]bool{migrations[1].Version: true}
+	migrator := henka.New(&src, &drv, henka.WithConfirm(
+		func(mig migration.Migration, _ migration.Direction, destructive []string) bool {
+			asked = append(asked, mig)
+			statements = append(statements, destructive)
+
+			return confirmed[mig.Version]
+		},
+	))
+
+	err := migrator.UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrNotConfirmed)
+	assert.Equal(t, []migration.Migration{migrations[1].Migration, migrations[2].Migration}, asked)
+	assert.Equal(t, [][]string{{"DROP INDEX a ON b"}, {}}, statements)
+	assert.Len(t, drv.migrateCalls, 2)
+
+	confirmed[migrations[2].Version] = true
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Len(t, drv.migrateCalls, 3)
+}
+
+//
+// -- Tests for henka.TenantRunner -----------------------------------
+//
+
+func TestTenantRunner(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+
+	first := driverMock{}
+	broken := failingDriverMock{failOn: migrations[1].Version}
+	upToDate := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+
+	var progress []string
+
+	runner := henka.TenantRunner{
+		Source:      &src,
+		Parallelism: 2,
+		Progress: func(result henka.TenantResult, done, total int) {
+			progress = append(progress, fmt.Sprintf("%d/%d", done, total))
+		},
+	}
+
+	report := runner.UpgradeAll(context.Background(), []henka.Tenant{
+		{Name: "first", Driver: &first},
+		{Name: "broken", Driver: &broken},
+		{Name: "up-to-date", Driver: &upToDate},
+	})
+
+	assert.Equal(t, []string{"broken"}, report.Failed)
+	assert.ElementsMatch(t, []string{"1/3", "2/3", "3/3"}, progress)
+
+	if assert.Len(t, report.Results, 3) {
+		assert.Equal(t, "first", report.Results[0].Tenant)
+		assert.NoError(t, report.Results[0].Err)
+		assert.Len(t, report.Results[0].Result.Applied, 2)
+
+		assert.ErrorIs(t, report.Results[1].Err, ErrAny)
+		assert.Equal(t, &migrations[1].Migration, report.Results[1].Result.Failed)
+
+		assert.NoError(t, report.Results[2].Err)
+		assert.Empty(t, report.Results[2].Result.Applied)
+	}
+
+	assert.Len(t, first.migrateCalls, 2)
+	assert.Empty(t, upToDate.migrateCalls)
+}
+
+func TestTenantRunnerStopsStartingTenantsWhenCanceled(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := driverMock{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := (&henka.TenantRunner{Source: &src}).UpgradeAll(ctx, []henka.Tenant{{Name: "a", Driver: &drv}})
+
+	assert.Equal(t, []string{"a"}, report.Failed)
+	assert.ErrorIs(t, report.Results[0].Err, context.Canceled)
+	assert.Nil(t, report.Results[0].Result)
+	assert.Empty(t, drv.migrateCalls)
+}
+
+//
+// -- Tests for Henka.RequireUpToDate() ------------------------------
+//
+
+func TestRequireUpToDate(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[2]},
+	}}
+
+	drv := driverMock{appliedMigrations: appliedLog(migrations[0], migrations[2])}
+	assert.NoError(t, henka.New(&src, &drv).RequireUpToDate())
+
+	drv = driverMock{appliedMigrations: appliedLog(migrations[0], migrations[1])}
+	err := henka.New(&src, &drv).RequireUpToDate()
+	assert.ErrorIs(t, err, henka.ErrNotUpToDate)
+
+	var outdated *henka.NotUpToDateError
+	if assert.ErrorAs(t, err, &outdated) {
+		assert.Equal(t, []migration.Migration{migrations[2].Migration}, outdated.Pending)
+		assert.Equal(t, []migration.Migration{migrations[1].Migration}, outdated.Missing)
+		assert.Equal(t, fmt.Sprintf("database schema is not up to date; pending: %d_%s; missing: %d_%s",
+			migrations[2].Version, migrations[2].Name, migrations[1].Version, migrations[1].Name), err.Error())
+	}
+
+	drv = driverMock{appliedMigrations: appliedLog(migrations[0])}
+	assert.NoError(t, henka.New(&src, &drv, henka.WithSkipVersions(migrations[2].Version)).RequireUpToDate())
+}
+
+//
+// -- Tests for migrations written in Go -----------------------------
+//
+
+type funcDriverMock struct {
+	driverMock
+	funcCalls []migration.Migration
+}
+
+func (m *funcDriverMock) MigrateFunc(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+	fn migration.Func,
+) error {
+	if err := fn(ctx, nil); err != nil {
+		return err
+	}
+
+	m.funcCalls = append(m.funcCalls, mig)
+	m.appliedMigrations.log = append(m.appliedMigrations.log, migration.Log{Migration: mig, Direction: direction})
+
+	return nil
+}
+
+func TestFuncMigrations(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should apply migrations written in Go through the driver, and SQL scripts as usual.")
+
+	backfilled := 0
+	backfill := gosource.Migration{
+		Version: 20210124131300,
+		Name:    "backfill",
+		Up: func(context.Context, *sql.Tx) error {
+			backfilled++
+			return nil
+		},
+	}
+
+	src, err := gosource.New(&sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}, backfill)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	drv := funcDriverMock{}
+	assert.NoError(t, henka.New(src, &drv).UpgradeAll())
+
+	assert.Equal(t, 1, backfilled)
+	assert.Equal(t, []migration.Migration{{Version: backfill.Version, Name: backfill.Name}}, drv.funcCalls)
+	assert.Equal(t, []driverMigrateCall{
+		makeMigrateCall(migrations[0], migration.Up),
+		makeMigrateCall(migrations[1], migration.Up),
+	}, drv.migrateCalls)
+
+	plain := driverMock{}
+	err = henka.New(src, &plain).UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrFuncMigrationsNotSupported)
+	assert.Equal(t, []driverMigrateCall{makeMigrateCall(migrations[0], migration.Up)}, plain.migrateCalls)
+}
+
+//
+// -- Tests for henka.WithDriverMiddleware() -------------------------
+//
+
+type flakyDriverMock struct {
+	lockingDriverMock
+	failures int
+}
+
+func (m *flakyDriverMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	if m.failures > 0 {
+		m.failures--
+		m.calls = append(m.calls, "fail")
+
+		return ErrAny
+	}
+
+	return m.lockingDriverMock.Migrate(mig, direction, script)
+}
+
+func TestDriverMiddleware(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should wrap the driver with middlewares and keep its optional interfaces visible.")
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := flakyDriverMock{failures: 2}
+
+	observed := make([]string, 0)
+	observe := driver.Observe(func(mig migration.Migration, _ migration.Direction, _ time.Duration, err error) {
+		observed = append(observed, fmt.Sprintf("%s: %v", mig.Name, err))
+	})
+	retry := driver.Retry(3, time.Millisecond, func(err error) bool { return errors.Is(err, ErrAny) })
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithDriverMiddleware(observe, retry)).UpgradeAll())
+	assert.Equal(t, []string{"lock", "fail", "fail", "migrate", "migrate", "unlock"}, drv.calls)
+	assert.Equal(t, []string{"initial_structure: <nil>", "indexes: <nil>"}, observed)
+
+	var locker driver.Locker
+	assert.True(t, driver.As(driver.Chain(&drv, observe, retry), &locker))
+
+	var stateReader driver.StateReader
+	assert.False(t, driver.As(driver.Chain(&drv, observe, retry), &stateReader))
+
+	drv = flakyDriverMock{failures: 2}
+	retryOnce := driver.Retry(2, time.Millisecond, func(err error) bool { return errors.Is(err, ErrAny) })
+
+	err := henka.New(&src, &drv, henka.WithDriverMiddleware(retryOnce)).UpgradeAll()
+	assert.ErrorIs(t, err, ErrAny)
+	assert.Equal(t, []string{"lock", "fail", "fail", "unlock"}, drv.calls)
+}
+
+// plainMiddlewareMock implements nothing but driver.Driver and driver.Wrapper, as middlewares written by users may.
+type plainMiddlewareMock struct {
+	base  driver.Driver
+	calls []string
+}
+
+func (m *plainMiddlewareMock) Unwrap() driver.Driver {
+	return m.base
+}
+
+func (m *plainMiddlewareMock) ListMigrationsLog() (*[]migration.Log, error) {
+	m.calls = append(m.calls, "list")
+	return m.base.ListMigrationsLog() //nolint:wrapcheck
+}
+
+func (m *plainMiddlewareMock) Migrate(mig migration.Migration, direction migration.Direction, script string) error {
+	m.calls = append(m.calls, "migrate")
+	return m.base.Migrate(mig, direction, script) //nolint:wrapcheck
+}
+
+func TestPlainDriverMiddleware(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1]},
+	}}
+	drv := contextDriverMock{cancel: func() {}}
+	middleware := plainMiddlewareMock{base: &drv}
+
+	assert.NoError(t, henka.New(&src, &middleware).UpgradeAll())
+	assert.Contains(t, middleware.calls, "list")
+	assert.Equal(t, 2, countCalls(middleware.calls, "migrate"), "the middleware must not be bypassed")
+	assert.Empty(t, drv.received, "context calls of the wrapped driver must not be made directly")
+	assert.Len(t, drv.migrateCalls, 2)
+}
+
+func countCalls(calls []string, name string) int {
+	count := 0
+
+	for _, call := range calls {
+		if call == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+//
+// -- Tests for henka.WithSourceMiddleware() -------------------------
+//
+
+type templatedSourceMock struct {
+	taggedSourceMock
+	listCalls int
+	readCalls int
+}
+
+func (m *templatedSourceMock) GetAvailableMigrations() (*[]migration.Description, error) {
+	m.listCalls++
+	return m.taggedSourceMock.GetAvailableMigrations()
+}
+
+func (m *templatedSourceMock) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	m.readCalls++
+	return strings.NewReader("-- {{.Schema}}." + mig.Name), nil
+}
+
+func TestSourceMiddleware(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should stack source middlewares and keep optional interfaces of the source visible.")
+
+	src := templatedSourceMock{taggedSourceMock: taggedSourceMock{
+		sourceMock: sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+			descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+		}},
+		tags: map[migration.Version][]string{migrations[0].Version: {"seed"}},
+	}}
+
+	skipIndexes := source.Filter(func(mig migration.Migration) bool { return mig.Name != migrations[1].Name })
+	middlewares := []source.Middleware{source.Cache(), skipIndexes, source.Template(map[string]string{"Schema": "app"})}
+
+	drv := driverMock{}
+	migrator := henka.New(&src, &drv, henka.WithSourceMiddleware(middlewares...), henka.WithExcludeTags("test"))
+
+	assert.NoError(t, migrator.UpgradeAll())
+	assert.Equal(t, []driverMigrateCall{
+		{migration: migrations[0].Migration, direction: migration.Up, script: "-- app.initial_structure"},
+		{migration: migrations[2].Migration, direction: migration.Up, script: "-- app.sessions_table"},
+	}, drv.migrateCalls)
+
+	listCalls, readCalls := src.listCalls, src.readCalls
+
+	plan, err := migrator.PlanDowngrade(0)
+	assert.NoError(t, err)
+	assert.Len(t, plan, 2)
+	assert.Equal(t, listCalls, src.listCalls, "the listing must be cached")
+	assert.Equal(t, readCalls+2, src.readCalls, "down scripts must be read once")
+
+	var tagger source.Tagger
+	assert.True(t, source.As(source.Chain(&src, middlewares...), &tagger))
+
+	_, err = source.Chain(&src, middlewares...).ReadMigration(migrations[1].Migration, migration.Up)
+	assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+
+	_, err = source.Chain(&src, source.VerifyChecksums(map[migration.Version]string{migrations[0].Version: "x"})).
+		ReadMigration(migrations[0].Migration, migration.Up)
+	assert.ErrorIs(t, err, source.ErrChecksumMismatch)
+}
+
+// schemaDriverMock has a table for every migration applied to it.
+type schemaDriverMock struct {
+	driverMock
+}
+
+func (m *schemaDriverMock) DumpSchema() (*schema.Schema, error) {
+	result := schema.Schema{}
+
+	for _, entry := range m.appliedMigrations.log {
+		if entry.Direction == migration.Up {
+			result.Tables = append(result.Tables, schema.Table{Name: entry.Name})
+		}
+	}
+
+	return &result, nil
+}
+
+func TestSchemaSnapshots(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should report the difference between schemas before and after an upgrade.")
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0], migrations[1], migrations[2]},
+	}}
+	drv := schemaDriverMock{driverMock{appliedMigrations: driverListAppliedMigrationsResult{
+		log: []migration.Log{{Migration: migrations[0].Migration, Direction: migration.Up}},
+	}}}
+
+	var report henka.RunReport
+
+	migrator := henka.New(&src, &drv, henka.WithSchemaSnapshots(), henka.WithRunReport(func(r henka.RunReport) { report = r }))
+	assert.NoError(t, migrator.UpgradeAll())
+
+	if assert.NotNil(t, report.SchemaDiff) {
+		assert.Equal(t, []schema.Table{{Name: migrations[1].Name}, {Name: migrations[2].Name}}, report.SchemaDiff.AddedTables)
+		assert.Empty(t, report.SchemaDiff.DroppedTables)
+	}
+
+	err := henka.New(&src, &driverMock{}, henka.WithSchemaSnapshots()).UpgradeAll()
+	assert.ErrorIs(t, err, henka.ErrSchemaSnapshotsNotSupported)
+
+	_, err = henka.NewBuilder().Source(&src).Driver(&driverMock{}).SchemaSnapshots().Build()
+	assert.ErrorIs(t, err, henka.ErrInvalidConfig)
+}
@@ -0,0 +1,300 @@
+// Package henkav2 provides the Source, Driver and Henka interfaces with value semantics:
+// listings and results are returned as slices and structs rather than pointers to them.
+//
+// The engine itself is shared with package henka. Adapters convert implementations between
+// both flavours, so existing sources and drivers keep working with the new interfaces and vice versa.
+package henkav2
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+type Source interface {
+	GetAvailableMigrations() ([]migration.Description, error)
+	ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error)
+}
+
+type Driver interface {
+	ListMigrationsLog() ([]migration.Log, error)
+	Migrate(mig migration.Migration, dir migration.Direction, script string) error
+}
+
+type Henka interface {
+	Validate() (henka.ValidationResult, error)
+	Status() (henka.ValidationResult, error)
+	Upgrade(maxVersion migration.Version) error
+	UpgradeWithResult(maxVersion migration.Version) (henka.UpgradeResult, error)
+	UpgradeAll() error
+	UpgradeUntil(t time.Time) error
+	Downgrade(toVersion migration.Version) error
+	DowngradeToTime(t time.Time) error
+	Reset() error
+	UpgradeTo(name string) error
+	DowngradeTo(name string) error
+	UpgradeSteps(n uint) error
+	DowngradeSteps(n uint) error
+	RequireUpToDate() error
+	Dirty() ([]migration.Log, error)
+	Reapply(version migration.Version) error
+	Baseline(version migration.Version) error
+	Repair(opts henka.RepairOptions) (henka.RepairResult, error)
+	PlanUpgrade(maxVersion migration.Version) ([]henka.PlannedMigration, error)
+	PlanDowngrade(toVersion migration.Version) ([]henka.PlannedMigration, error)
+
+	ValidateContext(ctx context.Context) (henka.ValidationResult, error)
+	UpgradeContext(ctx context.Context, maxVersion migration.Version) error
+	DowngradeContext(ctx context.Context, toVersion migration.Version) error
+}
+
+// New creates the engine for v2 sources and drivers.
+func New(src Source, drv Driver, opts ...henka.Option) Henka {
+	return FromV1(henka.New(SourceToV1(src), DriverToV1(drv), opts...))
+}
+
+// ---
+
+// FromV1 adapts the engine of package henka.
+func FromV1(engine henka.Henka) Henka {
+	return henkaV1{engine: engine}
+}
+
+type henkaV1 struct {
+	engine henka.Henka
+}
+
+func (h henkaV1) Validate() (henka.ValidationResult, error) {
+	return h.ValidateContext(context.Background())
+}
+
+func (h henkaV1) Status() (henka.ValidationResult, error) {
+	result, err := h.engine.Status()
+	if err != nil || result == nil {
+		return henka.ValidationResult{}, err //nolint:wrapcheck
+	}
+
+	return *result, nil
+}
+
+func (h henkaV1) ValidateContext(ctx context.Context) (henka.ValidationResult, error) {
+	result, err := h.engine.ValidateContext(ctx)
+	if err != nil || result == nil {
+		return henka.ValidationResult{}, err //nolint:wrapcheck
+	}
+
+	return *result, nil
+}
+
+func (h henkaV1) PlanUpgrade(maxVersion migration.Version) ([]henka.PlannedMigration, error) {
+	return h.engine.PlanUpgrade(maxVersion) //nolint:wrapcheck
+}
+
+func (h henkaV1) PlanDowngrade(toVersion migration.Version) ([]henka.PlannedMigration, error) {
+	return h.engine.PlanDowngrade(toVersion) //nolint:wrapcheck
+}
+
+func (h henkaV1) UpgradeContext(ctx context.Context, maxVersion migration.Version) error {
+	return h.engine.UpgradeContext(ctx, maxVersion) //nolint:wrapcheck
+}
+
+func (h henkaV1) DowngradeContext(ctx context.Context, toVersion migration.Version) error {
+	return h.engine.DowngradeContext(ctx, toVersion) //nolint:wrapcheck
+}
+
+func (h henkaV1) Upgrade(maxVersion migration.Version) error {
+	return h.engine.Upgrade(maxVersion) //nolint:wrapcheck
+}
+
+func (h henkaV1) Downgrade(toVersion migration.Version) error {
+	return h.engine.Downgrade(toVersion) //nolint:wrapcheck
+}
+
+func (h henkaV1) DowngradeToTime(t time.Time) error {
+	return h.engine.DowngradeToTime(t) //nolint:wrapcheck
+}
+
+func (h henkaV1) UpgradeAll() error {
+	return h.engine.UpgradeAll() //nolint:wrapcheck
+}
+
+func (h henkaV1) UpgradeUntil(t time.Time) error {
+	return h.engine.UpgradeUntil(t) //nolint:wrapcheck
+}
+
+func (h henkaV1) UpgradeWithResult(maxVersion migration.Version) (henka.UpgradeResult, error) {
+	result, err := h.engine.UpgradeWithResult(maxVersion)
+	if result == nil {
+		return henka.UpgradeResult{}, err //nolint:wrapcheck
+	}
+
+	return *result, err //nolint:wrapcheck
+}
+
+func (h henkaV1) Reset() error {
+	return h.engine.Reset() //nolint:wrapcheck
+}
+
+func (h henkaV1) RequireUpToDate() error {
+	return h.engine.RequireUpToDate() //nolint:wrapcheck
+}
+
+func (h henkaV1) Dirty() ([]migration.Log, error) {
+	return h.engine.Dirty() //nolint:wrapcheck
+}
+
+func (h henkaV1) UpgradeTo(name string) error {
+	return h.engine.UpgradeTo(name) //nolint:wrapcheck
+}
+
+func (h henkaV1) DowngradeTo(name string) error {
+	return h.engine.DowngradeTo(name) //nolint:wrapcheck
+}
+
+func (h henkaV1) UpgradeSteps(n uint) error {
+	return h.engine.UpgradeSteps(n) //nolint:wrapcheck
+}
+
+func (h henkaV1) DowngradeSteps(n uint) error {
+	return h.engine.DowngradeSteps(n) //nolint:wrapcheck
+}
+
+func (h henkaV1) Reapply(version migration.Version) error {
+	return h.engine.Reapply(version) //nolint:wrapcheck
+}
+
+func (h henkaV1) Baseline(version migration.Version) error {
+	return h.engine.Baseline(version) //nolint:wrapcheck
+}
+
+func (h henkaV1) Repair(opts henka.RepairOptions) (henka.RepairResult, error) {
+	result, err := h.engine.Repair(opts)
+	if err != nil || result == nil {
+		return henka.RepairResult{}, err //nolint:wrapcheck
+	}
+
+	return *result, nil
+}
+
+// ---
+
+// SourceFromV1 adapts a source.Source. Sources adapted with SourceToV1 are unwrapped.
+func SourceFromV1(src source.Source) Source {
+	if adapted, ok := src.(sourceV2); ok {
+		return adapted.src
+	}
+
+	return sourceV1{src: src}
+}
+
+// SourceToV1 adapts a Source to source.Source. Sources adapted with SourceFromV1 are unwrapped,
+// so that optional interfaces such as source.Walker stay visible to the engine.
+func SourceToV1(src Source) source.Source {
+	if adapted, ok := src.(sourceV1); ok {
+		return adapted.src
+	}
+
+	return sourceV2{src: src}
+}
+
+type sourceV1 struct {
+	src source.Source
+}
+
+func (s sourceV1) GetAvailableMigrations() ([]migration.Description, error) {
+	result, err := s.src.GetAvailableMigrations()
+	if err != nil || result == nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return *result, nil
+}
+
+func (s sourceV1) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	return s.src.ReadMigration(mig, direction) //nolint:wrapcheck
+}
+
+type sourceV2 struct {
+	src Source
+}
+
+func (s sourceV2) GetAvailableMigrations() (*[]migration.Description, error) {
+	result, err := s.src.GetAvailableMigrations()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if result == nil {
+		result = []migration.Description{}
+	}
+
+	return &result, nil
+}
+
+func (s sourceV2) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	return s.src.ReadMigration(mig, direction) //nolint:wrapcheck
+}
+
+// ---
+
+// DriverFromV1 adapts a driver.Driver. Drivers adapted with DriverToV1 are unwrapped.
+func DriverFromV1(drv driver.Driver) Driver {
+	if adapted, ok := drv.(driverV2); ok {
+		return adapted.drv
+	}
+
+	return driverV1{drv: drv}
+}
+
+// DriverToV1 adapts a Driver to driver.Driver. Drivers adapted with DriverFromV1 are unwrapped,
+// so that optional interfaces such as driver.StateReader stay visible to the engine.
+func DriverToV1(drv Driver) driver.Driver {
+	if adapted, ok := drv.(driverV1); ok {
+		return adapted.drv
+	}
+
+	return driverV2{drv: drv}
+}
+
+type driverV1 struct {
+	drv driver.Driver
+}
+
+func (d driverV1) ListMigrationsLog() ([]migration.Log, error) {
+	result, err := d.drv.ListMigrationsLog()
+	if err != nil || result == nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return *result, nil
+}
+
+func (d driverV1) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return d.drv.Migrate(mig, dir, script) //nolint:wrapcheck
+}
+
+type driverV2 struct {
+	drv Driver
+}
+
+func (d driverV2) ListMigrationsLog() (*[]migration.Log, error) {
+	result, err := d.drv.ListMigrationsLog()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if result == nil {
+		result = []migration.Log{}
+	}
+
+	return &result, nil
+}
+
+func (d driverV2) Migrate(mig migration.Migration, dir migration.Direction, script string) error {
+	return d.drv.Migrate(mig, dir, script) //nolint:wrapcheck
+}
@@ -0,0 +1,113 @@
+package henkav2_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/henkav2"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+var (
+	first  = migration.Description{Migration: migration.Migration{Version: 20220101000000, Name: "first"}}  // nolint:gochecknoglobals
+	second = migration.Description{Migration: migration.Migration{Version: 20220102000000, Name: "second"}} // nolint:gochecknoglobals
+)
+
+type sourceMock struct {
+	available []migration.Description
+}
+
+func (m *sourceMock) GetAvailableMigrations() ([]migration.Description, error) {
+	return m.available, nil
+}
+
+func (m *sourceMock) ReadMigration(mig migration.Migration, _ migration.Direction) (io.Reader, error) {
+	return strings.NewReader("-- " + mig.Name), nil
+}
+
+type driverMock struct {
+	log []migration.Log
+}
+
+func (m *driverMock) ListMigrationsLog() ([]migration.Log, error) {
+	return m.log, nil
+}
+
+func (m *driverMock) Migrate(mig migration.Migration, dir migration.Direction, _ string) error {
+	m.log = append(m.log, migration.Log{Migration: mig, Direction: dir, AppliedAt: time.Unix(1, 0)})
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{available: []migration.Description{first, second}}
+	drv := driverMock{}
+	migrator := henkav2.New(&src, &drv)
+
+	result, err := migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), result.PendingCount)
+
+	assert.NoError(t, migrator.Upgrade(first.Version))
+	assert.Len(t, drv.log, 1)
+
+	result, err = migrator.Validate()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), result.AppliedCount)
+	assert.Equal(t, uint(1), result.PendingCount)
+}
+
+func TestNilListingsAreEmpty(t *testing.T) {
+	t.Parallel()
+
+	available, err := henkav2.SourceToV1(&sourceMock{}).GetAvailableMigrations()
+	assert.NoError(t, err)
+	assert.NotNil(t, available)
+	assert.Empty(t, *available)
+
+	log, err := henkav2.DriverToV1(&driverMock{}).ListMigrationsLog()
+	assert.NoError(t, err)
+	assert.NotNil(t, log)
+	assert.Empty(t, *log)
+}
+
+type walkingSourceMock struct {
+	source.Source
+}
+
+func (m walkingSourceMock) WalkAvailableMigrations(func(migration.Description) error) error {
+	return nil
+}
+
+type stateReaderDriverMock struct {
+	driver.Driver
+}
+
+func (m stateReaderDriverMock) ListMigrationsState() (*[]migration.Log, error) {
+	return &[]migration.Log{}, nil
+}
+
+func TestAdaptersUnwrap(t *testing.T) {
+	t.Parallel()
+
+	src := walkingSourceMock{Source: henkav2.SourceToV1(&sourceMock{})}
+	_, isWalker := henkav2.SourceToV1(henkav2.SourceFromV1(src)).(source.Walker)
+	assert.True(t, isWalker, "optional interfaces must survive a round trip")
+
+	drv := stateReaderDriverMock{Driver: henkav2.DriverToV1(&driverMock{})}
+	_, isStateReader := henkav2.DriverToV1(henkav2.DriverFromV1(drv)).(driver.StateReader)
+	assert.True(t, isStateReader, "optional interfaces must survive a round trip")
+
+	v2src := &sourceMock{}
+	assert.Same(t, v2src, henkav2.SourceFromV1(henkav2.SourceToV1(v2src)))
+
+	v2drv := &driverMock{}
+	assert.Same(t, v2drv, henkav2.DriverFromV1(henkav2.DriverToV1(v2drv)))
+}
@@ -0,0 +1,164 @@
+package alembic
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/root-talis/henka/importer"
+)
+
+const defaultTableName = "alembic_version"
+
+var ErrBranchedHistory = errors.New("alembic history has several heads")
+
+// Config describes where Alembic keeps its state and how revisions map onto henka versions.
+type Config struct {
+	// TableName is the name of the Alembic version table, "alembic_version" if empty.
+	// It is used in queries as is, so it may be qualified with a schema name.
+	TableName string
+
+	// Mapping maps Alembic revision ids (e.g. "1975ea83b712") onto henka versions.
+	// Use importer.ReadMapping to load it from a file.
+	Mapping importer.Mapping
+
+	// DownRevisions is the revision graph: the down_revision of every revision, as in the revision files.
+	// Merge revisions have several. Without it, the history is assumed to be a single linear chain.
+	DownRevisions map[string][]string
+}
+
+type alembicReader struct {
+	conn   *sql.DB
+	config Config
+}
+
+// NewReader creates a reader for Alembic's alembic_version table.
+//
+// Alembic only stores the current head revisions. With Config.DownRevisions, the heads and all their ancestors
+// are applied, and those that are not present in the mapping are reported as unmatched. Otherwise the reader
+// treats every mapped revision whose henka version is not greater than the mapped head as applied. This assumes
+// that the order of henka versions in the mapping follows the order of the Alembic revision chain, so several
+// mapped heads are rejected with ErrBranchedHistory. Heads that are not present in the mapping are reported
+// as unmatched.
+func NewReader(conn *sql.DB, config Config) importer.Reader {
+	if config.TableName == "" {
+		config.TableName = defaultTableName
+	}
+
+	return &alembicReader{
+		conn:   conn,
+		config: config,
+	}
+}
+
+func (rdr *alembicReader) ReadEntries() ([]importer.Entry, error) {
+	heads, err := rdr.readHeads()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	if rdr.config.DownRevisions != nil {
+		applied = rdr.ancestors(heads)
+	} else if applied, err = rdr.linearHistory(heads); err != nil {
+		return nil, err
+	}
+
+	result := make([]importer.Entry, 0, len(applied))
+	for _, revision := range applied {
+		result = append(result, importer.Entry{
+			ForeignID: revision,
+			Version:   rdr.config.Mapping.Lookup(revision),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Version != result[j].Version {
+			return result[i].Version < result[j].Version
+		}
+
+		return result[i].ForeignID < result[j].ForeignID
+	})
+
+	return result, nil
+}
+
+// ancestors returns the heads and every revision they descend from through Config.DownRevisions.
+func (rdr *alembicReader) ancestors(heads []string) []string {
+	visited := make(map[string]bool)
+	pending := append([]string(nil), heads...)
+	result := make([]string, 0)
+
+	for len(pending) > 0 {
+		revision := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if revision == "" || visited[revision] {
+			continue
+		}
+
+		visited[revision] = true
+		result = append(result, revision)
+		pending = append(pending, rdr.config.DownRevisions[revision]...)
+	}
+
+	return result
+}
+
+// linearHistory returns the unmapped heads and every mapped revision up to the mapped head.
+func (rdr *alembicReader) linearHistory(heads []string) ([]string, error) {
+	result := make([]string, 0)
+	mappedHeads := make([]string, 0, 1)
+
+	for _, head := range heads {
+		if rdr.config.Mapping.Lookup(head) == 0 {
+			result = append(result, head)
+		} else {
+			mappedHeads = append(mappedHeads, head)
+		}
+	}
+
+	if len(mappedHeads) > 1 {
+		return nil, fmt.Errorf("%w: %s, Config.DownRevisions is required", ErrBranchedHistory, strings.Join(mappedHeads, ", "))
+	}
+
+	if len(mappedHeads) == 0 {
+		return result, nil
+	}
+
+	head := rdr.config.Mapping.Lookup(mappedHeads[0])
+
+	for revision, version := range rdr.config.Mapping {
+		if version <= head {
+			result = append(result, revision)
+		}
+	}
+
+	return result, nil
+}
+
+func (rdr *alembicReader) readHeads() ([]string, error) {
+	rows, err := rdr.conn.Query(fmt.Sprintf("SELECT version_num FROM %s", rdr.config.TableName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", rdr.config.TableName, err)
+	}
+	defer rows.Close()
+
+	heads := make([]string, 0, 1)
+	for rows.Next() {
+		var head string
+		if err = rows.Scan(&head); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+		}
+
+		heads = append(heads, strings.TrimSpace(head))
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+	}
+
+	return heads, nil
+}
@@ -0,0 +1,116 @@
+package alembic_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/importer"
+	"github.com/root-talis/henka/importer/alembic"
+	"github.com/root-talis/henka/importer/importertest"
+)
+
+var mapping = importer.Mapping{ // nolint:gochecknoglobals
+	"1975ea83b712": 20210124131258,
+	"ae1027a6acf":  20210124132201,
+	"27c6a30d7c24": 20210608080143,
+	"3c8b4a11f0d2": 20210609090000,
+}
+
+var readEntriesTestsTable = []struct { // nolint:gochecknoglobals
+	name          string
+	heads         []string
+	downRevisions map[string][]string
+	expected      []importer.Entry
+	expectedErr   error
+}{
+	/* s0 */ {
+		name:  "s0: should map revisions up to the head of a linear history onto versions",
+		heads: []string{"ae1027a6acf"},
+		expected: []importer.Entry{
+			{ForeignID: "1975ea83b712", Version: 20210124131258},
+			{ForeignID: "ae1027a6acf", Version: 20210124132201},
+		},
+	},
+	/* s1 */ {
+		name:  "s1: should report unmapped heads as unmatched",
+		heads: []string{"ffffffffffff", "1975ea83b712"},
+		expected: []importer.Entry{
+			{ForeignID: "ffffffffffff"},
+			{ForeignID: "1975ea83b712", Version: 20210124131258},
+		},
+	},
+	/* s2 */ {
+		name:        "s2: should reject several mapped heads without the revision graph",
+		heads:       []string{"ae1027a6acf", "27c6a30d7c24"},
+		expectedErr: alembic.ErrBranchedHistory,
+	},
+	/* s3 */ {
+		name:  "s3: should resolve the heads of branches through the revision graph",
+		heads: []string{"ae1027a6acf", "3c8b4a11f0d2"},
+		downRevisions: map[string][]string{
+			"1975ea83b712": nil,
+			"ae1027a6acf":  {"1975ea83b712"},
+			"27c6a30d7c24": {"1975ea83b712"},
+			"3c8b4a11f0d2": {"1975ea83b712"},
+		},
+		expected: []importer.Entry{
+			{ForeignID: "1975ea83b712", Version: 20210124131258},
+			{ForeignID: "ae1027a6acf", Version: 20210124132201},
+			{ForeignID: "3c8b4a11f0d2", Version: 20210609090000},
+		},
+	},
+	/* s4 */ {
+		name:  "s4: should follow every parent of a merge and report unmapped ancestors as unmatched",
+		heads: []string{"3c8b4a11f0d2"},
+		downRevisions: map[string][]string{
+			"0a1b2c3d4e5f": nil,
+			"1975ea83b712": {"0a1b2c3d4e5f"},
+			"ae1027a6acf":  {"1975ea83b712"},
+			"27c6a30d7c24": {"1975ea83b712"},
+			"3c8b4a11f0d2": {"ae1027a6acf", "27c6a30d7c24"},
+		},
+		expected: []importer.Entry{
+			{ForeignID: "0a1b2c3d4e5f"},
+			{ForeignID: "1975ea83b712", Version: 20210124131258},
+			{ForeignID: "ae1027a6acf", Version: 20210124132201},
+			{ForeignID: "27c6a30d7c24", Version: 20210608080143},
+			{ForeignID: "3c8b4a11f0d2", Version: 20210609090000},
+		},
+	},
+}
+
+func TestReadEntries(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range readEntriesTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			values := make([][]driver.Value, 0, len(test.heads))
+			for _, head := range test.heads {
+				values = append(values, []driver.Value{head})
+			}
+
+			conn := importertest.Open(map[string]importertest.Rows{
+				"SELECT version_num FROM alembic_version": {Columns: []string{"version_num"}, Values: values},
+			})
+			defer conn.Close()
+
+			entries, err := alembic.NewReader(conn, alembic.Config{
+				Mapping:       mapping,
+				DownRevisions: test.downRevisions,
+			}).ReadEntries()
+
+			if test.expectedErr != nil {
+				assert.ErrorIs(t, err, test.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, entries)
+		})
+	}
+}
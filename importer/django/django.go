@@ -0,0 +1,68 @@
+package django
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/root-talis/henka/importer"
+)
+
+const defaultTableName = "django_migrations"
+
+// Config describes where Django keeps its migrations and how they map onto henka versions.
+type Config struct {
+	// TableName is the name of the Django migrations table, "django_migrations" if empty.
+	// It is used in queries as is, so it may be qualified with a schema name.
+	TableName string
+
+	// Mapping maps "app.name" ids (e.g. "auth.0001_initial") onto henka versions.
+	// Use importer.ReadMapping to load it from a file.
+	Mapping importer.Mapping
+}
+
+type djangoReader struct {
+	conn   *sql.DB
+	config Config
+}
+
+// NewReader creates a reader for Django's django_migrations table.
+// Django migrations are numbered per app, so every entry is mapped onto a henka version via Config.Mapping.
+func NewReader(conn *sql.DB, config Config) importer.Reader {
+	if config.TableName == "" {
+		config.TableName = defaultTableName
+	}
+
+	return &djangoReader{
+		conn:   conn,
+		config: config,
+	}
+}
+
+func (rdr *djangoReader) ReadEntries() ([]importer.Entry, error) {
+	rows, err := rdr.conn.Query(fmt.Sprintf("SELECT app, name, applied FROM %s ORDER BY id", rdr.config.TableName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", rdr.config.TableName, err)
+	}
+	defer rows.Close()
+
+	result := make([]importer.Entry, 0)
+	for rows.Next() {
+		var app, name, applied string
+		if err = rows.Scan(&app, &name, &applied); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+		}
+
+		foreignID := fmt.Sprintf("%s.%s", app, name)
+		result = append(result, importer.Entry{
+			ForeignID: foreignID,
+			Version:   rdr.config.Mapping.Lookup(foreignID),
+			AppliedAt: importer.ParseTime(applied),
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+	}
+
+	return result, nil
+}
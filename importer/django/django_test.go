@@ -0,0 +1,54 @@
+package django_test
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/importer"
+	"github.com/root-talis/henka/importer/django"
+	"github.com/root-talis/henka/importer/importertest"
+)
+
+func TestReadEntries(t *testing.T) {
+	t.Parallel()
+
+	conn := importertest.Open(map[string]importertest.Rows{
+		"SELECT app, name, applied FROM legacy.django_migrations ORDER BY id": {
+			Columns: []string{"app", "name", "applied"},
+			Values: [][]driver.Value{
+				{"auth", "0001_initial", "2021-01-24 13:12:58.123456"},
+				{"billing", "0001_initial", "2021-01-24 13:22:01"},
+				{"billing", "0002_invoices", "not a time"},
+			},
+		},
+	})
+	defer conn.Close()
+
+	entries, err := django.NewReader(conn, django.Config{
+		TableName: "legacy.django_migrations",
+		Mapping: importer.Mapping{
+			"auth.0001_initial":     20210124131258,
+			"billing.0002_invoices": 20210124132201,
+		},
+	}).ReadEntries()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []importer.Entry{
+		{
+			ForeignID: "auth.0001_initial",
+			Version:   20210124131258,
+			AppliedAt: time.Date(2021, 1, 24, 13, 12, 58, 123456000, time.UTC),
+		},
+		{
+			ForeignID: "billing.0001_initial",
+			AppliedAt: time.Date(2021, 1, 24, 13, 22, 1, 0, time.UTC),
+		},
+		{
+			ForeignID: "billing.0002_invoices",
+			Version:   20210124132201,
+		},
+	}, entries)
+}
@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+// Entry is a single applied migration read from a migrations table of another tool.
+type Entry struct {
+	// ForeignID identifies the migration in the original tool (version string, revision hash, file name, etc.).
+	ForeignID string
+
+	// Version is the henka version the foreign migration maps onto. Zero means the entry could not be mapped.
+	Version migration.Version
+
+	// AppliedAt is the time the migration was applied, if the original tool recorded it.
+	AppliedAt time.Time
+
+	// RunID groups entries that were applied together, if the original tool recorded it.
+	RunID string
+}
+
+// Reader reads applied migrations from a migrations table of another tool.
+type Reader interface {
+	ReadEntries() ([]Entry, error)
+}
+
+// Result describes what Import has done.
+type Result struct {
+	// Imported migrations were written to the henka log.
+	Imported []migration.Migration
+
+	// Skipped migrations were already present in the henka log and were left untouched.
+	Skipped []migration.Migration
+
+	// Unmatched contains foreign ids of entries that have no corresponding migration in the source.
+	Unmatched []string
+}
+
+var ErrLogWriterNotSupported = errors.New("driver does not support writing to the migrations log")
+
+// Import writes baseline entries into the henka log for every foreign entry that matches
+// a migration available in the source. Migrations that already have entries in the henka log are skipped.
+func Import(reader Reader, src source.Source, drv driver.Driver) (*Result, error) {
+	var writer driver.LogWriter
+	if !driver.As(drv, &writer) {
+		return nil, ErrLogWriterNotSupported
+	}
+
+	entries, err := reader.ReadEntries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign migrations: %w", err)
+	}
+
+	available, err := loadAvailableMigrations(src)
+	if err != nil {
+		return nil, err
+	}
+
+	logged, err := loadLoggedVersions(drv)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Version < entries[j].Version
+	})
+
+	result := Result{}
+	now := time.Now()
+
+	for _, entry := range entries {
+		descr, found := available[entry.Version]
+
+		switch {
+		case entry.Version == 0 || !found:
+			result.Unmatched = append(result.Unmatched, entry.ForeignID)
+			continue
+		case logged[entry.Version]:
+			result.Skipped = append(result.Skipped, descr.Migration)
+			continue
+		}
+
+		appliedAt := entry.AppliedAt
+		if appliedAt.IsZero() {
+			appliedAt = now
+		}
+
+		err = writer.WriteLog(migration.Log{
+			Migration: descr.Migration,
+			Direction: migration.Up,
+			AppliedAt: appliedAt,
+			RunID:     entry.RunID,
+		})
+		if err != nil {
+			return &result, fmt.Errorf("failed to import migration %d: %w", entry.Version, err)
+		}
+
+		logged[entry.Version] = true
+		result.Imported = append(result.Imported, descr.Migration)
+	}
+
+	return &result, nil
+}
+
+// ParseVersionPrefix extracts a henka version from identifiers like "20210124131258" or
+// "20210124131258_create_users.js" that start with a timestamp. Zero is returned if there is no such prefix.
+func ParseVersionPrefix(id string) migration.Version {
+	end := 0
+	for end < len(id) && id[end] >= '0' && id[end] <= '9' {
+		end++
+	}
+
+	if end == 0 || (end < len(id) && id[end] != '_') {
+		return 0
+	}
+
+	version, err := strconv.ParseUint(id[:end], 10, migration.VersionBits)
+	if err != nil {
+		return 0
+	}
+
+	return migration.Version(version)
+}
+
+func loadAvailableMigrations(src source.Source) (map[migration.Version]migration.Description, error) {
+	descriptions, err := src.GetAvailableMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	result := make(map[migration.Version]migration.Description, len(*descriptions))
+	for _, descr := range *descriptions {
+		result[descr.Version] = descr
+	}
+
+	return result, nil
+}
+
+// loadLoggedVersions replays the log the way the engine does and returns the versions that are currently applied,
+// so that migrations whose latest entry is Down are imported again.
+func loadLoggedVersions(drv driver.Driver) (map[migration.Version]bool, error) {
+	log, err := drv.ListMigrationsLog()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the migrations log: %w", err)
+	}
+
+	result := make(map[migration.Version]bool, len(*log))
+	for _, entry := range *log {
+		result[entry.Version] = entry.Direction == migration.Up
+	}
+
+	return result, nil
+}
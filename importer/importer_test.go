@@ -0,0 +1,186 @@
+package importer_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/importer"
+	"github.com/root-talis/henka/migration"
+)
+
+// -- testing doubles ----------
+
+type readerMock struct {
+	entries []importer.Entry
+	err     error
+}
+
+func (m *readerMock) ReadEntries() ([]importer.Entry, error) {
+	return m.entries, m.err
+}
+
+type sourceMock struct {
+	descr []migration.Description
+}
+
+func (m *sourceMock) GetAvailableMigrations() (*[]migration.Description, error) {
+	return &m.descr, nil
+}
+
+func (m *sourceMock) ReadMigration(migration.Migration, migration.Direction) (io.Reader, error) {
+	return nil, nil
+}
+
+type readOnlyDriverMock struct {
+	log []migration.Log
+}
+
+func (m *readOnlyDriverMock) ListMigrationsLog() (*[]migration.Log, error) {
+	return &m.log, nil
+}
+
+func (m *readOnlyDriverMock) Migrate(migration.Migration, migration.Direction, string) error {
+	return nil
+}
+
+type driverMock struct {
+	readOnlyDriverMock
+	written []migration.Log
+}
+
+func (m *driverMock) WriteLog(log migration.Log) error {
+	m.written = append(m.written, log)
+	return nil
+}
+
+type wrappingDriverMock struct {
+	readOnlyDriverMock
+	wrapped driver.Driver
+}
+
+func (m *wrappingDriverMock) Unwrap() driver.Driver {
+	return m.wrapped
+}
+
+//
+// -- Tests for importer.Import() ------------
+//
+
+var migrations = []migration.Description{ // nolint:gochecknoglobals
+	{Migration: migration.Migration{Version: 20210124131258, Name: "initial_structure"}, CanUndo: true},
+	{Migration: migration.Migration{Version: 20210124132201, Name: "indexes"}, CanUndo: true},
+	{Migration: migration.Migration{Version: 20210608080143, Name: "sessions_table"}, CanUndo: true},
+}
+
+var ErrAny = errors.New("test error")
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{descr: migrations}
+	drv := driverMock{
+		readOnlyDriverMock: readOnlyDriverMock{
+			log: []migration.Log{
+				{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0)},
+			},
+		},
+	}
+	rdr := readerMock{
+		entries: []importer.Entry{
+			{ForeignID: "20210124132201", Version: 20210124132201},
+			{ForeignID: "20210124131258", Version: 20210124131258, AppliedAt: time.Unix(12300, 0), RunID: "batch-1"},
+			{ForeignID: "20200101000000", Version: 20200101000000},
+			{ForeignID: "abcdef", Version: 0},
+		},
+	}
+
+	result, err := importer.Import(&rdr, &src, &drv)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Migration{migrations[0].Migration}, result.Imported)
+	assert.Equal(t, []migration.Migration{migrations[1].Migration}, result.Skipped)
+	assert.ElementsMatch(t, []string{"20200101000000", "abcdef"}, result.Unmatched)
+	assert.Equal(t, []migration.Log{
+		{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12300, 0), RunID: "batch-1"},
+	}, drv.written)
+}
+
+func TestImportRevertedMigrations(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{descr: migrations}
+	drv := driverMock{
+		readOnlyDriverMock: readOnlyDriverMock{
+			log: []migration.Log{
+				{Migration: migrations[0].Migration, Direction: migration.Up, AppliedAt: time.Unix(12345, 0)},
+				{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12346, 0)},
+				{Migration: migrations[1].Migration, Direction: migration.Down, AppliedAt: time.Unix(12347, 0)},
+			},
+		},
+	}
+	rdr := readerMock{
+		entries: []importer.Entry{
+			{ForeignID: "20210124131258", Version: 20210124131258},
+			{ForeignID: "20210124132201", Version: 20210124132201, AppliedAt: time.Unix(12400, 0)},
+		},
+	}
+
+	result, err := importer.Import(&rdr, &src, &drv)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Migration{migrations[1].Migration}, result.Imported, "reverted migrations must be imported")
+	assert.Equal(t, []migration.Migration{migrations[0].Migration}, result.Skipped)
+	assert.Equal(t, []migration.Log{
+		{Migration: migrations[1].Migration, Direction: migration.Up, AppliedAt: time.Unix(12400, 0)},
+	}, drv.written)
+}
+
+func TestImportErrors(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{descr: migrations}
+
+	_, err := importer.Import(&readerMock{}, &src, &readOnlyDriverMock{})
+	assert.ErrorIs(t, err, importer.ErrLogWriterNotSupported)
+
+	_, err = importer.Import(&readerMock{err: ErrAny}, &src, &driverMock{})
+	assert.ErrorIs(t, err, ErrAny)
+}
+
+func TestImportThroughMiddleware(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{descr: migrations}
+	drv := driverMock{}
+	rdr := readerMock{entries: []importer.Entry{{ForeignID: "20210124131258", Version: 20210124131258}}}
+
+	result, err := importer.Import(&rdr, &src, &wrappingDriverMock{wrapped: &drv})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Migration{migrations[0].Migration}, result.Imported)
+	assert.Len(t, drv.written, 1, "the log writer must be found behind middlewares")
+}
+
+func TestParseVersionPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]migration.Version{
+		"20210124131258":                  20210124131258,
+		"20210124131258_create_users.js":  20210124131258,
+		"20210124131258_create_users":     20210124131258,
+		"":                                0,
+		"abc":                             0,
+		"20210124131258-create_users":     0,
+		"_20210124131258":                 0,
+		"99999999999999999999999999_name": 0,
+	}
+
+	for id, expected := range tests {
+		assert.Equal(t, expected, importer.ParseVersionPrefix(id), id)
+	}
+}
@@ -0,0 +1,105 @@
+// Package importertest provides a database that returns fixed rows, for tests of importer readers.
+package importertest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrUnknownQuery = errors.New("query is not known to the test database")
+	ErrNotSupported = errors.New("not supported by the test database")
+)
+
+// Rows are the result of a query.
+type Rows struct {
+	Columns []string
+	Values  [][]driver.Value
+}
+
+// Open returns a database that answers the queries given as keys of results with their rows.
+// Other queries fail with ErrUnknownQuery.
+func Open(results map[string]Rows) *sql.DB {
+	return sql.OpenDB(connector{results: results})
+}
+
+type connector struct {
+	results map[string]Rows
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return conn(c), nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return nil
+}
+
+type conn struct {
+	results map[string]Rows
+}
+
+func (c conn) Prepare(query string) (driver.Stmt, error) {
+	result, ok := c.results[query]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownQuery, query)
+	}
+
+	return stmt{result: result}, nil
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	return nil, ErrNotSupported
+}
+
+type stmt struct {
+	result Rows
+}
+
+func (s stmt) Close() error {
+	return nil
+}
+
+func (s stmt) NumInput() int {
+	return -1
+}
+
+func (s stmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, ErrNotSupported
+}
+
+func (s stmt) Query([]driver.Value) (driver.Rows, error) {
+	return &rows{result: s.result}, nil
+}
+
+type rows struct {
+	result Rows
+	next   int
+}
+
+func (r *rows) Columns() []string {
+	return r.result.Columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.result.Values) {
+		return io.EOF
+	}
+
+	copy(dest, r.result.Values[r.next])
+	r.next++
+
+	return nil
+}
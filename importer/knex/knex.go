@@ -0,0 +1,115 @@
+package knex
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/importer"
+)
+
+const (
+	defaultTableName = "knex_migrations"
+	lockTableSuffix  = "_lock"
+)
+
+var ErrLocked = errors.New("knex migrations are locked")
+
+// Config describes where Knex keeps its migrations.
+type Config struct {
+	// TableName is the name of the Knex migrations table, "knex_migrations" if empty.
+	// It is used in queries as is, so it may be qualified with a schema name.
+	TableName string
+
+	// LockTableName is the name of the Knex lock table, TableName with the "_lock" suffix if empty.
+	LockTableName string
+}
+
+type knexReader struct {
+	conn   *sql.DB
+	config Config
+}
+
+// NewReader creates a reader for Knex's knex_migrations table.
+// Migration file names start with a 14-digit timestamp, which maps onto henka versions directly.
+// Every Knex batch becomes a henka run with id "knex-batch-<batch>". Reading fails with ErrLocked while Knex
+// holds its lock, as the table may be half-written by a running migration.
+func NewReader(conn *sql.DB, config Config) importer.Reader {
+	if config.TableName == "" {
+		config.TableName = defaultTableName
+	}
+
+	if config.LockTableName == "" {
+		config.LockTableName = config.TableName + lockTableSuffix
+	}
+
+	return &knexReader{
+		conn:   conn,
+		config: config,
+	}
+}
+
+func (rdr *knexReader) ReadEntries() ([]importer.Entry, error) {
+	if err := rdr.checkLock(); err != nil {
+		return nil, err
+	}
+
+	rows, err := rdr.conn.Query(fmt.Sprintf(
+		"SELECT name, batch, migration_time FROM %s ORDER BY id",
+		rdr.config.TableName,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", rdr.config.TableName, err)
+	}
+	defer rows.Close()
+
+	result := make([]importer.Entry, 0)
+	for rows.Next() {
+		var name string
+		var batch int64
+		var migrationTime sql.NullString
+
+		if err = rows.Scan(&name, &batch, &migrationTime); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+		}
+
+		result = append(result, importer.Entry{
+			ForeignID: name,
+			Version:   importer.ParseVersionPrefix(name),
+			AppliedAt: importer.ParseTime(migrationTime.String),
+			RunID:     fmt.Sprintf("knex-batch-%d", batch),
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+	}
+
+	return result, nil
+}
+
+// checkLock fails with ErrLocked if a row of the lock table is locked.
+func (rdr *knexReader) checkLock() error {
+	rows, err := rdr.conn.Query(fmt.Sprintf("SELECT is_locked FROM %s", rdr.config.LockTableName))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", rdr.config.LockTableName, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var locked sql.NullBool
+		if err = rows.Scan(&locked); err != nil {
+			return fmt.Errorf("failed to read %s: %w", rdr.config.LockTableName, err)
+		}
+
+		if locked.Bool {
+			return fmt.Errorf("%w: %s", ErrLocked, rdr.config.LockTableName)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", rdr.config.LockTableName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package knex_test
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/importer"
+	"github.com/root-talis/henka/importer/importertest"
+	"github.com/root-talis/henka/importer/knex"
+)
+
+func migrationsTable(lock ...driver.Value) map[string]importertest.Rows {
+	locks := make([][]driver.Value, 0, len(lock))
+	for _, value := range lock {
+		locks = append(locks, []driver.Value{value})
+	}
+
+	return map[string]importertest.Rows{
+		"SELECT is_locked FROM knex_migrations_lock": {Columns: []string{"is_locked"}, Values: locks},
+		"SELECT name, batch, migration_time FROM knex_migrations ORDER BY id": {
+			Columns: []string{"name", "batch", "migration_time"},
+			Values: [][]driver.Value{
+				{"20210124131258_initial_structure.js", int64(1), "2021-01-24 13:12:58"},
+				{"20210124132201_indexes.js", int64(1), "2021-01-24 13:22:01"},
+				{"20210608080143_sessions_table.ts", int64(2), nil},
+				{"initial.js", int64(3), "2021-06-09 09:00:00"},
+			},
+		},
+	}
+}
+
+func TestReadEntries(t *testing.T) {
+	t.Parallel()
+
+	conn := importertest.Open(migrationsTable(int64(0)))
+	defer conn.Close()
+
+	entries, err := knex.NewReader(conn, knex.Config{}).ReadEntries()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []importer.Entry{
+		{
+			ForeignID: "20210124131258_initial_structure.js",
+			Version:   20210124131258,
+			AppliedAt: time.Date(2021, 1, 24, 13, 12, 58, 0, time.UTC),
+			RunID:     "knex-batch-1",
+		},
+		{
+			ForeignID: "20210124132201_indexes.js",
+			Version:   20210124132201,
+			AppliedAt: time.Date(2021, 1, 24, 13, 22, 1, 0, time.UTC),
+			RunID:     "knex-batch-1",
+		},
+		{
+			ForeignID: "20210608080143_sessions_table.ts",
+			Version:   20210608080143,
+			RunID:     "knex-batch-2",
+		},
+		{
+			ForeignID: "initial.js",
+			AppliedAt: time.Date(2021, 6, 9, 9, 0, 0, 0, time.UTC),
+			RunID:     "knex-batch-3",
+		},
+	}, entries)
+}
+
+func TestReadEntriesWhileLocked(t *testing.T) {
+	t.Parallel()
+
+	for _, locked := range []driver.Value{int64(1), true} {
+		conn := importertest.Open(migrationsTable(locked))
+
+		_, err := knex.NewReader(conn, knex.Config{}).ReadEntries()
+		assert.ErrorIs(t, err, knex.ErrLocked, "%v", locked)
+
+		_ = conn.Close()
+	}
+
+	conn := importertest.Open(map[string]importertest.Rows{
+		"SELECT is_locked FROM legacy_lock": {Columns: []string{"is_locked"}, Values: [][]driver.Value{{int64(1)}}},
+	})
+	defer conn.Close()
+
+	_, err := knex.NewReader(conn, knex.Config{TableName: "legacy", LockTableName: "legacy_lock"}).ReadEntries()
+	assert.ErrorIs(t, err, knex.ErrLocked, "the configured lock table must be checked")
+}
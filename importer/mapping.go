@@ -0,0 +1,82 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Mapping maps foreign migration ids onto henka versions.
+type Mapping map[string]migration.Version
+
+var ErrInvalidMapping = errors.New("mapping is invalid")
+
+// ReadMapping parses a mapping file. Every non-empty line contains a foreign id
+// and a henka version separated by whitespace. Lines starting with # are comments:
+//
+//	# django app.name        henka version
+//	auth.0001_initial        20210124131258
+//	billing.0002_invoices    20210124132201
+func ReadMapping(reader io.Reader) (Mapping, error) {
+	result := make(Mapping)
+	scanner := bufio.NewScanner(reader)
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 { //nolint:gomnd
+			return nil, fmt.Errorf("%w: line %d must contain a foreign id and a version", ErrInvalidMapping, lineNo)
+		}
+
+		version, err := strconv.ParseUint(fields[1], 10, migration.VersionBits)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d contains invalid version \"%s\"", ErrInvalidMapping, lineNo, fields[1])
+		}
+
+		if _, exists := result[fields[0]]; exists {
+			return nil, fmt.Errorf("%w: line %d maps \"%s\" more than once", ErrInvalidMapping, lineNo, fields[0])
+		}
+
+		result[fields[0]] = migration.Version(version)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mapping: %w", err)
+	}
+
+	return result, nil
+}
+
+// Lookup returns the henka version for a foreign id, or zero if the id is not mapped.
+func (m Mapping) Lookup(foreignID string) migration.Version {
+	return m[foreignID]
+}
+
+var timeLayouts = []string{ //nolint:gochecknoglobals
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+}
+
+// ParseTime parses timestamps the way database/sql drivers return them as strings.
+// Zero time is returned if the value can't be parsed.
+func ParseTime(value string) time.Time {
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,79 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/importer"
+)
+
+var readMappingTests = []struct { // nolint:gochecknoglobals
+	name        string
+	input       string
+	expected    importer.Mapping
+	expectError bool
+}{
+	/* s0 */ {
+		name:     "s0: should read an empty mapping",
+		input:    "",
+		expected: importer.Mapping{},
+	},
+	/* s1 */ {
+		name: "s1: should read mapping with comments and blank lines",
+		input: "# app.name  version\n" +
+			"auth.0001_initial     20210124131258\n" +
+			"\n" +
+			"  billing.0002_invoices\t20210124132201  \n",
+		expected: importer.Mapping{
+			"auth.0001_initial":     20210124131258,
+			"billing.0002_invoices": 20210124132201,
+		},
+	},
+	/* e0 */ {
+		name:        "e0: should fail on a line without version",
+		input:       "auth.0001_initial\n",
+		expectError: true,
+	},
+	/* e1 */ {
+		name:        "e1: should fail on an invalid version",
+		input:       "auth.0001_initial 2021-01-24\n",
+		expectError: true,
+	},
+	/* e2 */ {
+		name:        "e2: should fail on a duplicated foreign id",
+		input:       "auth.0001_initial 20210124131258\nauth.0001_initial 20210124132201\n",
+		expectError: true,
+	},
+}
+
+func TestReadMapping(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range readMappingTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			mapping, err := importer.ReadMapping(strings.NewReader(test.input))
+
+			if test.expectError {
+				assert.ErrorIs(t, err, importer.ErrInvalidMapping)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, mapping)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC), importer.ParseTime("2022-01-19 10:00:00"))
+	assert.Equal(t, time.Date(2022, 1, 19, 10, 0, 0, 500000000, time.UTC), importer.ParseTime("2022-01-19 10:00:00.5"))
+	assert.True(t, importer.ParseTime("2022-01-19T10:00:00Z").Equal(time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC)))
+	assert.True(t, importer.ParseTime("yesterday").IsZero())
+}
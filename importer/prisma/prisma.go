@@ -0,0 +1,75 @@
+package prisma
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/root-talis/henka/importer"
+)
+
+const defaultTableName = "_prisma_migrations"
+
+// Config describes where Prisma keeps its migrations.
+type Config struct {
+	// TableName is the name of the Prisma migrations table, "_prisma_migrations" if empty.
+	// It is used in queries as is, so it may be qualified with a schema name.
+	TableName string
+}
+
+type prismaReader struct {
+	conn   *sql.DB
+	config Config
+}
+
+// NewReader creates a reader for Prisma's _prisma_migrations table.
+// Only migrations that have finished and were not rolled back are read.
+// Migration names start with a 14-digit timestamp, which maps onto henka versions directly.
+func NewReader(conn *sql.DB, config Config) importer.Reader {
+	if config.TableName == "" {
+		config.TableName = defaultTableName
+	}
+
+	return &prismaReader{
+		conn:   conn,
+		config: config,
+	}
+}
+
+// ReadEntries reads every row and leaves out migrations that have not finished or were rolled back.
+// The rows are filtered here rather than in the query, so that the same rules apply to every database.
+func (rdr *prismaReader) ReadEntries() ([]importer.Entry, error) {
+	rows, err := rdr.conn.Query(fmt.Sprintf(
+		"SELECT migration_name, finished_at, rolled_back_at FROM %s",
+		rdr.config.TableName,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", rdr.config.TableName, err)
+	}
+	defer rows.Close()
+
+	result := make([]importer.Entry, 0)
+	for rows.Next() {
+		var name string
+		var finishedAt, rolledBackAt sql.NullString
+
+		if err = rows.Scan(&name, &finishedAt, &rolledBackAt); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+		}
+
+		if !finishedAt.Valid || rolledBackAt.Valid {
+			continue
+		}
+
+		result = append(result, importer.Entry{
+			ForeignID: name,
+			Version:   importer.ParseVersionPrefix(name),
+			AppliedAt: importer.ParseTime(finishedAt.String),
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package prisma_test
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/importer"
+	"github.com/root-talis/henka/importer/importertest"
+	"github.com/root-talis/henka/importer/prisma"
+)
+
+func TestReadEntries(t *testing.T) {
+	t.Parallel()
+
+	conn := importertest.Open(map[string]importertest.Rows{
+		"SELECT migration_name, finished_at, rolled_back_at FROM _prisma_migrations": {
+			Columns: []string{"migration_name", "finished_at", "rolled_back_at"},
+			Values: [][]driver.Value{
+				{"20210124131258_init", "2021-01-24 13:12:58", nil},
+				{"20210124132201_indexes", nil, nil},
+				{"20210608080143_sessions", "2021-06-08 08:01:43", "2021-06-08 08:05:00"},
+				{"20210609090000_users", "2021-06-09 09:00:00", nil},
+				{"baseline", "2021-06-10 10:00:00", nil},
+			},
+		},
+	})
+	defer conn.Close()
+
+	entries, err := prisma.NewReader(conn, prisma.Config{}).ReadEntries()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []importer.Entry{
+		{
+			ForeignID: "20210124131258_init",
+			Version:   20210124131258,
+			AppliedAt: time.Date(2021, 1, 24, 13, 12, 58, 0, time.UTC),
+		},
+		{
+			ForeignID: "20210609090000_users",
+			Version:   20210609090000,
+			AppliedAt: time.Date(2021, 6, 9, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			ForeignID: "baseline",
+			AppliedAt: time.Date(2021, 6, 10, 10, 0, 0, 0, time.UTC),
+		},
+	}, entries, "unfinished and rolled back migrations must be left out")
+}
@@ -0,0 +1,64 @@
+package rails
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/importer"
+)
+
+const defaultTableName = "schema_migrations"
+
+// Config describes where ActiveRecord keeps its migrations.
+type Config struct {
+	// TableName is the name of the ActiveRecord migrations table, "schema_migrations" if empty.
+	// It is used in queries as is, so it may be qualified with a schema name.
+	TableName string
+}
+
+type railsReader struct {
+	conn   *sql.DB
+	config Config
+}
+
+// NewReader creates a reader for ActiveRecord's schema_migrations table.
+// ActiveRecord stores 14-digit timestamp versions, which map onto henka versions directly.
+func NewReader(conn *sql.DB, config Config) importer.Reader {
+	if config.TableName == "" {
+		config.TableName = defaultTableName
+	}
+
+	return &railsReader{
+		conn:   conn,
+		config: config,
+	}
+}
+
+func (rdr *railsReader) ReadEntries() ([]importer.Entry, error) {
+	rows, err := rdr.conn.Query(fmt.Sprintf("SELECT version FROM %s", rdr.config.TableName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", rdr.config.TableName, err)
+	}
+	defer rows.Close()
+
+	result := make([]importer.Entry, 0)
+	for rows.Next() {
+		var version string
+		if err = rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+		}
+
+		version = strings.TrimSpace(version)
+		result = append(result, importer.Entry{
+			ForeignID: version,
+			Version:   importer.ParseVersionPrefix(version),
+		})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rdr.config.TableName, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,61 @@
+package rails_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/importer"
+	"github.com/root-talis/henka/importer/importertest"
+	"github.com/root-talis/henka/importer/rails"
+)
+
+func TestReadEntries(t *testing.T) {
+	t.Parallel()
+
+	conn := importertest.Open(map[string]importertest.Rows{
+		"SELECT version FROM schema_migrations": {
+			Columns: []string{"version"},
+			Values: [][]driver.Value{
+				{"20210124131258"},
+				{" 20210124132201 "},
+				{"20210608080143_sessions_table"},
+				{"1"},
+				{"legacy"},
+			},
+		},
+	})
+	defer conn.Close()
+
+	entries, err := rails.NewReader(conn, rails.Config{}).ReadEntries()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []importer.Entry{
+		{ForeignID: "20210124131258", Version: 20210124131258},
+		{ForeignID: "20210124132201", Version: 20210124132201},
+		{ForeignID: "20210608080143_sessions_table", Version: 20210608080143},
+		{ForeignID: "1", Version: 1},
+		{ForeignID: "legacy"},
+	}, entries)
+}
+
+func TestReadEntriesFromCustomTable(t *testing.T) {
+	t.Parallel()
+
+	conn := importertest.Open(map[string]importertest.Rows{
+		"SELECT version FROM legacy.schema_migrations": {
+			Columns: []string{"version"},
+			Values:  [][]driver.Value{{"20210124131258"}},
+		},
+	})
+	defer conn.Close()
+
+	entries, err := rails.NewReader(conn, rails.Config{TableName: "legacy.schema_migrations"}).ReadEntries()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []importer.Entry{{ForeignID: "20210124131258", Version: 20210124131258}}, entries)
+
+	_, err = rails.NewReader(conn, rails.Config{}).ReadEntries()
+	assert.ErrorIs(t, err, importertest.ErrUnknownQuery)
+}
@@ -0,0 +1,26 @@
+package henka
+
+// Logger receives structured log lines. Args are alternating keys and values. *slog.Logger implements it,
+// see also WithSlog.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// logger returns Options.Logger, or a logger that discards everything.
+func (m *henkaImpl) logger() Logger {
+	if m.options.Logger == nil {
+		return nopLogger{}
+	}
+
+	return m.options.Logger
+}
@@ -0,0 +1,12 @@
+package migration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Checksum returns the hex encoded SHA-256 of a migration script.
+func Checksum(script []byte) string {
+	sum := sha256.Sum256(script)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,10 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Func is a migration written in Go, e.g. a data backfill that needs application logic. It is executed
+// in a transaction that also writes the migrations log entry, so that both are committed or rolled back together.
+type Func func(ctx context.Context, tx *sql.Tx) error
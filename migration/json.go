@@ -0,0 +1,27 @@
+package migration
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MarshalJSON encodes AppliedAt in RFC 3339 and as null when the migration has not been applied,
+// so that the output doesn't depend on the precision or the zero value of time.Time.
+func (s State) MarshalJSON() ([]byte, error) {
+	type plainState State
+
+	var appliedAt *string
+
+	if !s.AppliedAt.IsZero() {
+		formatted := s.AppliedAt.Format(time.RFC3339)
+		appliedAt = &formatted
+	}
+
+	return json.Marshal(struct { //nolint:wrapcheck
+		plainState
+		AppliedAt *string `json:"applied_at"`
+	}{
+		plainState: plainState(s),
+		AppliedAt:  appliedAt,
+	})
+}
@@ -0,0 +1,54 @@
+package migration
+
+// Ordering defines the order migrations are applied in. Compare returns a negative number when a goes
+// before b, zero when a and b are the same version and a positive number when a goes after b.
+type Ordering interface {
+	Compare(a, b Version) int
+}
+
+// OrderingFunc adapts a function to Ordering.
+type OrderingFunc func(a, b Version) int
+
+func (f OrderingFunc) Compare(a, b Version) int {
+	return f(a, b)
+}
+
+// ExplicitOrdering puts versions in the given order, e.g. an order declared next to the migrations.
+// Versions that are not listed go after the listed ones, in numeric order.
+func ExplicitOrdering(versions ...Version) Ordering {
+	positions := make(map[Version]int, len(versions))
+
+	for i, version := range versions {
+		if _, ok := positions[version]; !ok {
+			positions[version] = i
+		}
+	}
+
+	return OrderingFunc(func(a, b Version) int {
+		positionA, listedA := positions[a]
+		positionB, listedB := positions[b]
+
+		switch {
+		case listedA && listedB:
+			return positionA - positionB
+		case listedA:
+			return -1
+		case listedB:
+			return 1
+		default:
+			return NumericOrdering.Compare(a, b)
+		}
+	})
+}
+
+// NumericOrdering orders versions as numbers, which is the chronological order of timestamp versions.
+var NumericOrdering Ordering = OrderingFunc(func(a, b Version) int { //nolint:gochecknoglobals
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+})
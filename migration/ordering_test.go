@@ -0,0 +1,24 @@
+package migration_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+)
+
+func TestExplicitOrdering(t *testing.T) {
+	t.Parallel()
+
+	ordering := migration.ExplicitOrdering(30, 10, 20, 10)
+	versions := []migration.Version{50, 10, 40, 20, 30}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return ordering.Compare(versions[i], versions[j]) < 0
+	})
+
+	assert.Equal(t, []migration.Version{30, 10, 20, 40, 50}, versions, "unlisted versions must go after listed ones")
+	assert.Zero(t, ordering.Compare(10, 10))
+}
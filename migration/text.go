@@ -0,0 +1,88 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrUnknownDirection = errors.New("unknown migration direction")
+	ErrUnknownStatus    = errors.New("unknown migration status")
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Up:
+		return "up"
+	case Down:
+		return "down"
+	default:
+		return fmt.Sprintf("Direction(%q)", rune(d))
+	}
+}
+
+func (d Direction) MarshalText() ([]byte, error) {
+	if d != Up && d != Down {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDirection, rune(d))
+	}
+
+	return []byte(d.String()), nil
+}
+
+func (d *Direction) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "up":
+		*d = Up
+	case "down":
+		*d = Down
+	default:
+		return fmt.Errorf("%w: \"%s\"", ErrUnknownDirection, text)
+	}
+
+	return nil
+}
+
+func (s Status) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Applied:
+		return "applied"
+	case Missing:
+		return "missing"
+	case Baselined:
+		return "baselined"
+	case Skipped:
+		return "skipped"
+	default:
+		return "Status(" + strconv.FormatUint(uint64(s), 10) + ")"
+	}
+}
+
+func (s Status) MarshalText() ([]byte, error) {
+	if s > Skipped {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownStatus, s)
+	}
+
+	return []byte(s.String()), nil
+}
+
+func (s *Status) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "pending":
+		*s = Pending
+	case "applied":
+		*s = Applied
+	case "missing":
+		*s = Missing
+	case "baselined":
+		*s = Baselined
+	case "skipped":
+		*s = Skipped
+	default:
+		return fmt.Errorf("%w: \"%s\"", ErrUnknownStatus, text)
+	}
+
+	return nil
+}
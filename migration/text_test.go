@@ -0,0 +1,110 @@
+package migration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+)
+
+func TestDirectionText(t *testing.T) {
+	t.Parallel()
+
+	for _, direction := range []migration.Direction{migration.Up, migration.Down} {
+		text, err := direction.MarshalText()
+		assert.NoError(t, err)
+		assert.Equal(t, direction.String(), string(text))
+
+		var parsed migration.Direction
+		assert.NoError(t, parsed.UnmarshalText(text))
+		assert.Equal(t, direction, parsed)
+	}
+
+	assert.Equal(t, "up", fmt.Sprint(migration.Up))
+
+	_, err := migration.Direction('x').MarshalText()
+	assert.ErrorIs(t, err, migration.ErrUnknownDirection)
+
+	var parsed migration.Direction
+	assert.ErrorIs(t, parsed.UnmarshalText([]byte("sideways")), migration.ErrUnknownDirection)
+}
+
+func TestStatusText(t *testing.T) {
+	t.Parallel()
+
+	for _, status := range []migration.Status{migration.Pending, migration.Applied, migration.Missing, migration.Baselined, migration.Skipped} {
+		text, err := status.MarshalText()
+		assert.NoError(t, err)
+		assert.Equal(t, status.String(), string(text))
+
+		var parsed migration.Status
+		assert.NoError(t, parsed.UnmarshalText(text))
+		assert.Equal(t, status, parsed)
+	}
+
+	_, err := migration.Status(42).MarshalText()
+	assert.ErrorIs(t, err, migration.ErrUnknownStatus)
+
+	var parsed migration.Status
+	assert.ErrorIs(t, parsed.UnmarshalText([]byte("unknown")), migration.ErrUnknownStatus)
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	state := migration.State{
+		Description: migration.Description{
+			Migration: migration.Migration{Version: 20220118115519, Name: "users"},
+			CanUndo:   true,
+		},
+		Status:    migration.Applied,
+		AppliedAt: time.Date(2022, 1, 19, 10, 0, 0, 0, time.UTC),
+	}
+
+	encoded, err := json.Marshal(state)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"version": 20220118115519, "name": "users", "can_undo": true, "status": "applied",
+		"applied_at": "2022-01-19T10:00:00Z"}`, string(encoded))
+
+	pending := migration.State{
+		Description: migration.Description{Migration: migration.Migration{Version: 20220120090000, Name: "roles"}},
+		Status:      migration.Pending,
+	}
+
+	encoded, err = json.Marshal([]migration.State{pending, {
+		Description: state.Description,
+		Status:      migration.Applied,
+		AppliedAt:   time.Date(2022, 1, 19, 10, 0, 0, 123456789, time.FixedZone("", 3*60*60)),
+	}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"version": 20220120090000, "name": "roles", "can_undo": false, "status": "pending", "applied_at": null},
+		{"version": 20220118115519, "name": "users", "can_undo": true, "status": "applied",
+			"applied_at": "2022-01-19T10:00:00+03:00"}
+	]`, string(encoded))
+
+	var decodedStates []migration.State
+	assert.NoError(t, json.Unmarshal(encoded, &decodedStates))
+	assert.Equal(t, pending, decodedStates[0])
+
+	log := migration.Log{
+		ID:         3,
+		Migration:  state.Migration,
+		Direction:  migration.Down,
+		AppliedAt:  state.AppliedAt,
+		FinishedAt: state.AppliedAt.Add(time.Second),
+	}
+
+	encoded, err = json.Marshal(log)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id": 3, "version": 20220118115519, "name": "users", "direction": "down",
+		"applied_at": "2022-01-19T10:00:00Z", "finished_at": "2022-01-19T10:00:01Z"}`, string(encoded))
+
+	var decoded migration.Log
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, log, decoded)
+}
@@ -16,8 +16,8 @@ const VersionBits = 64
 type Version uint64
 
 type Migration struct {
-	Version Version
-	Name    string
+	Version Version `json:"version"`
+	Name    string  `json:"name"`
 }
 
 // ---
@@ -28,25 +28,100 @@ const (
 	Pending Status = iota
 	Applied
 	Missing
+
+	// Baselined migrations are not later than the baseline of the database and are treated as applied
+	// without having been executed.
+	Baselined
+
+	// Skipped migrations are pending ones that are intentionally left out of upgrades.
+	Skipped
 )
 
+// BaselineName is the name of log entries that mark the baseline of the database.
+const BaselineName = "<< baseline >>"
+
 // ---
 
 type Log struct {
+	// ID is the position of the entry in the migrations log. Drivers that can't provide it leave it zero.
+	ID uint64 `json:"id,omitempty"`
+
 	Migration
-	Direction
-	AppliedAt time.Time
+	Direction Direction `json:"direction"`
+	AppliedAt time.Time `json:"applied_at"`
+
+	// RunID groups log entries written during the same run. Empty if unknown.
+	RunID string `json:"run_id,omitempty"`
+
+	// Checksum is the Checksum of the script that was executed. Empty if unknown.
+	Checksum string `json:"checksum,omitempty"`
+
+	// FinishedAt is when the script was done. Zero if unknown.
+	FinishedAt time.Time `json:"finished_at"`
+
+	// Baseline is set for the entry that marks the baseline of the database, see BaselineName.
+	Baseline bool `json:"baseline,omitempty"`
+
+	// Error is the failure recorded for an execution that has not completed. Empty if none was recorded.
+	Error string `json:"error,omitempty"`
+
+	// Namespace is the stream of migrations the entry belongs to, when several of them share the log. Empty by default.
+	Namespace string `json:"namespace,omitempty"`
+
+	// AppliedBy, Hostname and AppVersion tell who has written the entry: the OS user or a configured identity,
+	// the host and the version of the binary. Empty if unknown.
+	AppliedBy  string `json:"applied_by,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+	AppVersion string `json:"app_version,omitempty"`
+
+	// ExecutionTime is how long the script took, measured by the driver. Zero if not recorded.
+	ExecutionTime time.Duration `json:"execution_time,omitempty"`
+}
+
+// Duration is ExecutionTime if it was recorded, the time between AppliedAt and FinishedAt otherwise,
+// and zero if neither is known.
+func (l Log) Duration() time.Duration {
+	if l.ExecutionTime > 0 {
+		return l.ExecutionTime
+	}
+
+	if l.FinishedAt.IsZero() || l.FinishedAt.Before(l.AppliedAt) {
+		return 0
+	}
+
+	return l.FinishedAt.Sub(l.AppliedAt)
 }
 
 // ---
 
 type Description struct {
 	Migration
-	CanUndo bool
+	CanUndo bool `json:"can_undo"`
 }
 
 type State struct {
 	Description
-	Status    Status
-	AppliedAt time.Time
+	Status    Status    `json:"status"`
+	AppliedAt time.Time `json:"applied_at"`
+
+	// Checksum is the checksum recorded when the migration was applied. Empty if unknown.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Dirty is set when an execution of the migration has started but has not completed.
+	Dirty bool `json:"dirty,omitempty"`
+
+	// Failed is set for dirty migrations whose latest execution has failed with Error, as opposed to
+	// executions that have crashed or are still running.
+	Failed bool   `json:"failed,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// OutOfOrder is set for pending migrations older than the latest applied one.
+	OutOfOrder bool `json:"out_of_order,omitempty"`
+
+	// Duration is how long the latest up execution of an applied migration took, zero if unknown.
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// AppliedTimes and RevertedTimes count executions of the migration in both directions. They are filled by Henka.Status.
+	AppliedTimes  uint `json:"applied_times,omitempty"`
+	RevertedTimes uint `json:"reverted_times,omitempty"`
 }
@@ -0,0 +1,58 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// VersionLayout is the time layout of versions: YYYYMMDDHHMMSS in UTC.
+const VersionLayout = "20060102150405"
+
+var ErrInvalidVersion = errors.New("version must be a timestamp in YYYYMMDDHHMMSS format")
+
+// NewVersionFromTime makes a version of t converted to UTC, truncated to seconds.
+func NewVersionFromTime(t time.Time) Version {
+	v, _ := strconv.ParseUint(t.UTC().Format(VersionLayout), 10, VersionBits)
+	return Version(v)
+}
+
+// ParseVersion parses a version in YYYYMMDDHHMMSS format.
+func ParseVersion(s string) (Version, error) {
+	if len(s) != len(VersionLayout) {
+		return 0, fmt.Errorf("%w: \"%s\" is not %d digits long", ErrInvalidVersion, s, len(VersionLayout))
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w: \"%s\" contains non-digits", ErrInvalidVersion, s)
+		}
+	}
+
+	if _, err := time.Parse(VersionLayout, s); err != nil {
+		return 0, fmt.Errorf("%w: \"%s\" is not a valid timestamp", ErrInvalidVersion, s)
+	}
+
+	v, err := strconv.ParseUint(s, 10, VersionBits)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidVersion, err.Error())
+	}
+
+	return Version(v), nil
+}
+
+// Time returns the moment the version stands for, in UTC.
+func (v Version) Time() (time.Time, error) {
+	t, err := time.Parse(VersionLayout, v.String())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %d is not a valid timestamp", ErrInvalidVersion, uint64(v))
+	}
+
+	return t, nil
+}
+
+// String formats the version with leading zeros up to 14 digits.
+func (v Version) String() string {
+	return fmt.Sprintf("%0*d", len(VersionLayout), uint64(v))
+}
@@ -0,0 +1,63 @@
+package migration_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+)
+
+var parseVersionTestsTable = []struct { // nolint:gochecknoglobals
+	name     string
+	input    string
+	expected migration.Version
+	isValid  bool
+}{
+	/* s0 */ {name: "s0: should parse a valid version", input: "20220118115519", expected: 20220118115519, isValid: true},
+	/* s1 */ {name: "s1: should parse the first second of a year", input: "20230101000000", expected: 20230101000000, isValid: true},
+	/* e0 */ {name: "e0: should fail on a short version", input: "2022011811551"},
+	/* e1 */ {name: "e1: should fail on a long version", input: "202201181155190"},
+	/* e2 */ {name: "e2: should fail on non-digits", input: "2022-01-18 115"},
+	/* e3 */ {name: "e3: should fail on a sign", input: "+2022011811551"},
+	/* e4 */ {name: "e4: should fail on an invalid month", input: "20221318115519"},
+	/* e5 */ {name: "e5: should fail on an invalid time", input: "20220118245519"},
+	/* e6 */ {name: "e6: should fail on an empty string", input: ""},
+}
+
+func TestParseVersion(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range parseVersionTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			version, err := migration.ParseVersion(test.input)
+			if test.isValid {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expected, version)
+				assert.Equal(t, test.input, version.String())
+			} else {
+				assert.ErrorIs(t, err, migration.ErrInvalidVersion)
+			}
+		})
+	}
+}
+
+func TestVersionTime(t *testing.T) {
+	t.Parallel()
+
+	moment := time.Date(2022, 1, 18, 14, 55, 19, 999, time.FixedZone("UTC+3", 3*60*60))
+	version := migration.NewVersionFromTime(moment)
+	assert.Equal(t, migration.Version(20220118115519), version)
+
+	actual, err := version.Time()
+	assert.NoError(t, err)
+	assert.Equal(t, moment.Truncate(time.Second).UTC(), actual)
+
+	_, err = migration.Version(42).Time()
+	assert.ErrorIs(t, err, migration.ErrInvalidVersion)
+	assert.Equal(t, "00000000000042", migration.Version(42).String())
+}
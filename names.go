@@ -0,0 +1,60 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+var ErrAmbiguousName = errors.New("migration name is shared by several versions")
+
+// UpgradeTo upgrades to the version of the migration with the given name.
+func (m *henkaImpl) UpgradeTo(name string) error {
+	version, err := m.newRun(context.Background()).resolveName(name)
+	if err != nil {
+		return fmt.Errorf("failed to resolve upgrade target: %w", err)
+	}
+
+	return m.Upgrade(version)
+}
+
+// DowngradeTo downgrades to the version of the migration with the given name, which stays applied.
+func (m *henkaImpl) DowngradeTo(name string) error {
+	version, err := m.newRun(context.Background()).resolveName(name)
+	if err != nil {
+		return fmt.Errorf("failed to resolve downgrade target: %w", err)
+	}
+
+	return m.Downgrade(version)
+}
+
+// resolveName looks the name up in the source. It must belong to exactly one version.
+func (m *run) resolveName(name string) (migration.Version, error) {
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	var found *migration.Description
+
+	for i, descr := range *available {
+		if descr.Name != name {
+			continue
+		}
+
+		if found != nil {
+			return 0, fmt.Errorf("%w: \"%s\" is used by %d and %d", ErrAmbiguousName, name, found.Version, descr.Version)
+		}
+
+		found = &(*available)[i]
+	}
+
+	if found == nil {
+		return 0, fmt.Errorf("%w: \"%s\"", source2.ErrMigrationNotFound, name)
+	}
+
+	return found.Version, nil
+}
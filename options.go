@@ -0,0 +1,306 @@
+package henka
+
+import (
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+// DefaultLockTimeout is how long runs wait for the migration lock unless Options.LockTimeout is set.
+const DefaultLockTimeout = time.Minute
+
+// OutOfOrderPolicy tells what to do with pending migrations older than the latest applied one,
+// e.g. merged from a feature branch.
+type OutOfOrderPolicy uint
+
+const (
+	// OutOfOrderApply applies them in version order along with the newer ones.
+	OutOfOrderApply OutOfOrderPolicy = iota
+
+	// OutOfOrderReject makes Validate and Upgrade fail with ErrOutOfOrderMigration.
+	OutOfOrderReject
+
+	// OutOfOrderSkip leaves them pending. Validate still reports them, and Upgrade lists them in RunReport.Skipped.
+	OutOfOrderSkip
+
+	// OutOfOrderWarn applies them like OutOfOrderApply, but logs a warning about every one of them.
+	OutOfOrderWarn
+)
+
+// Options tune the behaviour of the engine. They are set with Option functions passed to New.
+type Options struct {
+	// VerifyChecksums makes Validate and Upgrade compare the checksums recorded for applied migrations
+	// with the checksums of their up scripts.
+	VerifyChecksums bool
+
+	// ChecksumWorkers limits the number of scripts read concurrently during verification.
+	// Zero means runtime.NumCPU().
+	ChecksumWorkers int
+
+	// SkipWhenUpToDate makes Upgrade compare the highest applied version with the highest available
+	// one first and return early when nothing is newer. Pending versions below the highest applied one
+	// are not noticed then, so it only suits histories where migrations are added in version order.
+	// Requires a driver that implements driver.MaxVersionReader and the numeric ordering, it has no effect otherwise.
+	SkipWhenUpToDate bool
+
+	// Ordering defines the order of versions, e.g. migration.ExplicitOrdering. Nil means migration.NumericOrdering.
+	// Sources list migrations in numeric order, so with any other ordering the listing is sorted in memory
+	// and can't be walked lazily.
+	Ordering migration.Ordering
+
+	// PrefetchBudget enables reading scripts of an upgrade plan ahead of their execution, in the background.
+	// Reading ahead pauses while the scripts that were read but not executed yet take more than PrefetchBudget
+	// bytes. Zero reads every script right before it is executed.
+	PrefetchBudget int64
+
+	// OnRunFinished receives the report of every finished Upgrade and Downgrade run, including failed ones.
+	OnRunFinished func(RunReport)
+
+	// Shutdown stops runs on request, see HandleSignals.
+	Shutdown *Shutdown
+
+	// ForceDowngrade makes Downgrade revert migrations that can't be undone by marking them as reverted
+	// in the log without executing any script. Downgrade fails on such migrations otherwise.
+	ForceDowngrade bool
+
+	// OutOfOrder is the policy for pending migrations older than the latest applied one.
+	OutOfOrder OutOfOrderPolicy
+
+	// Logger receives log lines about discovery, plans, executed migrations and failures. Nil disables logging.
+	Logger Logger
+
+	// Observer receives progress events of runs, see Event.
+	Observer Observer
+
+	// LockTimeout is how long Upgrade and Downgrade wait for the migration lock of drivers that implement
+	// driver.Locker, so that concurrent runs, e.g. of several replicas, don't apply the same migrations.
+	// Zero means DefaultLockTimeout.
+	LockTimeout time.Duration
+
+	// Transactions is how migrations are wrapped in transactions. Policies other than NoTransactions need
+	// a driver that implements driver.Transactor.
+	Transactions TransactionPolicy
+
+	// Resume lets Upgrade and Downgrade run when a previous execution of a migration has not completed,
+	// e.g. has failed halfway. Such migrations are executed again from the top, unless the driver resumes
+	// them on its own, as driver/mysql does with chunked migrations. Runs fail with ErrDirtyMigration otherwise.
+	Resume bool
+
+	// RejectMissing makes Upgrade fail with ErrMissingMigration when a migration applied to the database
+	// is absent from the source, e.g. because the source is an outdated copy of the migrations.
+	RejectMissing bool
+
+	// SkipVersions are pending migrations that Upgrade leaves out. Validate reports them as Skipped.
+	// Applied migrations are not affected.
+	SkipVersions map[migration.Version]bool
+
+	// IncludeTags and ExcludeTags filter tagged migrations during upgrades, so that the same migrations serve
+	// several environments. A tagged migration is applied when it has one of IncludeTags (or IncludeTags is empty)
+	// and none of ExcludeTags. Migrations without tags are always applied. Requires a source.Tagger.
+	IncludeTags []string
+	ExcludeTags []string
+
+	// MigrationTimeout limits how long a single migration may run. The context given to the driver is canceled then,
+	// and the running statement is killed if the driver implements driver.Canceler. The migration fails
+	// with ErrMigrationTimeout and the failure is recorded by drivers that implement driver.FailureRecorder.
+	// Zero means no limit.
+	MigrationTimeout time.Duration
+
+	// Confirm is asked before every destructive migration is applied, in both directions: one with DROP,
+	// TRUNCATE or ALTER ... DROP statements, or tagged with DestructiveTag. The run fails with ErrNotConfirmed
+	// unless it returns true. The run waits for it, so it may prompt a person.
+	Confirm ConfirmFunc
+
+	// DriverMiddlewares wrap the driver given to New, the first one being the outermost.
+	DriverMiddlewares []driver.Middleware
+
+	// SourceMiddlewares wrap the source given to New, the first one being the outermost.
+	SourceMiddlewares []source.Middleware
+
+	// Dependencies makes Validate check dependencies declared by migrations, so that every dependency exists and
+	// none of them is circular, and makes Upgrade apply migrations after the ones they depend on. Upgrade fails with
+	// ErrUnsatisfiedDependency when a dependency is neither applied nor planned. Requires a source.DependencyReader.
+	Dependencies bool
+
+	// SchemaSnapshots makes Upgrade dump the schema before and after applying migrations and report the difference
+	// in RunReport.SchemaDiff. Requires a driver that implements driver.SchemaDumper.
+	SchemaSnapshots bool
+}
+
+type Option func(*Options)
+
+// WithChecksumVerification enables checksum verification in Validate and before Upgrade.
+func WithChecksumVerification() Option {
+	return func(o *Options) {
+		o.VerifyChecksums = true
+	}
+}
+
+// WithChecksumWorkers sets the number of scripts read concurrently during checksum verification.
+func WithChecksumWorkers(workers int) Option {
+	return func(o *Options) {
+		o.ChecksumWorkers = workers
+	}
+}
+
+// WithSkipWhenUpToDate enables the cheap up-to-date check before Upgrade.
+func WithSkipWhenUpToDate() Option {
+	return func(o *Options) {
+		o.SkipWhenUpToDate = true
+	}
+}
+
+// WithRunReport sets the function that receives reports of finished runs.
+func WithRunReport(fn func(RunReport)) Option {
+	return func(o *Options) {
+		o.OnRunFinished = fn
+	}
+}
+
+// WithPrefetch enables reading scripts ahead of their execution, keeping up to budget bytes in memory.
+func WithPrefetch(budget int64) Option {
+	return func(o *Options) {
+		o.PrefetchBudget = budget
+	}
+}
+
+// WithVersionOrdering sets the order versions are applied in.
+func WithVersionOrdering(ordering migration.Ordering) Option {
+	return func(o *Options) {
+		o.Ordering = ordering
+	}
+}
+
+// WithShutdown makes runs stop when shutdown is requested.
+func WithShutdown(shutdown *Shutdown) Option {
+	return func(o *Options) {
+		o.Shutdown = shutdown
+	}
+}
+
+// WithOutOfOrderPolicy sets the policy for pending migrations older than the latest applied one.
+func WithOutOfOrderPolicy(policy OutOfOrderPolicy) Option {
+	return func(o *Options) {
+		o.OutOfOrder = policy
+	}
+}
+
+// WithLogger sets the logger of the engine.
+func WithLogger(logger Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithObserver sets the observer of progress events.
+func WithObserver(observer Observer) Option {
+	return func(o *Options) {
+		o.Observer = observer
+	}
+}
+
+// WithLockTimeout sets how long runs wait for the migration lock.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.LockTimeout = timeout
+	}
+}
+
+// WithTransactions sets how migrations are wrapped in transactions.
+func WithTransactions(policy TransactionPolicy) Option {
+	return func(o *Options) {
+		o.Transactions = policy
+	}
+}
+
+// WithResume lets runs execute migrations again after their previous execution has not completed.
+func WithResume() Option {
+	return func(o *Options) {
+		o.Resume = true
+	}
+}
+
+// WithRejectMissing makes Upgrade refuse to run while applied migrations are missing from the source.
+func WithRejectMissing() Option {
+	return func(o *Options) {
+		o.RejectMissing = true
+	}
+}
+
+// WithSkipVersions marks versions as intentionally skipped. It can be given several times.
+func WithSkipVersions(versions ...migration.Version) Option {
+	return func(o *Options) {
+		if o.SkipVersions == nil {
+			o.SkipVersions = make(map[migration.Version]bool, len(versions))
+		}
+
+		for _, version := range versions {
+			o.SkipVersions[version] = true
+		}
+	}
+}
+
+// WithIncludeTags limits upgrades to untagged migrations and the ones with any of the tags.
+func WithIncludeTags(tags ...string) Option {
+	return func(o *Options) {
+		o.IncludeTags = append(o.IncludeTags, tags...)
+	}
+}
+
+// WithExcludeTags leaves migrations with any of the tags out of upgrades.
+func WithExcludeTags(tags ...string) Option {
+	return func(o *Options) {
+		o.ExcludeTags = append(o.ExcludeTags, tags...)
+	}
+}
+
+// WithMigrationTimeout limits how long a single migration may run.
+func WithMigrationTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.MigrationTimeout = timeout
+	}
+}
+
+// WithConfirm gates destructive migrations with fn.
+func WithConfirm(fn ConfirmFunc) Option {
+	return func(o *Options) {
+		o.Confirm = fn
+	}
+}
+
+// WithDriverMiddleware wraps the driver with middlewares, e.g. driver.Observe or driver.Retry.
+func WithDriverMiddleware(middlewares ...driver.Middleware) Option {
+	return func(o *Options) {
+		o.DriverMiddlewares = append(o.DriverMiddlewares, middlewares...)
+	}
+}
+
+// WithSourceMiddleware wraps the source with middlewares, e.g. source.Cache or source.Template.
+func WithSourceMiddleware(middlewares ...source.Middleware) Option {
+	return func(o *Options) {
+		o.SourceMiddlewares = append(o.SourceMiddlewares, middlewares...)
+	}
+}
+
+// WithDependencies enables dependencies declared by migrations.
+func WithDependencies() Option {
+	return func(o *Options) {
+		o.Dependencies = true
+	}
+}
+
+// WithSchemaSnapshots reports how the schema has changed during upgrades.
+func WithSchemaSnapshots() Option {
+	return func(o *Options) {
+		o.SchemaSnapshots = true
+	}
+}
+
+// WithForceDowngrade lets Downgrade revert migrations that can't be undone.
+func WithForceDowngrade() Option {
+	return func(o *Options) {
+		o.ForceDowngrade = true
+	}
+}
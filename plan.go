@@ -0,0 +1,89 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// PlannedMigration is a step of a plan returned by PlanUpgrade and PlanDowngrade.
+type PlannedMigration struct {
+	migration.Migration
+	Direction migration.Direction `json:"direction"`
+	Script    string              `json:"script"`
+
+	// Repeatable is set for repeatable migrations, which have no version and follow versioned ones.
+	Repeatable bool `json:"repeatable,omitempty"`
+
+	// Forced is set for migrations that can't be undone and are planned to be marked as reverted
+	// without a script because of Options.ForceDowngrade.
+	Forced bool `json:"forced,omitempty"`
+}
+
+func (m *henkaImpl) PlanUpgrade(maxVersion migration.Version) ([]PlannedMigration, error) {
+	r := m.newRun(context.Background())
+
+	plan, err := r.planUpgrade(maxVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan upgrade: %w", err)
+	}
+
+	repeatable, err := r.planRepeatable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan upgrade: %w", err)
+	}
+
+	described, err := r.describePlan(plan, migration.Up, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, planned := range repeatable {
+		described = append(described, PlannedMigration{
+			Migration:  migration.Migration{Name: planned.name},
+			Direction:  migration.Up,
+			Script:     string(planned.script),
+			Repeatable: true,
+		})
+	}
+
+	return described, nil
+}
+
+func (m *henkaImpl) PlanDowngrade(toVersion migration.Version) ([]PlannedMigration, error) {
+	r := m.newRun(context.Background())
+
+	plan, forced, err := r.planDowngrade(toVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan downgrade: %w", err)
+	}
+
+	return r.describePlan(plan, migration.Down, forced)
+}
+
+// describePlan reads scripts of the plan the way execute would apply them.
+func (m *run) describePlan(
+	plan []migration.Migration,
+	direction migration.Direction,
+	withoutScript map[migration.Version]bool,
+) ([]PlannedMigration, error) {
+	result := make([]PlannedMigration, 0, len(plan))
+
+	for _, mig := range plan {
+		step := PlannedMigration{Migration: mig, Direction: direction, Forced: withoutScript[mig.Version]}
+
+		if !step.Forced {
+			script, err := readScript(m.ctx, m.source, mig, direction)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			step.Script = string(script)
+		}
+
+		result = append(result, step)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package henka
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+type prefetchResult struct {
+	script []byte
+	err    error
+}
+
+// prefetcher reads scripts of a plan in a background goroutine while earlier migrations are executed,
+// which hides the latency of remote sources. Reading stops while the scripts that were read but not taken
+// yet exceed the budget, so at least one script is always read ahead. With no budget, scripts are read
+// when they are taken.
+type prefetcher struct {
+	ctx       context.Context
+	source    source2.Source
+	plan      []migration.Migration
+	direction migration.Direction
+	results   []chan prefetchResult
+
+	cond    *sync.Cond
+	budget  int64
+	used    int64
+	stopped bool
+}
+
+func (m *run) prefetch(plan []migration.Migration, direction migration.Direction) *prefetcher {
+	fetcher := &prefetcher{
+		ctx:       m.ctx,
+		source:    m.source,
+		plan:      plan,
+		direction: direction,
+		budget:    m.options.PrefetchBudget,
+		cond:      sync.NewCond(&sync.Mutex{}),
+	}
+
+	if fetcher.budget <= 0 || len(plan) < 2 { //nolint:gomnd
+		return fetcher
+	}
+
+	fetcher.results = make([]chan prefetchResult, len(plan))
+	for i := range fetcher.results {
+		fetcher.results[i] = make(chan prefetchResult, 1)
+	}
+
+	go fetcher.run()
+
+	return fetcher
+}
+
+func (p *prefetcher) run() {
+	for i, mig := range p.plan {
+		p.cond.L.Lock()
+		for p.used >= p.budget && !p.stopped {
+			p.cond.Wait()
+		}
+
+		stopped := p.stopped
+		p.cond.L.Unlock()
+
+		if stopped {
+			return
+		}
+
+		var script []byte
+		err := recoverPanic(func() (err error) {
+			script, err = readScript(p.ctx, p.source, mig, p.direction)
+			return err
+		})
+
+		p.cond.L.Lock()
+		p.used += int64(len(script))
+		p.cond.L.Unlock()
+
+		p.results[i] <- prefetchResult{script: script, err: err}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// take returns the script of the i-th migration of the plan. Scripts must be taken in the order of the plan.
+func (p *prefetcher) take(i int) ([]byte, error) {
+	if p.results == nil {
+		return readScript(p.ctx, p.source, p.plan[i], p.direction)
+	}
+
+	result := <-p.results[i]
+
+	p.cond.L.Lock()
+	p.used -= int64(len(result.script))
+	p.cond.Signal()
+	p.cond.L.Unlock()
+
+	return result.script, result.err
+}
+
+// stop makes the background goroutine exit after the script it is reading now.
+func (p *prefetcher) stop() {
+	p.cond.L.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.cond.L.Unlock()
+}
+
+func readScript(ctx context.Context, src source2.Source, mig migration.Migration, direction migration.Direction) ([]byte, error) {
+	reader, err := readMigration(ctx, src, mig, direction)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return io.ReadAll(reader) //nolint:wrapcheck
+}
@@ -0,0 +1,59 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+// Reapply executes the up script of an applied migration again, e.g. after it was corrected by hand.
+// The execution is logged as a new entry, so the history keeps both.
+func (m *henkaImpl) Reapply(version migration.Version) error {
+	return m.newRun(context.Background()).reapply(version)
+}
+
+func (m *run) reapply(version migration.Version) error {
+	return m.inRun(func() error {
+		var mig migration.Migration
+
+		err := m.phase(PhasePlan, migration.Migration{}, func() (err error) {
+			mig, err = m.planReapply(version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to plan reapplying: %w", err)
+		}
+
+		m.logger().Info("planned reapplying", "version", mig.Version, "name", mig.Name)
+
+		return m.execute([]migration.Migration{mig}, migration.Up, nil)
+	})
+}
+
+func (m *run) planReapply(version migration.Version) (migration.Migration, error) {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return migration.Migration{}, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return migration.Migration{}, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	for _, descr := range *available {
+		if descr.Version != version {
+			continue
+		}
+
+		if state, ok := (*appliedMigrations)[version]; !ok || state.Status != migration.Applied {
+			return migration.Migration{}, newMigrationError(ErrNotApplied, descr.Migration)
+		}
+
+		return descr.Migration, nil
+	}
+
+	return migration.Migration{}, fmt.Errorf("%w: %d", source2.ErrMigrationNotFound, version)
+}
@@ -0,0 +1,108 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+)
+
+var ErrRepairNotSupported = errors.New("driver does not support repairing the migrations log")
+
+// RepairOptions select what Repair fixes.
+type RepairOptions struct {
+	// UpdateChecksums replaces recorded checksums of applied migrations that don't match their up scripts.
+	// Requires a driver that implements driver.ChecksumUpdater.
+	UpdateChecksums bool
+
+	// RemoveMissing deletes log entries of Missing migrations. Requires a driver that implements driver.LogDeleter.
+	RemoveMissing bool
+}
+
+// RepairResult lists migrations that were repaired, in version order.
+type RepairResult struct {
+	UpdatedChecksums []migration.Migration `json:"updated_checksums"`
+	RemovedMissing   []migration.Migration `json:"removed_missing"`
+}
+
+// Repair aligns the migrations log with the source: it fixes checksum mismatches and drops entries of
+// migrations that are gone from the source. No script is executed. The log is rewritten under the migration lock.
+func (m *henkaImpl) Repair(opts RepairOptions) (*RepairResult, error) {
+	return m.newRun(context.Background()).repair(opts)
+}
+
+func (m *run) repair(opts RepairOptions) (*RepairResult, error) {
+	var updater driver.ChecksumUpdater
+	canUpdate := driver.As(m.driver, &updater)
+	if opts.UpdateChecksums && !canUpdate {
+		return nil, fmt.Errorf("%w: checksums can't be updated", ErrRepairNotSupported)
+	}
+
+	var deleter driver.LogDeleter
+	canDelete := driver.As(m.driver, &deleter)
+	if opts.RemoveMissing && !canDelete {
+		return nil, fmt.Errorf("%w: log entries can't be deleted", ErrRepairNotSupported)
+	}
+
+	var result *RepairResult
+
+	err := m.inRun(func() (err error) {
+		result, err = m.repairLog(opts, updater, deleter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (m *run) repairLog(opts RepairOptions, updater driver.ChecksumUpdater, deleter driver.LogDeleter) (*RepairResult, error) {
+	states := make([]migration.State, 0)
+
+	err := m.mergeStates(false, func(state migration.State) error {
+		states = append(states, state)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	defer m.invalidateAppliedMigrations()
+	defer m.resetAppliedState()
+
+	result := RepairResult{
+		UpdatedChecksums: make([]migration.Migration, 0),
+		RemovedMissing:   make([]migration.Migration, 0),
+	}
+
+	for _, state := range states {
+		switch {
+		case opts.UpdateChecksums && state.Status == migration.Applied && state.Checksum != "":
+			checksum, err := m.checksum(m.ctx, state.Migration)
+			if err != nil {
+				return nil, err
+			}
+
+			if checksum == state.Checksum {
+				continue
+			}
+
+			if err = updater.UpdateChecksum(state.Version, checksum); err != nil {
+				return nil, fmt.Errorf("failed to update checksum of migration %d_%s: %w", state.Version, state.Name, err)
+			}
+
+			result.UpdatedChecksums = append(result.UpdatedChecksums, state.Migration)
+		case opts.RemoveMissing && state.Status == migration.Missing:
+			if err = deleter.DeleteLog(state.Version); err != nil {
+				return nil, fmt.Errorf("failed to delete log of migration %d_%s: %w", state.Version, state.Name, err)
+			}
+
+			result.RemovedMissing = append(result.RemovedMissing, state.Migration)
+		}
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,107 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+var ErrRepeatableNotSupported = errors.New("driver does not support repeatable migrations")
+
+// plannedRepeatable is a repeatable migration that is new or whose script has changed since its latest execution.
+// Repeatable migrations go through the engine as migrations without a version, see isRepeatable.
+type plannedRepeatable struct {
+	name   string
+	script []byte
+}
+
+func isRepeatable(mig migration.Migration) bool {
+	return mig.Version == 0
+}
+
+// planRepeatable reads the scripts of repeatable migrations and picks the ones that are to be executed by Upgrade.
+func (m *run) planRepeatable() ([]plannedRepeatable, error) {
+	var src source2.RepeatableSource
+	if !source2.As(m.source, &src) {
+		return nil, nil
+	}
+
+	names, err := src.ListRepeatableMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repeatable migrations: %w", err)
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var drv driver.RepeatableMigrator
+	if !driver.As(m.driver, &drv) {
+		return nil, fmt.Errorf("%w: %T", ErrRepeatableNotSupported, m.driver)
+	}
+
+	checksums, err := drv.ListRepeatableChecksums()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checksums of repeatable migrations: %w", err)
+	}
+
+	plan := make([]plannedRepeatable, 0)
+
+	for _, name := range names {
+		reader, err := src.ReadRepeatableMigration(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repeatable migration %s: %w", name, err)
+		}
+
+		script, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repeatable migration %s: %w", name, err)
+		}
+
+		if checksums[name] != migration.Checksum(script) {
+			plan = append(plan, plannedRepeatable{name: name, script: script})
+		}
+	}
+
+	return plan, nil
+}
+
+// executeRepeatable executes planned repeatable migrations the way executePlan executes versioned ones.
+// It is called by Upgrade after versioned migrations.
+func (m *run) executeRepeatable(plan []plannedRepeatable) error {
+	for index, planned := range plan {
+		if m.options.Shutdown != nil && m.options.Shutdown.isStopped() {
+			return fmt.Errorf("%w before repeatable migration %s", ErrInterrupted, planned.name)
+		}
+
+		if err := m.ctx.Err(); err != nil {
+			return fmt.Errorf("run was canceled before repeatable migration %s: %w", planned.name, err)
+		}
+
+		planned := planned
+		mig := migration.Migration{Name: planned.name}
+
+		err := m.executeStep(mig, migration.Up, index, len(plan), func() error {
+			return m.migrate(mig, migration.Up, func() ([]byte, error) { return planned.script, nil })
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateRepeatable executes the script of a repeatable migration and records its checksum.
+func (m *run) migrateRepeatable(name string, script string) error {
+	var drv driver.RepeatableMigrator
+	if !driver.As(m.driver, &drv) {
+		return fmt.Errorf("%w: %T", ErrRepeatableNotSupported, m.driver)
+	}
+
+	return drv.MigrateRepeatable(name, script) //nolint:wrapcheck
+}
@@ -0,0 +1,107 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"time"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
+)
+
+// Phase is a part of a run that is timed separately. Phases are also set as the "henka.phase"
+// pprof label, and migration phases set the "henka.migration" label, so that CPU profiles of
+// a slow run attribute time to the right migration and phase.
+type Phase string
+
+const (
+	PhaseListSource Phase = "list_source"
+	PhaseLoadLog    Phase = "load_log"
+	PhaseValidate   Phase = "validate"
+	PhasePlan       Phase = "plan"
+	PhaseReadScript Phase = "read_script"
+
+	// PhaseSnapshotSchema is a dump of the schema before or after an upgrade, see Options.SchemaSnapshots.
+	PhaseSnapshotSchema Phase = "snapshot_schema"
+
+	// PhaseMigrate covers both executing the script and writing the log entry, as drivers do it in one call.
+	PhaseMigrate Phase = "migrate"
+)
+
+// PhaseTiming is the time spent in one phase. Migration is zero for phases that are not related to a single migration.
+type PhaseTiming struct {
+	Phase     Phase
+	Migration migration.Migration
+	Duration  time.Duration
+}
+
+// RunReport describes a finished run. Phases are listed in the order they were finished,
+// so nested phases (e.g. listing the source while validating) go before their parents.
+type RunReport struct {
+	Phases   []PhaseTiming
+	Duration time.Duration
+	Err      error
+
+	// Skipped are pending migrations left out of the plan because of OutOfOrderSkip.
+	Skipped []migration.Migration
+
+	// Applied are migrations executed during the run, in order. Failed is the one that has failed, nil if none.
+	Applied []AppliedMigration
+	Failed  *migration.Migration
+
+	// SchemaDiff is how the schema has changed during an upgrade, nil unless Options.SchemaSnapshots is set.
+	SchemaDiff *schema.Diff
+}
+
+// AppliedMigration is a migration executed during a run. Repeatable migrations have no version.
+type AppliedMigration struct {
+	migration.Migration
+	Direction migration.Direction
+	Duration  time.Duration
+}
+
+// UpgradeResult describes what an upgrade has done, also when it has failed halfway.
+type UpgradeResult struct {
+	Applied []AppliedMigration
+	Failed  *migration.Migration
+	Err     error
+}
+
+// phase runs fn with pprof labels of the phase and records its duration in the report of the current run.
+func (m *run) phase(phase Phase, mig migration.Migration, fn func() error) error {
+	labels := []string{"henka.phase", string(phase)}
+	if mig.Version != 0 {
+		labels = append(labels, "henka.migration", fmt.Sprintf("%d_%s", mig.Version, mig.Name))
+	}
+
+	parent := m.ctx
+	if m.snapshot != nil && m.snapshot.labels != nil {
+		parent = m.snapshot.labels
+	}
+
+	var err error
+
+	start := time.Now()
+
+	pprof.Do(parent, pprof.Labels(labels...), func(ctx context.Context) {
+		if m.snapshot == nil {
+			err = fn()
+			return
+		}
+
+		m.snapshot.labels = ctx
+		err = fn()
+		m.snapshot.labels = parent
+	})
+
+	if m.snapshot != nil {
+		m.snapshot.report.Phases = append(m.snapshot.report.Phases, PhaseTiming{
+			Phase:     phase,
+			Migration: mig,
+			Duration:  time.Since(start),
+		})
+	}
+
+	return err
+}
@@ -0,0 +1,39 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Reset reverts every applied migration, latest first, e.g. to tear down a test database. Nothing is reverted
+// if any of them can't be undone, regardless of Options.ForceDowngrade.
+func (m *henkaImpl) Reset() error {
+	return m.newRun(context.Background()).reset()
+}
+
+func (m *run) reset() error {
+	return m.inRun(func() error {
+		var plan []migration.Migration
+		var forced map[migration.Version]bool
+
+		err := m.phase(PhasePlan, migration.Migration{}, func() (err error) {
+			plan, forced, err = m.planDowngrade(0)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to plan reset: %w", err)
+		}
+
+		for _, mig := range plan {
+			if forced[mig.Version] {
+				return fmt.Errorf("failed to plan reset: %w", newMigrationError(ErrIrreversibleMigration, mig))
+			}
+		}
+
+		m.logger().Info("planned reset", "migrations", len(plan))
+
+		return m.execute(plan, migration.Down, nil)
+	})
+}
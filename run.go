@@ -0,0 +1,211 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+// runSnapshot caches what the engine has read during a single run, so that validating, planning
+// and executing don't list the source and the migrations log over and over. The applied state is
+// dropped after every migration the driver writes to the log.
+type runSnapshot struct {
+	available *[]migration.Description
+	applied   *map[migration.Version]migration.State
+
+	report RunReport
+	labels context.Context
+}
+
+// run is the state of a single call of the engine, so that calls made by several goroutines
+// don't share it. The engine itself only holds what outlives calls.
+type run struct {
+	*henkaImpl
+
+	// ctx is the context of the calls the engine makes to the source and the driver
+	ctx context.Context
+
+	// snapshot is set while inRun runs fn
+	snapshot *runSnapshot
+}
+
+func (m *henkaImpl) newRun(ctx context.Context) *run {
+	return &run{henkaImpl: m, ctx: ctx}
+}
+
+// inRun surrounds fn with BeginRun and EndRun of drivers that implement driver.RunScoper
+// and keeps a snapshot of the source and the migrations log while fn runs. The report of the run
+// is passed to Options.OnRunFinished.
+func (m *run) inRun(fn func() error) error {
+	_, err := m.inReportedRun(fn)
+	return err
+}
+
+// inReportedRun is inRun that also returns the report of the run.
+func (m *run) inReportedRun(fn func() error) (report RunReport, err error) {
+	start := time.Now()
+	m.snapshot = &runSnapshot{}
+
+	defer func() {
+		report = m.snapshot.report
+		report.Duration = time.Since(start)
+		report.Err = err
+		m.snapshot = nil
+
+		if err != nil {
+			m.logger().Error("migration run failed", "duration", report.Duration, "error", err)
+		} else {
+			m.logger().Info("migration run finished", "duration", report.Duration)
+		}
+
+		if m.options.OnRunFinished != nil {
+			m.options.OnRunFinished(report)
+		}
+	}()
+
+	var canceler driver.Canceler
+	if driver.As(m.driver, &canceler) && m.options.Shutdown != nil {
+		m.options.Shutdown.attach(canceler)
+		defer m.options.Shutdown.attach(nil)
+	}
+
+	var scoper driver.RunScoper
+	if driver.As(m.driver, &scoper) {
+		if err = scoper.BeginRun(); err != nil {
+			return report, fmt.Errorf("failed to begin migration run: %w", err)
+		}
+
+		defer func() {
+			if endErr := scoper.EndRun(); endErr != nil && err == nil {
+				err = fmt.Errorf("failed to end migration run: %w", endErr)
+			}
+		}()
+	}
+
+	var locker driver.Locker
+	if driver.As(m.driver, &locker) {
+		if err = locker.Lock(m.lockTimeout()); err != nil {
+			return report, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		defer func() {
+			if unlockErr := locker.Unlock(); unlockErr != nil && err == nil {
+				err = fmt.Errorf("failed to release migration lock: %w", unlockErr)
+			}
+		}()
+	}
+
+	return report, fn()
+}
+
+func (m *henkaImpl) lockTimeout() time.Duration {
+	if m.options.LockTimeout <= 0 {
+		return DefaultLockTimeout
+	}
+
+	return m.options.LockTimeout
+}
+
+// getAvailableMigrations lists the source once per run.
+func (m *run) getAvailableMigrations() (*[]migration.Description, error) {
+	if m.snapshot != nil && m.snapshot.available != nil {
+		return m.snapshot.available, nil
+	}
+
+	var available *[]migration.Description
+
+	err := m.phase(PhaseListSource, migration.Migration{}, func() (err error) {
+		available, err = listAvailableMigrations(m.ctx, m.source)
+		return err //nolint:wrapcheck
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger().Debug("listed available migrations", "count", len(*available))
+
+	if m.snapshot != nil {
+		m.snapshot.available = available
+	}
+
+	return available, nil
+}
+
+// walkAvailableMigrations walks the listing cached in the run snapshot if there is one and walks the source
+// lazily otherwise. Callers that are going to walk through the whole listing set cache, so that the listing
+// is kept in the snapshot for the rest of the run. With a custom ordering, the listing is sorted before walking.
+func (m *run) walkAvailableMigrations(cache bool, fn func(migration.Description) error) error {
+	if m.options.Ordering == nil && (m.snapshot == nil || (m.snapshot.available == nil && !cache)) {
+		return source2.Walk(m.source, fn) //nolint:wrapcheck
+	}
+
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	if m.options.Ordering != nil {
+		available = m.sortedDescriptions(available)
+	}
+
+	for _, descr := range *available {
+		if err = fn(descr); err != nil {
+			if errors.Is(err, source2.ErrStopWalk) {
+				return nil
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getAppliedMigrations loads the applied state once per run until a migration is applied.
+func (m *run) getAppliedMigrations() (*map[migration.Version]migration.State, error) {
+	if m.snapshot != nil && m.snapshot.applied != nil {
+		return m.snapshot.applied, nil
+	}
+
+	var applied *map[migration.Version]migration.State
+
+	err := m.phase(PhaseLoadLog, migration.Migration{}, func() (err error) {
+		applied, err = m.loadSortedMigrationsFromDB()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger().Debug("loaded migrations log", "versions", len(*applied))
+
+	if m.snapshot != nil {
+		m.snapshot.applied = applied
+	}
+
+	return applied, nil
+}
+
+// invalidateAppliedMigrations is called after the driver has written to the migrations log.
+func (m *run) invalidateAppliedMigrations() {
+	if m.snapshot != nil {
+		m.snapshot.applied = nil
+	}
+}
+
+func (m *henkaImpl) sortedDescriptions(available *[]migration.Description) *[]migration.Description {
+	sorted := make([]migration.Description, len(*available))
+	copy(sorted, *available)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return m.compareVersions(sorted[i].Version, sorted[j].Version) < 0
+	})
+
+	return &sorted
+}
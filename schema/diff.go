@@ -0,0 +1,127 @@
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff is the structural difference between two schemas, e.g. before and after an upgrade.
+type Diff struct {
+	AddedTables   []Table
+	DroppedTables []Table
+	ChangedTables []TableDiff
+}
+
+// TableDiff is the difference between two versions of a table.
+type TableDiff struct {
+	Name           string
+	AddedColumns   []Column
+	DroppedColumns []Column
+	ChangedColumns []ColumnChange
+}
+
+// ColumnChange is a column whose type, nullability or primary key membership has changed.
+type ColumnChange struct {
+	Before Column
+	After  Column
+}
+
+// Compare returns what has changed from before to after. Tables and columns are listed in the order of after,
+// dropped ones in the order of before.
+func Compare(before, after *Schema) Diff {
+	var diff Diff
+
+	for _, table := range after.Tables {
+		existing, exists := before.Table(table.Name)
+		if !exists {
+			diff.AddedTables = append(diff.AddedTables, table)
+			continue
+		}
+
+		if tableDiff := compareTables(existing, &table); !tableDiff.IsEmpty() {
+			diff.ChangedTables = append(diff.ChangedTables, tableDiff)
+		}
+	}
+
+	for _, table := range before.Tables {
+		if _, exists := after.Table(table.Name); !exists {
+			diff.DroppedTables = append(diff.DroppedTables, table)
+		}
+	}
+
+	return diff
+}
+
+func compareTables(before, after *Table) TableDiff {
+	diff := TableDiff{Name: after.Name}
+
+	for _, column := range after.Columns {
+		existing, exists := before.Column(column.Name)
+
+		switch {
+		case !exists:
+			diff.AddedColumns = append(diff.AddedColumns, column)
+		case *existing != column:
+			diff.ChangedColumns = append(diff.ChangedColumns, ColumnChange{Before: *existing, After: column})
+		}
+	}
+
+	for _, column := range before.Columns {
+		if _, exists := after.Column(column.Name); !exists {
+			diff.DroppedColumns = append(diff.DroppedColumns, column)
+		}
+	}
+
+	return diff
+}
+
+func (d Diff) IsEmpty() bool {
+	return len(d.AddedTables) == 0 && len(d.DroppedTables) == 0 && len(d.ChangedTables) == 0
+}
+
+func (d TableDiff) IsEmpty() bool {
+	return len(d.AddedColumns) == 0 && len(d.DroppedColumns) == 0 && len(d.ChangedColumns) == 0
+}
+
+// String lists the changes one per line, e.g. "+ table users" or "~ column users.name: varchar(50) -> varchar(100)".
+func (d Diff) String() string {
+	lines := make([]string, 0)
+
+	for _, table := range d.AddedTables {
+		lines = append(lines, "+ table "+table.Name)
+	}
+
+	for _, table := range d.DroppedTables {
+		lines = append(lines, "- table "+table.Name)
+	}
+
+	for _, table := range d.ChangedTables {
+		for _, column := range table.AddedColumns {
+			lines = append(lines, fmt.Sprintf("+ column %s.%s %s", table.Name, column.Name, describeColumn(column)))
+		}
+
+		for _, column := range table.DroppedColumns {
+			lines = append(lines, fmt.Sprintf("- column %s.%s", table.Name, column.Name))
+		}
+
+		for _, change := range table.ChangedColumns {
+			lines = append(lines, fmt.Sprintf("~ column %s.%s: %s -> %s",
+				table.Name, change.After.Name, describeColumn(change.Before), describeColumn(change.After)))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func describeColumn(column Column) string {
+	description := column.Type
+	if !column.Nullable {
+		description += " not null"
+	}
+
+	if column.PrimaryKey {
+		description += " primary key"
+	}
+
+	return description
+}
@@ -0,0 +1,47 @@
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/root-talis/henka/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	id := schema.Column{Name: "id", Type: "int", PrimaryKey: true}
+	name := schema.Column{Name: "name", Type: "varchar(50)", Nullable: true}
+	wideName := schema.Column{Name: "name", Type: "varchar(100)"}
+	age := schema.Column{Name: "age", Type: "int", Nullable: true}
+
+	before := schema.Schema{Tables: []schema.Table{
+		{Name: "users", Columns: []schema.Column{id, name, age}},
+		{Name: "sessions", Columns: []schema.Column{id}},
+	}}
+	after := schema.Schema{Tables: []schema.Table{
+		{Name: "users", Columns: []schema.Column{id, wideName, {Name: "email", Type: "varchar(255)"}}},
+		{Name: "orders", Columns: []schema.Column{id}},
+	}}
+
+	diff := schema.Compare(&before, &after)
+
+	assert.Equal(t, schema.Diff{
+		AddedTables:   []schema.Table{after.Tables[1]},
+		DroppedTables: []schema.Table{before.Tables[1]},
+		ChangedTables: []schema.TableDiff{{
+			Name:           "users",
+			AddedColumns:   []schema.Column{{Name: "email", Type: "varchar(255)"}},
+			DroppedColumns: []schema.Column{age},
+			ChangedColumns: []schema.ColumnChange{{Before: name, After: wideName}},
+		}},
+	}, diff)
+
+	assert.Equal(t, "+ table orders\n"+
+		"- table sessions\n"+
+		"+ column users.email varchar(255) not null\n"+
+		"- column users.age\n"+
+		"~ column users.name: varchar(50) -> varchar(100) not null", diff.String())
+
+	assert.True(t, schema.Compare(&before, &before).IsEmpty())
+}
@@ -0,0 +1,43 @@
+package schema
+
+// Schema is a structural description of database tables, as far as migrations are concerned.
+type Schema struct {
+	Tables []Table
+}
+
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+type Column struct {
+	Name string
+
+	// Type is the column type as reported by the database, e.g. "varchar(100)" or "bigint unsigned".
+	Type string
+
+	Nullable   bool
+	PrimaryKey bool
+}
+
+// Table returns a table by its name.
+func (s *Schema) Table(name string) (*Table, bool) {
+	for i := range s.Tables {
+		if s.Tables[i].Name == name {
+			return &s.Tables[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// Column returns a column by its name.
+func (t *Table) Column(name string) (*Column, bool) {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i], true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,118 @@
+package henka
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+)
+
+var ErrInterrupted = errors.New("migration run was interrupted")
+
+// Shutdown stops runs of the engine it is passed to with WithShutdown. Stop lets the migration that is being
+// applied finish and prevents the next ones from starting. Cancel aborts the migration that is being applied
+// as well, if the driver implements driver.Canceler. In both cases the run returns an error that wraps
+// ErrInterrupted, and the run is ended normally, so that locks and connections are released.
+type Shutdown struct {
+	mutex    sync.Mutex
+	stopped  bool
+	canceled bool
+	canceler driver.Canceler
+}
+
+func NewShutdown() *Shutdown {
+	return &Shutdown{}
+}
+
+// Stop prevents migrations that have not started yet from starting.
+func (s *Shutdown) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+}
+
+// Cancel stops the run and aborts the migration that is being applied.
+func (s *Shutdown) Cancel() error {
+	s.mutex.Lock()
+	s.stopped = true
+	s.canceled = true
+	canceler := s.canceler
+	s.mutex.Unlock()
+
+	if canceler == nil {
+		return nil
+	}
+
+	return canceler.CancelMigration() //nolint:wrapcheck
+}
+
+func (s *Shutdown) isStopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stopped
+}
+
+func (s *Shutdown) isCanceled() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.canceled
+}
+
+// attach makes Cancel reach the driver while a run is in progress. Nil detaches it.
+func (s *Shutdown) attach(canceler driver.Canceler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.canceler = canceler
+}
+
+// HandleSignals stops the shutdown on the first of signals, SIGINT and SIGTERM if none are given.
+// The migration that is being applied is canceled when grace elapses or when a second signal arrives.
+// The returned function stops handling signals.
+func HandleSignals(s *Shutdown, grace time.Duration, signals ...os.Signal) (release func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	received := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(received, signals...)
+
+	go func() {
+		select {
+		case <-received:
+			s.Stop()
+		case <-done:
+			return
+		}
+
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-received:
+		case <-timer.C:
+		case <-done:
+			return
+		}
+
+		_ = s.Cancel()
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,16 @@
+//go:build go1.21
+
+package henka
+
+import "log/slog"
+
+var _ Logger = (*slog.Logger)(nil)
+
+// WithSlog makes the engine log to logger, or to slog.Default() if it is nil.
+func WithSlog(logger *slog.Logger) Option {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return WithLogger(logger)
+}
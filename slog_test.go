@@ -0,0 +1,29 @@
+//go:build go1.21
+
+package henka_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/migration"
+)
+
+func TestWithSlog(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[0]},
+	}}
+	drv := driverMock{}
+	output := bytes.Buffer{}
+
+	logger := slog.New(slog.NewTextHandler(&output, nil))
+
+	assert.NoError(t, henka.New(&src, &drv, henka.WithSlog(logger)).UpgradeAll())
+	assert.Contains(t, output.String(), `msg="applied migration" version=20210124131258 name=initial_structure direction=up`)
+}
@@ -0,0 +1,63 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
+)
+
+var ErrSchemaSnapshotsNotSupported = errors.New("driver can't dump database schema")
+
+// withSchemaSnapshots runs fn between two dumps of the schema and puts their difference into the report
+// of the run when Options.SchemaSnapshots is set. The difference is reported when fn fails as well,
+// so that it shows what a failed upgrade has left behind.
+func (m *run) withSchemaSnapshots(fn func() error) error {
+	if !m.options.SchemaSnapshots {
+		return fn()
+	}
+
+	var dumper driver.SchemaDumper
+	if !driver.As(m.driver, &dumper) {
+		return fmt.Errorf("%w: %T", ErrSchemaSnapshotsNotSupported, m.driver)
+	}
+
+	before, err := m.snapshotSchema(dumper)
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	after, snapshotErr := m.snapshotSchema(dumper)
+	if snapshotErr != nil {
+		if err == nil {
+			err = snapshotErr
+		}
+
+		return err
+	}
+
+	if m.snapshot != nil {
+		diff := schema.Compare(before, after)
+		m.snapshot.report.SchemaDiff = &diff
+	}
+
+	return err
+}
+
+func (m *run) snapshotSchema(dumper driver.SchemaDumper) (*schema.Schema, error) {
+	var snapshot *schema.Schema
+
+	err := m.phase(PhaseSnapshotSchema, migration.Migration{}, func() (err error) {
+		snapshot, err = dumper.DumpSchema()
+		return err //nolint:wrapcheck
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to take schema snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
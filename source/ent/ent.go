@@ -0,0 +1,288 @@
+package ent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+const (
+	sumFileName     = "atlas.sum"
+	scriptExtension = ".sql"
+	hashPrefix      = "h1:"
+)
+
+// Config controls how ent's migrations directory is read.
+type Config struct {
+	// SkipChecksumVerification disables verification of migration files against atlas.sum.
+	SkipChecksumVerification bool
+}
+
+type entSource struct {
+	migrationsDir string
+	fs            fs.FS
+	config        Config
+}
+
+var (
+	ErrMigrationsDirectoryIsNotADirectory = errors.New("migrationsDirectory is not a directory")
+	ErrDownMigrationsNotSupported         = errors.New("ent versioned migrations can't be reverted")
+	ErrChecksumFileMissing                = errors.New("atlas.sum is missing")
+	ErrChecksumFileInvalid                = errors.New("atlas.sum is invalid")
+	ErrChecksumMismatch                   = errors.New("migration files don't match atlas.sum")
+)
+
+// NewEntSource creates a source that reads versioned migrations generated by ent (atlas format):
+// "<timestamp>_<name>.sql" files accompanied by an atlas.sum integrity file.
+// Unless disabled in config, the files are verified against atlas.sum every time they are listed or read.
+// Atlas migrations are forward-only, so none of the migrations can be undone.
+func NewEntSource(fileSystem fs.FS, migrationsDirectory string, config Config) (source.Source, error) {
+	stat, err := fs.Stat(fileSystem, migrationsDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat migrations directory: %w", err)
+	}
+
+	if !stat.IsDir() {
+		return nil, ErrMigrationsDirectoryIsNotADirectory
+	}
+
+	return &entSource{
+		migrationsDir: migrationsDirectory,
+		fs:            fileSystem,
+		config:        config,
+	}, nil
+}
+
+func (src *entSource) GetAvailableMigrations() (*[]migration.Description, error) {
+	fileNames, err := src.listScripts()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = src.verify(fileNames); err != nil {
+		return nil, err
+	}
+
+	result := make([]migration.Description, 0, len(fileNames))
+	for _, fileName := range fileNames {
+		mig, ok := parseFileName(fileName)
+		if !ok {
+			continue
+		}
+
+		if len(result) > 0 && result[len(result)-1].Version == mig.Version {
+			return nil, fmt.Errorf(
+				"%w: version %d has conflicting names: \"%s\" and \"%s\"",
+				source.ErrMigrationDuplicated,
+				mig.Version,
+				result[len(result)-1].Name,
+				mig.Name,
+			)
+		}
+
+		result = append(result, migration.Description{Migration: mig})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return &result, nil
+}
+
+func (src *entSource) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	if direction != migration.Up {
+		return nil, fmt.Errorf("%w: %d_%s", ErrDownMigrationsNotSupported, mig.Version, mig.Name)
+	}
+
+	fileNames, err := src.listScripts()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = src.verify(fileNames); err != nil {
+		return nil, err
+	}
+
+	for _, fileName := range fileNames {
+		if parsed, ok := parseFileName(fileName); ok && parsed == mig {
+			script, err := fs.ReadFile(src.fs, path.Join(src.migrationsDir, fileName))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+			}
+
+			return bytes.NewReader(script), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %d_%s", source.ErrMigrationNotFound, mig.Version, mig.Name)
+}
+
+// listScripts returns names of all .sql files in lexicographic order, which is the order atlas hashes them in.
+func (src *entSource) listScripts() ([]string, error) {
+	dirEntries, err := fs.ReadDir(src.fs, src.migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contents of migrations directory: %w", err)
+	}
+
+	result := make([]string, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), scriptExtension) {
+			result = append(result, entry.Name())
+		}
+	}
+
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// verify checks the files against atlas.sum the same way atlas does: every file name and contents
+// are fed into a running sha256 hash, which is recorded after each file, and the first line holds
+// a hash over all of the recorded names and hashes.
+func (src *entSource) verify(fileNames []string) error {
+	if src.config.SkipChecksumVerification {
+		return nil
+	}
+
+	expected, err := src.readSumFile()
+	if err != nil {
+		return err
+	}
+
+	actual := make([]fileHash, 0, len(fileNames))
+	running := sha256.New()
+
+	for _, fileName := range fileNames {
+		contents, err := fs.ReadFile(src.fs, path.Join(src.migrationsDir, fileName))
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		running.Write([]byte(fileName))
+		running.Write(contents)
+
+		actual = append(actual, fileHash{
+			name: fileName,
+			hash: base64.StdEncoding.EncodeToString(running.Sum(nil)),
+		})
+	}
+
+	return compareHashes(expected, actual)
+}
+
+type fileHash struct {
+	name string
+	hash string
+}
+
+type sumFile struct {
+	sum   string
+	files []fileHash
+}
+
+func (src *entSource) readSumFile() (*sumFile, error) {
+	contents, err := fs.ReadFile(src.fs, path.Join(src.migrationsDir, sumFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrChecksumFileMissing
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sumFileName, err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	result := sumFile{}
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if lineNo == 1 {
+			if !strings.HasPrefix(line, hashPrefix) {
+				return nil, fmt.Errorf("%w: first line must contain the directory hash", ErrChecksumFileInvalid)
+			}
+
+			result.sum = strings.TrimPrefix(line, hashPrefix)
+			continue
+		}
+
+		separator := strings.LastIndex(line, " "+hashPrefix)
+		if separator <= 0 {
+			return nil, fmt.Errorf("%w: line %d is malformed", ErrChecksumFileInvalid, lineNo)
+		}
+
+		result.files = append(result.files, fileHash{
+			name: line[:separator],
+			hash: line[separator+len(hashPrefix)+1:],
+		})
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", sumFileName, err)
+	}
+
+	return &result, nil
+}
+
+func compareHashes(expected *sumFile, actual []fileHash) error {
+	total := sha256.New()
+	for _, file := range expected.files {
+		total.Write([]byte(file.name))
+		total.Write([]byte(file.hash))
+	}
+
+	if base64.StdEncoding.EncodeToString(total.Sum(nil)) != expected.sum {
+		return fmt.Errorf("%w: %s has been edited manually", ErrChecksumMismatch, sumFileName)
+	}
+
+	if len(expected.files) != len(actual) {
+		return fmt.Errorf("%w: %d files are listed in %s, but %d files are present",
+			ErrChecksumMismatch, len(expected.files), sumFileName, len(actual))
+	}
+
+	for i := range actual {
+		if expected.files[i].name != actual[i].name {
+			return fmt.Errorf("%w: expected %s, found %s", ErrChecksumMismatch, expected.files[i].name, actual[i].name)
+		}
+
+		if expected.files[i].hash != actual[i].hash {
+			return fmt.Errorf("%w: %s has been changed", ErrChecksumMismatch, actual[i].name)
+		}
+	}
+
+	return nil
+}
+
+// parseFileName splits "20210124131258_init.sql" into a version and a name.
+func parseFileName(fileName string) (migration.Migration, bool) {
+	name := strings.TrimSuffix(fileName, scriptExtension)
+
+	separator := strings.IndexByte(name, '_')
+	if separator <= 0 || separator == len(name)-1 {
+		return migration.Migration{}, false
+	}
+
+	version, err := strconv.ParseUint(name[:separator], 10, migration.VersionBits)
+	if err != nil {
+		return migration.Migration{}, false
+	}
+
+	return migration.Migration{
+		Version: migration.Version(version),
+		Name:    name[separator+1:],
+	}, true
+}
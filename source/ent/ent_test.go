@@ -0,0 +1,155 @@
+package ent_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source/ent"
+)
+
+// makeSumFile builds atlas.sum contents for the given files the way `atlas migrate hash` does.
+func makeSumFile(files map[string]string) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	running := sha256.New()
+	total := sha256.New()
+	lines := strings.Builder{}
+
+	for _, name := range names {
+		running.Write([]byte(name))
+		running.Write([]byte(files[name]))
+		hash := base64.StdEncoding.EncodeToString(running.Sum(nil))
+
+		total.Write([]byte(name))
+		total.Write([]byte(hash))
+		lines.WriteString(fmt.Sprintf("%s h1:%s\n", name, hash))
+	}
+
+	return fmt.Sprintf("h1:%s\n%s", base64.StdEncoding.EncodeToString(total.Sum(nil)), lines.String())
+}
+
+func makeFS(files map[string]string, sum string) fstest.MapFS {
+	result := fstest.MapFS{"migrations": {Mode: fs.ModeDir}}
+	for name, contents := range files {
+		result["migrations/"+name] = &fstest.MapFile{Data: []byte(contents)}
+	}
+
+	if sum != "" {
+		result["migrations/atlas.sum"] = &fstest.MapFile{Data: []byte(sum)}
+	}
+
+	return result
+}
+
+var scripts = map[string]string{ // nolint:gochecknoglobals
+	"20220101120000_create_users.sql": "CREATE TABLE users (id bigint);\n",
+	"20220102120000_create_pets.sql":  "CREATE TABLE pets (id bigint);\n",
+}
+
+func TestGetAvailableMigrations(t *testing.T) {
+	t.Parallel()
+
+	src, err := ent.NewEntSource(makeFS(scripts, makeSumFile(scripts)), "migrations", ent.Config{})
+	assert.NoError(t, err)
+
+	migrations, err := src.GetAvailableMigrations()
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Description{
+		{Migration: migration.Migration{Version: 20220101120000, Name: "create_users"}},
+		{Migration: migration.Migration{Version: 20220102120000, Name: "create_pets"}},
+	}, *migrations)
+
+	reader, err := src.ReadMigration(migration.Migration{Version: 20220102120000, Name: "create_pets"}, migration.Up)
+	assert.NoError(t, err)
+	script, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, scripts["20220102120000_create_pets.sql"], string(script))
+
+	_, err = src.ReadMigration(migration.Migration{Version: 20220102120000, Name: "create_pets"}, migration.Down)
+	assert.ErrorIs(t, err, ent.ErrDownMigrationsNotSupported)
+}
+
+var verificationTests = []struct { // nolint:gochecknoglobals
+	name          string
+	files         map[string]string
+	sum           string
+	config        ent.Config
+	expectedError error
+}{
+	/* e0 */ {
+		name: "e0: should fail if a file was changed",
+		files: map[string]string{
+			"20220101120000_create_users.sql": "CREATE TABLE users (id int);\n",
+			"20220102120000_create_pets.sql":  scripts["20220102120000_create_pets.sql"],
+		},
+		sum:           makeSumFile(scripts),
+		expectedError: ent.ErrChecksumMismatch,
+	},
+	/* e1 */ {
+		name: "e1: should fail if a file was added",
+		files: map[string]string{
+			"20220101120000_create_users.sql": scripts["20220101120000_create_users.sql"],
+			"20220101130000_hotfix.sql":       "ALTER TABLE users ADD name text;\n",
+			"20220102120000_create_pets.sql":  scripts["20220102120000_create_pets.sql"],
+		},
+		sum:           makeSumFile(scripts),
+		expectedError: ent.ErrChecksumMismatch,
+	},
+	/* e2 */ {
+		name:          "e2: should fail if atlas.sum was edited",
+		files:         scripts,
+		sum:           strings.Replace(makeSumFile(scripts), "create_pets.sql h1:", "create_pets.sql h1:x", 1),
+		expectedError: ent.ErrChecksumMismatch,
+	},
+	/* e3 */ {
+		name:          "e3: should fail if atlas.sum is missing",
+		files:         scripts,
+		expectedError: ent.ErrChecksumFileMissing,
+	},
+	/* e4 */ {
+		name:          "e4: should fail if atlas.sum is malformed",
+		files:         scripts,
+		sum:           "20220101120000_create_users.sql h1:abc\n",
+		expectedError: ent.ErrChecksumFileInvalid,
+	},
+	/* s0 */ {
+		name:   "s0: should not verify anything if verification is disabled",
+		files:  scripts,
+		config: ent.Config{SkipChecksumVerification: true},
+	},
+}
+
+func TestChecksumVerification(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range verificationTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src, err := ent.NewEntSource(makeFS(test.files, test.sum), "migrations", test.config)
+			assert.NoError(t, err)
+
+			_, err = src.GetAvailableMigrations()
+			if test.expectedError != nil {
+				assert.ErrorIs(t, err, test.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
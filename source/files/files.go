@@ -1,12 +1,13 @@
 package files
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/root-talis/henka/migration"
@@ -16,16 +17,30 @@ import (
 type filesSource struct {
 	migrationsDir string
 	fs            fs.FS
+	versions      VersionParser
 }
 
-const versionLength = 14
+// Option configures the files source.
+type Option func(*filesSource)
+
+// WithVersionParser sets the format of versions in file names, TimestampVersions by default.
+func WithVersionParser(versions VersionParser) Option {
+	return func(rdr *filesSource) {
+		rdr.versions = versions
+	}
+}
+
+const (
+	upSuffix   = ".up.hmf"
+	downSuffix = ".down.hmf"
+)
 
 var (
 	ErrMigrationsDirectoryIsNotADirectory = errors.New("migrationsDirectory is not a directory")
 	ErrMigrationFileNameIsInvalid         = errors.New("migration file name is invalid")
 )
 
-func NewFilesSource(fileSystem fs.FS, migrationsDirectory string) (source.Source, error) {
+func NewFilesSource(fileSystem fs.FS, migrationsDirectory string, opts ...Option) (source.Source, error) {
 	stat, err := fs.Stat(fileSystem, migrationsDirectory)
 
 	if err != nil {
@@ -36,138 +51,147 @@ func NewFilesSource(fileSystem fs.FS, migrationsDirectory string) (source.Source
 		return nil, ErrMigrationsDirectoryIsNotADirectory
 	}
 
-	return &filesSource{
-		migrationsDir: migrationsDirectory,
-		fs:            fileSystem,
-	}, nil
+	return newFilesSource(fileSystem, migrationsDirectory, opts), nil
 }
 
-func (rdr *filesSource) GetAvailableMigrations() (*[]migration.Description, error) {
-	dirEntries, err := fs.ReadDir(rdr.fs, rdr.migrationsDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read contents of migrations directory: %w", err)
+func newFilesSource(fileSystem fs.FS, migrationsDirectory string, opts []Option) *filesSource {
+	rdr := &filesSource{
+		migrationsDir: migrationsDirectory,
+		fs:            fileSystem,
+		versions:      TimestampVersions,
 	}
 
-	// find all suitable migrations and build a collection of descriptions
-	migrations := make(versionMap)
-	for _, entry := range dirEntries {
-		if entry.IsDir() || !entry.Type().IsRegular() {
-			continue
-		}
+	for _, opt := range opts {
+		opt(rdr)
+	}
 
-		fileName := entry.Name()
-		mig, err := getValidMigrationFromFileName(fileName)
-		if err != nil {
-			continue
-		}
+	return rdr
+}
 
-		if strings.HasSuffix(fileName, ".up.hmf") {
-			err = migrations.updateDescription(mig, migration.Up)
-		} else if strings.HasSuffix(fileName, ".down.hmf") {
-			err = migrations.updateDescription(mig, migration.Down)
-		}
+func (rdr *filesSource) GetAvailableMigrations() (*[]migration.Description, error) {
+	result := make([]migration.Description, 0)
 
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse directory entries: %w", err)
-		}
+	err := rdr.WalkAvailableMigrations(func(descr migration.Description) error {
+		result = append(result, descr)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	keys := getSortedVersions(migrations)
-	result := buildMigrationsSlice(keys, migrations)
-
 	return &result, nil
 }
 
-func getSortedVersions(migrations versionMap) []int {
-	keys := make([]int, 0, len(migrations))
+// WalkAvailableMigrations groups script files by version. With fixed-length versions fs.ReadDir already
+// returns them in version order; files of other version formats are sorted first.
+func (rdr *filesSource) WalkAvailableMigrations(fn func(migration.Description) error) error {
+	listed, err := rdr.listFiles()
+	if err != nil {
+		return err
+	}
 
-	for k := range migrations {
-		keys = append(keys, int(k))
+	byVersion := func(i, j int) bool { return listed[i].Migration.Version < listed[j].Migration.Version }
+	if !sort.SliceIsSorted(listed, byVersion) {
+		sort.SliceStable(listed, byVersion)
 	}
 
-	sort.Ints(keys)
+	var current migration.Description
+	hasCurrent := false
 
-	return keys
-}
+	for _, file := range listed {
+		mig, direction := file.Migration, file.Direction
 
-func buildMigrationsSlice(keys []int, migrations versionMap) []migration.Description {
-	result := make([]migration.Description, len(keys))
-	for i, k := range keys {
-		result[i] = migrations[migration.Version(k)]
-	}
-	return result
-}
+		switch {
+		case hasCurrent && current.Version != mig.Version:
+			if err = fn(current); err != nil {
+				return err
+			}
 
-type versionMap map[migration.Version]migration.Description
+			current = migration.Description{Migration: mig, CanUndo: direction == migration.Down}
 
-func (m *versionMap) updateDescription(mig migration.Migration, direction migration.Direction) error {
-	version, exists := (*m)[mig.Version]
+		case !hasCurrent:
+			current = migration.Description{Migration: mig, CanUndo: direction == migration.Down}
+			hasCurrent = true
 
-	switch {
-	case !exists:
-		(*m)[mig.Version] = migration.Description{
-			Migration: mig,
-			CanUndo:   direction == migration.Down,
-		}
+		case current.Name != mig.Name:
+			return fmt.Errorf(
+				"failed to parse directory entries: %w: version %d has conflicting names: \"%s\" and \"%s\"",
+				source.ErrMigrationDuplicated,
+				mig.Version,
+				current.Name,
+				mig.Name,
+			)
 
-	case version.Name != mig.Name:
-		return fmt.Errorf(
-			"%w: version %d has conflicting names: \"%s\" and \"%s\"",
-			source.ErrMigrationDuplicated,
-			mig.Version,
-			version.Name,
-			mig.Name,
-		)
+		case direction == migration.Down:
+			current.CanUndo = true
+		}
+	}
 
-	// IDK how to get this case to show up in coverage.
-	// It would only be reached if file names are fetched from FS in reverse order.
-	case direction == migration.Down:
-		version.CanUndo = true
-		(*m)[mig.Version] = version
+	if hasCurrent {
+		return fn(current)
 	}
 
 	return nil
 }
 
-func getValidMigrationFromFileName(fileName string) (migration.Migration, error) {
-	if !strings.HasPrefix(fileName, "V") {
-		return migration.Migration{}, fmt.Errorf("%w: %s", ErrMigrationFileNameIsInvalid, fileName)
+func getDirectionFromFileName(fileName string) (migration.Direction, bool) {
+	switch {
+	case strings.HasSuffix(fileName, upSuffix):
+		return migration.Up, true
+	case strings.HasSuffix(fileName, downSuffix):
+		return migration.Down, true
+	default:
+		return 0, false
 	}
+}
 
-	migrationFullName := strings.TrimPrefix(fileName, "V")
-	migrationFullName = strings.TrimSuffix(migrationFullName, ".up.hmf")
-	migrationFullName = strings.TrimSuffix(migrationFullName, ".down.hmf")
-
-	asRunes := []rune(migrationFullName)
+// getValidMigrationFromFileName parses "V<version>_<name>.up.hmf" and "V<version>_<name>.down.hmf"
+// in a single pass. The name is sliced from fileName, so valid names are parsed without allocations.
+func getValidMigrationFromFileName(fileName string, versions VersionParser) (migration.Migration, error) {
+	end := len(fileName)
+	switch {
+	case strings.HasSuffix(fileName, upSuffix):
+		end -= len(upSuffix)
+	case strings.HasSuffix(fileName, downSuffix):
+		end -= len(downSuffix)
+	}
 
-	if len(asRunes) < versionLength+1 {
-		return migration.Migration{}, fmt.Errorf("%w: %s is too short", ErrMigrationFileNameIsInvalid, fileName)
+	if end == 0 || fileName[0] != 'V' {
+		return migration.Migration{}, fmt.Errorf("%w: %s", ErrMigrationFileNameIsInvalid, fileName)
 	}
 
-	version := asRunes[:versionLength]
-	v := string(version)
-	versionAsInt, err := strconv.ParseUint(v, 0, migration.VersionBits)
-	if err != nil {
-		return migration.Migration{}, fmt.Errorf("%w: %s does not contain a valid version", ErrMigrationFileNameIsInvalid, fileName)
+	separator := strings.IndexByte(fileName[:end], '_')
+	if separator < 0 {
+		return migration.Migration{}, fmt.Errorf("%w: %s is missing an underscore after version",
+			ErrMigrationFileNameIsInvalid, fileName)
 	}
 
-	nameAsRunes := asRunes[versionLength:]
-	if nameAsRunes[0] != '_' {
-		return migration.Migration{}, fmt.Errorf("%w: %s is missing an underscore after version (%c given)",
-			ErrMigrationFileNameIsInvalid, fileName, nameAsRunes[0])
+	version, err := versions.ParseVersion(fileName[1:separator])
+	if err != nil {
+		return migration.Migration{}, fmt.Errorf("%w: %s does not contain a valid version: %s",
+			ErrMigrationFileNameIsInvalid, fileName, err.Error())
 	}
 
-	name := strings.TrimPrefix(string(nameAsRunes), "_")
-	if len(name) == 0 {
+	if end == separator+1 {
 		return migration.Migration{}, fmt.Errorf("%w: %s is missing name section", ErrMigrationFileNameIsInvalid, fileName)
 	}
 
 	return migration.Migration{
-		Version: migration.Version(versionAsInt),
-		Name:    name,
+		Version: version,
+		Name:    fileName[separator+1 : end],
 	}, nil
 }
 
-func (rdr *filesSource) ReadMigration(migration migration.Migration, direction migration.Direction) (io.Reader, error) {
-	return nil, nil
+func (rdr *filesSource) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	fileName := rdr.fileName(mig, direction)
+
+	script, err := fs.ReadFile(rdr.fs, path.Join(rdr.migrationsDir, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", source.ErrMigrationNotFound, fileName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+	}
+
+	return bytes.NewReader(script), nil
 }
@@ -1,6 +1,8 @@
 package files_test
 
 import (
+	"fmt"
+	"io"
 	"io/fs"
 	"testing"
 	"testing/fstest"
@@ -8,6 +10,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
 	"github.com/root-talis/henka/source/files"
 )
 
@@ -287,3 +290,376 @@ func TestGetAvailableMigrations(t *testing.T) {
 		})
 	}
 }
+
+var readMigrationTestTable = []struct { // nolint:gochecknoglobals
+	name           string
+	migration      migration.Migration
+	direction      migration.Direction
+	expectError    bool
+	expectedScript string
+}{
+	/* s0 */ {
+		name:           "s0: should read up script",
+		migration:      migration.Migration{Version: 20211224091800, Name: "add_users_table"},
+		direction:      migration.Up,
+		expectedScript: "CREATE TABLE users (id int);",
+	},
+	/* s1 */ {
+		name:           "s1: should read down script",
+		migration:      migration.Migration{Version: 20211224091800, Name: "add_users_table"},
+		direction:      migration.Down,
+		expectedScript: "DROP TABLE users;",
+	},
+	/* e0 */ {
+		name:        "e0: should fail when down script does not exist",
+		migration:   migration.Migration{Version: 20211224081255, Name: "initial"},
+		direction:   migration.Down,
+		expectError: true,
+	},
+	/* e1 */ {
+		name:        "e1: should fail when name does not match",
+		migration:   migration.Migration{Version: 20211224091800, Name: "add_user_table"},
+		direction:   migration.Up,
+		expectError: true,
+	},
+}
+
+func TestReadMigration(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should correctly read migration scripts.")
+
+	src, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20211224081255_initial.up.hmf":           {},
+		"migrations/V20211224091800_add_users_table.down.hmf": {Data: []byte("DROP TABLE users;")},
+		"migrations/V20211224091800_add_users_table.up.hmf":   {Data: []byte("CREATE TABLE users (id int);")},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, test := range readMigrationTestTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := src.ReadMigration(test.migration, test.direction)
+
+			if test.expectError {
+				assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				script, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedScript, string(script))
+			}
+		})
+	}
+}
+
+func TestWalkAvailableMigrations(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should walk migrations in order and stop when asked to.")
+
+	src, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20211224081255_initial.up.hmf":           {},
+		"migrations/V20211224091800_add_users_table.down.hmf": {},
+		"migrations/V20211224091800_add_users_table.up.hmf":   {},
+		"migrations/V20211224101800_add_roles_table.up.hmf":   {},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	walker, ok := src.(source.Walker)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	visited := make([]migration.Description, 0)
+	err = source.Walk(src, func(descr migration.Description) error {
+		visited = append(visited, descr)
+		if descr.Version >= 20211224091800 {
+			return source.ErrStopWalk
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Description{
+		{Migration: migration.Migration{Version: 20211224081255, Name: "initial"}, CanUndo: false},
+		{Migration: migration.Migration{Version: 20211224091800, Name: "add_users_table"}, CanUndo: true},
+	}, visited)
+
+	err = walker.WalkAvailableMigrations(func(migration.Description) error {
+		return source.ErrStopWalk
+	})
+	assert.ErrorIs(t, err, source.ErrStopWalk)
+}
+
+func TestMigrationTags(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should read tags from the header of up scripts.")
+
+	src, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20211224081255_initial.up.hmf": {Data: []byte("CREATE TABLE users (id int);\n-- tags: late")},
+		"migrations/V20211224091800_add_users.up.hmf": {
+			Data: []byte("-- Seeds users.\n-- tags: seed, test-data\n\n-- tags: prod-only,\nINSERT INTO users VALUES (1);"),
+		},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tagger, ok := src.(source.Tagger)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	tags, err := tagger.MigrationTags(migration.Migration{Version: 20211224081255, Name: "initial"})
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	tags, err = tagger.MigrationTags(migration.Migration{Version: 20211224091800, Name: "add_users"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"seed", "test-data", "prod-only"}, tags)
+
+	_, err = tagger.MigrationTags(migration.Migration{Version: 20211224101800, Name: "add_roles"})
+	assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+}
+
+func TestMigrationDependencies(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should read dependencies from the header of up scripts.")
+
+	src, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20211224081255_initial.up.hmf": {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/V20211224091800_add_users.up.hmf": {
+			Data: []byte("-- depends: 20211224081255\n-- tags: seed\n-- depends: 20211224101800\nINSERT INTO users VALUES (1);"),
+		},
+		"migrations/V20211224101800_add_roles.up.hmf": {Data: []byte("-- depends: latest\nCREATE TABLE roles (id int);")},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	reader, ok := src.(source.DependencyReader)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	dependencies, err := reader.MigrationDependencies(migration.Migration{Version: 20211224081255, Name: "initial"})
+	assert.NoError(t, err)
+	assert.Empty(t, dependencies)
+
+	dependencies, err = reader.MigrationDependencies(migration.Migration{Version: 20211224091800, Name: "add_users"})
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Version{20211224081255, 20211224101800}, dependencies)
+
+	_, err = reader.MigrationDependencies(migration.Migration{Version: 20211224101800, Name: "add_roles"})
+	assert.Error(t, err)
+}
+
+// listedFS serves a prepared directory listing, so that benchmarks measure parsing rather than fstest.MapFS.
+type listedFS struct {
+	fstest.MapFS
+	entries []fs.DirEntry
+}
+
+func (f listedFS) ReadDir(string) ([]fs.DirEntry, error) {
+	return f.entries, nil
+}
+
+func makeListedFS(count int) listedFS {
+	dir := fstest.MapFS{"migrations": {Mode: fs.ModeDir}}
+	files := fstest.MapFS{}
+
+	for i := 0; i < count; i++ {
+		files[fmt.Sprintf("V%014d_migration_number_%d.down.hmf", 20210000000000+i, i)] = &fstest.MapFile{}
+		files[fmt.Sprintf("V%014d_migration_number_%d.up.hmf", 20210000000000+i, i)] = &fstest.MapFile{}
+	}
+
+	entries, _ := files.ReadDir(".")
+
+	return listedFS{MapFS: dir, entries: entries}
+}
+
+func BenchmarkWalkAvailableMigrations(b *testing.B) {
+	src, err := files.NewFilesSource(makeListedFS(5000), "migrations")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	walker, _ := src.(source.Walker)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err = walker.WalkAvailableMigrations(func(migration.Description) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetAvailableMigrations(b *testing.B) {
+	src, err := files.NewFilesSource(makeListedFS(5000), "migrations")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err = src.GetAvailableMigrations(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRepeatableMigrations(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should list and read repeatable migrations apart from versioned ones.")
+
+	src, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/R__views.hmf":                   {Data: []byte("CREATE OR REPLACE VIEW v AS SELECT 1;")},
+		"migrations/R__procedures.hmf":              {},
+		"migrations/R__.hmf":                        {},
+		"migrations/V20211224081255_initial.up.hmf": {},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	repeatable, ok := src.(source.RepeatableSource)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	names, err := repeatable.ListRepeatableMigrations()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"procedures", "views"}, names)
+
+	reader, err := repeatable.ReadRepeatableMigration("views")
+	if assert.NoError(t, err) {
+		script, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "CREATE OR REPLACE VIEW v AS SELECT 1;", string(script))
+	}
+
+	_, err = repeatable.ReadRepeatableMigration("triggers")
+	assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+
+	available, err := src.GetAvailableMigrations()
+	assert.NoError(t, err)
+	assert.Len(t, *available, 1)
+}
+
+var versionParsersTestTable = []struct { // nolint:gochecknoglobals
+	name               string
+	versions           files.VersionParser
+	fs                 fstest.MapFS
+	expectedMigrations []migration.Description
+	expectedFileName   string
+}{
+	/* s0 */ {
+		name:     "s0: should list zero-padded versions of custom length",
+		versions: files.FixedLengthVersions(4),
+		fs: fstest.MapFS{
+			"migrations":                    {Mode: fs.ModeDir},
+			"migrations/V0001_init.up.hmf":  {},
+			"migrations/V0002_users.up.hmf": {},
+			"migrations/V002_short.up.hmf":  {},
+			"migrations/V00003_long.up.hmf": {},
+		},
+		expectedMigrations: []migration.Description{
+			{Migration: migration.Migration{Version: 1, Name: "init"}},
+			{Migration: migration.Migration{Version: 2, Name: "users"}},
+		},
+		expectedFileName: "V0002_users.up.hmf",
+	},
+	/* s1 */ {
+		name:     "s1: should list sequential versions in numeric order",
+		versions: files.SequentialVersions{},
+		fs: fstest.MapFS{
+			"migrations":                        {Mode: fs.ModeDir},
+			"migrations/V1_init.up.hmf":         {},
+			"migrations/V10_roles.down.hmf":     {},
+			"migrations/V10_roles.up.hmf":       {},
+			"migrations/V2_users.up.hmf":        {},
+			"migrations/V02_padded.up.hmf":      {},
+			"migrations/Vx_not_a_number.up.hmf": {},
+		},
+		expectedMigrations: []migration.Description{
+			{Migration: migration.Migration{Version: 1, Name: "init"}},
+			{Migration: migration.Migration{Version: 2, Name: "users"}},
+			{Migration: migration.Migration{Version: 10, Name: "roles"}, CanUndo: true},
+		},
+		expectedFileName: "V10_roles.up.hmf",
+	},
+	/* s2 */ {
+		name:     "s2: should list semantic versions in version order",
+		versions: files.SemanticVersions{},
+		fs: fstest.MapFS{
+			"migrations":                        {Mode: fs.ModeDir},
+			"migrations/V1.10.0_roles.up.hmf":   {},
+			"migrations/V1.2.0_users.up.hmf":    {},
+			"migrations/V1.2.1_fix.up.hmf":      {},
+			"migrations/V1.2_incomplete.up.hmf": {},
+			"migrations/V1.02.0_padded.up.hmf":  {},
+		},
+		expectedMigrations: []migration.Description{
+			{Migration: migration.Migration{Version: 1_000_002_000_000, Name: "users"}},
+			{Migration: migration.Migration{Version: 1_000_002_000_001, Name: "fix"}},
+			{Migration: migration.Migration{Version: 1_000_010_000_000, Name: "roles"}},
+		},
+		expectedFileName: "V1.10.0_roles.up.hmf",
+	},
+}
+
+func TestVersionParsers(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range versionParsersTestTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src, err := files.NewFilesSource(test.fs, "migrations", files.WithVersionParser(test.versions))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			available, err := src.GetAvailableMigrations()
+			if assert.NoError(t, err) {
+				assert.Equal(t, test.expectedMigrations, *available)
+			}
+
+			last := test.expectedMigrations[len(test.expectedMigrations)-1].Migration
+			assert.Equal(t, test.expectedFileName, files.FileName(last, migration.Up, files.WithVersionParser(test.versions)))
+
+			_, err = src.ReadMigration(last, migration.Up)
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package files
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// File is a migration script file.
+type File struct {
+	Name      string
+	Migration migration.Migration
+	Direction migration.Direction
+}
+
+// ListFiles lists migration script files of the directory in file name order. Unlike the source,
+// it doesn't fail on versions with conflicting names, so that such conflicts can be inspected and resolved.
+func ListFiles(fileSystem fs.FS, migrationsDirectory string, opts ...Option) ([]File, error) {
+	return newFilesSource(fileSystem, migrationsDirectory, opts).listFiles()
+}
+
+func (rdr *filesSource) listFiles() ([]File, error) {
+	dirEntries, err := fs.ReadDir(rdr.fs, rdr.migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contents of migrations directory: %w", err)
+	}
+
+	result := make([]File, 0, len(dirEntries))
+
+	for _, entry := range dirEntries {
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			continue
+		}
+
+		direction, ok := getDirectionFromFileName(entry.Name())
+		if !ok {
+			continue
+		}
+
+		mig, err := getValidMigrationFromFileName(entry.Name(), rdr.versions)
+		if err != nil {
+			continue
+		}
+
+		result = append(result, File{Name: entry.Name(), Migration: mig, Direction: direction})
+	}
+
+	return result, nil
+}
+
+// FileName is the name of the script file of the migration in the given direction.
+func FileName(mig migration.Migration, direction migration.Direction, opts ...Option) string {
+	return newFilesSource(nil, "", opts).fileName(mig, direction)
+}
+
+func (rdr *filesSource) fileName(mig migration.Migration, direction migration.Direction) string {
+	suffix := upSuffix
+	if direction == migration.Down {
+		suffix = downSuffix
+	}
+
+	return "V" + rdr.versions.FormatVersion(mig.Version) + "_" + mig.Name + suffix
+}
@@ -0,0 +1,62 @@
+package files
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/root-talis/henka/source"
+)
+
+const (
+	repeatablePrefix = "R__"
+	repeatableSuffix = ".hmf"
+)
+
+// ListRepeatableMigrations lists "R__<name>.hmf" files in file name order.
+func (rdr *filesSource) ListRepeatableMigrations() ([]string, error) {
+	dirEntries, err := fs.ReadDir(rdr.fs, rdr.migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contents of migrations directory: %w", err)
+	}
+
+	names := make([]string, 0)
+
+	for _, entry := range dirEntries {
+		if entry.IsDir() || !entry.Type().IsRegular() {
+			continue
+		}
+
+		fileName := entry.Name()
+		if !strings.HasPrefix(fileName, repeatablePrefix) || !strings.HasSuffix(fileName, repeatableSuffix) {
+			continue
+		}
+
+		name := fileName[len(repeatablePrefix) : len(fileName)-len(repeatableSuffix)]
+		if name == "" {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (rdr *filesSource) ReadRepeatableMigration(name string) (io.Reader, error) {
+	fileName := repeatablePrefix + name + repeatableSuffix
+
+	script, err := fs.ReadFile(rdr.fs, path.Join(rdr.migrationsDir, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", source.ErrMigrationNotFound, fileName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+	}
+
+	return bytes.NewReader(script), nil
+}
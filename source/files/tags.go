@@ -0,0 +1,82 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+)
+
+const (
+	tagsPrefix    = "-- tags:"
+	dependsPrefix = "-- depends:"
+)
+
+// MigrationTags reads tags from the header of the up script: the comment lines it starts with,
+// e.g. "-- tags: seed, test-data". The header may declare tags on several lines.
+func (rdr *filesSource) MigrationTags(mig migration.Migration) ([]string, error) {
+	tags, err := rdr.readHeader(mig, tagsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags of migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return tags, nil
+}
+
+// MigrationDependencies reads versions the migration depends on from the header of the up script,
+// e.g. "-- depends: 20211224081255, 20211224091800". Versions are written as in file names.
+func (rdr *filesSource) MigrationDependencies(mig migration.Migration) ([]migration.Version, error) {
+	values, err := rdr.readHeader(mig, dependsPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dependencies of migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	dependencies := make([]migration.Version, 0, len(values))
+
+	for _, value := range values {
+		version, err := rdr.versions.ParseVersion(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dependencies of migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+
+		dependencies = append(dependencies, version)
+	}
+
+	return dependencies, nil
+}
+
+// readHeader collects comma-separated values of the lines with the prefix among the comment lines
+// the up script starts with. The prefix may be repeated on several lines.
+func (rdr *filesSource) readHeader(mig migration.Migration, prefix string) ([]string, error) {
+	script, err := rdr.ReadMigration(mig, migration.Up)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, 0)
+	scanner := bufio.NewScanner(script)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+
+		for _, value := range strings.Split(line[len(prefix):], ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	}
+
+	return values, scanner.Err() //nolint:wrapcheck
+}
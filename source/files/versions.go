@@ -0,0 +1,129 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// VersionParser reads and writes the version part of migration file names: the text between "V" and
+// the first underscore. FormatVersion must return the text ParseVersion has parsed the version from,
+// as script files are found by formatting the version back.
+type VersionParser interface {
+	ParseVersion(text string) (migration.Version, error)
+	FormatVersion(version migration.Version) string
+}
+
+// FixedLengthVersions are decimal versions padded with zeros to the given number of digits, e.g. "0001" for 4.
+type FixedLengthVersions int
+
+// TimestampVersions are 14-digit timestamps such as "20211224091800", the default version format.
+const TimestampVersions = FixedLengthVersions(14)
+
+// SequentialVersions are decimal versions without leading zeros, e.g. "1", "2", ..., "10".
+type SequentialVersions struct{}
+
+// SemanticVersions are "major.minor.patch" versions, e.g. "1.2.0". Minor and patch must be below 1000000,
+// major must be below 18446744; they are packed into the version as major*10^12 + minor*10^6 + patch.
+type SemanticVersions struct{}
+
+const semanticPartLimit = 1000000
+
+var ErrVersionIsInvalid = errors.New("version is invalid")
+
+func (digits FixedLengthVersions) ParseVersion(text string) (migration.Version, error) {
+	if len(text) != int(digits) {
+		return 0, fmt.Errorf("%w: %s is not %d digits long", ErrVersionIsInvalid, text, digits)
+	}
+
+	var version uint64
+
+	for i := 0; i < len(text); i++ {
+		digit := text[i]
+		if digit < '0' || digit > '9' {
+			return 0, fmt.Errorf("%w: %s is not a number", ErrVersionIsInvalid, text)
+		}
+
+		version = version*10 + uint64(digit-'0') //nolint:gomnd
+	}
+
+	return migration.Version(version), nil
+}
+
+func (digits FixedLengthVersions) FormatVersion(version migration.Version) string {
+	return fmt.Sprintf("%0*d", int(digits), version)
+}
+
+func (SequentialVersions) ParseVersion(text string) (migration.Version, error) {
+	if len(text) > 1 && text[0] == '0' {
+		return 0, fmt.Errorf("%w: %s has leading zeros", ErrVersionIsInvalid, text)
+	}
+
+	version, err := parseDecimal(text)
+	if err != nil {
+		return 0, err
+	}
+
+	return migration.Version(version), nil
+}
+
+func (SequentialVersions) FormatVersion(version migration.Version) string {
+	return strconv.FormatUint(uint64(version), 10) //nolint:gomnd
+}
+
+func (SemanticVersions) ParseVersion(text string) (migration.Version, error) {
+	parts := strings.Split(text, ".")
+	if len(parts) != 3 { //nolint:gomnd
+		return 0, fmt.Errorf("%w: %s is not major.minor.patch", ErrVersionIsInvalid, text)
+	}
+
+	var version uint64
+
+	for i, part := range parts {
+		if len(part) > 1 && part[0] == '0' {
+			return 0, fmt.Errorf("%w: %s has leading zeros", ErrVersionIsInvalid, text)
+		}
+
+		number, err := parseDecimal(part)
+		if err != nil {
+			return 0, err
+		}
+
+		limit := uint64(semanticPartLimit)
+		if i == 0 {
+			limit = (^uint64(0)) / semanticPartLimit / semanticPartLimit
+		}
+
+		if number >= limit {
+			return 0, fmt.Errorf("%w: %s is too large", ErrVersionIsInvalid, text)
+		}
+
+		version = version*semanticPartLimit + number
+	}
+
+	return migration.Version(version), nil
+}
+
+func (SemanticVersions) FormatVersion(version migration.Version) string {
+	patch := uint64(version) % semanticPartLimit
+	minor := uint64(version) / semanticPartLimit % semanticPartLimit
+	major := uint64(version) / semanticPartLimit / semanticPartLimit
+
+	return fmt.Sprintf("%d.%d.%d", major, minor, patch)
+}
+
+func parseDecimal(text string) (uint64, error) {
+	if text == "" || strings.TrimLeft(text, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %s is not a number", ErrVersionIsInvalid, text)
+	}
+
+	number, err := strconv.ParseUint(text, 10, 64) //nolint:gomnd
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s is too large", ErrVersionIsInvalid, text)
+	}
+
+	return number, nil
+}
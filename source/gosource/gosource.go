@@ -0,0 +1,149 @@
+// Package gosource provides migrations written in Go, e.g. data backfills that need application logic.
+// They can be mixed with SQL scripts of another source.
+package gosource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+// Migration is a migration written in Go. Down is nil for migrations that can't be undone.
+type Migration struct {
+	Version migration.Version
+	Name    string
+	Up      migration.Func
+	Down    migration.Func
+}
+
+var ErrMigrationIsInvalid = errors.New("go migration is invalid")
+
+// Source lists migrations registered with Register together with the ones of the base source.
+type Source struct {
+	base source.Source
+
+	mutex      sync.RWMutex
+	migrations map[migration.Version]Migration
+}
+
+// New creates a source of Go migrations. SQL scripts are read from base, which may be nil if there are none.
+func New(base source.Source, migrations ...Migration) (*Source, error) {
+	src := &Source{
+		base:       base,
+		migrations: make(map[migration.Version]Migration),
+	}
+
+	if err := src.Register(migrations...); err != nil {
+		return nil, err
+	}
+
+	return src, nil
+}
+
+// Register adds migrations to the source. Versions must not be registered twice.
+func (src *Source) Register(migrations ...Migration) error {
+	src.mutex.Lock()
+	defer src.mutex.Unlock()
+
+	for _, mig := range migrations {
+		switch {
+		case mig.Version == 0:
+			return fmt.Errorf("%w: %s has no version", ErrMigrationIsInvalid, mig.Name)
+		case mig.Name == "":
+			return fmt.Errorf("%w: %d has no name", ErrMigrationIsInvalid, mig.Version)
+		case mig.Up == nil:
+			return fmt.Errorf("%w: %d_%s has no up function", ErrMigrationIsInvalid, mig.Version, mig.Name)
+		}
+
+		if registered, ok := src.migrations[mig.Version]; ok {
+			return fmt.Errorf("%w: version %d has conflicting names: \"%s\" and \"%s\"",
+				source.ErrMigrationDuplicated, mig.Version, registered.Name, mig.Name)
+		}
+
+		src.migrations[mig.Version] = mig
+	}
+
+	return nil
+}
+
+func (src *Source) GetAvailableMigrations() (*[]migration.Description, error) {
+	result := make([]migration.Description, 0)
+
+	if src.base != nil {
+		available, err := src.base.GetAvailableMigrations()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the list of available migrations: %w", err)
+		}
+
+		result = append(result, *available...)
+	}
+
+	src.mutex.RLock()
+	defer src.mutex.RUnlock()
+
+	for _, descr := range result {
+		if registered, ok := src.migrations[descr.Version]; ok {
+			return nil, fmt.Errorf("%w: version %d has conflicting names: \"%s\" and \"%s\"",
+				source.ErrMigrationDuplicated, descr.Version, descr.Name, registered.Name)
+		}
+	}
+
+	for _, mig := range src.migrations {
+		result = append(result, migration.Description{
+			Migration: migration.Migration{Version: mig.Version, Name: mig.Name},
+			CanUndo:   mig.Down != nil,
+		})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+
+	return &result, nil
+}
+
+// ReadMigration returns an empty script for Go migrations, their functions are returned by MigrationFunc.
+func (src *Source) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	if registered, ok := src.lookup(mig); ok {
+		if direction == migration.Down && registered.Down == nil {
+			return nil, fmt.Errorf("%w: %d_%s has no down function", source.ErrMigrationNotFound, mig.Version, mig.Name)
+		}
+
+		return strings.NewReader(""), nil
+	}
+
+	if src.base == nil {
+		return nil, fmt.Errorf("%w: %d_%s", source.ErrMigrationNotFound, mig.Version, mig.Name)
+	}
+
+	return src.base.ReadMigration(mig, direction) //nolint:wrapcheck
+}
+
+func (src *Source) MigrationFunc(mig migration.Migration, direction migration.Direction) (migration.Func, error) {
+	registered, ok := src.lookup(mig)
+	if !ok {
+		return nil, nil
+	}
+
+	if direction == migration.Down {
+		return registered.Down, nil
+	}
+
+	return registered.Up, nil
+}
+
+func (src *Source) lookup(mig migration.Migration) (Migration, bool) {
+	src.mutex.RLock()
+	defer src.mutex.RUnlock()
+
+	registered, ok := src.migrations[mig.Version]
+	if !ok || registered.Name != mig.Name {
+		return Migration{}, false
+	}
+
+	return registered, true
+}
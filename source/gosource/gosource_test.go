@@ -0,0 +1,106 @@
+package gosource_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+	"github.com/root-talis/henka/source/files"
+	"github.com/root-talis/henka/source/gosource"
+)
+
+func backfill(context.Context, *sql.Tx) error {
+	return nil
+}
+
+func TestSource(t *testing.T) {
+	t.Parallel()
+	t.Logf("Should list Go migrations together with SQL scripts of the base source.")
+
+	base, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20220101000000_initial.up.hmf":   {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/V20220301000000_add_roles.up.hmf": {},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	src, err := gosource.New(base, gosource.Migration{
+		Version: 20220201000000, Name: "backfill_users", Up: backfill, Down: backfill,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, src.Register(gosource.Migration{Version: 20220401000000, Name: "backfill_roles", Up: backfill}))
+
+	available, err := src.GetAvailableMigrations()
+	assert.NoError(t, err)
+	assert.Equal(t, []migration.Description{
+		{Migration: migration.Migration{Version: 20220101000000, Name: "initial"}},
+		{Migration: migration.Migration{Version: 20220201000000, Name: "backfill_users"}, CanUndo: true},
+		{Migration: migration.Migration{Version: 20220301000000, Name: "add_roles"}},
+		{Migration: migration.Migration{Version: 20220401000000, Name: "backfill_roles"}},
+	}, *available)
+
+	initial := migration.Migration{Version: 20220101000000, Name: "initial"}
+	fn, err := src.MigrationFunc(initial, migration.Up)
+	assert.NoError(t, err)
+	assert.Nil(t, fn)
+
+	reader, err := src.ReadMigration(initial, migration.Up)
+	if assert.NoError(t, err) {
+		script, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "CREATE TABLE users (id int);", string(script))
+	}
+
+	roles := migration.Migration{Version: 20220401000000, Name: "backfill_roles"}
+	fn, err = src.MigrationFunc(roles, migration.Up)
+	assert.NoError(t, err)
+	assert.NotNil(t, fn)
+
+	reader, err = src.ReadMigration(roles, migration.Up)
+	if assert.NoError(t, err) {
+		script, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Empty(t, script)
+	}
+
+	_, err = src.ReadMigration(roles, migration.Down)
+	assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+
+	assert.NoError(t, src.Register(gosource.Migration{Version: 20220101000000, Name: "conflict", Up: backfill}))
+
+	_, err = src.GetAvailableMigrations()
+	assert.ErrorIs(t, err, source.ErrMigrationDuplicated)
+}
+
+func TestRegisterRejectsInvalidMigrations(t *testing.T) {
+	t.Parallel()
+
+	src, err := gosource.New(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.ErrorIs(t, src.Register(gosource.Migration{Name: "no_version", Up: backfill}), gosource.ErrMigrationIsInvalid)
+	assert.ErrorIs(t, src.Register(gosource.Migration{Version: 1, Up: backfill}), gosource.ErrMigrationIsInvalid)
+	assert.ErrorIs(t, src.Register(gosource.Migration{Version: 1, Name: "no_up"}), gosource.ErrMigrationIsInvalid)
+
+	assert.NoError(t, src.Register(gosource.Migration{Version: 1, Name: "first", Up: backfill}))
+	assert.ErrorIs(t, src.Register(gosource.Migration{Version: 1, Name: "again", Up: backfill}), source.ErrMigrationDuplicated)
+
+	_, err = src.ReadMigration(migration.Migration{Version: 2, Name: "unknown"}, migration.Up)
+	assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+}
@@ -0,0 +1,288 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"text/template"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Middleware wraps a source, e.g. to cache, filter or render its migrations, without changing its implementation.
+type Middleware func(Source) Source
+
+// Wrapper is implemented by sources that wrap another one. Optional interfaces are looked up through
+// the whole chain with As, so that middlewares don't have to implement them. Calls made through such
+// interfaces, e.g. reading repeatable migrations, go straight to the wrapped source.
+type Wrapper interface {
+	Unwrap() Source
+}
+
+// Chain wraps src with middlewares. The first middleware is the outermost one: it sees every call first.
+func Chain(src Source, middlewares ...Middleware) Source {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		src = middlewares[i](src)
+	}
+
+	return src
+}
+
+// As finds the first source in the chain of wrapped sources that implements the interface target points to,
+// and sets target to it. It panics if target is not a non-nil pointer to an interface.
+func As(src Source, target interface{}) bool {
+	value := reflect.ValueOf(target)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Interface {
+		panic("source: target must be a non-nil pointer to an interface")
+	}
+
+	targetType := value.Type().Elem()
+
+	for src != nil {
+		if reflect.TypeOf(src).Implements(targetType) {
+			value.Elem().Set(reflect.ValueOf(src))
+			return true
+		}
+
+		wrapper, ok := src.(Wrapper)
+		if !ok {
+			return false
+		}
+
+		src = wrapper.Unwrap()
+	}
+
+	return false
+}
+
+var ErrChecksumMismatch = errors.New("checksum of migration script does not match the expected one")
+
+// ListFunc lists available migrations, see Intercept.
+type ListFunc func(ctx context.Context) (*[]migration.Description, error)
+
+// ReadFunc reads a migration script, see Intercept.
+type ReadFunc func(ctx context.Context, mig migration.Migration, direction migration.Direction) (io.Reader, error)
+
+// Intercept creates a middleware that intercepts listing and reading migrations. wrapList and wrapRead get
+// the functions of the wrapped source and return the ones to be used instead; either may be nil to leave
+// the calls untouched. Migrations of the wrapped source are listed as a whole, not walked one by one.
+func Intercept(wrapList func(next ListFunc) ListFunc, wrapRead func(next ReadFunc) ReadFunc) Middleware {
+	return func(src Source) Source {
+		list := func(ctx context.Context) (*[]migration.Description, error) {
+			return src.GetAvailableMigrations() //nolint:wrapcheck
+		}
+
+		read := func(ctx context.Context, mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+			return src.ReadMigration(mig, direction) //nolint:wrapcheck
+		}
+
+		if contextSource, ok := src.(ContextSource); ok {
+			list = contextSource.GetAvailableMigrationsContext
+			read = contextSource.ReadMigrationContext
+		}
+
+		if wrapList != nil {
+			list = wrapList(list)
+		}
+
+		if wrapRead != nil {
+			read = wrapRead(read)
+		}
+
+		return &interceptor{base: src, list: list, read: read}
+	}
+}
+
+// interceptor implements Walker and ContextSource itself, so that As doesn't find them on the wrapped
+// source and bypass the middleware.
+type interceptor struct {
+	base Source
+	list ListFunc
+	read ReadFunc
+}
+
+func (i *interceptor) Unwrap() Source {
+	return i.base
+}
+
+func (i *interceptor) GetAvailableMigrations() (*[]migration.Description, error) {
+	return i.list(context.Background())
+}
+
+func (i *interceptor) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	return i.read(context.Background(), mig, direction)
+}
+
+func (i *interceptor) GetAvailableMigrationsContext(ctx context.Context) (*[]migration.Description, error) {
+	return i.list(ctx)
+}
+
+func (i *interceptor) ReadMigrationContext(
+	ctx context.Context,
+	mig migration.Migration,
+	direction migration.Direction,
+) (io.Reader, error) {
+	return i.read(ctx, mig, direction)
+}
+
+func (i *interceptor) WalkAvailableMigrations(fn func(migration.Description) error) error {
+	return walkList(i, fn)
+}
+
+// Cache keeps the listing and the scripts in memory once they have been read, e.g. for remote sources.
+// Failures are not cached.
+func Cache() Middleware {
+	var mutex sync.Mutex
+
+	var listing *[]migration.Description
+
+	scripts := make(map[cacheKey][]byte)
+
+	return Intercept(
+		func(next ListFunc) ListFunc {
+			return func(ctx context.Context) (*[]migration.Description, error) {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				if listing == nil {
+					available, err := next(ctx)
+					if err != nil {
+						return nil, err
+					}
+
+					listing = available
+				}
+
+				copied := append([]migration.Description{}, *listing...)
+
+				return &copied, nil
+			}
+		},
+		func(next ReadFunc) ReadFunc {
+			return func(ctx context.Context, mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+				key := cacheKey{Migration: mig, direction: direction}
+
+				mutex.Lock()
+				script, ok := scripts[key]
+				mutex.Unlock()
+
+				if ok {
+					return bytes.NewReader(script), nil
+				}
+
+				script, err := readAll(next(ctx, mig, direction))
+				if err != nil {
+					return nil, err
+				}
+
+				mutex.Lock()
+				scripts[key] = script
+				mutex.Unlock()
+
+				return bytes.NewReader(script), nil
+			}
+		},
+	)
+}
+
+type cacheKey struct {
+	migration.Migration
+	direction migration.Direction
+}
+
+// Filter leaves out migrations keep returns false for. They are neither listed nor read.
+func Filter(keep func(migration.Migration) bool) Middleware {
+	return Intercept(
+		func(next ListFunc) ListFunc {
+			return func(ctx context.Context) (*[]migration.Description, error) {
+				available, err := next(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				kept := make([]migration.Description, 0, len(*available))
+				for _, descr := range *available {
+					if keep(descr.Migration) {
+						kept = append(kept, descr)
+					}
+				}
+
+				return &kept, nil
+			}
+		},
+		func(next ReadFunc) ReadFunc {
+			return func(ctx context.Context, mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+				if !keep(mig) {
+					return nil, fmt.Errorf("%w: %d_%s is filtered out", ErrMigrationNotFound, mig.Version, mig.Name)
+				}
+
+				return next(ctx, mig, direction)
+			}
+		},
+	)
+}
+
+// Transform replaces every script with the one fn returns, e.g. to substitute environment-specific names.
+func Transform(fn func(mig migration.Migration, direction migration.Direction, script []byte) ([]byte, error)) Middleware {
+	return Intercept(nil, func(next ReadFunc) ReadFunc {
+		return func(ctx context.Context, mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+			script, err := readAll(next(ctx, mig, direction))
+			if err != nil {
+				return nil, err
+			}
+
+			transformed, err := fn(mig, direction, script)
+			if err != nil {
+				return nil, fmt.Errorf("failed to transform migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			return bytes.NewReader(transformed), nil
+		}
+	})
+}
+
+// Template renders every script as a text/template with data, e.g. "CREATE TABLE {{.Schema}}.users".
+func Template(data interface{}) Middleware {
+	return Transform(func(mig migration.Migration, direction migration.Direction, script []byte) ([]byte, error) {
+		tmpl, err := template.New(fmt.Sprintf("%d_%s", mig.Version, mig.Name)).Option("missingkey=error").Parse(string(script))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template: %w", err)
+		}
+
+		rendered := bytes.Buffer{}
+		if err = tmpl.Execute(&rendered, data); err != nil {
+			return nil, fmt.Errorf("failed to render template: %w", err)
+		}
+
+		return rendered.Bytes(), nil
+	})
+}
+
+// VerifyChecksums fails to read up scripts whose migration.Checksum differs from the expected one,
+// e.g. from a lock file committed next to the migrations. Migrations without an expected checksum are read as is.
+func VerifyChecksums(expected map[migration.Version]string) Middleware {
+	return Transform(func(mig migration.Migration, direction migration.Direction, script []byte) ([]byte, error) {
+		checksum, ok := expected[mig.Version]
+		if !ok || direction != migration.Up {
+			return script, nil
+		}
+
+		if actual := migration.Checksum(script); actual != checksum {
+			return nil, fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, actual)
+		}
+
+		return script, nil
+	})
+}
+
+func readAll(reader io.Reader, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(reader) //nolint:wrapcheck
+}
@@ -0,0 +1,133 @@
+package prisma
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+// scriptFileName is the name of the file Prisma puts into every migration folder.
+const scriptFileName = "migration.sql"
+
+type prismaSource struct {
+	migrationsDir string
+	fs            fs.FS
+}
+
+var (
+	ErrMigrationsDirectoryIsNotADirectory = errors.New("migrationsDirectory is not a directory")
+	ErrDownMigrationsNotSupported         = errors.New("prisma migrations can't be reverted")
+)
+
+// NewPrismaSource creates a source that reads Prisma's migrations layout:
+// a directory of "<timestamp>_<name>" folders, each of them containing a migration.sql file.
+// Prisma has no down migrations, so none of the migrations can be undone.
+func NewPrismaSource(fileSystem fs.FS, migrationsDirectory string) (source.Source, error) {
+	stat, err := fs.Stat(fileSystem, migrationsDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat migrations directory: %w", err)
+	}
+
+	if !stat.IsDir() {
+		return nil, ErrMigrationsDirectoryIsNotADirectory
+	}
+
+	return &prismaSource{
+		migrationsDir: migrationsDirectory,
+		fs:            fileSystem,
+	}, nil
+}
+
+func (src *prismaSource) GetAvailableMigrations() (*[]migration.Description, error) {
+	dirEntries, err := fs.ReadDir(src.fs, src.migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contents of migrations directory: %w", err)
+	}
+
+	migrations := make(map[migration.Version]migration.Description)
+	for _, entry := range dirEntries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		mig, ok := parseFolderName(entry.Name())
+		if !ok {
+			continue
+		}
+
+		stat, err := fs.Stat(src.fs, path.Join(src.migrationsDir, entry.Name(), scriptFileName))
+		if err != nil || !stat.Mode().IsRegular() {
+			continue
+		}
+
+		if existing, exists := migrations[mig.Version]; exists {
+			return nil, fmt.Errorf(
+				"%w: version %d has conflicting names: \"%s\" and \"%s\"",
+				source.ErrMigrationDuplicated,
+				mig.Version,
+				existing.Name,
+				mig.Name,
+			)
+		}
+
+		migrations[mig.Version] = migration.Description{Migration: mig}
+	}
+
+	result := make([]migration.Description, 0, len(migrations))
+	for _, descr := range migrations {
+		result = append(result, descr)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return &result, nil
+}
+
+func (src *prismaSource) ReadMigration(mig migration.Migration, direction migration.Direction) (io.Reader, error) {
+	if direction != migration.Up {
+		return nil, fmt.Errorf("%w: %d_%s", ErrDownMigrationsNotSupported, mig.Version, mig.Name)
+	}
+
+	script, err := fs.ReadFile(src.fs, path.Join(src.migrationsDir, folderName(mig), scriptFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %d_%s", source.ErrMigrationNotFound, mig.Version, mig.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	return bytes.NewReader(script), nil
+}
+
+func folderName(mig migration.Migration) string {
+	return fmt.Sprintf("%d_%s", mig.Version, mig.Name)
+}
+
+// parseFolderName splits "20210124131258_init" into a version and a name.
+func parseFolderName(name string) (migration.Migration, bool) {
+	separator := strings.IndexByte(name, '_')
+	if separator <= 0 || separator == len(name)-1 {
+		return migration.Migration{}, false
+	}
+
+	version, err := strconv.ParseUint(name[:separator], 10, migration.VersionBits)
+	if err != nil {
+		return migration.Migration{}, false
+	}
+
+	return migration.Migration{
+		Version: migration.Version(version),
+		Name:    name[separator+1:],
+	}, true
+}
@@ -0,0 +1,119 @@
+package prisma_test
+
+import (
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+	"github.com/root-talis/henka/source/prisma"
+)
+
+var getAvailableMigrationsTestTable = []struct { // nolint:gochecknoglobals
+	name                   string
+	expectErrorWhenCalling bool
+	fs                     fstest.MapFS
+	expectedMigrations     []migration.Description
+}{
+	// -- success tests ------
+	/* s0 */ {
+		name: "s0: should correctly list all migrations",
+		fs: fstest.MapFS{
+			"prisma/migrations":                                        {Mode: fs.ModeDir},
+			"prisma/migrations/migration_lock.toml":                    {},
+			"prisma/migrations/20211224091800_add_users/migration.sql": {},
+			"prisma/migrations/20211224081255_init/migration.sql":      {},
+		},
+		expectedMigrations: []migration.Description{
+			{Migration: migration.Migration{Version: 20211224081255, Name: "init"}},
+			{Migration: migration.Migration{Version: 20211224091800, Name: "add_users"}},
+		},
+	},
+	/* s1 */ {
+		name: "s1: should skip folders with bad names or without migration.sql",
+		fs: fstest.MapFS{
+			"prisma/migrations": {Mode: fs.ModeDir},
+			"prisma/migrations/20211224081255_init/migration.sql":      {},
+			"prisma/migrations/init_20211224081256/migration.sql":      {},
+			"prisma/migrations/20211224081257_/migration.sql":          {},
+			"prisma/migrations/20211224091800_add_users/README.md":     {},
+			"prisma/migrations/20211224091801_add_roles/migration.sql": {Mode: fs.ModeDir},
+		},
+		expectedMigrations: []migration.Description{
+			{Migration: migration.Migration{Version: 20211224081255, Name: "init"}},
+		},
+	},
+
+	// -- error tests ------
+	/* e0 */ {
+		name: "e0: should fail on duplicated versions",
+		fs: fstest.MapFS{
+			"prisma/migrations": {Mode: fs.ModeDir},
+			"prisma/migrations/20211224081255_init/migration.sql":    {},
+			"prisma/migrations/20211224081255_initial/migration.sql": {},
+		},
+		expectErrorWhenCalling: true,
+	},
+}
+
+func TestGetAvailableMigrations(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range getAvailableMigrationsTestTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			src, err := prisma.NewPrismaSource(test.fs, "prisma/migrations")
+			assert.NoError(t, err)
+
+			migrations, err := src.GetAvailableMigrations()
+			if test.expectErrorWhenCalling {
+				assert.ErrorIs(t, err, source.ErrMigrationDuplicated)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedMigrations, *migrations)
+			}
+		})
+	}
+}
+
+func TestNewPrismaSource(t *testing.T) {
+	t.Parallel()
+
+	fileSystem := fstest.MapFS{"schema.prisma": {}}
+
+	_, err := prisma.NewPrismaSource(fileSystem, "schema.prisma")
+	assert.ErrorIs(t, err, prisma.ErrMigrationsDirectoryIsNotADirectory)
+
+	_, err = prisma.NewPrismaSource(fileSystem, "migrations")
+	assert.Error(t, err)
+}
+
+func TestReadMigration(t *testing.T) {
+	t.Parallel()
+
+	src, err := prisma.NewPrismaSource(fstest.MapFS{
+		"migrations": {Mode: fs.ModeDir},
+		"migrations/20211224081255_init/migration.sql": {Data: []byte("CREATE TABLE users (id int);")},
+	}, "migrations")
+	assert.NoError(t, err)
+
+	mig := migration.Migration{Version: 20211224081255, Name: "init"}
+
+	reader, err := src.ReadMigration(mig, migration.Up)
+	assert.NoError(t, err)
+	script, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE users (id int);", string(script))
+
+	_, err = src.ReadMigration(mig, migration.Down)
+	assert.ErrorIs(t, err, prisma.ErrDownMigrationsNotSupported)
+
+	_, err = src.ReadMigration(migration.Migration{Version: 20211224081256, Name: "init"}, migration.Up)
+	assert.ErrorIs(t, err, source.ErrMigrationNotFound)
+}
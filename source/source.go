@@ -1,7 +1,9 @@
 package source
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/root-talis/henka/migration"
@@ -12,6 +14,86 @@ type Source interface {
 	ReadMigration(migration migration.Migration, direction migration.Direction) (io.Reader, error)
 }
 
+// Walker is implemented by sources that can list available migrations one by one, in ascending
+// version order, without materializing the whole list. The walk stops at the first error returned
+// by fn; ErrStopWalk stops it without failing.
+type Walker interface {
+	WalkAvailableMigrations(fn func(migration.Description) error) error
+}
+
+// ContextSource is implemented by sources that accept a context, so that listing and reading
+// migrations can be canceled or given a deadline.
+type ContextSource interface {
+	GetAvailableMigrationsContext(ctx context.Context) (*[]migration.Description, error)
+	ReadMigrationContext(ctx context.Context, mig migration.Migration, direction migration.Direction) (io.Reader, error)
+}
+
+// Tagger is implemented by sources whose migrations can declare tags, e.g. "seed" or "test-data",
+// so that runs can include or exclude them. Migrations without tags return an empty list.
+type Tagger interface {
+	MigrationTags(mig migration.Migration) ([]string, error)
+}
+
+// DependencyReader is implemented by sources whose migrations can declare versions they depend on,
+// so that they are applied after them whatever the order of versions is. Migrations without dependencies
+// return an empty list.
+type DependencyReader interface {
+	MigrationDependencies(mig migration.Migration) ([]migration.Version, error)
+}
+
+// RepeatableSource is implemented by sources that provide repeatable migrations: scripts without a version
+// that are executed again whenever they change, e.g. views, stored procedures or seed data.
+// ListRepeatableMigrations returns their names in the order they are to be executed.
+type RepeatableSource interface {
+	ListRepeatableMigrations() ([]string, error)
+	ReadRepeatableMigration(name string) (io.Reader, error)
+}
+
+// FuncSource is implemented by sources that provide migrations written in Go. MigrationFunc returns nil
+// for migrations that are SQL scripts, which are read with ReadMigration as usual.
+type FuncSource interface {
+	MigrationFunc(mig migration.Migration, direction migration.Direction) (migration.Func, error)
+}
+
 var (
 	ErrMigrationDuplicated = errors.New("migration version already exists with different name")
+	ErrMigrationNotFound   = errors.New("migration not found")
+
+	ErrMigrationsNotSorted = errors.New("migrations are not listed in ascending version order")
+
+	ErrStopWalk = errors.New("stop walking migrations")
 )
+
+// Walk calls fn for every available migration in ascending version order. Sources that implement
+// Walker are walked lazily, the rest are listed with GetAvailableMigrations first.
+func Walk(src Source, fn func(migration.Description) error) error {
+	var err error
+
+	var walker Walker
+	if As(src, &walker) {
+		err = walker.WalkAvailableMigrations(fn)
+	} else {
+		err = walkList(src, fn)
+	}
+
+	if errors.Is(err, ErrStopWalk) {
+		return nil
+	}
+
+	return err
+}
+
+func walkList(src Source, fn func(migration.Description) error) error {
+	available, err := src.GetAvailableMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	for _, descr := range *available {
+		if err = fn(descr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package sqlscript
+
+import "strings"
+
+// Destructive returns the statements of the script that drop or empty objects: DROP, TRUNCATE
+// and ALTER statements with a DROP clause. Keywords in strings, quoted identifiers and comments are ignored.
+func Destructive(script string) []string {
+	result := make([]string, 0)
+
+	for _, statement := range Split(script) {
+		words := strings.Fields(strings.ToUpper(code(statement)))
+		if len(words) == 0 {
+			continue
+		}
+
+		switch words[0] {
+		case "DROP", "TRUNCATE":
+			result = append(result, statement)
+		case "ALTER":
+			for _, word := range words[1:] {
+				if word == "DROP" {
+					result = append(result, statement)
+					break
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// Keyword returns the first word of the statement in upper case, e.g. "INSERT". Comments are skipped.
+func Keyword(statement string) string {
+	words := strings.Fields(strings.ToUpper(code(statement)))
+	if len(words) == 0 {
+		return ""
+	}
+
+	return words[0]
+}
+
+// code returns the statement with strings, quoted identifiers and comments replaced by spaces.
+func code(statement string) string {
+	result := strings.Builder{}
+	scanner := splitter{script: statement}
+
+	for scanner.pos < len(statement) {
+		switch char := statement[scanner.pos]; {
+		case char == '\'' || char == '"' || char == '`':
+			scanner.skipQuoted(char)
+			result.WriteByte(' ')
+		case char == '#' || strings.HasPrefix(statement[scanner.pos:], "-- ") || strings.HasPrefix(statement[scanner.pos:], "--\n"):
+			scanner.skipLineComment()
+			result.WriteByte(' ')
+		case strings.HasPrefix(statement[scanner.pos:], "/*"):
+			scanner.skipBlockComment()
+			result.WriteByte(' ')
+		default:
+			result.WriteByte(char)
+			scanner.pos++
+		}
+	}
+
+	return result.String()
+}
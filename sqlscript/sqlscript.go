@@ -0,0 +1,133 @@
+// Package sqlscript splits migration scripts into separate statements.
+package sqlscript
+
+import "strings"
+
+// Split splits a script into statements separated by semicolons. Semicolons inside quoted strings,
+// quoted identifiers and comments don't separate statements. Statements are returned without the
+// trailing semicolon and surrounding whitespace; statements that contain only comments are dropped.
+//
+// Like in the mysql client, a "DELIMITER <delimiter>" line at the start of a statement changes the delimiter,
+// e.g. to "$$" around stored procedures and triggers whose bodies contain semicolons. The line itself is dropped.
+func Split(script string) []string {
+	statements := make([]string, 0)
+	splitter := splitter{script: script, delimiter: ";"}
+
+	for splitter.pos < len(script) {
+		switch char := script[splitter.pos]; {
+		case !splitter.hasCode && isDelimiterDirective(script[splitter.pos:]):
+			splitter.changeDelimiter()
+		case char == '\'' || char == '"' || char == '`':
+			splitter.skipQuoted(char)
+		case char == '#' || strings.HasPrefix(script[splitter.pos:], "-- ") || strings.HasPrefix(script[splitter.pos:], "--\n"):
+			splitter.skipLineComment()
+		case strings.HasPrefix(script[splitter.pos:], "/*"):
+			splitter.skipBlockComment()
+		case strings.HasPrefix(script[splitter.pos:], splitter.delimiter):
+			statements = splitter.flush(statements)
+			splitter.pos += len(splitter.delimiter)
+			splitter.start = splitter.pos
+		default:
+			if !isSpace(char) {
+				splitter.hasCode = true
+			}
+			splitter.pos++
+		}
+	}
+
+	return splitter.flush(statements)
+}
+
+type splitter struct {
+	script    string
+	start     int
+	pos       int
+	hasCode   bool
+	delimiter string
+}
+
+const delimiterDirective = "DELIMITER"
+
+func isDelimiterDirective(rest string) bool {
+	return len(rest) > len(delimiterDirective) &&
+		strings.EqualFold(rest[:len(delimiterDirective)], delimiterDirective) &&
+		isSpace(rest[len(delimiterDirective)])
+}
+
+// changeDelimiter reads the delimiter from the rest of the DELIMITER line and skips the line.
+// The delimiter stays the same if the line has none.
+func (s *splitter) changeDelimiter() {
+	end := strings.IndexByte(s.script[s.pos:], '\n')
+	if end < 0 {
+		end = len(s.script) - s.pos
+	}
+
+	if fields := strings.Fields(s.script[s.pos+len(delimiterDirective) : s.pos+end]); len(fields) > 0 {
+		s.delimiter = fields[0]
+	}
+
+	s.pos += end
+	s.start = s.pos
+}
+
+func (s *splitter) flush(statements []string) []string {
+	if s.hasCode {
+		statements = append(statements, strings.TrimSpace(s.script[s.start:s.pos]))
+	}
+
+	s.hasCode = false
+
+	return statements
+}
+
+// skipQuoted skips a string or an identifier. Quotes are escaped by doubling them,
+// backslash escapes are recognized in strings only.
+func (s *splitter) skipQuoted(quote byte) {
+	s.hasCode = true
+	s.pos++
+
+	for s.pos < len(s.script) {
+		char := s.script[s.pos]
+
+		switch {
+		case char == '\\' && quote != '`':
+			s.pos += 2
+		case char == quote && s.pos+1 < len(s.script) && s.script[s.pos+1] == quote:
+			s.pos += 2
+		case char == quote:
+			s.pos++
+			return
+		default:
+			s.pos++
+		}
+	}
+
+	// an unterminated string that ends with a backslash
+	if s.pos > len(s.script) {
+		s.pos = len(s.script)
+	}
+}
+
+func (s *splitter) skipLineComment() {
+	end := strings.IndexByte(s.script[s.pos:], '\n')
+	if end < 0 {
+		s.pos = len(s.script)
+		return
+	}
+
+	s.pos += end + 1
+}
+
+func (s *splitter) skipBlockComment() {
+	end := strings.Index(s.script[s.pos+2:], "*/")
+	if end < 0 {
+		s.pos = len(s.script)
+		return
+	}
+
+	s.pos += 2 + end + 2
+}
+
+func isSpace(char byte) bool {
+	return char == ' ' || char == '\t' || char == '\n' || char == '\r' || char == '\f' || char == '\v'
+}
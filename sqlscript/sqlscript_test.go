@@ -0,0 +1,159 @@
+package sqlscript_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/sqlscript"
+)
+
+var splitTestsTable = []struct { // nolint:gochecknoglobals
+	name     string
+	script   string
+	expected []string
+}{
+	/* s0 */ {
+		name:     "s0: should return nothing for an empty script",
+		script:   " \n\t",
+		expected: []string{},
+	},
+	/* s1 */ {
+		name:     "s1: should split statements",
+		script:   "CREATE TABLE a (id int);\nINSERT INTO a VALUES (1);\n",
+		expected: []string{"CREATE TABLE a (id int)", "INSERT INTO a VALUES (1)"},
+	},
+	/* s2 */ {
+		name:     "s2: should keep the last statement without a semicolon",
+		script:   "DELETE FROM a; DELETE FROM b",
+		expected: []string{"DELETE FROM a", "DELETE FROM b"},
+	},
+	/* s3 */ {
+		name:   "s3: should not split on semicolons in strings and identifiers",
+		script: `INSERT INTO a VALUES ('x;y', "it\";s", 'it''s;'); SELECT ` + "`a;b`" + ` FROM a;`,
+		expected: []string{
+			`INSERT INTO a VALUES ('x;y', "it\";s", 'it''s;')`,
+			"SELECT `a;b` FROM a",
+		},
+	},
+	/* s4 */ {
+		name: "s4: should not split on semicolons in comments",
+		script: "-- first; statement\nDELETE FROM a; # second; one\nDELETE FROM b /* ; */;\n" +
+			"/* trailing; comment */ -- and another\n",
+		expected: []string{
+			"-- first; statement\nDELETE FROM a",
+			"# second; one\nDELETE FROM b /* ; */",
+		},
+	},
+	/* s5 */ {
+		name:     "s5: should skip empty statements",
+		script:   ";;DELETE FROM a;;",
+		expected: []string{"DELETE FROM a"},
+	},
+	/* s6 */ {
+		name:     "s6: should not treat a double dash without a space as a comment",
+		script:   "UPDATE a SET x = x--1; DELETE FROM a",
+		expected: []string{"UPDATE a SET x = x--1", "DELETE FROM a"},
+	},
+	/* s7 */ {
+		name:     "s7: should return an unterminated string as is",
+		script:   "SELECT 1; SELECT 'abc\\",
+		expected: []string{"SELECT 1", "SELECT 'abc\\"},
+	},
+	/* s8 */ {
+		name: "s8: should split by the delimiter set with DELIMITER",
+		script: "CREATE TABLE a (id int);\nDELIMITER $$\n" +
+			"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.id = 1; END$$\n" +
+			"delimiter ;\nINSERT INTO a VALUES (2);\n",
+		expected: []string{
+			"CREATE TABLE a (id int)",
+			"CREATE TRIGGER t BEFORE INSERT ON a FOR EACH ROW BEGIN SET NEW.id = 1; END",
+			"INSERT INTO a VALUES (2)",
+		},
+	},
+	/* s9 */ {
+		name:     "s9: should treat DELIMITER as a directive only at the start of a statement",
+		script:   "SELECT 'DELIMITER $$'; SELECT delimiter FROM t;",
+		expected: []string{"SELECT 'DELIMITER $$'", "SELECT delimiter FROM t"},
+	},
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range splitTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, sqlscript.Split(test.script))
+		})
+	}
+}
+
+var destructiveTestsTable = []struct { // nolint:gochecknoglobals
+	name     string
+	script   string
+	expected []string
+}{
+	/* s0 */ {
+		name:     "s0: should find nothing in a script that only adds",
+		script:   "CREATE TABLE a (id int); ALTER TABLE a ADD COLUMN b int; INSERT INTO a VALUES (1);",
+		expected: []string{},
+	},
+	/* s1 */ {
+		name:     "s1: should find drops and truncates",
+		script:   "-- cleanup\nDROP TABLE a;\ntruncate b;\nALTER TABLE c DROP COLUMN d, ADD COLUMN e int;",
+		expected: []string{"-- cleanup\nDROP TABLE a", "truncate b", "ALTER TABLE c DROP COLUMN d, ADD COLUMN e int"},
+	},
+	/* s2 */ {
+		name:     "s2: should ignore keywords in strings, identifiers and comments",
+		script:   "INSERT INTO a VALUES ('DROP TABLE b'); ALTER TABLE `drop` ADD COLUMN c int /* drop */; /* DROP */ SELECT 1",
+		expected: []string{},
+	},
+}
+
+func TestDestructive(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range destructiveTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, sqlscript.Destructive(test.script))
+		})
+	}
+}
+
+var keywordTestsTable = []struct { // nolint:gochecknoglobals
+	name      string
+	statement string
+	expected  string
+}{
+	/* s0 */ {
+		name:      "s0: should return the first word in upper case",
+		statement: "insert INTO a VALUES (1)",
+		expected:  "INSERT",
+	},
+	/* s1 */ {
+		name:      "s1: should skip comments",
+		statement: "-- backfill\n/* a */ UPDATE a SET b = 1",
+		expected:  "UPDATE",
+	},
+	/* s2 */ {
+		name:      "s2: should return nothing for comments only",
+		statement: "/* nothing */",
+		expected:  "",
+	},
+}
+
+func TestKeyword(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range keywordTestsTable {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, sqlscript.Keyword(test.statement))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package henka
+
+import (
+	"context"
+	"iter"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+// StateStreamer is implemented by engines returned by New when built with Go 1.23 or later.
+type StateStreamer interface {
+	// States yields the state of every version in version order, the way Validate lists them,
+	// without collecting them first. The source is walked lazily when it supports it. Checksums
+	// are not verified. An error is yielded once, as the last element, and so is ctx.Err()
+	// when ctx is done.
+	States(ctx context.Context) iter.Seq2[migration.State, error]
+}
+
+func (m *henkaImpl) States(ctx context.Context) iter.Seq2[migration.State, error] {
+	return func(yield func(migration.State, error) bool) {
+		err := m.newRun(ctx).mergeStates(false, func(state migration.State) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if !yield(state, nil) {
+				return source2.ErrStopWalk
+			}
+
+			return nil
+		})
+		if err != nil {
+			yield(migration.State{}, err)
+		}
+	}
+}
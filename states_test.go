@@ -0,0 +1,56 @@
+//go:build go1.23
+
+package henka_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/migration"
+)
+
+func TestStates(t *testing.T) {
+	t.Parallel()
+
+	src := sourceMock{availableMigrations: sourceGetAvailableMigrationsResult{
+		descr: []migration.Description{migrations[1], migrations[2]},
+	}}
+	drv := driverMock{appliedMigrations: driverListAppliedMigrationsResult{log: []migration.Log{
+		{Migration: migrations[0].Migration, Direction: migration.Up},
+		{Migration: migrations[1].Migration, Direction: migration.Up},
+		{Migration: migrations[3].Migration, Direction: migration.Up},
+	}}}
+
+	streamer, ok := henka.New(&src, &drv).(henka.StateStreamer)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	statuses := make([]migration.Status, 0)
+	for state, err := range streamer.States(context.Background()) {
+		assert.NoError(t, err)
+		statuses = append(statuses, state.Status)
+	}
+
+	assert.Equal(t, []migration.Status{migration.Missing, migration.Applied, migration.Pending, migration.Missing}, statuses)
+
+	count := 0
+	for range streamer.States(context.Background()) {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+
+	assert.Equal(t, 2, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, err := range streamer.States(ctx) {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
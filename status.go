@@ -0,0 +1,59 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// Status is Validate with the history of every migration: how many times it was applied and reverted,
+// and how long its latest up execution took. The whole migrations log is read for that, so it costs
+// more than Validate.
+func (m *henkaImpl) Status() (*ValidationResult, error) {
+	return m.newRun(context.Background()).status()
+}
+
+func (m *run) status() (*ValidationResult, error) {
+	result, err := m.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	log, err := m.listMigrationsLog()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the migrations log: %w", err)
+	}
+
+	history := make(map[migration.Version]*migration.State)
+
+	for _, entry := range *log {
+		if entry.Baseline {
+			continue
+		}
+
+		state, ok := history[entry.Version]
+		if !ok {
+			state = &migration.State{}
+			history[entry.Version] = state
+		}
+
+		if entry.Direction == migration.Down {
+			state.RevertedTimes++
+			continue
+		}
+
+		state.AppliedTimes++
+		state.Duration = entry.Duration()
+	}
+
+	for i := range result.Migrations {
+		if state, ok := history[result.Migrations[i].Version]; ok {
+			result.Migrations[i].AppliedTimes = state.AppliedTimes
+			result.Migrations[i].RevertedTimes = state.RevertedTimes
+			result.Migrations[i].Duration = state.Duration
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,118 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/root-talis/henka/migration"
+)
+
+// UpgradeSteps applies the next n pending migrations in version order.
+func (m *henkaImpl) UpgradeSteps(n uint) error {
+	if n == 0 {
+		return nil
+	}
+
+	target, err := m.newRun(context.Background()).resolveUpgradeSteps(n)
+	if err != nil {
+		return fmt.Errorf("failed to resolve upgrade target: %w", err)
+	}
+
+	if target == 0 {
+		return nil
+	}
+
+	return m.Upgrade(target)
+}
+
+// DowngradeSteps reverts the latest n applied migrations, latest first.
+func (m *henkaImpl) DowngradeSteps(n uint) error {
+	if n == 0 {
+		return nil
+	}
+
+	target, err := m.newRun(context.Background()).resolveDowngradeSteps(n)
+	if err != nil {
+		return fmt.Errorf("failed to resolve downgrade target: %w", err)
+	}
+
+	return m.Downgrade(target)
+}
+
+// resolveUpgradeSteps returns the n-th pending version, or the last one if there are fewer. Zero if none is pending.
+func (m *run) resolveUpgradeSteps(n uint) (migration.Version, error) {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	available, err := m.getAvailableMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	latest := m.latestApplied(appliedMigrations)
+	baseline := m.baseline(appliedMigrations)
+	pending := make([]migration.Version, 0, len(*available))
+
+	for _, descr := range *available {
+		if state, ok := (*appliedMigrations)[descr.Version]; ok && state.Status == migration.Applied {
+			continue
+		}
+
+		if m.isBaselined(descr.Version, baseline) || m.options.SkipVersions[descr.Version] {
+			continue
+		}
+
+		excluded, err := m.excludedByTags(descr.Migration)
+		if err != nil {
+			return 0, err
+		}
+
+		if excluded {
+			continue
+		}
+
+		if m.options.OutOfOrder == OutOfOrderSkip && latest != 0 && m.compareVersions(descr.Version, latest) < 0 {
+			continue
+		}
+
+		pending = append(pending, descr.Version)
+	}
+
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return m.compareVersions(pending[i], pending[j]) < 0
+	})
+
+	if n > uint(len(pending)) {
+		n = uint(len(pending))
+	}
+
+	return pending[n-1], nil
+}
+
+// resolveDowngradeSteps returns the applied version that precedes the latest n applied ones. Zero if there is none.
+func (m *run) resolveDowngradeSteps(n uint) (migration.Version, error) {
+	appliedMigrations, err := m.getAppliedMigrations()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the list of applied migrations: %w", err)
+	}
+
+	applied := make([]migration.Version, 0, len(*appliedMigrations))
+	for _, state := range m.sortedStates(appliedMigrations) {
+		if state.Status == migration.Applied {
+			applied = append(applied, state.Version)
+		}
+	}
+
+	if n >= uint(len(applied)) {
+		return 0, nil
+	}
+
+	return applied[uint(len(applied))-n-1], nil
+}
@@ -0,0 +1,55 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/migration"
+	source2 "github.com/root-talis/henka/source"
+)
+
+var ErrTagsNotSupported = errors.New("source does not support migration tags")
+
+// excludedByTags tells whether Options.IncludeTags and Options.ExcludeTags leave the migration out of upgrades.
+// Migrations without tags are never left out.
+func (m *run) excludedByTags(mig migration.Migration) (bool, error) {
+	if len(m.options.IncludeTags) == 0 && len(m.options.ExcludeTags) == 0 {
+		return false, nil
+	}
+
+	var tagger source2.Tagger
+	if !source2.As(m.source, &tagger) {
+		return false, fmt.Errorf("%w: %T", ErrTagsNotSupported, m.source)
+	}
+
+	tags, err := tagger.MigrationTags(mig)
+	if err != nil {
+		return false, fmt.Errorf("failed to read tags of migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	if len(tags) == 0 {
+		return false, nil
+	}
+
+	included := len(m.options.IncludeTags) == 0
+
+	for _, tag := range tags {
+		if containsTag(m.options.ExcludeTags, tag) {
+			return true, nil
+		}
+
+		included = included || containsTag(m.options.IncludeTags, tag)
+	}
+
+	return !included, nil
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
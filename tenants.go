@@ -0,0 +1,129 @@
+package henka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/root-talis/henka/driver"
+	source2 "github.com/root-talis/henka/source"
+)
+
+// Tenant is one of the databases TenantRunner migrates, e.g. a driver for the database of a customer.
+type Tenant struct {
+	Name   string
+	Driver driver.Driver
+}
+
+// TenantResult is the outcome of the upgrade of a tenant. Result is nil if the upgrade has not started.
+type TenantResult struct {
+	Tenant string
+	Result *UpgradeResult
+	Err    error
+}
+
+// TenantsReport lists results in the order the tenants were given. Failed are the names of tenants
+// whose upgrade has failed or has not started.
+type TenantsReport struct {
+	Results []TenantResult
+	Failed  []string
+}
+
+// TenantRunner applies the same migrations to many databases. Every tenant gets an engine of its own,
+// created with Options, and the source is shared between them, so it must be safe for concurrent use.
+type TenantRunner struct {
+	Source  source2.Source
+	Options []Option
+
+	// Parallelism is the number of tenants migrated at the same time. Zero or less migrates them one by one.
+	Parallelism int
+
+	// Progress is called when the upgrade of a tenant is over, with the number of tenants done so far.
+	// Calls don't overlap.
+	Progress func(result TenantResult, done, total int)
+}
+
+// UpgradeAll upgrades every tenant to the latest version. The upgrade of a tenant doesn't stop the others.
+// Tenants that have not started when ctx is done are reported as failed with the error of ctx.
+func (r *TenantRunner) UpgradeAll(ctx context.Context, tenants []Tenant) *TenantsReport {
+	parallelism := r.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	results := make([]TenantResult, len(tenants))
+	slots := make(chan struct{}, parallelism)
+	done := 0
+
+	var progress sync.Mutex
+	var wait sync.WaitGroup
+
+	for i, tenant := range tenants {
+		i, tenant := i, tenant
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if err := ctx.Err(); err != nil {
+			results[i] = TenantResult{Tenant: tenant.Name, Err: fmt.Errorf("upgrade of tenant %s has not started: %w", tenant.Name, err)}
+			continue
+		}
+
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+			defer func() { <-slots }()
+
+			results[i] = r.upgrade(ctx, tenant)
+
+			progress.Lock()
+			defer progress.Unlock()
+
+			done++
+			if r.Progress != nil {
+				r.Progress(results[i], done, len(tenants))
+			}
+		}()
+	}
+
+	wait.Wait()
+
+	report := &TenantsReport{Results: results, Failed: make([]string, 0)}
+
+	for _, result := range results {
+		if result.Err != nil {
+			report.Failed = append(report.Failed, result.Tenant)
+		}
+	}
+
+	return report
+}
+
+func (r *TenantRunner) upgrade(ctx context.Context, tenant Tenant) (result TenantResult) {
+	result.Tenant = tenant.Name
+
+	engine, _ := New(r.Source, tenant.Driver, r.Options...).(*henkaImpl)
+	engine.logger().Info("upgrading tenant", "tenant", tenant.Name)
+
+	tenantRun := engine.newRun(ctx)
+
+	report, err := tenantRun.inReportedRun(func() error {
+		target, err := tenantRun.resolveLatestVersion()
+		if err != nil {
+			return fmt.Errorf("failed to resolve upgrade target: %w", err)
+		}
+
+		return tenantRun.upgrade(target)
+	})
+
+	result.Result = &UpgradeResult{Applied: report.Applied, Failed: report.Failed, Err: err}
+
+	if err != nil {
+		result.Err = fmt.Errorf("failed to upgrade tenant %s: %w", tenant.Name, err)
+	}
+
+	return result
+}
@@ -0,0 +1,188 @@
+package terraform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/migration"
+)
+
+// Modes accepted in the "mode" key of the query.
+const (
+	ModePlan  = "plan"
+	ModeApply = "apply"
+)
+
+var ErrInvalidQuery = errors.New("terraform query is invalid")
+
+// allVersions is the target when target_version is empty.
+const allVersions = migration.Version(^uint64(0))
+
+// Run speaks the protocol of Terraform's external data source: it reads a JSON object with string values
+// from stdin and writes a JSON object with string values to stdout.
+//
+// Recognized query keys:
+//
+//	mode            "plan" (default) only reports the state, "apply" applies pending migrations first
+//	target_version  highest version to apply, all pending migrations are applied if empty
+//
+// Both modes are idempotent: apply on an up-to-date database changes nothing and reports the same state as plan.
+// The result contains "up_to_date", "pending_count", "applied_count", "missing_count", "pending_versions"
+// (comma-separated), "latest_applied_version" and "applied_now" (versions applied by this call, comma-separated).
+func Run(migrator henka.Henka, stdin io.Reader, stdout io.Writer) error {
+	query := make(map[string]string)
+	if err := json.NewDecoder(stdin).Decode(&query); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %s", ErrInvalidQuery, err)
+	}
+
+	mode := query["mode"]
+	if mode == "" {
+		mode = ModePlan
+	}
+
+	target, err := parseTargetVersion(query["target_version"])
+	if err != nil {
+		return err
+	}
+
+	before, err := migrator.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate migrations: %w", err)
+	}
+
+	after := before
+	switch mode {
+	case ModePlan:
+	case ModeApply:
+		if after, err = apply(migrator, before, target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown mode \"%s\"", ErrInvalidQuery, mode)
+	}
+
+	result := describe(after, target)
+	result["applied_now"] = joinVersions(appliedNow(before, after))
+
+	if err = json.NewEncoder(stdout).Encode(result); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	return nil
+}
+
+func apply(migrator henka.Henka, before *henka.ValidationResult, target migration.Version) (*henka.ValidationResult, error) {
+	if len(pendingVersions(before, target)) == 0 {
+		return before, nil
+	}
+
+	upgrade := func() error { return migrator.Upgrade(target) }
+	if target == allVersions {
+		upgrade = migrator.UpgradeAll
+	}
+
+	if err := upgrade(); err != nil {
+		return nil, fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	after, err := migrator.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate migrations: %w", err)
+	}
+
+	return after, nil
+}
+
+func parseTargetVersion(value string) (migration.Version, error) {
+	if value == "" {
+		return allVersions, nil
+	}
+
+	version, err := strconv.ParseUint(value, 10, migration.VersionBits)
+	if err != nil {
+		return 0, fmt.Errorf("%w: target_version \"%s\" is not a valid version", ErrInvalidQuery, value)
+	}
+
+	return migration.Version(version), nil
+}
+
+func describe(state *henka.ValidationResult, target migration.Version) map[string]string {
+	pending := pendingVersions(state, target)
+
+	// migrations are listed in the order of the engine, which may differ from the numeric one
+	var latestApplied migration.Version
+	for _, mig := range state.Migrations {
+		if mig.Status == migration.Applied {
+			latestApplied = mig.Version
+		}
+	}
+
+	latest := ""
+	if latestApplied > 0 {
+		latest = strconv.FormatUint(uint64(latestApplied), 10)
+	}
+
+	return map[string]string{
+		"up_to_date":             strconv.FormatBool(len(pending) == 0),
+		"pending_count":          strconv.Itoa(len(pending)),
+		"applied_count":          strconv.FormatUint(uint64(state.AppliedCount), 10),
+		"missing_count":          strconv.FormatUint(uint64(state.MissingCount), 10),
+		"pending_versions":       joinVersions(pending),
+		"latest_applied_version": latest,
+	}
+}
+
+// pendingVersions returns pending versions up to target. Migrations are listed in the order of the engine,
+// so a target that is one of them cuts the listing at its position; other targets are compared numerically.
+func pendingVersions(state *henka.ValidationResult, target migration.Version) []migration.Version {
+	listed := state.Migrations
+	found := false
+
+	for i, mig := range listed {
+		if mig.Version == target {
+			listed = listed[:i+1]
+			found = true
+
+			break
+		}
+	}
+
+	result := make([]migration.Version, 0, state.PendingCount)
+	for _, mig := range listed {
+		if mig.Status == migration.Pending && (found || mig.Version <= target) {
+			result = append(result, mig.Version)
+		}
+	}
+
+	return result
+}
+
+func appliedNow(before, after *henka.ValidationResult) []migration.Version {
+	wasApplied := make(map[migration.Version]bool, len(before.Migrations))
+	for _, mig := range before.Migrations {
+		wasApplied[mig.Version] = mig.Status == migration.Applied
+	}
+
+	result := make([]migration.Version, 0)
+	for _, mig := range after.Migrations {
+		if mig.Status == migration.Applied && !wasApplied[mig.Version] {
+			result = append(result, mig.Version)
+		}
+	}
+
+	return result
+}
+
+func joinVersions(versions []migration.Version) string {
+	parts := make([]string, len(versions))
+	for i, version := range versions {
+		parts[i] = strconv.FormatUint(uint64(version), 10)
+	}
+
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,278 @@
+package terraform_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/terraform"
+)
+
+// -- testing double for henka ----------
+
+type henkaMock struct {
+	states       []migration.State
+	upgradeCalls []migration.Version
+}
+
+func (m *henkaMock) Validate() (*henka.ValidationResult, error) {
+	result := henka.ValidationResult{Migrations: append([]migration.State{}, m.states...)}
+	for _, state := range m.states {
+		switch state.Status {
+		case migration.Applied:
+			result.AppliedCount++
+		case migration.Pending:
+			result.PendingCount++
+		case migration.Missing:
+			result.MissingCount++
+		}
+	}
+
+	return &result, nil
+}
+
+func (m *henkaMock) Status() (*henka.ValidationResult, error) {
+	return m.Validate()
+}
+
+func (m *henkaMock) Upgrade(maxVersion migration.Version) error {
+	m.upgradeCalls = append(m.upgradeCalls, maxVersion)
+	for i := range m.states {
+		if m.states[i].Status == migration.Pending && m.states[i].Version <= maxVersion {
+			m.states[i].Status = migration.Applied
+		}
+	}
+
+	return nil
+}
+
+func (m *henkaMock) Downgrade(migration.Version) error {
+	return nil
+}
+
+func (m *henkaMock) DowngradeToTime(time.Time) error {
+	return nil
+}
+
+func (m *henkaMock) UpgradeAll() error {
+	return m.Upgrade(migration.Version(^uint64(0)))
+}
+
+func (m *henkaMock) UpgradeUntil(time.Time) error {
+	return nil
+}
+
+func (m *henkaMock) UpgradeWithResult(migration.Version) (*henka.UpgradeResult, error) {
+	return &henka.UpgradeResult{}, nil
+}
+
+func (m *henkaMock) Reset() error {
+	return nil
+}
+
+func (m *henkaMock) RequireUpToDate() error {
+	return nil
+}
+
+func (m *henkaMock) Dirty() ([]migration.Log, error) {
+	return make([]migration.Log, 0), nil
+}
+
+func (m *henkaMock) UpgradeTo(string) error {
+	return nil
+}
+
+func (m *henkaMock) DowngradeTo(string) error {
+	return nil
+}
+
+func (m *henkaMock) UpgradeSteps(uint) error {
+	return nil
+}
+
+func (m *henkaMock) DowngradeSteps(uint) error {
+	return nil
+}
+
+func (m *henkaMock) Reapply(migration.Version) error {
+	return nil
+}
+
+func (m *henkaMock) Baseline(migration.Version) error {
+	return nil
+}
+
+func (m *henkaMock) Repair(henka.RepairOptions) (*henka.RepairResult, error) {
+	return &henka.RepairResult{}, nil
+}
+
+func (m *henkaMock) PlanUpgrade(migration.Version) ([]henka.PlannedMigration, error) {
+	return nil, nil
+}
+
+func (m *henkaMock) PlanDowngrade(migration.Version) ([]henka.PlannedMigration, error) {
+	return nil, nil
+}
+
+func (m *henkaMock) ValidateContext(context.Context) (*henka.ValidationResult, error) {
+	return m.Validate()
+}
+
+func (m *henkaMock) UpgradeContext(_ context.Context, maxVersion migration.Version) error {
+	return m.Upgrade(maxVersion)
+}
+
+func (m *henkaMock) DowngradeContext(_ context.Context, toVersion migration.Version) error {
+	return m.Downgrade(toVersion)
+}
+
+func makeStates(applied, pending []migration.Version) []migration.State {
+	result := make([]migration.State, 0, len(applied)+len(pending))
+	for _, version := range applied {
+		result = append(result, migration.State{
+			Description: migration.Description{Migration: migration.Migration{Version: version}},
+			Status:      migration.Applied,
+		})
+	}
+	for _, version := range pending {
+		result = append(result, migration.State{
+			Description: migration.Description{Migration: migration.Migration{Version: version}},
+			Status:      migration.Pending,
+		})
+	}
+
+	return result
+}
+
+var runTests = []struct { // nolint:gochecknoglobals
+	name           string
+	query          string
+	states         []migration.State
+	expectUpgrade  bool
+	expectedResult map[string]string
+	expectError    bool
+}{
+	/* s0 */ {
+		name:   "s0: plan should report pending migrations without applying them",
+		query:  `{"mode": "plan"}`,
+		states: makeStates([]migration.Version{20220101000000}, []migration.Version{20220102000000, 20220103000000}),
+		expectedResult: map[string]string{
+			"up_to_date":             "false",
+			"pending_count":          "2",
+			"applied_count":          "1",
+			"missing_count":          "0",
+			"pending_versions":       "20220102000000,20220103000000",
+			"latest_applied_version": "20220101000000",
+			"applied_now":            "",
+		},
+	},
+	/* s1 */ {
+		name:          "s1: apply should apply migrations up to target version",
+		query:         `{"mode": "apply", "target_version": "20220102000000"}`,
+		states:        makeStates([]migration.Version{20220101000000}, []migration.Version{20220102000000, 20220103000000}),
+		expectUpgrade: true,
+		expectedResult: map[string]string{
+			"up_to_date":             "true",
+			"pending_count":          "0",
+			"applied_count":          "2",
+			"missing_count":          "0",
+			"pending_versions":       "",
+			"latest_applied_version": "20220102000000",
+			"applied_now":            "20220102000000",
+		},
+	},
+	/* s2 */ {
+		name:   "s2: apply should do nothing when up to date",
+		query:  `{"mode": "apply"}`,
+		states: makeStates([]migration.Version{20220101000000}, nil),
+		expectedResult: map[string]string{
+			"up_to_date":             "true",
+			"pending_count":          "0",
+			"applied_count":          "1",
+			"missing_count":          "0",
+			"pending_versions":       "",
+			"latest_applied_version": "20220101000000",
+			"applied_now":            "",
+		},
+	},
+	/* s3 */ {
+		name:   "s3: empty query should plan",
+		query:  ``,
+		states: makeStates(nil, nil),
+		expectedResult: map[string]string{
+			"up_to_date":             "true",
+			"pending_count":          "0",
+			"applied_count":          "0",
+			"missing_count":          "0",
+			"pending_versions":       "",
+			"latest_applied_version": "",
+			"applied_now":            "",
+		},
+	},
+	/* s4 */ {
+		name:  "s4: plan should follow the order of the engine",
+		query: `{"mode": "plan", "target_version": "20220102000000"}`,
+		states: makeStates(
+			[]migration.Version{20220105000000, 20220103000000}, []migration.Version{20220102000000, 20220101000000},
+		),
+		expectedResult: map[string]string{
+			"up_to_date":             "false",
+			"pending_count":          "1",
+			"applied_count":          "2",
+			"missing_count":          "0",
+			"pending_versions":       "20220102000000",
+			"latest_applied_version": "20220103000000",
+			"applied_now":            "",
+		},
+	},
+	/* e0 */ {
+		name:        "e0: should fail on unknown mode",
+		query:       `{"mode": "destroy"}`,
+		expectError: true,
+	},
+	/* e1 */ {
+		name:        "e1: should fail on invalid target version",
+		query:       `{"target_version": "latest"}`,
+		expectError: true,
+	},
+	/* e2 */ {
+		name:        "e2: should fail on non-string values",
+		query:       `{"target_version": 20220101000000}`,
+		expectError: true,
+	},
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range runTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			migrator := henkaMock{states: test.states}
+			stdout := bytes.Buffer{}
+
+			err := terraform.Run(&migrator, strings.NewReader(test.query), &stdout)
+
+			if test.expectError {
+				assert.ErrorIs(t, err, terraform.ErrInvalidQuery)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectUpgrade, len(migrator.upgradeCalls) > 0)
+
+			result := make(map[string]string)
+			assert.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+			assert.Equal(t, test.expectedResult, result)
+		})
+	}
+}
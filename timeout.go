@@ -0,0 +1,45 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+)
+
+var ErrMigrationTimeout = errors.New("migration has exceeded its timeout")
+
+// withMigrationTimeout runs fn with a context that is canceled after Options.MigrationTimeout. When it expires,
+// the statement that is being executed is killed as well, if the driver implements driver.Canceler.
+// expired tells whether fn has run out of time.
+func (m *run) withMigrationTimeout(fn func(ctx context.Context) error) (expired bool, err error) {
+	if m.options.MigrationTimeout <= 0 {
+		return false, fn(m.ctx)
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+
+	var timedOut int32
+
+	// The flag is set before the context is canceled, so that the failure is always attributed to the timeout.
+	timer := time.AfterFunc(m.options.MigrationTimeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+
+		var canceler driver.Canceler
+		if driver.As(m.driver, &canceler) {
+			if err := canceler.CancelMigration(); err != nil {
+				m.logger().Error("failed to cancel migration after timeout", "error", err)
+			}
+		}
+
+		cancel()
+	})
+	defer timer.Stop()
+
+	err = fn(ctx)
+
+	return err != nil && atomic.LoadInt32(&timedOut) == 1, err
+}
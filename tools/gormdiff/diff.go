@@ -0,0 +1,198 @@
+package gormdiff
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/schema"
+)
+
+// Scripts is a scaffolded pair of migration scripts.
+type Scripts struct {
+	Up   string
+	Down string
+}
+
+func (s Scripts) IsEmpty() bool {
+	return s.Up == "" && s.Down == ""
+}
+
+var (
+	ErrSchemaDumpNotSupported = errors.New("driver can't dump database schema")
+	ErrNoChanges              = errors.New("models match the database schema")
+)
+
+// Diff produces MySQL scripts that bring the current schema to the desired one and back.
+//
+// Only additive and type changes are scripted: tables and columns that exist in the database
+// but not in the models are never dropped, a comment is emitted for such columns instead.
+func Diff(current, desired *schema.Schema) Scripts {
+	up := make([]string, 0)
+	down := make([]string, 0)
+
+	for _, table := range desired.Tables {
+		existing, exists := current.Table(table.Name)
+		if !exists {
+			up = append(up, createTable(table))
+			down = append(down, fmt.Sprintf("DROP TABLE %s;", quote(table.Name)))
+			continue
+		}
+
+		tableUp, tableDown := diffTable(existing, &table)
+		up = append(up, tableUp...)
+		down = append(down, tableDown...)
+	}
+
+	// every actual change has a counterpart in down, the rest are comments
+	if len(down) == 0 {
+		return Scripts{}
+	}
+
+	return Scripts{
+		Up:   joinStatements(up),
+		Down: joinStatements(reverse(down)),
+	}
+}
+
+// Scaffold dumps the current schema through the driver, compares it with the models and writes
+// "V<version>_<name>.up.hmf" and "V<version>_<name>.down.hmf" into dir. The version is derived from
+// the current time. Paths of written files are returned.
+func Scaffold(drv driver.Driver, dir string, name string, models ...interface{}) ([]string, error) {
+	dumper, ok := drv.(driver.SchemaDumper)
+	if !ok {
+		return nil, ErrSchemaDumpNotSupported
+	}
+
+	current, err := dumper.DumpSchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump current schema: %w", err)
+	}
+
+	desired, err := FromModels(models...)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := Diff(current, desired)
+	if scripts.IsEmpty() {
+		return nil, ErrNoChanges
+	}
+
+	version := migration.NewVersionFromTime(time.Now())
+	files := []struct {
+		path   string
+		script string
+	}{
+		{filepath.Join(dir, fmt.Sprintf("V%s_%s.up.hmf", version, name)), scripts.Up},
+		{filepath.Join(dir, fmt.Sprintf("V%s_%s.down.hmf", version, name)), scripts.Down},
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if err = os.WriteFile(file.path, []byte(file.script), 0o644); err != nil { //nolint:gosec,gomnd
+			return paths, fmt.Errorf("failed to write %s: %w", file.path, err)
+		}
+
+		paths = append(paths, file.path)
+	}
+
+	return paths, nil
+}
+
+func diffTable(current, desired *schema.Table) ([]string, []string) {
+	up := make([]string, 0)
+	down := make([]string, 0)
+	table := quote(desired.Name)
+
+	for _, column := range desired.Columns {
+		existing, exists := current.Column(column.Name)
+
+		switch {
+		case !exists:
+			up = append(up, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table, columnDefinition(column)))
+			down = append(down, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, quote(column.Name)))
+		case !sameColumn(existing, &column):
+			up = append(up, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s;", table, columnDefinition(column)))
+			down = append(down, fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s;", table, columnDefinition(*existing)))
+		}
+	}
+
+	for _, column := range current.Columns {
+		if _, exists := desired.Column(column.Name); !exists {
+			up = append(up, fmt.Sprintf("-- column %s.%s is not present in models and was left untouched", desired.Name, column.Name))
+		}
+	}
+
+	return up, down
+}
+
+func createTable(table schema.Table) string {
+	lines := make([]string, 0, len(table.Columns)+1)
+	primaryKey := make([]string, 0, 1)
+
+	for _, column := range table.Columns {
+		lines = append(lines, "  "+columnDefinition(column))
+		if column.PrimaryKey {
+			primaryKey = append(primaryKey, quote(column.Name))
+		}
+	}
+
+	if len(primaryKey) > 0 {
+		lines = append(lines, fmt.Sprintf("  PRIMARY KEY (%s)", strings.Join(primaryKey, ", ")))
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n);", quote(table.Name), strings.Join(lines, ",\n"))
+}
+
+func columnDefinition(column schema.Column) string {
+	nullability := "NOT NULL"
+	if column.Nullable {
+		nullability = "NULL"
+	}
+
+	return fmt.Sprintf("%s %s %s", quote(column.Name), column.Type, nullability)
+}
+
+func sameColumn(a, b *schema.Column) bool {
+	return normalizeType(a.Type) == normalizeType(b.Type) && a.Nullable == b.Nullable
+}
+
+var intDisplayWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|bigint)\(\d+\)`)
+
+// normalizeType removes integer display widths that MySQL 5.x reports ("bigint(20)"), keeping tinyint(1) booleans.
+func normalizeType(columnType string) string {
+	columnType = strings.ToLower(strings.TrimSpace(columnType))
+	if strings.HasPrefix(columnType, "tinyint(1)") {
+		return columnType
+	}
+
+	return intDisplayWidth.ReplaceAllString(columnType, "$1")
+}
+
+func quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
+
+func joinStatements(statements []string) string {
+	if len(statements) == 0 {
+		return ""
+	}
+
+	return strings.Join(statements, "\n\n") + "\n"
+}
+
+func reverse(statements []string) []string {
+	result := make([]string, len(statements))
+	for i, stmt := range statements {
+		result[len(statements)-1-i] = stmt
+	}
+
+	return result
+}
@@ -0,0 +1,167 @@
+package gormdiff_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/schema"
+	"github.com/root-talis/henka/tools/gormdiff"
+)
+
+// -- models ----------
+
+// baseModel mimics gorm.Model without importing gorm.
+type baseModel struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt sql.NullTime `gorm:"index"`
+}
+
+type UserProfile struct {
+	baseModel
+	Email     string `gorm:"size:255;not null"`
+	Nickname  *string
+	IsActive  bool
+	HTTPToken []byte
+	Ignored   string `gorm:"-"`
+	Company   Company
+	internal  int //nolint:unused,structcheck
+}
+
+type Company struct {
+	ID   int64
+	Name string `gorm:"column:title;type:VARCHAR(64)"`
+}
+
+func (Company) TableName() string {
+	return "companies_registry"
+}
+
+type Category struct {
+	ID int64
+}
+
+func TestFromModels(t *testing.T) {
+	t.Parallel()
+
+	result, err := gormdiff.FromModels(&UserProfile{}, Company{}, Category{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, &schema.Schema{
+		Tables: []schema.Table{
+			{
+				Name: "user_profiles",
+				Columns: []schema.Column{
+					{Name: "id", Type: "bigint unsigned", PrimaryKey: true},
+					{Name: "created_at", Type: "datetime(3)"},
+					{Name: "updated_at", Type: "datetime(3)"},
+					{Name: "deleted_at", Type: "datetime(3)", Nullable: true},
+					{Name: "email", Type: "varchar(255)"},
+					{Name: "nickname", Type: "varchar(191)", Nullable: true},
+					{Name: "is_active", Type: "tinyint(1)"},
+					{Name: "http_token", Type: "longblob"},
+				},
+			},
+			{
+				Name: "companies_registry",
+				Columns: []schema.Column{
+					{Name: "id", Type: "bigint", PrimaryKey: true},
+					{Name: "title", Type: "varchar(64)"},
+				},
+			},
+			{
+				Name: "categories",
+				Columns: []schema.Column{
+					{Name: "id", Type: "bigint", PrimaryKey: true},
+				},
+			},
+		},
+	}, result)
+}
+
+func TestFromModelsErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := gormdiff.FromModels(42)
+	assert.ErrorIs(t, err, gormdiff.ErrInvalidModel)
+
+	_, err = gormdiff.FromModels(Company{}, &Company{})
+	assert.ErrorIs(t, err, gormdiff.ErrInvalidModel)
+
+	_, err = gormdiff.FromModels(struct{ Company Company }{})
+	assert.ErrorIs(t, err, gormdiff.ErrInvalidModel)
+}
+
+var diffTests = []struct { // nolint:gochecknoglobals
+	name     string
+	current  schema.Schema
+	desired  schema.Schema
+	expected gormdiff.Scripts
+}{
+	/* s0 */ {
+		name: "s0: should produce nothing when schemas match",
+		current: schema.Schema{Tables: []schema.Table{
+			{Name: "users", Columns: []schema.Column{{Name: "id", Type: "bigint(20)", PrimaryKey: true}}},
+		}},
+		desired: schema.Schema{Tables: []schema.Table{
+			{Name: "users", Columns: []schema.Column{{Name: "id", Type: "bigint", PrimaryKey: true}}},
+		}},
+		expected: gormdiff.Scripts{},
+	},
+	/* s1 */ {
+		name:    "s1: should create missing tables",
+		current: schema.Schema{},
+		desired: schema.Schema{Tables: []schema.Table{
+			{Name: "users", Columns: []schema.Column{
+				{Name: "id", Type: "bigint", PrimaryKey: true},
+				{Name: "name", Type: "varchar(191)", Nullable: true},
+			}},
+		}},
+		expected: gormdiff.Scripts{
+			Up: "CREATE TABLE `users` (\n" +
+				"  `id` bigint NOT NULL,\n" +
+				"  `name` varchar(191) NULL,\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				");\n",
+			Down: "DROP TABLE `users`;\n",
+		},
+	},
+	/* s2 */ {
+		name: "s2: should add and modify columns, but never drop unknown ones",
+		current: schema.Schema{Tables: []schema.Table{
+			{Name: "users", Columns: []schema.Column{
+				{Name: "id", Type: "int(11)", PrimaryKey: true},
+				{Name: "legacy", Type: "text", Nullable: true},
+			}},
+		}},
+		desired: schema.Schema{Tables: []schema.Table{
+			{Name: "users", Columns: []schema.Column{
+				{Name: "id", Type: "bigint", PrimaryKey: true},
+				{Name: "email", Type: "varchar(255)"},
+			}},
+		}},
+		expected: gormdiff.Scripts{
+			Up: "ALTER TABLE `users` MODIFY COLUMN `id` bigint NOT NULL;\n\n" +
+				"ALTER TABLE `users` ADD COLUMN `email` varchar(255) NOT NULL;\n\n" +
+				"-- column users.legacy is not present in models and was left untouched\n",
+			Down: "ALTER TABLE `users` DROP COLUMN `email`;\n\n" +
+				"ALTER TABLE `users` MODIFY COLUMN `id` int(11) NOT NULL;\n",
+		},
+	},
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range diffTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, gormdiff.Diff(&test.current, &test.desired))
+		})
+	}
+}
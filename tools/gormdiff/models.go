@@ -0,0 +1,279 @@
+package gormdiff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/root-talis/henka/schema"
+)
+
+// defaultStringSize is the varchar size GORM uses for strings without an explicit size.
+const defaultStringSize = 191
+
+var ErrInvalidModel = errors.New("model is invalid")
+
+type tabler interface {
+	TableName() string
+}
+
+// FromModels builds the schema GORM's AutoMigrate would create for the given models.
+//
+// Models are read by reflection, so gorm itself is not required. Table names are taken
+// from TableName() when a model implements it and are derived the way GORM's default
+// naming strategy does otherwise (snake case, plural). The following tags are understood:
+// "-", column, type, size, primaryKey, not null. Relations (fields of struct and slice types
+// that are not known column types) are skipped.
+func FromModels(models ...interface{}) (*schema.Schema, error) {
+	result := schema.Schema{}
+
+	for _, model := range models {
+		table, err := tableFromModel(model)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exists := result.Table(table.Name); exists {
+			return nil, fmt.Errorf("%w: table %s is defined more than once", ErrInvalidModel, table.Name)
+		}
+
+		result.Tables = append(result.Tables, table)
+	}
+
+	return &result, nil
+}
+
+func tableFromModel(model interface{}) (schema.Table, error) {
+	modelType := reflect.TypeOf(model)
+	for modelType != nil && modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+
+	if modelType == nil || modelType.Kind() != reflect.Struct {
+		return schema.Table{}, fmt.Errorf("%w: %T is not a struct", ErrInvalidModel, model)
+	}
+
+	table := schema.Table{Name: tableName(model, modelType)}
+	if err := addColumns(&table, modelType); err != nil {
+		return schema.Table{}, err
+	}
+
+	if len(table.Columns) == 0 {
+		return schema.Table{}, fmt.Errorf("%w: %s has no columns", ErrInvalidModel, modelType.Name())
+	}
+
+	return table, nil
+}
+
+func tableName(model interface{}, modelType reflect.Type) string {
+	if t, ok := model.(tabler); ok {
+		return t.TableName()
+	}
+
+	if t, ok := reflect.New(modelType).Interface().(tabler); ok {
+		return t.TableName()
+	}
+
+	return pluralize(toSnakeCase(modelType.Name()))
+}
+
+func addColumns(table *schema.Table, structType reflect.Type) error {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue // unexported
+		}
+
+		tags := parseTags(field.Tag.Get("gorm"))
+		if _, skip := tags["-"]; skip {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && !isKnownStruct(field.Type) {
+			if err := addColumns(table, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+
+		column, ok := columnFromField(field, tags)
+		if !ok {
+			continue
+		}
+
+		if _, exists := table.Column(column.Name); exists {
+			return fmt.Errorf("%w: column %s.%s is defined more than once", ErrInvalidModel, table.Name, column.Name)
+		}
+
+		table.Columns = append(table.Columns, column)
+	}
+
+	return nil
+}
+
+func columnFromField(field reflect.StructField, tags map[string]string) (schema.Column, bool) {
+	column := schema.Column{
+		Name:       toSnakeCase(field.Name),
+		PrimaryKey: hasTag(tags, "primarykey") || field.Name == "ID",
+	}
+
+	if name, ok := tags["column"]; ok {
+		column.Name = name
+	}
+
+	fieldType := field.Type
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+		column.Nullable = true
+	}
+
+	columnType, nullable, ok := sqlType(fieldType, tags)
+	if !ok {
+		return schema.Column{}, false
+	}
+
+	column.Type = columnType
+	column.Nullable = (column.Nullable || nullable) && !column.PrimaryKey && !hasTag(tags, "not null")
+
+	return column, true
+}
+
+// sqlType maps a Go type onto a MySQL column type. The second result tells if the type is nullable by nature.
+func sqlType(fieldType reflect.Type, tags map[string]string) (string, bool, bool) { //nolint:cyclop
+	nullable := isNullableStruct(fieldType)
+
+	if explicit, ok := tags["type"]; ok {
+		return strings.ToLower(explicit), nullable, true
+	}
+
+	switch {
+	case fieldType == reflect.TypeOf(time.Time{}), fieldType.Name() == "NullTime", fieldType.Name() == "DeletedAt":
+		return "datetime(3)", nullable, true
+	case fieldType.Name() == "NullString":
+		return stringType(tags), true, true
+	case fieldType.Name() == "NullBool":
+		return "tinyint(1)", true, true
+	case fieldType.Name() == "NullInt64":
+		return "bigint", true, true
+	case fieldType.Name() == "NullInt32":
+		return "int", true, true
+	case fieldType.Name() == "NullFloat64":
+		return "double", true, true
+	}
+
+	switch fieldType.Kind() { //nolint:exhaustive
+	case reflect.Bool:
+		return "tinyint(1)", false, true
+	case reflect.Int8:
+		return "tinyint", false, true
+	case reflect.Int16:
+		return "smallint", false, true
+	case reflect.Int32:
+		return "int", false, true
+	case reflect.Int, reflect.Int64:
+		return "bigint", false, true
+	case reflect.Uint8:
+		return "tinyint unsigned", false, true
+	case reflect.Uint16:
+		return "smallint unsigned", false, true
+	case reflect.Uint32:
+		return "int unsigned", false, true
+	case reflect.Uint, reflect.Uint64:
+		return "bigint unsigned", false, true
+	case reflect.Float32:
+		return "float", false, true
+	case reflect.Float64:
+		return "double", false, true
+	case reflect.String:
+		return stringType(tags), false, true
+	case reflect.Slice:
+		if fieldType.Elem().Kind() == reflect.Uint8 {
+			return "longblob", false, true
+		}
+	}
+
+	return "", false, false
+}
+
+func stringType(tags map[string]string) string {
+	if size, ok := tags["size"]; ok {
+		return fmt.Sprintf("varchar(%s)", size)
+	}
+
+	return fmt.Sprintf("varchar(%d)", defaultStringSize)
+}
+
+func isKnownStruct(structType reflect.Type) bool {
+	return structType == reflect.TypeOf(time.Time{}) || isNullableStruct(structType)
+}
+
+func isNullableStruct(structType reflect.Type) bool {
+	name := structType.Name()
+	return structType.Kind() == reflect.Struct && (strings.HasPrefix(name, "Null") || name == "DeletedAt")
+}
+
+// parseTags parses `gorm:"column:user_name;size:64;not null"` into a map with lower-cased keys.
+func parseTags(tag string) map[string]string {
+	result := make(map[string]string)
+
+	for _, part := range strings.Split(tag, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		key, value := part, ""
+		if idx := strings.IndexByte(part, ':'); idx >= 0 {
+			key, value = part[:idx], part[idx+1:]
+		}
+
+		result[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return result
+}
+
+func hasTag(tags map[string]string, name string) bool {
+	_, ok := tags[name]
+	return ok
+}
+
+// toSnakeCase converts "UserID" to "user_id" and "HTTPServer" to "http_server".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	builder := strings.Builder{}
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevIsLower := i > 0 && !unicode.IsUpper(runes[i-1])
+			nextIsLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+
+			if prevIsLower || nextIsLower {
+				builder.WriteRune('_')
+			}
+
+			r = unicode.ToLower(r)
+		}
+
+		builder.WriteRune(r)
+	}
+
+	return strings.TrimPrefix(builder.String(), "_")
+}
+
+// pluralize covers the regular English plurals, which is what most table names need.
+// Models with irregular names should implement TableName().
+func pluralize(name string) string {
+	switch {
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "z"),
+		strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	default:
+		return name + "s"
+	}
+}
@@ -0,0 +1,186 @@
+// Package renumber detects migrations that conflict after merging branches and renumbers their files.
+//
+// Two branches that both add migrations may produce a version that is older than versions already
+// applied from the other branch, or a version that is taken by a migration with another name.
+// Such migrations are moved after the latest version by renaming their files.
+package renumber
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/root-talis/henka/driver"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source/files"
+)
+
+type Reason int
+
+const (
+	// OlderThanApplied is a migration that is not applied, but a later version is.
+	OlderThanApplied Reason = iota
+	// DuplicateVersion is a migration with a version that is taken by a migration with another name.
+	DuplicateVersion
+)
+
+func (r Reason) String() string {
+	switch r {
+	case OlderThanApplied:
+		return "older than applied"
+	case DuplicateVersion:
+		return "duplicate version"
+	default:
+		return fmt.Sprintf("Reason(%d)", int(r))
+	}
+}
+
+type Conflict struct {
+	migration.Migration
+	Reason Reason
+}
+
+// Mapping is a renumbered migration.
+type Mapping struct {
+	From migration.Migration
+	To   migration.Migration
+}
+
+// Detect lists migration files of the directory and finds the ones that conflict with each other
+// or with the migrations applied according to the log of the driver.
+func Detect(fileSystem fs.FS, migrationsDirectory string, drv driver.Driver) ([]Conflict, error) {
+	listed, err := files.ListFiles(fileSystem, migrationsDirectory)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	log, err := drv.ListMigrationsLog()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations log: %w", err)
+	}
+
+	applied := make(map[migration.Version]string)
+
+	for _, entry := range *log {
+		if entry.Direction == migration.Up {
+			applied[entry.Version] = entry.Name
+		} else {
+			delete(applied, entry.Version)
+		}
+	}
+
+	return Conflicts(listed, applied), nil
+}
+
+// Conflicts finds conflicting migrations among listed files. applied maps applied versions to their names.
+// Of migrations sharing a version, the applied one is kept, or the first one by name when none is applied.
+func Conflicts(listed []files.File, applied map[migration.Version]string) []Conflict {
+	var lastApplied migration.Version
+	for version := range applied {
+		if version > lastApplied {
+			lastApplied = version
+		}
+	}
+
+	names := make(map[migration.Version][]string)
+	versions := make([]migration.Version, 0)
+
+	for _, file := range listed {
+		existing, ok := names[file.Migration.Version]
+		if !ok {
+			versions = append(versions, file.Migration.Version)
+		}
+
+		if !contains(existing, file.Migration.Name) {
+			names[file.Migration.Version] = append(existing, file.Migration.Name)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	result := make([]Conflict, 0)
+
+	for _, version := range versions {
+		kept := names[version][0]
+		if appliedName, ok := applied[version]; ok && contains(names[version], appliedName) {
+			kept = appliedName
+		}
+
+		for _, name := range names[version] {
+			mig := migration.Migration{Version: version, Name: name}
+
+			switch _, isApplied := applied[version]; {
+			case name != kept:
+				result = append(result, Conflict{Migration: mig, Reason: DuplicateVersion})
+			case !isApplied && version < lastApplied:
+				result = append(result, Conflict{Migration: mig, Reason: OlderThanApplied})
+			}
+		}
+	}
+
+	return result
+}
+
+// Renumber renames files of conflicting migrations in the directory, giving them versions one second apart
+// after both the latest listed version and now. Migrations are renumbered in the order of conflicts.
+// The mapping of the migrations renamed so far is returned on errors as well.
+func Renumber(migrationsDirectory string, conflicts []Conflict, now time.Time) ([]Mapping, error) {
+	listed, err := files.ListFiles(os.DirFS(migrationsDirectory), ".")
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	next := migration.NewVersionFromTime(now)
+	for _, file := range listed {
+		if file.Migration.Version >= next {
+			next = following(file.Migration.Version)
+		}
+	}
+
+	result := make([]Mapping, 0, len(conflicts))
+
+	for _, conflict := range conflicts {
+		mapping := Mapping{From: conflict.Migration, To: migration.Migration{Version: next, Name: conflict.Name}}
+
+		for _, file := range listed {
+			if file.Migration != conflict.Migration {
+				continue
+			}
+
+			from := filepath.Join(migrationsDirectory, file.Name)
+			to := filepath.Join(migrationsDirectory, files.FileName(mapping.To, file.Direction))
+
+			if err = os.Rename(from, to); err != nil {
+				return result, fmt.Errorf("failed to renumber migration %d_%s: %w", conflict.Version, conflict.Name, err)
+			}
+		}
+
+		result = append(result, mapping)
+		next = following(next)
+	}
+
+	return result, nil
+}
+
+// following is the version a second after the given one, or the next number if it is not a timestamp.
+func following(version migration.Version) migration.Version {
+	t, err := version.Time()
+	if err != nil {
+		return version + 1
+	}
+
+	return migration.NewVersionFromTime(t.Add(time.Second))
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
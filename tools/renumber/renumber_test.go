@@ -0,0 +1,98 @@
+package renumber_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source/files"
+	"github.com/root-talis/henka/tools/renumber"
+)
+
+type logDriver struct {
+	log []migration.Log
+}
+
+func (d *logDriver) ListMigrationsLog() (*[]migration.Log, error) {
+	return &d.log, nil
+}
+
+func (d *logDriver) Migrate(migration.Migration, migration.Direction, string) error {
+	return nil
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	fileSystem := fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20211224081255_initial.up.hmf":           {},
+		"migrations/V20211224091800_add_orders_table.up.hmf":  {},
+		"migrations/V20211224091800_add_users_table.down.hmf": {},
+		"migrations/V20211224091800_add_users_table.up.hmf":   {},
+		"migrations/V20211225100000_add_sessions.up.hmf":      {},
+		"migrations/V20211226100000_add_indexes.up.hmf":       {},
+	}
+
+	drv := logDriver{log: []migration.Log{
+		{Migration: migration.Migration{Version: 20211224081255, Name: "initial"}, Direction: migration.Up},
+		{Migration: migration.Migration{Version: 20211224091800, Name: "add_users_table"}, Direction: migration.Up},
+		{Migration: migration.Migration{Version: 20211226100000, Name: "add_indexes"}, Direction: migration.Up},
+	}}
+
+	conflicts, err := renumber.Detect(fileSystem, "migrations", &drv)
+	assert.NoError(t, err)
+	assert.Equal(t, []renumber.Conflict{
+		{Migration: migration.Migration{Version: 20211224091800, Name: "add_orders_table"}, Reason: renumber.DuplicateVersion},
+		{Migration: migration.Migration{Version: 20211225100000, Name: "add_sessions"}, Reason: renumber.OlderThanApplied},
+	}, conflicts)
+}
+
+func TestRenumber(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"V20211224091800_add_orders_table.up.hmf",
+		"V20211224091800_add_orders_table.down.hmf",
+		"V20211224091800_add_users_table.up.hmf",
+		"V20211226100000_add_indexes.up.hmf",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+
+	conflict := renumber.Conflict{
+		Migration: migration.Migration{Version: 20211224091800, Name: "add_orders_table"},
+		Reason:    renumber.DuplicateVersion,
+	}
+
+	mapping, err := renumber.Renumber(dir, []renumber.Conflict{conflict}, time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	assert.Equal(t, []renumber.Mapping{{
+		From: conflict.Migration,
+		To:   migration.Migration{Version: 20211226100001, Name: "add_orders_table"},
+	}}, mapping, "versions must be allocated after the latest listed one")
+
+	listed, err := files.ListFiles(os.DirFS(dir), ".")
+	assert.NoError(t, err)
+
+	names := make([]string, 0, len(listed))
+	for _, file := range listed {
+		names = append(names, file.Name)
+	}
+
+	assert.Equal(t, []string{
+		"V20211224091800_add_users_table.up.hmf",
+		"V20211226100000_add_indexes.up.hmf",
+		"V20211226100001_add_orders_table.down.hmf",
+		"V20211226100001_add_orders_table.up.hmf",
+	}, names)
+}
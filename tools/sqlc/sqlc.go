@@ -0,0 +1,133 @@
+package sqlc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/root-talis/henka"
+	"github.com/root-talis/henka/migration"
+	"github.com/root-talis/henka/source"
+)
+
+// Config describes how sqlc is invoked by Verify.
+type Config struct {
+	// SchemaFile is the path the schema is exported to. It should be listed in the "schema" section of sqlc config.
+	SchemaFile string
+
+	// SqlcConfigFile is the path to sqlc.yaml (or sqlc.json). Empty means sqlc looks up its config in the working directory.
+	SqlcConfigFile string
+
+	// SqlcBinary is the sqlc executable, "sqlc" if empty.
+	SqlcBinary string
+
+	// SkipCompile only exports the schema after applying migrations, without running sqlc.
+	SkipCompile bool
+}
+
+var ErrSqlcFailed = errors.New("sqlc has reported errors")
+
+// ExportSchema writes up scripts of all available migrations, in order, into a single schema file
+// that sqlc can parse.
+func ExportSchema(src source.Source, writer io.Writer) error {
+	available, err := src.GetAvailableMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	for _, descr := range *available {
+		script, err := src.ReadMigration(descr.Migration, migration.Up)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %d_%s: %w", descr.Version, descr.Name, err)
+		}
+
+		if _, err = fmt.Fprintf(writer, "-- V%d_%s\n", descr.Version, descr.Name); err != nil {
+			return fmt.Errorf("failed to write schema: %w", err)
+		}
+
+		if _, err = io.Copy(writer, script); err != nil {
+			return fmt.Errorf("failed to write schema: %w", err)
+		}
+
+		if _, err = io.WriteString(writer, "\n\n"); err != nil {
+			return fmt.Errorf("failed to write schema: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Verify applies all migrations to a scratch database through migrator, which proves that they run,
+// then exports the schema and runs `sqlc compile` against it, so queries that don't match the schema
+// are reported in the same step. The migrator must point to a disposable database.
+func Verify(migrator henka.Henka, src source.Source, config Config) error {
+	available, err := src.GetAvailableMigrations()
+	if err != nil {
+		return fmt.Errorf("failed to get the list of available migrations: %w", err)
+	}
+
+	if len(*available) > 0 {
+		if err = migrator.Upgrade((*available)[len(*available)-1].Version); err != nil {
+			return fmt.Errorf("failed to apply migrations to scratch database: %w", err)
+		}
+	}
+
+	if err = exportSchemaFile(src, config.SchemaFile); err != nil {
+		return err
+	}
+
+	if config.SkipCompile {
+		return nil
+	}
+
+	return runSqlc(config)
+}
+
+func exportSchemaFile(src source.Source, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create schema file: %w", err)
+	}
+
+	if err = ExportSchema(src, file); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failed to write schema file: %w", err)
+	}
+
+	return nil
+}
+
+func runSqlc(config Config) error {
+	binary := config.SqlcBinary
+	if binary == "" {
+		binary = "sqlc"
+	}
+
+	args := []string{"compile"}
+	if config.SqlcConfigFile != "" {
+		args = append(args, "--file", config.SqlcConfigFile)
+	}
+
+	output := bytes.Buffer{}
+	cmd := exec.Command(binary, args...) //nolint:gosec
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%w:\n%s", ErrSqlcFailed, output.String())
+		}
+
+		return fmt.Errorf("failed to run sqlc: %w", err)
+	}
+
+	return nil
+}
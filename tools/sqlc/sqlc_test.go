@@ -0,0 +1,37 @@
+package sqlc_test
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/root-talis/henka/source/files"
+	"github.com/root-talis/henka/tools/sqlc"
+)
+
+func TestExportSchema(t *testing.T) {
+	t.Parallel()
+
+	src, err := files.NewFilesSource(fstest.MapFS{
+		"migrations": {
+			Mode: fs.ModeDir,
+		},
+		"migrations/V20211224091800_add_users_table.down.hmf": {Data: []byte("DROP TABLE users;")},
+		"migrations/V20211224091800_add_users_table.up.hmf":   {Data: []byte("CREATE TABLE users (id int);")},
+		"migrations/V20211224081255_initial.up.hmf":           {Data: []byte("CREATE TABLE settings (id int);")},
+	}, "migrations")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	schema := bytes.Buffer{}
+	assert.NoError(t, sqlc.ExportSchema(src, &schema))
+	assert.Equal(t,
+		"-- V20211224081255_initial\nCREATE TABLE settings (id int);\n\n"+
+			"-- V20211224091800_add_users_table\nCREATE TABLE users (id int);\n\n",
+		schema.String(),
+	)
+}
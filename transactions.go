@@ -0,0 +1,70 @@
+package henka
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/root-talis/henka/driver"
+)
+
+var ErrTransactionsNotSupported = errors.New("driver does not support transactions")
+
+// TransactionPolicy tells how Upgrade and Downgrade wrap migrations in transactions.
+type TransactionPolicy uint
+
+const (
+	// NoTransactions leaves transactions to the driver and to scripts.
+	NoTransactions TransactionPolicy = iota
+
+	// WrapEachMigration executes every migration and writes its log entry in a transaction of its own.
+	WrapEachMigration
+
+	// WrapWholeRun executes all migrations of a run in a single transaction, so that either all of them are
+	// applied or none.
+	WrapWholeRun
+)
+
+// checkTransactions fails when the policy needs transactions the driver can't provide. Drivers that can't
+// roll back schema changes are accepted with a warning: only data changes and log entries are rolled back then.
+func (m *run) checkTransactions() error {
+	if m.options.Transactions == NoTransactions {
+		return nil
+	}
+
+	var transactor driver.Transactor
+	if !driver.As(m.driver, &transactor) {
+		return ErrTransactionsNotSupported
+	}
+
+	if !transactor.TransactionalDDL() {
+		m.logger().Warn("driver commits schema changes implicitly, transactions won't roll them back")
+	}
+
+	return nil
+}
+
+// inTransaction commits what fn did, or rolls it back if fn fails.
+func (m *run) inTransaction(fn func() error) error {
+	var transactor driver.Transactor
+	if !driver.As(m.driver, &transactor) {
+		return ErrTransactionsNotSupported
+	}
+
+	if err := transactor.BeginTx(); err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(); err != nil {
+		if rollbackErr := transactor.RollbackTx(); rollbackErr != nil {
+			return fmt.Errorf("%w (failed to roll back transaction: %s)", err, rollbackErr)
+		}
+
+		return err
+	}
+
+	if err := transactor.CommitTx(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package henka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/root-talis/henka/migration"
+)
+
+var ErrNotUpToDate = errors.New("database schema is not up to date")
+
+// NotUpToDateError lists the migrations that keep the database from matching the source: pending ones
+// that an upgrade would apply and applied ones that are missing from the source.
+type NotUpToDateError struct {
+	Pending []migration.Migration
+	Missing []migration.Migration
+}
+
+func (e *NotUpToDateError) Error() string {
+	message := strings.Builder{}
+	message.WriteString(ErrNotUpToDate.Error())
+
+	for _, group := range []struct {
+		label      string
+		migrations []migration.Migration
+	}{{"pending", e.Pending}, {"missing", e.Missing}} {
+		if len(group.migrations) == 0 {
+			continue
+		}
+
+		names := make([]string, 0, len(group.migrations))
+		for _, mig := range group.migrations {
+			names = append(names, fmt.Sprintf("%d_%s", mig.Version, mig.Name))
+		}
+
+		fmt.Fprintf(&message, "; %s: %s", group.label, strings.Join(names, ", "))
+	}
+
+	return message.String()
+}
+
+func (e *NotUpToDateError) Unwrap() error {
+	return ErrNotUpToDate
+}
+
+// RequireUpToDate returns NotUpToDateError if any migration is pending or missing, so that an application
+// can refuse to start against an outdated schema. Skipped migrations and the ones left out by tags don't count.
+func (m *henkaImpl) RequireUpToDate() error {
+	return m.newRun(context.Background()).requireUpToDate()
+}
+
+func (m *run) requireUpToDate() error {
+	result, err := m.validate()
+	if err != nil {
+		return err
+	}
+
+	outdated := &NotUpToDateError{}
+
+	for _, state := range result.Migrations {
+		switch state.Status {
+		case migration.Pending:
+			excluded, err := m.excludedByTags(state.Migration)
+			if err != nil {
+				return err
+			}
+
+			if !excluded {
+				outdated.Pending = append(outdated.Pending, state.Migration)
+			}
+		case migration.Missing:
+			outdated.Missing = append(outdated.Missing, state.Migration)
+		case migration.Applied, migration.Baselined, migration.Skipped:
+		}
+	}
+
+	if len(outdated.Pending) > 0 || len(outdated.Missing) > 0 {
+		return outdated
+	}
+
+	return nil
+}